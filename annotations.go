@@ -0,0 +1,141 @@
+package annotatedcsv
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// extraKeys returns the names of all the extra
+// annotations of the columns, in sorted order.
+func extraKeys(cols []Column) []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, col := range cols {
+		for key := range col.Extra {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// equalExtra reports whether two sets of extra annotations
+// are the same. A missing annotation is the same as an
+// empty one.
+func equalExtra(e0, e1 map[string]string) bool {
+	for key, v := range e0 {
+		if e1[key] != v {
+			return false
+		}
+	}
+	for key, v := range e1 {
+		if e0[key] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// copyExtra returns a copy of the extra annotations e.
+func copyExtra(e map[string]string) map[string]string {
+	if e == nil {
+		return nil
+	}
+	e1 := make(map[string]string, len(e))
+	for key, v := range e {
+		e1[key] = v
+	}
+	return e1
+}
+
+// intersectExtra returns the extra annotations
+// that have the same values in e0 and e1.
+func intersectExtra(e0, e1 map[string]string) map[string]string {
+	if equalExtra(e0, e1) {
+		return e0
+	}
+	var e map[string]string
+	for key, v := range e0 {
+		if e1[key] == v {
+			if e == nil {
+				e = make(map[string]string)
+			}
+			e[key] = v
+		}
+	}
+	return e
+}
+
+// AnnotationHandler handles an annotation row with a keyword
+// registered with Reader.HandleAnnotation. It is called once the
+// table's header row has been read, with the table's columns and the
+// annotation row's cells, and returns the columns to use for the
+// table. It may change the columns' metadata, and it may add columns
+// to the end, which hold their default value in every row of the
+// table, but it may not remove columns.
+type AnnotationHandler func(cols []Column, cells []string) ([]Column, error)
+
+// HandleAnnotation registers a handler for annotation rows whose
+// first cell starts with the given keyword, such as "#constant",
+// followed by the end of the cell or a space, so that rows in the
+// form used by "influx write", such as "#constant measurement,cpu",
+// are also matched. Annotation rows with a registered keyword need
+// not have the same number of cells as the table. The #datatype,
+// #group and #default annotations cannot be handled; other
+// registered keywords take precedence over the Reader's own handling.
+// A nil handler removes the registration.
+func (r *Reader) HandleAnnotation(keyword string, h AnnotationHandler) {
+	if h == nil {
+		delete(r.annotationHandlers, keyword)
+		return
+	}
+	if r.annotationHandlers == nil {
+		r.annotationHandlers = make(map[string]AnnotationHandler)
+	}
+	r.annotationHandlers[keyword] = h
+}
+
+// annotationKeyword returns the keyword of an
+// annotation row with the given first cell.
+func annotationKeyword(cell string) string {
+	if i := strings.IndexByte(cell, ' '); i >= 0 {
+		return cell[:i]
+	}
+	return cell
+}
+
+// isHandled reports whether the annotation row with the
+// given first cell has a handler.
+func (r *Reader) isHandled(cell string) bool {
+	switch keyword := annotationKeyword(cell); keyword {
+	case "#datatype", "#group", "#default":
+		return false
+	default:
+		return r.annotationHandlers[keyword] != nil
+	}
+}
+
+// handleAnnotations calls the handlers for the annotation
+// rows of the current table and returns the resulting columns.
+func (r *Reader) handleAnnotations(cols []Column) ([]Column, error) {
+	r.ncells = len(cols)
+	rows := r.handledRows
+	r.handledRows = nil
+	for _, row := range rows {
+		keyword := annotationKeyword(row[0])
+		n := len(cols)
+		cols1, err := r.annotationHandlers[keyword](cols, row)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %v", keyword, err)
+		}
+		if len(cols1) < n {
+			return nil, fmt.Errorf("%s annotation handler removed columns", keyword)
+		}
+		cols = cols1
+	}
+	return cols, nil
+}
@@ -0,0 +1,178 @@
+package arrowconv
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+// This file implements just enough of the FlatBuffers encoding
+// to write Arrow IPC metadata. Objects are laid out front to back,
+// with each table's vtable placed immediately before it and any
+// referenced objects placed after it, so all offsets point forward.
+
+// fbTable represents a FlatBuffers table.
+type fbTable []fbField
+
+// fbField represents a field in a table. The value may be a bool,
+// uint8, int16, int32 or int64 to be stored inline, or an fbTable,
+// string, fbStructs or []fbTable to be referenced by offset.
+type fbField struct {
+	slot  int
+	value interface{}
+}
+
+// fbStructs represents a vector of n structs, or scalars,
+// holding the given encoded data.
+type fbStructs struct {
+	n    int
+	data []byte
+}
+
+type fbBuilder struct {
+	buf []byte
+}
+
+// buildFlatbuffer returns the encoding of the given root table,
+// padded to a multiple of 8 bytes.
+func buildFlatbuffer(root fbTable) []byte {
+	b := &fbBuilder{
+		buf: make([]byte, 4, 256),
+	}
+	pos := b.table(root)
+	binary.LittleEndian.PutUint32(b.buf[0:], uint32(pos))
+	b.align(8)
+	return b.buf
+}
+
+func (b *fbBuilder) align(n int) {
+	for len(b.buf)%n != 0 {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+// object writes the given value and returns its position.
+func (b *fbBuilder) object(v interface{}) int {
+	switch v := v.(type) {
+	case fbTable:
+		return b.table(v)
+	case string:
+		b.align(4)
+		pos := len(b.buf)
+		b.appendUint32(uint32(len(v)))
+		b.buf = append(b.buf, v...)
+		b.buf = append(b.buf, 0)
+		return pos
+	case fbStructs:
+		// The elements must be aligned to 8 bytes in case
+		// they hold 64-bit values.
+		for (len(b.buf)+4)%8 != 0 {
+			b.buf = append(b.buf, 0)
+		}
+		pos := len(b.buf)
+		b.appendUint32(uint32(v.n))
+		b.buf = append(b.buf, v.data...)
+		return pos
+	case []fbTable:
+		b.align(4)
+		pos := len(b.buf)
+		b.appendUint32(uint32(len(v)))
+		elems := len(b.buf)
+		b.buf = append(b.buf, make([]byte, 4*len(v))...)
+		for i, t := range v {
+			b.patch(elems+4*i, b.table(t))
+		}
+		return pos
+	}
+	panic("unexpected flatbuffer value")
+}
+
+func (b *fbBuilder) appendUint32(x uint32) {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], x)
+	b.buf = append(b.buf, buf[:]...)
+}
+
+// patch stores at pos the offset from pos to target.
+func (b *fbBuilder) patch(pos, target int) {
+	binary.LittleEndian.PutUint32(b.buf[pos:], uint32(target-pos))
+}
+
+// table writes the vtable and contents of t
+// and returns the position of the table.
+func (b *fbBuilder) table(t fbTable) int {
+	// Lay out the inline fields, largest first
+	// so that they are all aligned.
+	fields := append(fbTable(nil), t...)
+	sort.SliceStable(fields, func(i, j int) bool {
+		return inlineSize(fields[i].value) > inlineSize(fields[j].value)
+	})
+	nslots := 0
+	offsets := make([]int, len(fields))
+	size := 4
+	for i, f := range fields {
+		if f.slot >= nslots {
+			nslots = f.slot + 1
+		}
+		n := inlineSize(f.value)
+		for size%n != 0 {
+			size++
+		}
+		offsets[i] = size
+		size += n
+	}
+	// Write the vtable.
+	b.align(2)
+	vtablePos := len(b.buf)
+	vtable := make([]byte, 4+2*nslots)
+	binary.LittleEndian.PutUint16(vtable[0:], uint16(len(vtable)))
+	binary.LittleEndian.PutUint16(vtable[2:], uint16(size))
+	for i, f := range fields {
+		binary.LittleEndian.PutUint16(vtable[4+2*f.slot:], uint16(offsets[i]))
+	}
+	b.buf = append(b.buf, vtable...)
+
+	// Write the table itself.
+	b.align(8)
+	pos := len(b.buf)
+	b.buf = append(b.buf, make([]byte, size)...)
+	binary.LittleEndian.PutUint32(b.buf[pos:], uint32(pos-vtablePos))
+	var refs []int
+	for i, f := range fields {
+		p := b.buf[pos+offsets[i]:]
+		switch v := f.value.(type) {
+		case bool:
+			if v {
+				p[0] = 1
+			}
+		case uint8:
+			p[0] = v
+		case int16:
+			binary.LittleEndian.PutUint16(p, uint16(v))
+		case int32:
+			binary.LittleEndian.PutUint32(p, uint32(v))
+		case int64:
+			binary.LittleEndian.PutUint64(p, uint64(v))
+		default:
+			refs = append(refs, i)
+		}
+	}
+	for _, i := range refs {
+		b.patch(pos+offsets[i], b.object(fields[i].value))
+	}
+	return pos
+}
+
+// inlineSize returns the number of bytes used to
+// store v inside a table.
+func inlineSize(v interface{}) int {
+	switch v.(type) {
+	case bool, uint8:
+		return 1
+	case int16:
+		return 2
+	case int64:
+		return 8
+	}
+	// int32 and offsets.
+	return 4
+}
@@ -0,0 +1,388 @@
+// Package arrowconv converts annotated CSV tables to Apache Arrow
+// record batches, written in the Arrow IPC file format (also known as
+// Feather version 2) or the Arrow IPC streaming format.
+//
+// Datatypes map to Arrow types as follows:
+//
+//	boolean       Bool
+//	long          Int64
+//	unsignedLong  UInt64
+//	double        Float64
+//	dateTime:*    Timestamp (nanoseconds, UTC)
+//	other         Utf8
+//
+// The original datatype and group flag of each column are recorded
+// in the field metadata under the keys "annotatedcsv.datatype" and
+// "annotatedcsv.group".
+package arrowconv
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv"
+)
+
+// Format represents an Arrow IPC format.
+type Format int
+
+const (
+	// File is the Arrow IPC file format, also used by Feather files.
+	File Format = iota
+	// Stream is the Arrow IPC streaming format.
+	Stream
+)
+
+// Arrow flatbuffer enum values.
+const (
+	metadataV5 = 4
+
+	headerSchema      = 1
+	headerRecordBatch = 3
+
+	typeInt           = 2
+	typeFloatingPoint = 3
+	typeUtf8          = 5
+	typeBool          = 6
+	typeTimestamp     = 10
+
+	precisionDouble = 2
+	unitNanosecond  = 3
+)
+
+var fileMagic = []byte("ARROW1")
+
+// Writer writes rows as Arrow record batches.
+type Writer struct {
+	w       io.Writer
+	format  Format
+	offset  int64
+	cols    []annotatedcsv.Column
+	schema  fbTable
+	batches []block
+}
+
+// block records the position of a record batch in a file.
+type block struct {
+	offset         int64
+	metadataLength int32
+	bodyLength     int64
+}
+
+// NewWriter returns a Writer that writes record batches with
+// the given columns to w in the given format. The Close method
+// must be called to complete the output.
+func NewWriter(w io.Writer, cols []annotatedcsv.Column, format Format) (*Writer, error) {
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("no columns")
+	}
+	aw := &Writer{
+		w:      w,
+		format: format,
+		cols:   cols,
+		schema: schema(cols),
+	}
+	if format == File {
+		if err := aw.write(append(fileMagic, 0, 0)); err != nil {
+			return nil, err
+		}
+	}
+	_, err := aw.writeMessage(headerSchema, aw.schema, nil)
+	if err != nil {
+		return nil, err
+	}
+	return aw, nil
+}
+
+// Columns returns the columns of a table that are converted
+// to Arrow fields, omitting the annotation column. The result
+// is suitable for passing to NewWriter.
+func Columns(cols []annotatedcsv.Column) []annotatedcsv.Column {
+	if len(cols) > 0 && cols[0].Name == "" && cols[0].Default == nil {
+		return cols[1:]
+	}
+	return cols
+}
+
+// WriteTable writes the rows of the given table as record batches
+// holding at most batchRows rows each. If batchRows is zero or
+// negative, all the rows are written as a single record batch. The
+// table's columns must match those passed to NewWriter, ignoring
+// any annotation column.
+func (w *Writer) WriteTable(t *annotatedcsv.Table, batchRows int) error {
+	cols := Columns(t.Columns)
+	if len(cols) != len(w.cols) {
+		return fmt.Errorf("table has %d columns; want %d", len(cols), len(w.cols))
+	}
+	for i, col := range cols {
+		if col.Name != w.cols[i].Name || col.Type != w.cols[i].Type {
+			return fmt.Errorf("table column %q of type %q does not match column %q of type %q", col.Name, col.Type, w.cols[i].Name, w.cols[i].Type)
+		}
+	}
+	offset := len(t.Columns) - len(cols)
+	rows := t.Rows
+	for {
+		n := len(rows)
+		if batchRows > 0 && n > batchRows {
+			n = batchRows
+		}
+		if err := w.WriteRecordBatch(rows[:n], offset); err != nil {
+			return err
+		}
+		rows = rows[n:]
+		if len(rows) == 0 {
+			return nil
+		}
+	}
+}
+
+// WriteRecordBatch writes the given rows as a single record batch.
+// The value for column i in each row is taken from index offset+i
+// in the row; offset is typically 1 to skip the annotation column.
+func (w *Writer) WriteRecordBatch(rows [][]interface{}, offset int) error {
+	var nodes, buffers []byte
+	var body []byte
+	addBuffer := func(data []byte) {
+		buffers = appendInt64s(buffers, int64(len(body)), int64(len(data)))
+		body = append(body, data...)
+		for len(body)%8 != 0 {
+			body = append(body, 0)
+		}
+	}
+	for i, col := range w.cols {
+		validity := make([]byte, (len(rows)+7)/8)
+		nulls := 0
+		for j, row := range rows {
+			if row[offset+i] == nil {
+				nulls++
+			} else {
+				validity[j/8] |= 1 << (j % 8)
+			}
+		}
+		nodes = appendInt64s(nodes, int64(len(rows)), int64(nulls))
+		if nulls == 0 {
+			validity = nil
+		}
+		addBuffer(validity)
+		switch arrowType(col.Type) {
+		case typeBool:
+			values := make([]byte, (len(rows)+7)/8)
+			for j, row := range rows {
+				if v, ok := row[offset+i].(bool); ok && v {
+					values[j/8] |= 1 << (j % 8)
+				}
+			}
+			addBuffer(values)
+		case typeInt, typeFloatingPoint, typeTimestamp:
+			values := make([]byte, 8*len(rows))
+			for j, row := range rows {
+				x, err := fixedValue(row[offset+i])
+				if err != nil {
+					return fmt.Errorf("column %q: %v", col.Name, err)
+				}
+				binary.LittleEndian.PutUint64(values[8*j:], x)
+			}
+			addBuffer(values)
+		default:
+			offsets := make([]byte, 4*(len(rows)+1))
+			var data []byte
+			for j, row := range rows {
+				switch v := row[offset+i].(type) {
+				case nil:
+				case string:
+					data = append(data, v...)
+				default:
+					data = append(data, fmt.Sprint(v)...)
+				}
+				if len(data) > math.MaxInt32 {
+					return fmt.Errorf("column %q: too much data for one record batch", col.Name)
+				}
+				binary.LittleEndian.PutUint32(offsets[4*(j+1):], uint32(len(data)))
+			}
+			addBuffer(offsets)
+			addBuffer(data)
+		}
+	}
+	header := fbTable{
+		{0, int64(len(rows))},
+		{1, fbStructs{len(w.cols), nodes}},
+		{2, fbStructs{len(buffers) / 16, buffers}},
+	}
+	b, err := w.writeMessage(headerRecordBatch, header, body)
+	if err != nil {
+		return err
+	}
+	w.batches = append(w.batches, b)
+	return nil
+}
+
+// fixedValue returns the 64-bit representation of v.
+func fixedValue(v interface{}) (uint64, error) {
+	switch v := v.(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		return uint64(v), nil
+	case uint64:
+		return v, nil
+	case float64:
+		return math.Float64bits(v), nil
+	case time.Time:
+		return uint64(v.UnixNano()), nil
+	case string:
+		// The reader represents infinities and NaN as strings.
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, err
+		}
+		return math.Float64bits(f), nil
+	}
+	return 0, fmt.Errorf("unexpected value type %T", v)
+}
+
+// Close writes the end of the output. It does not close
+// the underlying writer.
+func (w *Writer) Close() error {
+	// End-of-stream marker.
+	if err := w.write([]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0}); err != nil {
+		return err
+	}
+	if w.format == Stream {
+		return nil
+	}
+	var blocks []byte
+	for _, b := range w.batches {
+		blocks = appendInt64s(blocks, b.offset)
+		var buf [8]byte
+		binary.LittleEndian.PutUint32(buf[:], uint32(b.metadataLength))
+		blocks = append(blocks, buf[:]...)
+		blocks = appendInt64s(blocks, b.bodyLength)
+	}
+	footer := buildFlatbuffer(fbTable{
+		{0, int16(metadataV5)},
+		{1, w.schema},
+		{2, fbStructs{0, nil}},
+		{3, fbStructs{len(w.batches), blocks}},
+	})
+	if err := w.write(footer); err != nil {
+		return err
+	}
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(len(footer)))
+	if err := w.write(size[:]); err != nil {
+		return err
+	}
+	return w.write(fileMagic)
+}
+
+// writeMessage writes an encapsulated IPC message with
+// the given header and body.
+func (w *Writer) writeMessage(headerType uint8, header fbTable, body []byte) (block, error) {
+	meta := buildFlatbuffer(fbTable{
+		{0, int16(metadataV5)},
+		{1, headerType},
+		{2, header},
+		{3, int64(len(body))},
+	})
+	b := block{
+		offset:         w.offset,
+		metadataLength: int32(8 + len(meta)),
+		bodyLength:     int64(len(body)),
+	}
+	var prefix [8]byte
+	binary.LittleEndian.PutUint32(prefix[0:], 0xffffffff)
+	binary.LittleEndian.PutUint32(prefix[4:], uint32(len(meta)))
+	if err := w.write(prefix[:]); err != nil {
+		return block{}, err
+	}
+	if err := w.write(meta); err != nil {
+		return block{}, err
+	}
+	if err := w.write(body); err != nil {
+		return block{}, err
+	}
+	return b, nil
+}
+
+func (w *Writer) write(data []byte) error {
+	n, err := w.w.Write(data)
+	w.offset += int64(n)
+	return err
+}
+
+// schema returns the Schema table for the given columns.
+func schema(cols []annotatedcsv.Column) fbTable {
+	fields := make([]fbTable, len(cols))
+	for i, col := range cols {
+		typ := arrowType(col.Type)
+		var typeTable fbTable
+		switch typ {
+		case typeInt:
+			typeTable = fbTable{
+				{0, int32(64)},
+				{1, col.Type == "long"},
+			}
+		case typeFloatingPoint:
+			typeTable = fbTable{
+				{0, int16(precisionDouble)},
+			}
+		case typeTimestamp:
+			typeTable = fbTable{
+				{0, int16(unitNanosecond)},
+				{1, "UTC"},
+			}
+		default:
+			typeTable = fbTable{}
+		}
+		fields[i] = fbTable{
+			{0, col.Name},
+			{1, true},
+			{2, typ},
+			{3, typeTable},
+			{5, []fbTable{}},
+			{6, []fbTable{
+				keyValue("annotatedcsv.datatype", col.Type),
+				keyValue("annotatedcsv.group", strconv.FormatBool(col.Group)),
+			}},
+		}
+	}
+	return fbTable{
+		{1, fields},
+	}
+}
+
+func keyValue(key, value string) fbTable {
+	return fbTable{
+		{0, key},
+		{1, value},
+	}
+}
+
+// arrowType returns the Arrow type used for
+// values of the given datatype.
+func arrowType(typ string) uint8 {
+	switch annotatedcsv.DatatypeKind(typ) {
+	case annotatedcsv.BooleanKind:
+		return typeBool
+	case annotatedcsv.LongKind, annotatedcsv.UnsignedLongKind:
+		return typeInt
+	case annotatedcsv.DoubleKind:
+		return typeFloatingPoint
+	case annotatedcsv.DateTimeKind:
+		return typeTimestamp
+	}
+	return typeUtf8
+}
+
+func appendInt64s(buf []byte, xs ...int64) []byte {
+	var b [8]byte
+	for _, x := range xs {
+		binary.LittleEndian.PutUint64(b[:], uint64(x))
+		buf = append(buf, b[:]...)
+	}
+	return buf
+}
@@ -0,0 +1,113 @@
+package arrowconv
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+var t0 = time.Date(2020, 1, 1, 0, 0, 0, 123456789, time.UTC)
+
+var testTable = &annotatedcsv.Table{
+	Columns: []annotatedcsv.Column{
+		{Name: ""},
+		{Name: "_time", Type: "dateTime:RFC3339Nano"},
+		{Name: "_value", Type: "double"},
+		{Name: "n", Type: "long"},
+		{Name: "u", Type: "unsignedLong"},
+		{Name: "b", Type: "boolean"},
+		{Name: "host", Type: "string", Group: true},
+	},
+	Rows: [][]interface{}{
+		{nil, t0, 1.5, int64(-1), uint64(math.MaxUint64), true, "a"},
+		{nil, nil, "+Inf", int64(2), uint64(0), false, "bb"},
+		{nil, t0.Add(time.Second), nil, nil, nil, nil, nil},
+		{nil, t0.Add(2 * time.Second), -0.25, int64(math.MinInt64), uint64(7), true, ""},
+		{nil, t0.Add(3 * time.Second), 0.0, int64(4), uint64(8), false, "héllo"},
+	},
+}
+
+// The golden files in testdata were checked by reading them with
+// the Apache Arrow Go IPC reader. Run the tests with -update to
+// rewrite them after changing the writer, and check them again.
+var goldenTests = []struct {
+	testName  string
+	format    Format
+	batchRows int
+}{{
+	testName: "table.arrow",
+	format:   File,
+}, {
+	testName:  "batches.arrow",
+	format:    File,
+	batchRows: 2,
+}, {
+	testName:  "batches.arrows",
+	format:    Stream,
+	batchRows: 2,
+}}
+
+func TestGolden(t *testing.T) {
+	for _, test := range goldenTests {
+		t.Run(test.testName, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewWriter(&buf, Columns(testTable.Columns), test.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := w.WriteTable(testTable, test.batchRows); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			file := filepath.Join("testdata", test.testName)
+			if *update {
+				if err := ioutil.WriteFile(file, buf.Bytes(), 0666); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("output differs from %s", file)
+			}
+		})
+	}
+}
+
+func TestColumns(t *testing.T) {
+	cols := Columns(testTable.Columns)
+	if len(cols) != len(testTable.Columns)-1 || cols[0].Name != "_time" {
+		t.Errorf("annotation column not removed; got %v", cols)
+	}
+	// A first column with a default is a real column.
+	withDefault := []annotatedcsv.Column{{Name: "", Type: "string", Default: "x"}}
+	if cols := Columns(withDefault); len(cols) != 1 {
+		t.Errorf("column with default removed; got %v", cols)
+	}
+}
+
+func TestWriteTableMismatch(t *testing.T) {
+	w, err := NewWriter(ioutil.Discard, Columns(testTable.Columns), Stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.WriteTable(&annotatedcsv.Table{
+		Columns: []annotatedcsv.Column{{Name: ""}, {Name: "x", Type: "long"}},
+	}, 0)
+	if want := "table has 1 columns; want 6"; err == nil || err.Error() != want {
+		t.Errorf("unexpected error; got %v want %q", err, want)
+	}
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/annotate"
+)
+
+func main() {
+	annotate.Main("annotate", os.Args[1:])
+}
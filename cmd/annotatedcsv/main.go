@@ -0,0 +1,124 @@
+// The annotatedcsv command provides all the annotated CSV
+// tools as subcommands of a single binary.
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/annotate"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csv2arrow"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csv2avro"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csv2clickhouse"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csv2graphite"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csv2html"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csv2json"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csv2lineprotocol"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csv2md"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csv2otlp"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csv2parquet"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csv2postgres"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csv2prom"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csv2sql"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csv2sqlite"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csv2xlsx"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csvcat"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csvcut"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csvdiff"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csvgrep"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csvhead"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csvindex"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csvjoin"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csvpivot"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csvsample"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csvsort"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csvsplit"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csvstat"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csvtail"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csvvalidate"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/json2annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/lineprotocol2csv"
+)
+
+type command struct {
+	name string
+	main func(name string, args []string)
+	// standalone holds the name of the equivalent
+	// standalone command.
+	standalone string
+	summary    string
+}
+
+var commands = []command{
+	{"annotate", annotate.Main, "annotate", "infer annotations for plain CSV"},
+	{"cat", csvcat.Main, "csvcat", "concatenate tables"},
+	{"cut", csvcut.Main, "csvcut", "select, rename or remove columns"},
+	{"diff", csvdiff.Main, "csvdiff", "compare two files"},
+	{"fromjson", json2annotatedcsv.Main, "json2annotatedcsv", "convert JSON produced by tojson back to annotated CSV"},
+	{"fromlp", lineprotocol2csv.Main, "lineprotocol2csv", "convert line protocol to annotated CSV"},
+	{"grep", csvgrep.Main, "csvgrep", "select rows matching an expression"},
+	{"head", csvhead.Main, "csvhead", "print the first rows of each table"},
+	{"index", csvindex.Main, "csvindex", "index the tables in files for fast selection"},
+	{"join", csvjoin.Main, "csvjoin", "join rows with a reference file"},
+	{"pivot", csvpivot.Main, "csvpivot", "pivot fields into columns and back"},
+	{"sample", csvsample.Main, "csvsample", "select a random sample of rows"},
+	{"sort", csvsort.Main, "csvsort", "sort rows"},
+	{"split", csvsplit.Main, "csvsplit", "split tables into separate files"},
+	{"stat", csvstat.Main, "csvstat", "print column statistics"},
+	{"tail", csvtail.Main, "csvtail", "print the last rows of each table"},
+	{"toarrow", csv2arrow.Main, "csv2arrow", "convert to Apache Arrow IPC"},
+	{"toavro", csv2avro.Main, "csv2avro", "convert to an Avro object container file"},
+	{"toclickhouse", csv2clickhouse.Main, "csv2clickhouse", "convert to ClickHouse formats or load into ClickHouse"},
+	{"tographite", csv2graphite.Main, "csv2graphite", "convert to Graphite plaintext or send to Carbon"},
+	{"tohtml", csv2html.Main, "csv2html", "render tables as HTML"},
+	{"tojson", csv2json.Main, "csv2json", "convert to JSON"},
+	{"tolp", csv2lineprotocol.Main, "csv2lineprotocol", "convert to line protocol or write to InfluxDB"},
+	{"tomd", csv2md.Main, "csv2md", "render tables as Markdown"},
+	{"tootlp", csv2otlp.Main, "csv2otlp", "export to an OpenTelemetry (OTLP) receiver"},
+	{"toparquet", csv2parquet.Main, "csv2parquet", "convert to Parquet"},
+	{"topostgres", csv2postgres.Main, "csv2postgres", "load into PostgreSQL or TimescaleDB"},
+	{"toprom", csv2prom.Main, "csv2prom", "convert to OpenMetrics or write to Prometheus"},
+	{"tosql", csv2sql.Main, "csv2sql", "generate SQL statements"},
+	{"tosqlite", csv2sqlite.Main, "csv2sqlite", "load into a SQLite database"},
+	{"toxlsx", csv2xlsx.Main, "csv2xlsx", "convert to an Excel workbook"},
+	{"validate", csvvalidate.Main, "csvvalidate", "check that files are well formed"},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	name, args := os.Args[1], os.Args[2:]
+	switch name {
+	case "help", "-h", "-help", "--help":
+		if len(args) == 0 {
+			usage()
+			return
+		}
+		// Show the usage message of the given command.
+		name, args = args[0], []string{"-h"}
+	}
+	for _, c := range commands {
+		if c.name == name || c.standalone == name {
+			c.main("annotatedcsv "+c.name, args)
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "error: unknown command %q; run \"annotatedcsv help\" for a list of commands\n", name)
+	os.Exit(2)
+}
+
+func usage() {
+	var b strings.Builder
+	b.WriteString("usage: annotatedcsv command [flags] [args...]\n\nThe commands are:\n\n")
+	tw := tabwriter.NewWriter(&b, 0, 8, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(tw, "\t%s\t%s\n", c.name, c.summary)
+	}
+	tw.Flush()
+	b.WriteString("\nUse \"annotatedcsv help command\" for more information about a command.\n")
+	fmt.Fprint(os.Stderr, b.String())
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csv2arrow"
+)
+
+func main() {
+	csv2arrow.Main("csv2arrow", os.Args[1:])
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csv2avro"
+)
+
+func main() {
+	csv2avro.Main("csv2avro", os.Args[1:])
+}
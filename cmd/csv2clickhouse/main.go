@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csv2clickhouse"
+)
+
+func main() {
+	csv2clickhouse.Main("csv2clickhouse", os.Args[1:])
+}
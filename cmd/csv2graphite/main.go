@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csv2graphite"
+)
+
+func main() {
+	csv2graphite.Main("csv2graphite", os.Args[1:])
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csv2html"
+)
+
+func main() {
+	csv2html.Main("csv2html", os.Args[1:])
+}
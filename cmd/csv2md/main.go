@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csv2md"
+)
+
+func main() {
+	csv2md.Main("csv2md", os.Args[1:])
+}
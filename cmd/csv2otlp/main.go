@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csv2otlp"
+)
+
+func main() {
+	csv2otlp.Main("csv2otlp", os.Args[1:])
+}
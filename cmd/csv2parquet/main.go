@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csv2parquet"
+)
+
+func main() {
+	csv2parquet.Main("csv2parquet", os.Args[1:])
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csv2postgres"
+)
+
+func main() {
+	csv2postgres.Main("csv2postgres", os.Args[1:])
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csv2prom"
+)
+
+func main() {
+	csv2prom.Main("csv2prom", os.Args[1:])
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csv2sql"
+)
+
+func main() {
+	csv2sql.Main("csv2sql", os.Args[1:])
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csv2sqlite"
+)
+
+func main() {
+	csv2sqlite.Main("csv2sqlite", os.Args[1:])
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csv2xlsx"
+)
+
+func main() {
+	csv2xlsx.Main("csv2xlsx", os.Args[1:])
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csvcat"
+)
+
+func main() {
+	csvcat.Main("csvcat", os.Args[1:])
+}
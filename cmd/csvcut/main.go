@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csvcut"
+)
+
+func main() {
+	csvcut.Main("csvcut", os.Args[1:])
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csvdiff"
+)
+
+func main() {
+	csvdiff.Main("csvdiff", os.Args[1:])
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csvgrep"
+)
+
+func main() {
+	csvgrep.Main("csvgrep", os.Args[1:])
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csvhead"
+)
+
+func main() {
+	csvhead.Main("csvhead", os.Args[1:])
+}
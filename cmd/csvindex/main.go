@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csvindex"
+)
+
+func main() {
+	csvindex.Main("csvindex", os.Args[1:])
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csvjoin"
+)
+
+func main() {
+	csvjoin.Main("csvjoin", os.Args[1:])
+}
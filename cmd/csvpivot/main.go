@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csvpivot"
+)
+
+func main() {
+	csvpivot.Main("csvpivot", os.Args[1:])
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csvsample"
+)
+
+func main() {
+	csvsample.Main("csvsample", os.Args[1:])
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csvsort"
+)
+
+func main() {
+	csvsort.Main("csvsort", os.Args[1:])
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csvsplit"
+)
+
+func main() {
+	csvsplit.Main("csvsplit", os.Args[1:])
+}
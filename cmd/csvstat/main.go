@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csvstat"
+)
+
+func main() {
+	csvstat.Main("csvstat", os.Args[1:])
+}
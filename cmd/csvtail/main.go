@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csvtail"
+)
+
+func main() {
+	csvtail.Main("csvtail", os.Args[1:])
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/csvvalidate"
+)
+
+func main() {
+	csvvalidate.Main("csvvalidate", os.Args[1:])
+}
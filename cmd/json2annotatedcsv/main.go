@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/json2annotatedcsv"
+)
+
+func main() {
+	json2annotatedcsv.Main("json2annotatedcsv", os.Args[1:])
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/cmd/lineprotocol2csv"
+)
+
+func main() {
+	lineprotocol2csv.Main("lineprotocol2csv", os.Args[1:])
+}
@@ -0,0 +1,84 @@
+package annotatedcsv
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// constantAnnotation handles the #constant annotation of the extended
+// annotated CSV format read by "influx write", which adds a column
+// holding the same value in every row. Its arguments are a datatype,
+// an optional column name and the value, for example:
+//
+//	#constant measurement,cpu
+//	#constant tag,host,server01
+//	#constant long,count,1
+//
+// The arguments may follow the keyword in the first cell, separated
+// by a space, as in the examples, or be in the following cells. As
+// well as the Reader's datatypes, the datatypes measurement, tag and
+// field are allowed, which add a _measurement group column, a group
+// string column and a string column respectively, and a dateTime
+// without a column name adds a _time column.
+func (r *Reader) constantAnnotation(cols []Column, cells []string) ([]Column, error) {
+	var args []string
+	if arg := strings.TrimSpace(strings.TrimPrefix(cells[0], "#constant")); arg != "" {
+		args = append(args, arg)
+	}
+	args = append(args, cells[1:]...)
+	for len(args) > 2 && args[len(args)-1] == "" {
+		// Remove padding to the width of the table.
+		args = args[:len(args)-1]
+	}
+	var typ, name, value string
+	switch len(args) {
+	case 2:
+		typ, value = args[0], args[1]
+	case 3:
+		typ, name, value = args[0], args[1], args[2]
+	default:
+		return nil, fmt.Errorf("got %d arguments, want datatype[,name],value", len(args))
+	}
+	col := Column{
+		Name: name,
+		Type: typ,
+	}
+	switch typ {
+	case "measurement":
+		if col.Name == "" {
+			col.Name = "_measurement"
+		}
+		col.Type, col.Group = "string", true
+	case "tag":
+		col.Type, col.Group = "string", true
+	case "field":
+		col.Type = "string"
+	case "dateTime":
+		// The format is inferred from the value.
+		col.Type = "dateTime:RFC3339Nano"
+		if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+			col.Type = epochDatatype
+		}
+	}
+	if col.Name == "" {
+		if !strings.HasPrefix(col.Type, "dateTime:") {
+			return nil, fmt.Errorf("no column name for datatype %q", typ)
+		}
+		col.Name = "_time"
+	}
+	for _, c := range cols {
+		if c.Name == col.Name {
+			return nil, fmt.Errorf("column %q already exists", col.Name)
+		}
+	}
+	if !KnownDatatype(col.Type) {
+		return nil, fmt.Errorf("unknown datatype %q", typ)
+	}
+	x, err := r.convert(value, col.Type)
+	if err != nil {
+		return nil, fmt.Errorf("cannot convert %q to type %q: %v", value, col.Type, err)
+	}
+	col.Default = r.double(x, col.Type)
+	return append(cols, col), nil
+}
@@ -0,0 +1,107 @@
+package annotatedcsv
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConstantReadWrite(t *testing.T) {
+	const data = `#constant measurement,cpu
+#constant,tag,host,server01
+#constant long,count,1
+#constant dateTime,1609459200000000000
+#constant,field,f,x,,
+#datatype,double
+#group,false
+#default,
+,v
+,1.5
+,2
+`
+	tables, err := ReadAll(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 1 {
+		t.Fatalf("got %d tables, want 1", len(tables))
+	}
+	tm := time.Unix(1609459200, 0).UTC()
+	expectRows := [][]interface{}{
+		{nil, 1.5, "cpu", "server01", int64(1), tm, "x"},
+		{nil, 2.0, "cpu", "server01", int64(1), tm, "x"},
+	}
+	if got := tables[0].Rows; !reflect.DeepEqual(got, expectRows) {
+		t.Fatalf("unexpected rows\ngot  %#v\nwant %#v", got, expectRows)
+	}
+
+	// The constant columns are written as columns with
+	// default values, which read back as the same tables.
+	var buf bytes.Buffer
+	if err := WriteAll(&buf, tables); err != nil {
+		t.Fatal(err)
+	}
+	const expectOutput = `#datatype,double,string,string,long,dateTime:number,string
+#group,false,true,true,false,false,false
+#default,,cpu,server01,1,1609459200000000000,x
+,v,_measurement,host,count,_time,f
+,1.5,,,,,
+,2,,,,,
+`
+	if got := buf.String(); got != expectOutput {
+		t.Fatalf("unexpected output\ngot:\n%s\nwant:\n%s", got, expectOutput)
+	}
+	tables1, err := ReadAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tables1[0].Rows; !reflect.DeepEqual(got, expectRows) {
+		t.Fatalf("unexpected rows after round trip\ngot  %#v\nwant %#v", got, expectRows)
+	}
+}
+
+var constantErrorTests = []struct {
+	testName    string
+	annotation  string
+	expectError string
+}{{
+	testName:    "too-few-arguments",
+	annotation:  "#constant long",
+	expectError: `got 1 arguments, want datatype\[,name\],value`,
+}, {
+	testName:    "too-many-arguments",
+	annotation:  "#constant long,n,1,2",
+	expectError: `got 4 arguments, want datatype\[,name\],value`,
+}, {
+	testName:    "no-name",
+	annotation:  "#constant long,1",
+	expectError: `no column name for datatype "long"`,
+}, {
+	testName:    "second-time-column",
+	annotation:  "#constant dateTime,1\n#constant dateTime:RFC3339,2021-01-01T00:00:00Z",
+	expectError: `column "_time" already exists`,
+}, {
+	testName:    "existing-column",
+	annotation:  "#constant long,v,1",
+	expectError: `column "v" already exists`,
+}, {
+	testName:    "unknown-datatype",
+	annotation:  "#constant color,c,red",
+	expectError: `unknown datatype "color"`,
+}, {
+	testName:    "bad-value",
+	annotation:  "#constant long,n,x",
+	expectError: `cannot convert "x" to type "long": .*`,
+}}
+
+func TestConstantErrors(t *testing.T) {
+	for _, test := range constantErrorTests {
+		t.Run(test.testName, func(t *testing.T) {
+			data := test.annotation + "\n#datatype,double\n#group,false\n#default,\n,v\n,1\n"
+			_, err := ReadAll(strings.NewReader(data))
+			assertErrorMatches(t, err, `invalid #constant annotation: `+test.expectError+` at line \d+`)
+		})
+	}
+}
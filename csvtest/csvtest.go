@@ -0,0 +1,324 @@
+// Package csvtest provides helpers for writing tests
+// that build and compare annotated CSV tables.
+package csvtest
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv"
+)
+
+// maxRowDiffs holds the maximum number of row
+// differences that Diff reports for each table.
+const maxRowDiffs = 10
+
+// Builder builds a table. Its methods return the Builder so that
+// calls can be chained, for example:
+//
+//	t := csvtest.NewTable().
+//		Col("host", "string", true).
+//		Col("_value", "double", false).
+//		Row("a", 1.5).
+//		Row("b", 2).
+//		Table()
+type Builder struct {
+	t   *annotatedcsv.Table
+	err error
+}
+
+// NewTable returns a Builder for a table with no columns
+// other than the annotation column, as returned by the
+// Reader at column index 0.
+func NewTable() *Builder {
+	return &Builder{
+		t: &annotatedcsv.Table{
+			Columns: []annotatedcsv.Column{{}},
+		},
+	}
+}
+
+// Col adds a column with the given name, datatype and group flag.
+// All columns must be added before any rows.
+func (b *Builder) Col(name, typ string, group bool) *Builder {
+	if b.err != nil {
+		return b
+	}
+	if len(b.t.Rows) > 0 {
+		b.err = fmt.Errorf("column %q added after rows", name)
+		return b
+	}
+	b.t.Columns = append(b.t.Columns, annotatedcsv.Column{
+		Name:  name,
+		Type:  typ,
+		Group: group,
+	})
+	return b
+}
+
+// Default sets the default value of the most recently added column.
+// The value is converted as for Row.
+func (b *Builder) Default(v interface{}) *Builder {
+	if b.err != nil {
+		return b
+	}
+	if len(b.t.Columns) < 2 {
+		b.err = fmt.Errorf("default set before any columns")
+		return b
+	}
+	col := &b.t.Columns[len(b.t.Columns)-1]
+	v, err := convert(v, col.Type)
+	if err != nil {
+		b.err = fmt.Errorf("bad default for column %q: %v", col.Name, err)
+		return b
+	}
+	col.Default = v
+	return b
+}
+
+// Unit sets the unit of the most recently added column.
+func (b *Builder) Unit(unit string) *Builder {
+	if b.err != nil {
+		return b
+	}
+	if len(b.t.Columns) < 2 {
+		b.err = fmt.Errorf("unit set before any columns")
+		return b
+	}
+	b.t.Columns[len(b.t.Columns)-1].Unit = unit
+	return b
+}
+
+// Annotation sets the value of an extra annotation, named
+// without the leading "#", for the most recently added column.
+func (b *Builder) Annotation(name, value string) *Builder {
+	if b.err != nil {
+		return b
+	}
+	if len(b.t.Columns) < 2 {
+		b.err = fmt.Errorf("annotation set before any columns")
+		return b
+	}
+	col := &b.t.Columns[len(b.t.Columns)-1]
+	if col.Extra == nil {
+		col.Extra = make(map[string]string)
+	}
+	col.Extra[name] = value
+	return b
+}
+
+// Row adds a row with one value for each column, not including
+// the annotation column. A nil value is replaced by the column's
+// default value, as the Reader does for empty cells. A string value
+// in a column that does not have the string datatype is parsed as
+// the Reader would parse it, so, for example, dateTime values may be
+// given in RFC3339 format. Other values are converted to the type
+// that the Reader returns for the column's datatype if that can be
+// done without loss, so Go int values can be used for long and
+// double columns.
+func (b *Builder) Row(vals ...interface{}) *Builder {
+	if b.err != nil {
+		return b
+	}
+	cols := b.t.Columns
+	if len(vals) != len(cols)-1 {
+		b.err = fmt.Errorf("wrong number of values in row %d; got %d want %d", len(b.t.Rows), len(vals), len(cols)-1)
+		return b
+	}
+	row := make([]interface{}, len(cols))
+	for i, v := range vals {
+		col := cols[i+1]
+		v, err := convert(v, col.Type)
+		if err != nil {
+			b.err = fmt.Errorf("bad value for column %q in row %d: %v", col.Name, len(b.t.Rows), err)
+			return b
+		}
+		if v == nil {
+			v = col.Default
+		}
+		row[i+1] = v
+	}
+	b.t.Rows = append(b.t.Rows, row)
+	return b
+}
+
+// Build returns the table, or the first error
+// encountered when building it.
+func (b *Builder) Build() (*annotatedcsv.Table, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.t, nil
+}
+
+// Table is like Build except that it panics on error.
+func (b *Builder) Table() *annotatedcsv.Table {
+	t, err := b.Build()
+	if err != nil {
+		panic(fmt.Errorf("csvtest: %v", err))
+	}
+	return t
+}
+
+// convert converts v to the type that the Reader
+// returns for the given datatype.
+func convert(v interface{}, typ string) (interface{}, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		if typ != "json" {
+			return nil, fmt.Errorf("JSON value for datatype %q", typ)
+		}
+		return v, nil
+	case string:
+		if typ == "string" || !annotatedcsv.KnownDatatype(typ) {
+			return v, nil
+		}
+		return annotatedcsv.ParseValue(v, typ)
+	case time.Time:
+		if annotatedcsv.DatatypeKind(typ) != annotatedcsv.DateTimeKind {
+			return nil, fmt.Errorf("time value for datatype %q", typ)
+		}
+		return v, nil
+	}
+	if reflect.TypeOf(v).Kind() == reflect.Slice {
+		if kind := annotatedcsv.DatatypeKind(typ); kind != annotatedcsv.JSONKind && kind != annotatedcsv.ListKind {
+			return nil, fmt.Errorf("slice value for datatype %q", typ)
+		}
+		return v, nil
+	}
+	switch annotatedcsv.DatatypeKind(typ) {
+	case annotatedcsv.BooleanKind, annotatedcsv.LongKind, annotatedcsv.UnsignedLongKind, annotatedcsv.DoubleKind,
+		annotatedcsv.DecimalKind, annotatedcsv.UUIDKind, annotatedcsv.IPKind, annotatedcsv.CIDRKind:
+		x, err := annotatedcsv.ParseValue(fmt.Sprint(v), typ)
+		if err != nil {
+			return nil, fmt.Errorf("cannot convert %v of type %T to datatype %q", v, v, typ)
+		}
+		return x, nil
+	}
+	return nil, fmt.Errorf("unexpected value %v of type %T for datatype %q", v, v, typ)
+}
+
+// Diff returns a description of the differences between the tables
+// got and want, or the empty string if they are the same. Tables are
+// compared in order, and rows within each table are compared in
+// order.
+func Diff(got, want annotatedcsv.Tables) string {
+	var diffs []string
+	if len(got) != len(want) {
+		diffs = append(diffs, fmt.Sprintf("got %d tables, want %d", len(got), len(want)))
+	}
+	for i := 0; i < len(got) && i < len(want); i++ {
+		for _, d := range tableDiff(got[i], want[i]) {
+			diffs = append(diffs, fmt.Sprintf("table %d: %s", i, d))
+		}
+	}
+	for i := len(want); i < len(got); i++ {
+		diffs = append(diffs, fmt.Sprintf("table %d: unexpected table with %d rows", i, len(got[i].Rows)))
+	}
+	for i := len(got); i < len(want); i++ {
+		diffs = append(diffs, fmt.Sprintf("table %d: missing table with %d rows", i, len(want[i].Rows)))
+	}
+	if len(diffs) == 0 {
+		return ""
+	}
+	return strings.Join(diffs, "\n") + "\n"
+}
+
+// tableDiff returns the differences between two tables.
+// Rows are only compared if the schemas are the same.
+func tableDiff(got, want *annotatedcsv.Table) []string {
+	var diffs []string
+	for _, d := range annotatedcsv.Schema(want.Columns).Diff(got.Columns) {
+		diffs = append(diffs, d.String())
+	}
+	if len(diffs) > 0 {
+		return diffs
+	}
+	cols := want.Columns
+	nrows := 0
+	for i := 0; i < len(got.Rows) || i < len(want.Rows); i++ {
+		var d string
+		switch {
+		case i >= len(want.Rows):
+			d = fmt.Sprintf("row %d: unexpected row %s", i, formatRow(cols, got.Rows[i]))
+		case i >= len(got.Rows):
+			d = fmt.Sprintf("row %d: missing row %s", i, formatRow(cols, want.Rows[i]))
+		default:
+			var cdiffs []string
+			for j, col := range cols {
+				g, w := value(got.Rows[i], j), value(want.Rows[i], j)
+				if equal(g, w) {
+					continue
+				}
+				gs, ws := formatValue(g), formatValue(w)
+				if gs == ws {
+					// The values differ only in type.
+					gs, ws = fmt.Sprintf("%T(%s)", g, gs), fmt.Sprintf("%T(%s)", w, ws)
+				}
+				cdiffs = append(cdiffs, fmt.Sprintf("column %q: got %s want %s", col.Name, gs, ws))
+			}
+			if len(cdiffs) == 0 {
+				continue
+			}
+			d = fmt.Sprintf("row %d: %s", i, strings.Join(cdiffs, "; "))
+		}
+		if nrows++; nrows > maxRowDiffs {
+			diffs = append(diffs, "... more row differences omitted")
+			break
+		}
+		diffs = append(diffs, d)
+	}
+	if len(got.Rows) != len(want.Rows) {
+		diffs = append(diffs, fmt.Sprintf("got %d rows, want %d", len(got.Rows), len(want.Rows)))
+	}
+	return diffs
+}
+
+func value(row []interface{}, i int) interface{} {
+	if i < len(row) {
+		return row[i]
+	}
+	return nil
+}
+
+func equal(a, b interface{}) bool {
+	switch a := a.(type) {
+	case time.Time:
+		b, ok := b.(time.Time)
+		return ok && a.Equal(b)
+	case annotatedcsv.Decimal:
+		b, ok := b.(annotatedcsv.Decimal)
+		return ok && a.Cmp(b) == 0
+	}
+	if a != nil && !reflect.TypeOf(a).Comparable() {
+		return reflect.DeepEqual(a, b)
+	}
+	return a == b
+}
+
+func formatRow(cols []annotatedcsv.Column, row []interface{}) string {
+	vals := make([]string, 0, len(cols)-1)
+	for i := 1; i < len(cols); i++ {
+		vals = append(vals, formatValue(value(row, i)))
+	}
+	return "[" + strings.Join(vals, ", ") + "]"
+}
+
+// formatValue formats v for a difference report.
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "nil"
+	case string:
+		return fmt.Sprintf("%q", v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case int64, float64, bool, annotatedcsv.Decimal:
+		return fmt.Sprint(v)
+	}
+	return fmt.Sprintf("%T(%v)", v, v)
+}
@@ -0,0 +1,200 @@
+package csvtest
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv"
+)
+
+func TestBuilderMatchesReader(t *testing.T) {
+	const data = `#datatype,string,dateTime:RFC3339,double,long
+#group,true,false,false,false
+#default,,,,7
+,host,_time,_value,n
+,a,2021-01-02T03:04:05Z,1.5,1
+,a,2021-01-02T03:04:06Z,2,
+`
+	want, err := annotatedcsv.ReadAll(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := NewTable().
+		Col("host", "string", true).
+		Col("_time", "dateTime:RFC3339", false).
+		Col("_value", "double", false).
+		Col("n", "long", false).Default(7).
+		Row("a", "2021-01-02T03:04:05Z", 1.5, 1).
+		Row("a", time.Date(2021, 1, 2, 3, 4, 6, 0, time.UTC), 2, nil).
+		Table()
+	if d := Diff(annotatedcsv.Tables{got}, want); d != "" {
+		t.Fatalf("unexpected difference:\n%s", d)
+	}
+}
+
+var builderErrorTests = []struct {
+	testName    string
+	build       func() *Builder
+	expectError string
+}{{
+	testName: "col-after-row",
+	build: func() *Builder {
+		return NewTable().Col("a", "long", false).Row(1).Col("b", "long", false)
+	},
+	expectError: `column "b" added after rows`,
+}, {
+	testName: "default-before-col",
+	build: func() *Builder {
+		return NewTable().Default(1)
+	},
+	expectError: `default set before any columns`,
+}, {
+	testName: "bad-default",
+	build: func() *Builder {
+		return NewTable().Col("a", "long", false).Default("x")
+	},
+	expectError: `bad default for column "a": .*`,
+}, {
+	testName: "wrong-row-length",
+	build: func() *Builder {
+		return NewTable().Col("a", "long", false).Row(1, 2)
+	},
+	expectError: `wrong number of values in row 0; got 2 want 1`,
+}, {
+	testName: "lossy-conversion",
+	build: func() *Builder {
+		return NewTable().Col("a", "long", false).Row(1.5)
+	},
+	expectError: `bad value for column "a" in row 0: cannot convert 1.5 of type float64 to datatype "long"`,
+}, {
+	testName: "time-in-long-column",
+	build: func() *Builder {
+		return NewTable().Col("a", "long", false).Row(time.Time{})
+	},
+	expectError: `bad value for column "a" in row 0: time value for datatype "long"`,
+}, {
+	testName: "slice-in-long-column",
+	build: func() *Builder {
+		return NewTable().Col("a", "long", false).Row([]int64{1})
+	},
+	expectError: `bad value for column "a" in row 0: slice value for datatype "long"`,
+}, {
+	testName: "json-in-string-column",
+	build: func() *Builder {
+		return NewTable().Col("a", "string", false).Row(map[string]interface{}{})
+	},
+	expectError: `bad value for column "a" in row 0: JSON value for datatype "string"`,
+}, {
+	testName: "first-error-wins",
+	build: func() *Builder {
+		return NewTable().Unit("s").Annotation("x", "y")
+	},
+	expectError: `unit set before any columns`,
+}}
+
+func TestBuilderErrors(t *testing.T) {
+	for _, test := range builderErrorTests {
+		t.Run(test.testName, func(t *testing.T) {
+			_, err := test.build().Build()
+			if err == nil {
+				t.Fatalf("no error; want %q", test.expectError)
+			}
+			if !regexp.MustCompile("^(" + test.expectError + ")$").MatchString(err.Error()) {
+				t.Fatalf("unexpected error; got %q want %q", err, test.expectError)
+			}
+		})
+	}
+}
+
+func TestBuilderUnitAndAnnotation(t *testing.T) {
+	tb := NewTable().
+		Col("a", "double", false).Unit("ms").Annotation("description", "latency").
+		Table()
+	col := tb.Columns[1]
+	if col.Unit != "ms" || col.Extra["description"] != "latency" {
+		t.Fatalf("unexpected column %#v", col)
+	}
+}
+
+var diffTests = []struct {
+	testName string
+	got      annotatedcsv.Tables
+	want     annotatedcsv.Tables
+	expect   string
+}{{
+	testName: "same",
+	got:      annotatedcsv.Tables{NewTable().Col("a", "long", false).Row(1).Table()},
+	want:     annotatedcsv.Tables{NewTable().Col("a", "long", false).Row(1).Table()},
+}, {
+	testName: "equal-times-in-different-zones",
+	got: annotatedcsv.Tables{NewTable().Col("t", "dateTime:RFC3339", false).
+		Row(time.Date(2021, 1, 1, 1, 0, 0, 0, time.FixedZone("", 3600))).Table()},
+	want: annotatedcsv.Tables{NewTable().Col("t", "dateTime:RFC3339", false).
+		Row(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)).Table()},
+}, {
+	testName: "value",
+	got:      annotatedcsv.Tables{NewTable().Col("a", "long", false).Col("b", "string", false).Row(1, "x").Row(2, "y").Table()},
+	want:     annotatedcsv.Tables{NewTable().Col("a", "long", false).Col("b", "string", false).Row(1, "x").Row(3, "z").Table()},
+	expect: `table 0: row 1: column "a": got 2 want 3; column "b": got "y" want "z"
+`,
+}, {
+	testName: "type-only",
+	got:      annotatedcsv.Tables{&annotatedcsv.Table{Columns: NewTable().Col("a", "long", false).Table().Columns, Rows: [][]interface{}{{nil, 1}}}},
+	want:     annotatedcsv.Tables{NewTable().Col("a", "long", false).Row(1).Table()},
+	expect: `table 0: row 0: column "a": got int(1) want 1
+`,
+}, {
+	// Rows are not compared when the schemas differ.
+	testName: "schema",
+	got:      annotatedcsv.Tables{NewTable().Col("a", "long", false).Row(1).Table()},
+	want:     annotatedcsv.Tables{NewTable().Col("a", "double", false).Row(2).Table()},
+	expect: `table 0: column "a": datatype changed from "double" to "long"
+`,
+}, {
+	testName: "rows",
+	got:      annotatedcsv.Tables{NewTable().Col("a", "long", false).Row(1).Table()},
+	want:     annotatedcsv.Tables{NewTable().Col("a", "long", false).Row(1).Row(nil).Table()},
+	expect: `table 0: row 1: missing row [nil]
+table 0: got 1 rows, want 2
+`,
+}, {
+	testName: "tables",
+	got: annotatedcsv.Tables{
+		NewTable().Col("a", "long", false).Table(),
+		NewTable().Col("a", "long", false).Row(1).Table(),
+	},
+	want: annotatedcsv.Tables{
+		NewTable().Col("a", "long", false).Table(),
+	},
+	expect: `got 2 tables, want 1
+table 1: unexpected table with 1 rows
+`,
+}}
+
+func TestDiff(t *testing.T) {
+	for _, test := range diffTests {
+		t.Run(test.testName, func(t *testing.T) {
+			if got := Diff(test.got, test.want); got != test.expect {
+				t.Fatalf("unexpected diff\ngot:\n%s\nwant:\n%s", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestDiffLimitsRows(t *testing.T) {
+	b := NewTable().Col("a", "long", false)
+	for i := 0; i < maxRowDiffs+5; i++ {
+		b.Row(i)
+	}
+	got := annotatedcsv.Tables{b.Table()}
+	want := annotatedcsv.Tables{NewTable().Col("a", "long", false).Table()}
+	lines := strings.Split(strings.TrimSuffix(Diff(got, want), "\n"), "\n")
+	if n := len(lines); n != maxRowDiffs+2 {
+		t.Fatalf("got %d lines of difference, want %d", n, maxRowDiffs+2)
+	}
+	if got, want := lines[maxRowDiffs], "table 0: ... more row differences omitted"; got != want {
+		t.Fatalf("unexpected line; got %q want %q", got, want)
+	}
+}
@@ -0,0 +1,148 @@
+package annotatedcsv
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// maxDecimalScale holds the largest magnitude of scale
+// allowed by ParseDecimal, to bound the length of the
+// decimal's string representation.
+const maxDecimalScale = 10000
+
+// Decimal is an arbitrary-precision decimal number, as returned by
+// the Reader for values of the decimal datatype. Its value is
+// Unscaled × 10^-Scale. The zero Decimal represents zero.
+type Decimal struct {
+	Unscaled *big.Int
+	Scale    int
+}
+
+// ParseDecimal parses s as a decimal number with an optional sign,
+// decimal point and exponent, for example "-12.50" or "1.5e-3". The
+// result keeps all the digits of s, so its String method returns
+// "-12.50" rather than "-12.5" for example.
+func ParseDecimal(s string) (Decimal, error) {
+	mantissa, exp := s, 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		mantissa = s[:i]
+		e, err := strconv.Atoi(s[i+1:])
+		if err != nil || e > maxDecimalScale || e < -maxDecimalScale {
+			return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+		}
+		exp = e
+	}
+	digits := strings.TrimLeft(mantissa, "+-")
+	if len(mantissa)-len(digits) > 1 {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	scale := 0
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		scale = len(digits) - i - 1
+		digits = digits[:i] + digits[i+1:]
+	}
+	if digits == "" || strings.TrimLeft(digits, "0123456789") != "" {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	scale -= exp
+	if scale > maxDecimalScale || scale < -maxDecimalScale {
+		return Decimal{}, fmt.Errorf("decimal %q out of range", s)
+	}
+	unscaled, _ := new(big.Int).SetString(digits, 10)
+	if strings.HasPrefix(mantissa, "-") {
+		unscaled.Neg(unscaled)
+	}
+	return Decimal{
+		Unscaled: unscaled,
+		Scale:    scale,
+	}, nil
+}
+
+// String returns d in decimal notation with
+// Scale digits after the decimal point.
+func (d Decimal) String() string {
+	digits := d.unscaled().String()
+	neg := strings.HasPrefix(digits, "-")
+	digits = strings.TrimPrefix(digits, "-")
+	switch {
+	case d.Scale < 0:
+		digits += strings.Repeat("0", -d.Scale)
+	case d.Scale > 0:
+		if n := d.Scale + 1 - len(digits); n > 0 {
+			digits = strings.Repeat("0", n) + digits
+		}
+		i := len(digits) - d.Scale
+		digits = digits[:i] + "." + digits[i:]
+	}
+	if neg {
+		return "-" + digits
+	}
+	return digits
+}
+
+// MarshalJSON implements json.Marshaler by encoding
+// d as a JSON number with all its digits.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// Rat returns the exact value of d as a rational number.
+func (d Decimal) Rat() *big.Rat {
+	r := new(big.Rat).SetInt(d.unscaled())
+	if d.Scale == 0 {
+		return r
+	}
+	scale := d.Scale
+	if scale < 0 {
+		scale = -scale
+	}
+	p := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil))
+	if d.Scale > 0 {
+		return r.Quo(r, p)
+	}
+	return r.Mul(r, p)
+}
+
+// Float64 returns the float64 value nearest to d.
+func (d Decimal) Float64() float64 {
+	x, _ := d.Rat().Float64()
+	return x
+}
+
+// Cmp returns -1, 0 or 1 according to whether d is
+// numerically less than, equal to or greater than d1.
+func (d Decimal) Cmp(d1 Decimal) int {
+	return d.Rat().Cmp(d1.Rat())
+}
+
+// add returns the exact sum of d and d1.
+func (d Decimal) add(d1 Decimal) Decimal {
+	x, y := d.unscaled(), d1.unscaled()
+	scale := d.Scale
+	switch {
+	case d.Scale < d1.Scale:
+		x = shiftDecimal(x, d1.Scale-d.Scale)
+		scale = d1.Scale
+	case d.Scale > d1.Scale:
+		y = shiftDecimal(y, d.Scale-d1.Scale)
+	}
+	return Decimal{
+		Unscaled: new(big.Int).Add(x, y),
+		Scale:    scale,
+	}
+}
+
+// shiftDecimal returns x × 10^n.
+func shiftDecimal(x *big.Int, n int) *big.Int {
+	p := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+	return p.Mul(p, x)
+}
+
+func (d Decimal) unscaled() *big.Int {
+	if d.Unscaled == nil {
+		return new(big.Int)
+	}
+	return d.Unscaled
+}
@@ -0,0 +1,42 @@
+package annotatedcsv
+
+import (
+	"fmt"
+	"strings"
+)
+
+// enumName returns the enumeration name of typ
+// and reports whether typ is an enum datatype.
+func enumName(typ string) (string, bool) {
+	name := strings.TrimPrefix(typ, "enum:")
+	return name, len(name) != len(typ) && name != ""
+}
+
+// SetEnum sets the allowed values of the enum datatype with the
+// given name, so that it is an error for a column of datatype
+// "enum:"+name to hold any other value. Values of enum datatypes are
+// strings. Enums without allowed values, the default, allow any
+// value. A nil values slice removes the enum's allowed values.
+func (r *Reader) SetEnum(name string, values []string) {
+	if values == nil {
+		delete(r.enums, name)
+		return
+	}
+	if r.enums == nil {
+		r.enums = make(map[string]map[string]bool)
+	}
+	allowed := make(map[string]bool)
+	for _, v := range values {
+		allowed[v] = true
+	}
+	r.enums[name] = allowed
+}
+
+// checkEnum returns an error if s is not an allowed
+// value of the enum with the given name.
+func (r *Reader) checkEnum(s, name string) error {
+	if allowed, ok := r.enums[name]; ok && !allowed[s] {
+		return fmt.Errorf("%q is not an allowed value of enum %q", s, name)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package annotatedcsv
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// epochDatatype is the datatype of times held as integer
+// counts of units since the Unix epoch. The unit is
+// nanoseconds unless set with Reader.SetEpochUnit or
+// Writer.SetEpochUnit.
+const epochDatatype = "dateTime:number"
+
+// checkEpochUnit panics if unit is not a valid epoch unit.
+func checkEpochUnit(unit time.Duration) {
+	switch unit {
+	case time.Second, time.Millisecond, time.Microsecond, time.Nanosecond:
+		return
+	}
+	panic(fmt.Errorf("annotatedcsv: invalid epoch unit %v", unit))
+}
+
+// parseEpoch parses s as an integer number of the
+// given units since the Unix epoch. A zero unit
+// means nanoseconds.
+func parseEpoch(s string, unit time.Duration) (time.Time, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if unit == 0 {
+		unit = time.Nanosecond
+	}
+	perSecond := int64(time.Second / unit)
+	return time.Unix(n/perSecond, n%perSecond*int64(unit)).UTC(), nil
+}
+
+// formatEpoch is the inverse of parseEpoch. Times
+// are rounded down to a whole number of units.
+func formatEpoch(t time.Time, unit time.Duration) (string, error) {
+	if unit == 0 {
+		unit = time.Nanosecond
+	}
+	perSecond := int64(time.Second / unit)
+	sec, frac := t.Unix(), int64(t.Nanosecond())/int64(unit)
+	if sec > (math.MaxInt64-frac)/perSecond || sec < math.MinInt64/perSecond {
+		return "", fmt.Errorf("time %v out of range for %s", t.Format(time.RFC3339Nano), epochDatatype)
+	}
+	return strconv.FormatInt(sec*perSecond+frac, 10), nil
+}
@@ -0,0 +1,582 @@
+package annotatedcsv
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Expr is a parsed filter expression, as used by the csvgrep
+// command. The expression syntax is:
+//
+//	expr = and { "||" and }
+//	and = unary { "&&" unary }
+//	unary = "!" unary | comparison
+//	comparison = operand [ op operand ]
+//	op = "==" | "!=" | "<" | "<=" | ">" | ">=" | "=~" | "!~"
+//	operand = column | string | number | "true" | "false" | "(" expr ")"
+//
+// A column is an identifier (letters, digits, '_', '.' and '-',
+// not starting with a digit or '-'), or any name enclosed in
+// square brackets. Strings are double-quoted with Go syntax.
+// Strings compared with dateTime columns are parsed as RFC3339
+// times; the right hand side of =~ and !~ is a regular expression.
+// Values of uuid, ip, cidr, json and list columns are compared as
+// they appear in annotated CSV.
+type Expr struct {
+	n node
+}
+
+// ParseExpr parses the given filter expression.
+func ParseExpr(s string) (*Expr, error) {
+	p := &parser{s: s}
+	p.next()
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok != "" {
+		return nil, fmt.Errorf("unexpected %q at end of expression", p.tok)
+	}
+	return &Expr{n}, nil
+}
+
+// Predicate returns a function that reports whether a row of a
+// table with the given columns matches the expression. Comparisons
+// use the column datatypes: for example, numeric columns are
+// compared as numbers and dateTime columns as times. It returns an
+// error if the expression compares values of incompatible types.
+//
+// A comparison involving a column that is not in the table, or a
+// cell with no value, is false, except for != and !~, which are
+// true.
+func (e *Expr) Predicate(cols []Column) (func(Row) bool, error) {
+	match, err := compile(e.n, cols)
+	if err != nil {
+		return nil, err
+	}
+	return func(row Row) bool {
+		return match(row.Values)
+	}, nil
+}
+
+// node is a node in the expression syntax tree.
+type node interface{}
+
+type binaryNode struct {
+	op   string
+	x, y node
+}
+
+type notNode struct {
+	x node
+}
+
+type columnNode struct {
+	name string
+}
+
+type literalNode struct {
+	// value holds a string, bool, int64, uint64, Decimal or float64.
+	value interface{}
+}
+
+type parser struct {
+	s string
+	// tok holds the current token, or "" at the end of input.
+	tok string
+	// kind holds the kind of the current token: "op",
+	// "column", "string" or "number".
+	kind string
+}
+
+func (p *parser) next() {
+	p.s = strings.TrimLeftFunc(p.s, unicode.IsSpace)
+	if p.s == "" {
+		p.tok, p.kind = "", ""
+		return
+	}
+	for _, op := range []string{"||", "&&", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "(", ")"} {
+		if strings.HasPrefix(p.s, op) {
+			p.tok, p.kind, p.s = op, "op", p.s[len(op):]
+			return
+		}
+	}
+	c := p.s[0]
+	var n int
+	switch {
+	case c == '"':
+		n = 1
+		for n < len(p.s) && p.s[n] != '"' {
+			if p.s[n] == '\\' {
+				n++
+			}
+			n++
+		}
+		n++
+		p.kind = "string"
+	case c == '[':
+		n = strings.IndexByte(p.s, ']') + 1
+		p.kind = "column"
+	case c >= '0' && c <= '9' || c == '-' || c == '.':
+		n = strings.IndexFunc(p.s, func(r rune) bool {
+			return !(r >= '0' && r <= '9' || r == '.' || r == 'e' || r == 'E' || r == '-' || r == '+' || r == 'x' || r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F')
+		})
+		p.kind = "number"
+	case isIdentChar(rune(c)):
+		n = strings.IndexFunc(p.s, func(r rune) bool {
+			return !isIdentChar(r)
+		})
+		p.kind = "column"
+	default:
+		n = 1
+		p.kind = "invalid"
+	}
+	if n <= 0 || n > len(p.s) {
+		n = len(p.s)
+	}
+	p.tok, p.s = p.s[:n], p.s[n:]
+}
+
+func isIdentChar(r rune) bool {
+	return r == '_' || r == '.' || r == '-' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func (p *parser) parseOr() (node, error) {
+	x, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == "||" {
+		p.next()
+		y, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		x = binaryNode{"||", x, y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == "&&" {
+		p.next()
+		y, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		x = binaryNode{"&&", x, y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.tok == "!" {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{x}, nil
+	}
+	x, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	switch op := p.tok; op {
+	case "==", "!=", "<", "<=", ">", ">=", "=~", "!~":
+		p.next()
+		y, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return binaryNode{op, x, y}, nil
+	}
+	return x, nil
+}
+
+func (p *parser) parseOperand() (node, error) {
+	tok, kind := p.tok, p.kind
+	if tok == "" {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	p.next()
+	switch kind {
+	case "op":
+		if tok != "(" {
+			return nil, fmt.Errorf("unexpected %q", tok)
+		}
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.next()
+		return x, nil
+	case "string":
+		s, err := strconv.Unquote(tok)
+		if err != nil {
+			return nil, fmt.Errorf("invalid string %s", tok)
+		}
+		return literalNode{s}, nil
+	case "number":
+		if x, err := strconv.ParseInt(tok, 0, 64); err == nil {
+			return literalNode{x}, nil
+		}
+		if x, err := strconv.ParseUint(tok, 0, 64); err == nil {
+			return literalNode{x}, nil
+		}
+		// Keep all the digits of other numbers
+		// so that they compare exactly with decimals.
+		if x, err := ParseDecimal(tok); err == nil {
+			return literalNode{x}, nil
+		}
+		x, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", tok)
+		}
+		return literalNode{x}, nil
+	case "column":
+		switch tok {
+		case "true":
+			return literalNode{true}, nil
+		case "false":
+			return literalNode{false}, nil
+		}
+		if strings.HasPrefix(tok, "[") {
+			tok = strings.TrimSuffix(strings.TrimPrefix(tok, "["), "]")
+		}
+		return columnNode{tok}, nil
+	}
+	return nil, fmt.Errorf("unexpected %q", tok)
+}
+
+// predicate evaluates an expression against rows of a table.
+type predicate func(row []interface{}) bool
+
+// operand evaluates an operand of a comparison.
+type operand func(row []interface{}) interface{}
+
+// compile returns a predicate that evaluates n against rows of a
+// table with the given columns, as described by Expr.Predicate.
+func compile(n node, cols []Column) (predicate, error) {
+	switch n := n.(type) {
+	case binaryNode:
+		switch n.op {
+		case "&&", "||":
+			x, err := compile(n.x, cols)
+			if err != nil {
+				return nil, err
+			}
+			y, err := compile(n.y, cols)
+			if err != nil {
+				return nil, err
+			}
+			if n.op == "&&" {
+				return func(row []interface{}) bool { return x(row) && y(row) }, nil
+			}
+			return func(row []interface{}) bool { return x(row) || y(row) }, nil
+		}
+		return compileComparison(n, cols)
+	case notNode:
+		x, err := compile(n.x, cols)
+		if err != nil {
+			return nil, err
+		}
+		return func(row []interface{}) bool { return !x(row) }, nil
+	case columnNode:
+		// A column on its own must be boolean.
+		return compileComparison(binaryNode{"==", n, literalNode{true}}, cols)
+	case literalNode:
+		b, ok := n.value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("non-boolean value %v used as condition", n.value)
+		}
+		return func([]interface{}) bool { return b }, nil
+	}
+	return nil, fmt.Errorf("unexpected expression node %T", n)
+}
+
+func compileComparison(n binaryNode, cols []Column) (predicate, error) {
+	if !isDecimalColumn(n.x, cols) && !isDecimalColumn(n.y, cols) {
+		// Exact comparison is only needed for decimal columns.
+		n.x, n.y = floatLiteral(n.x), floatLiteral(n.y)
+	}
+	x, xtype, err := compileOperand(n.x, cols)
+	if err != nil {
+		return nil, err
+	}
+	y, ytype, err := compileOperand(n.y, cols)
+	if err != nil {
+		return nil, err
+	}
+	negated := n.op == "!=" || n.op == "!~"
+	if xtype == "missing" || ytype == "missing" {
+		return func([]interface{}) bool { return negated }, nil
+	}
+	if n.op == "=~" || n.op == "!~" {
+		lit, ok := n.y.(literalNode)
+		pattern, isString := lit.value.(string)
+		if !ok || !isString {
+			return nil, fmt.Errorf("right hand side of %s must be a string", n.op)
+		}
+		if xtype != "string" {
+			return nil, fmt.Errorf("cannot match %s value against regular expression", xtype)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return func(row []interface{}) bool {
+			s, ok := x(row).(string)
+			if !ok {
+				return negated
+			}
+			return re.MatchString(s) != negated
+		}, nil
+	}
+	// Allow strings to be compared with times.
+	if xtype == "time" && ytype == "string" {
+		y, ytype, err = timeOperand(n.y)
+	} else if xtype == "string" && ytype == "time" {
+		x, xtype, err = timeOperand(n.x)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if xtype != ytype {
+		return nil, fmt.Errorf("cannot compare %s with %s", xtype, ytype)
+	}
+	if xtype == "bool" && n.op != "==" && n.op != "!=" {
+		return nil, fmt.Errorf("cannot use %s on boolean values", n.op)
+	}
+	op := n.op
+	return func(row []interface{}) bool {
+		c, ok := compareExprValues(x(row), y(row))
+		if !ok {
+			return negated
+		}
+		switch op {
+		case "==":
+			return c == 0
+		case "!=":
+			return c != 0
+		case "<":
+			return c < 0
+		case "<=":
+			return c <= 0
+		case ">":
+			return c > 0
+		}
+		return c >= 0
+	}, nil
+}
+
+// compileOperand returns a function that evaluates the operand n
+// and its type, one of "string", "number", "bool", "time" or
+// "missing".
+func compileOperand(n node, cols []Column) (operand, string, error) {
+	switch n := n.(type) {
+	case literalNode:
+		v := n.value
+		var typ string
+		switch v.(type) {
+		case string:
+			typ = "string"
+		case bool:
+			typ = "bool"
+		default:
+			typ = "number"
+		}
+		return func([]interface{}) interface{} { return v }, typ, nil
+	case columnNode:
+		for i, col := range cols {
+			if col.Name != n.name {
+				continue
+			}
+			if comparedAsText(col.Type) {
+				typ := col.Type
+				return func(row []interface{}) interface{} {
+					if row[i] == nil {
+						return nil
+					}
+					s, _ := formatValue(row[i], typ)
+					return s
+				}, "string", nil
+			}
+			if DatatypeKind(col.Type) == DoubleKind {
+				// The Reader represents infinities and NaN as strings.
+				return func(row []interface{}) interface{} {
+					if s, ok := row[i].(string); ok {
+						return floatValue(s)
+					}
+					return row[i]
+				}, "number", nil
+			}
+			return func(row []interface{}) interface{} { return row[i] }, exprType(col.Type), nil
+		}
+		return nil, "missing", nil
+	}
+	return nil, "", fmt.Errorf("comparison operands must be columns or literal values")
+}
+
+// isDecimalColumn reports whether n refers
+// to a column of datatype decimal.
+func isDecimalColumn(n node, cols []Column) bool {
+	if n, ok := n.(columnNode); ok {
+		for _, col := range cols {
+			if col.Name == n.name {
+				return col.Type == "decimal"
+			}
+		}
+	}
+	return false
+}
+
+// floatLiteral returns n with any decimal
+// literal value converted to float64.
+func floatLiteral(n node) node {
+	if lit, ok := n.(literalNode); ok {
+		if d, ok := lit.value.(Decimal); ok {
+			return literalNode{d.Float64()}
+		}
+	}
+	return n
+}
+
+// comparedAsText reports whether values of the given
+// datatype are compared as they appear in annotated CSV.
+func comparedAsText(datatype string) bool {
+	switch DatatypeKind(datatype) {
+	case UUIDKind, IPKind, CIDRKind, JSONKind, ListKind:
+		return true
+	}
+	return false
+}
+
+// timeOperand returns a time operand for a string literal.
+func timeOperand(n node) (operand, string, error) {
+	lit, ok := n.(literalNode)
+	if !ok {
+		return nil, "", fmt.Errorf("cannot compare string column with time")
+	}
+	t, err := time.Parse(time.RFC3339Nano, lit.value.(string))
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid time: %v", err)
+	}
+	return func([]interface{}) interface{} { return t }, "time", nil
+}
+
+// exprType returns the expression type for the given datatype.
+func exprType(datatype string) string {
+	switch DatatypeKind(datatype) {
+	case BooleanKind:
+		return "bool"
+	case LongKind, UnsignedLongKind, DoubleKind, DecimalKind:
+		return "number"
+	case DateTimeKind:
+		return "time"
+	}
+	return "string"
+}
+
+// compareExprValues compares x and y, which must be of the same
+// expression type. It reports false if the values cannot be
+// compared, such as when either is nil or a NaN.
+func compareExprValues(x, y interface{}) (int, bool) {
+	switch x := x.(type) {
+	case string:
+		y, ok := y.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(x, y), true
+	case bool:
+		y, ok := y.(bool)
+		if !ok {
+			return 0, false
+		}
+		if x == y {
+			return 0, true
+		}
+		return 1, true
+	case time.Time:
+		y, ok := y.(time.Time)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x.Before(y):
+			return -1, true
+		case x.After(y):
+			return 1, true
+		}
+		return 0, true
+	}
+	// Compare decimals exactly unless compared with doubles.
+	_, xdec := x.(Decimal)
+	_, ydec := y.(Decimal)
+	if xdec || ydec {
+		xr, ok1 := exactRat(x)
+		yr, ok2 := exactRat(y)
+		if ok1 && ok2 {
+			return xr.Cmp(yr), true
+		}
+	}
+	// Compare integers of the same type exactly.
+	switch x := x.(type) {
+	case int64:
+		if y, ok := y.(int64); ok {
+			return compareOrdered(x < y, x > y), true
+		}
+	case uint64:
+		if y, ok := y.(uint64); ok {
+			return compareOrdered(x < y, x > y), true
+		}
+	}
+	xf, ok1 := toFloat(x)
+	yf, ok2 := toFloat(y)
+	if !ok1 || !ok2 || math.IsNaN(xf) || math.IsNaN(yf) {
+		return 0, false
+	}
+	return compareOrdered(xf < yf, xf > yf), true
+}
+
+// exactRat returns the exact value of v if v is a decimal
+// or an integer.
+func exactRat(v interface{}) (*big.Rat, bool) {
+	switch v := v.(type) {
+	case Decimal:
+		return v.Rat(), true
+	case int64:
+		return new(big.Rat).SetInt64(v), true
+	case uint64:
+		return new(big.Rat).SetInt(new(big.Int).SetUint64(v)), true
+	}
+	return nil, false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case Decimal:
+		return v.Float64(), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
@@ -0,0 +1,136 @@
+package annotatedcsv
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const exprTestData = `#datatype,string,long,unsignedLong,double,decimal,dateTime:RFC3339,boolean,ip,string
+#group,false,false,false,false,false,false,false,false,false
+#default,,,,,,,,,
+,s,n,u,d,dec,t,b,ip,odd name
+,apple,1,1,1.5,1.10,2021-01-01T00:00:00Z,true,10.0.0.1,x
+,Banana,-5,18446744073709551615,+Inf,,2021-06-01T00:00:00Z,false,,
+,"a""quote",,,NaN,0.3,,,192.168.0.1,y
+`
+
+var exprTests = []struct {
+	expr        string
+	expectRows  []int
+	expectError string
+}{
+	// Precedence.
+	{expr: `n == 1 || n == -5 && s == "x"`, expectRows: []int{0}},
+	{expr: `(n == 1 || n == -5) && s =~ "^B"`, expectRows: []int{1}},
+	{expr: `!b && n == -5`, expectRows: []int{1}},
+	{expr: `!(n == 1 || n == -5)`, expectRows: []int{2}},
+	{expr: `!!b`, expectRows: []int{0}},
+	{expr: `true || n == 1 && false`, expectRows: []int{0, 1, 2}},
+
+	// Strings and column names.
+	{expr: `s == "a\"quote"`, expectRows: []int{2}},
+	{expr: `s == "apple"`, expectRows: []int{0}},
+	{expr: `s != "apple"`, expectRows: []int{1, 2}},
+	{expr: `[odd name] == "x"`, expectRows: []int{0}},
+	{expr: `s < "b"`, expectRows: []int{0, 1, 2}},
+	{expr: `s < "a"`, expectRows: []int{1}},
+
+	// Numbers.
+	{expr: `n > -10`, expectRows: []int{0, 1}},
+	{expr: `n <= 0`, expectRows: []int{1}},
+	{expr: `n != 1`, expectRows: []int{1, 2}},
+	{expr: `n == 0x1`, expectRows: []int{0}},
+	{expr: `u > 9223372036854775807`, expectRows: []int{1}},
+	{expr: `u == 18446744073709551615`, expectRows: []int{1}},
+	{expr: `u == 18446744073709551614`, expectRows: nil},
+	{expr: `d > 1`, expectRows: []int{0, 1}},
+	{expr: `d < 2`, expectRows: []int{0}},
+	{expr: `d >= 1.5e0`, expectRows: []int{0, 1}},
+	{expr: `d == 1e400`, expectRows: []int{1}},
+	{expr: `d != 1.5`, expectRows: []int{1, 2}},
+	{expr: `dec == 1.1`, expectRows: []int{0}},
+	{expr: `dec > 0.29999999999999999`, expectRows: []int{0, 2}},
+	{expr: `dec < n`, expectRows: nil},
+
+	// Times.
+	{expr: `t >= "2021-06-01T00:00:00Z"`, expectRows: []int{1}},
+	{expr: `t < "2021-03-01T00:00:00+01:00"`, expectRows: []int{0}},
+	{expr: `"2021-03-01T00:00:00Z" < t`, expectRows: []int{1}},
+	{expr: `t != "2021-01-01T00:00:00Z"`, expectRows: []int{1, 2}},
+
+	// Booleans.
+	{expr: `b`, expectRows: []int{0}},
+	{expr: `b == false`, expectRows: []int{1}},
+	{expr: `!b`, expectRows: []int{1, 2}},
+
+	// Nulls and missing columns.
+	{expr: `ip == "10.0.0.1"`, expectRows: []int{0}},
+	{expr: `ip != "10.0.0.1"`, expectRows: []int{1, 2}},
+	{expr: `nosuch == 1`, expectRows: nil},
+	{expr: `nosuch != 1`, expectRows: []int{0, 1, 2}},
+
+	// Regular expressions.
+	{expr: `s =~ "^[ab]"`, expectRows: []int{0, 2}},
+	{expr: `s =~ "(?i)^b"`, expectRows: []int{1}},
+	{expr: `s !~ "an"`, expectRows: []int{0, 2}},
+	{expr: `ip =~ "^1"`, expectRows: []int{0, 2}},
+	{expr: `ip !~ "^10\\."`, expectRows: []int{1, 2}},
+
+	// Parse errors.
+	{expr: ``, expectError: `unexpected end of expression`},
+	{expr: `n ==`, expectError: `unexpected end of expression`},
+	{expr: `(n == 1`, expectError: `missing closing parenthesis`},
+	{expr: `n == 1)`, expectError: `unexpected "\)" at end of expression`},
+	{expr: `n == 1 2`, expectError: `unexpected "2" at end of expression`},
+	{expr: `s == "abc`, expectError: `invalid string "abc`},
+	{expr: `s == "\q"`, expectError: `invalid string "\\q"`},
+	{expr: `n == 1x`, expectError: `invalid number "1x"`},
+	{expr: `n @ 1`, expectError: `unexpected "@" at end of expression`},
+	{expr: `== 1`, expectError: `unexpected "=="`},
+	{expr: `n == 1 == 2`, expectError: `unexpected "==" at end of expression`},
+
+	// Type errors.
+	{expr: `n == "x"`, expectError: `cannot compare number with string`},
+	{expr: `b < true`, expectError: `cannot use < on boolean values`},
+	{expr: `n =~ "1"`, expectError: `cannot match number value against regular expression`},
+	{expr: `s =~ n`, expectError: `right hand side of =~ must be a string`},
+	{expr: `s =~ "("`, expectError: `error parsing regexp: .*`},
+	{expr: `t > "yesterday"`, expectError: `invalid time: .*`},
+	{expr: `t > s`, expectError: `cannot compare string column with time`},
+	{expr: `n`, expectError: `cannot compare number with bool`},
+	{expr: `1`, expectError: `non-boolean value 1 used as condition`},
+}
+
+func TestExpr(t *testing.T) {
+	tables, err := ReadAll(strings.NewReader(exprTestData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := tables[0]
+	for _, test := range exprTests {
+		t.Run(test.expr, func(t *testing.T) {
+			e, err := ParseExpr(test.expr)
+			var match func(Row) bool
+			if err == nil {
+				match, err = e.Predicate(table.Columns)
+			}
+			if test.expectError != "" {
+				assertErrorMatches(t, err, test.expectError)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var rows []int
+			for i, row := range table.Rows {
+				if match(Row{Columns: table.Columns, Values: row}) {
+					rows = append(rows, i)
+				}
+			}
+			if !reflect.DeepEqual(rows, test.expectRows) {
+				t.Fatalf("unexpected matching rows; got %v want %v", rows, test.expectRows)
+			}
+		})
+	}
+}
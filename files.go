@@ -0,0 +1,189 @@
+package annotatedcsv
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// FileReader reads the tables from a sequence of files, such as
+// the chunks of a large export, parsing several files in parallel.
+// The tables are returned in order: all the tables from the first
+// file, then all those from the second, and so on.
+type FileReader struct {
+	files     []string
+	workers   int
+	open      func(name string) (io.ReadCloser, error)
+	configure func(r *Reader)
+
+	started bool
+	// results holds the result of reading each file.
+	results []chan fileResult
+	// sem holds a token for each file being read or
+	// waiting to be returned.
+	sem       chan struct{}
+	stop      chan struct{}
+	closeOnce sync.Once
+
+	index  int
+	file   string
+	tables []*Table
+	table  *Table
+	err    error
+}
+
+// FileError holds an error encountered when reading a file
+// with a FileReader.
+type FileError struct {
+	File string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%s: %v", e.File, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+type fileResult struct {
+	tables []*Table
+	err    error
+}
+
+// NewFileReader returns a FileReader that reads the given files,
+// parsing up to the given number of them at once. Each file is held
+// in memory between being parsed and all its tables being returned.
+func NewFileReader(files []string, workers int) *FileReader {
+	if workers < 1 {
+		workers = 1
+	}
+	return &FileReader{
+		files:   files,
+		workers: workers,
+		open: func(name string) (io.ReadCloser, error) {
+			return os.Open(name)
+		},
+	}
+}
+
+// SetOpen sets the function used to open each file.
+// By default, os.Open is used.
+// It must be called before the first call to Next.
+func (fr *FileReader) SetOpen(open func(name string) (io.ReadCloser, error)) {
+	fr.open = open
+}
+
+// SetConfigure sets a function that is called with the Reader
+// for each file before any tables are read from it, so that it
+// can be configured, for example with SetEmptyCells.
+// It must be called before the first call to Next and
+// may be called concurrently.
+func (fr *FileReader) SetConfigure(configure func(r *Reader)) {
+	fr.configure = configure
+}
+
+// Next advances to the next table and reports whether there is one.
+// When it returns false, the FileReader is closed.
+func (fr *FileReader) Next() bool {
+	if fr.err != nil {
+		return false
+	}
+	if !fr.started {
+		fr.start()
+	}
+	for len(fr.tables) == 0 {
+		if fr.index >= len(fr.files) {
+			fr.table = nil
+			fr.Close()
+			return false
+		}
+		res := <-fr.results[fr.index]
+		<-fr.sem
+		if res.err != nil {
+			fr.err = &FileError{
+				File: fr.files[fr.index],
+				Err:  res.err,
+			}
+			fr.table = nil
+			fr.Close()
+			return false
+		}
+		fr.file = fr.files[fr.index]
+		fr.tables = res.tables
+		fr.index++
+	}
+	fr.table = fr.tables[0]
+	fr.tables[0] = nil
+	fr.tables = fr.tables[1:]
+	return true
+}
+
+// Table returns the current table.
+func (fr *FileReader) Table() *Table {
+	return fr.table
+}
+
+// File returns the name of the file holding the current table.
+func (fr *FileReader) File() string {
+	return fr.file
+}
+
+// Err returns any error encountered when reading,
+// which is a *FileError.
+func (fr *FileReader) Err() error {
+	return fr.err
+}
+
+// Close stops any parsing still in progress. It should be
+// called if the FileReader is abandoned before Next
+// returns false.
+func (fr *FileReader) Close() {
+	if !fr.started {
+		return
+	}
+	fr.closeOnce.Do(func() {
+		close(fr.stop)
+	})
+}
+
+func (fr *FileReader) start() {
+	fr.started = true
+	fr.results = make([]chan fileResult, len(fr.files))
+	for i := range fr.results {
+		fr.results[i] = make(chan fileResult, 1)
+	}
+	fr.sem = make(chan struct{}, fr.workers)
+	fr.stop = make(chan struct{})
+	go func() {
+		for i, file := range fr.files {
+			// Files are started in order, so the file that Next
+			// is waiting for always gets a token.
+			select {
+			case fr.sem <- struct{}{}:
+			case <-fr.stop:
+				return
+			}
+			go func(i int, file string) {
+				tables, err := fr.readFile(file)
+				fr.results[i] <- fileResult{tables, err}
+			}(i, file)
+		}
+	}()
+}
+
+func (fr *FileReader) readFile(file string) (Tables, error) {
+	f, err := fr.open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := NewReader(f)
+	if fr.configure != nil {
+		fr.configure(r)
+	}
+	return r.ReadAll()
+}
@@ -0,0 +1,104 @@
+package annotatedcsv
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// TableError holds an error returned by the function
+// passed to ForEachTable.
+type TableError struct {
+	// Index holds the index of the table in the input,
+	// starting from zero.
+	Index int
+	Err   error
+}
+
+func (e *TableError) Error() string {
+	return fmt.Sprintf("table %d: %v", e.Index, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *TableError) Unwrap() error {
+	return e.Err
+}
+
+// Errors holds several errors.
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ForEachTable reads all the remaining tables from r and calls f with
+// each one. Tables are read sequentially, but f is called concurrently
+// by up to the given number of workers, so it may be called with a
+// table before it has returned for earlier ones. At most one table
+// beyond those being processed is held in memory at once.
+//
+// A failing call does not stop the others. If any calls fail or
+// reading fails, ForEachTable returns an Errors value holding a
+// *TableError for each failed call, in table order, followed by any
+// error from r.
+func ForEachTable(r *Reader, workers int, f func(t *Table) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+	type job struct {
+		index int
+		t     *Table
+	}
+	jobs := make(chan job)
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs Errors
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if err := f(j.t); err != nil {
+					mu.Lock()
+					errs = append(errs, &TableError{
+						Index: j.index,
+						Err:   err,
+					})
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for index := 0; r.NextTable(); index++ {
+		t := &Table{
+			Columns: r.Columns(),
+		}
+		for r.NextRow() {
+			t.Rows = append(t.Rows, r.Row())
+		}
+		if r.Err() != nil {
+			// Don't process a partially read table.
+			break
+		}
+		jobs <- job{index, t}
+	}
+	close(jobs)
+	wg.Wait()
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].(*TableError).Index < errs[j].(*TableError).Index
+	})
+	if err := r.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
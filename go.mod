@@ -1,3 +1,9 @@
 module github.com/rogpeppe/annotatedcsv
 
-go 1.16
+go 1.18
+
+require (
+	github.com/golang/snappy v0.0.4
+	github.com/mattn/go-sqlite3 v1.14.33
+	gopkg.in/yaml.v3 v3.0.1
+)
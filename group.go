@@ -0,0 +1,613 @@
+package annotatedcsv
+
+import (
+	"fmt"
+	"math"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tables holds a sequence of tables.
+type Tables []*Table
+
+// GroupBy groups the rows of all the tables by the values of the
+// given columns, which form the group key. A row from a table
+// without one of the columns has a nil value for it. The columns
+// must have the same datatype in all the tables that have them.
+func (ts Tables) GroupBy(cols ...string) *Grouping {
+	g := &Grouping{
+		tables:  ts,
+		keyCols: make([]Column, len(cols)),
+	}
+	for i, name := range cols {
+		g.keyCols[i] = Column{
+			Name:  name,
+			Group: true,
+		}
+	}
+	typeFound := make([]bool, len(cols))
+	groupIndex := make(map[string]int)
+	var keyBuf strings.Builder
+	for _, t := range ts {
+		indexes := make([]int, len(cols))
+		for i, name := range cols {
+			indexes[i] = t.columnIndex(name)
+			if indexes[i] < 0 {
+				continue
+			}
+			typ := t.Columns[indexes[i]].Type
+			if !typeFound[i] {
+				g.keyCols[i].Type = typ
+				typeFound[i] = true
+			} else if typ != g.keyCols[i].Type {
+				g.err = fmt.Errorf("column %q has inconsistent datatypes %q and %q", name, g.keyCols[i].Type, typ)
+				return g
+			}
+		}
+		for _, row := range t.Rows {
+			key := make([]interface{}, len(cols))
+			keyBuf.Reset()
+			for i, j := range indexes {
+				if j >= 0 {
+					key[i] = row[j]
+				}
+				appendKeyValue(&keyBuf, key[i])
+			}
+			gi, ok := groupIndex[keyBuf.String()]
+			if !ok {
+				gi = len(g.groups)
+				groupIndex[keyBuf.String()] = gi
+				g.groups = append(g.groups, &group{
+					key: key,
+				})
+			}
+			g.groups[gi].add(t, row)
+		}
+	}
+	return g
+}
+
+// appendKeyValue appends a representation of a group key value
+// to b that distinguishes it from any other value.
+func appendKeyValue(b *strings.Builder, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		b.WriteString("n,")
+	case time.Time:
+		b.WriteString("t")
+		b.WriteString(v.UTC().Format(time.RFC3339Nano))
+		b.WriteString(",")
+	case Decimal:
+		// Numerically equal decimals may have different scales.
+		b.WriteString("d")
+		b.WriteString(v.Rat().RatString())
+		b.WriteString(",")
+	default:
+		fmt.Fprintf(b, "%T%q,", v, fmt.Sprint(v))
+	}
+}
+
+// Grouping holds rows grouped by the values of their group key.
+type Grouping struct {
+	tables  Tables
+	keyCols []Column
+	// groups holds the groups in order of their first row.
+	groups []*group
+	// window is non-nil if the rows are
+	// to be aggregated over time windows.
+	window *windowing
+	err    error
+}
+
+type group struct {
+	key []interface{}
+	// parts holds the rows in the group, divided
+	// into runs of rows from the same table.
+	parts []groupPart
+}
+
+type groupPart struct {
+	table *Table
+	rows  [][]interface{}
+}
+
+func (g *group) add(t *Table, row []interface{}) {
+	if n := len(g.parts); n > 0 && g.parts[n-1].table == t {
+		g.parts[n-1].rows = append(g.parts[n-1].rows, row)
+		return
+	}
+	g.parts = append(g.parts, groupPart{
+		table: t,
+		rows:  [][]interface{}{row},
+	})
+}
+
+// Aggregate returns a table for each group, in order of the first
+// row of each group. Each table holds the group key followed by a
+// value computed by each of the given aggregators. There is a
+// single row, or, if the grouping was made by Tables.Window, a row
+// for each window.
+func (g *Grouping) Aggregate(aggs ...Aggregator) (Tables, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+	cols := make([]Column, 0, 4+len(g.keyCols)+len(aggs))
+	// The first column holds the annotation names.
+	cols = append(cols, Column{})
+	cols = append(cols, g.keyCols...)
+	if g.window != nil {
+		typ, err := g.tables.columnType(g.window.Column)
+		if err != nil {
+			return nil, err
+		}
+		if DatatypeKind(typ) != DateTimeKind {
+			return nil, fmt.Errorf("cannot window by column %q of datatype %q", g.window.Column, typ)
+		}
+		for _, name := range []string{"_start", "_stop", g.window.Column} {
+			cols = append(cols, Column{
+				Name: name,
+				Type: "dateTime:RFC3339Nano",
+			})
+		}
+	}
+	names := make(map[string]bool)
+	for _, col := range cols[1:] {
+		names[col.Name] = true
+	}
+	inTypes := make([]string, len(aggs))
+	for i, agg := range aggs {
+		if names[agg.name] {
+			return nil, fmt.Errorf("duplicate result column %q", agg.name)
+		}
+		names[agg.name] = true
+		if agg.column != "" {
+			typ, err := g.tables.columnType(agg.column)
+			if err != nil {
+				return nil, err
+			}
+			inTypes[i] = typ
+		}
+		typ, err := agg.resultType(inTypes[i])
+		if err != nil {
+			return nil, fmt.Errorf("cannot compute %s of column %q: %v", agg.kind, agg.column, err)
+		}
+		cols = append(cols, Column{
+			Name: agg.name,
+			Type: typ,
+		})
+	}
+	aggregate := func(parts []groupPart) []interface{} {
+		vals := make([]interface{}, len(aggs))
+		for i, agg := range aggs {
+			a := agg.newAggregation(inTypes[i])
+			for _, part := range parts {
+				j := -1
+				if agg.column != "" {
+					if j = part.table.columnIndex(agg.column); j < 0 {
+						continue
+					}
+				}
+				for _, r := range part.rows {
+					if j < 0 {
+						a.add(nil)
+					} else {
+						a.add(r[j])
+					}
+				}
+			}
+			vals[i] = a.result()
+		}
+		return vals
+	}
+	result := make(Tables, len(g.groups))
+	for gi, grp := range g.groups {
+		t := &Table{
+			Columns: append([]Column(nil), cols...),
+		}
+		if g.window == nil {
+			row := make([]interface{}, 0, len(cols))
+			row = append(row, nil)
+			row = append(row, grp.key...)
+			t.Rows = [][]interface{}{append(row, aggregate(grp.parts)...)}
+		} else {
+			t.Rows = g.window.aggregate(grp, aggregate)
+		}
+		result[gi] = t
+	}
+	return result, nil
+}
+
+// columnType returns the datatype of the named column,
+// which must have the same datatype in all the tables
+// that have it.
+func (ts Tables) columnType(name string) (string, error) {
+	typ, found := "", false
+	for _, t := range ts {
+		i := t.columnIndex(name)
+		if i < 0 {
+			continue
+		}
+		if !found {
+			typ, found = t.Columns[i].Type, true
+		} else if t.Columns[i].Type != typ {
+			return "", fmt.Errorf("column %q has inconsistent datatypes %q and %q", name, typ, t.Columns[i].Type)
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("no column %q", name)
+	}
+	return typ, nil
+}
+
+// Aggregator computes a value from the rows in each group.
+// Aggregators are created by functions such as Sum and Count.
+type Aggregator struct {
+	kind   string
+	name   string
+	column string
+	// resultType returns the datatype of the result
+	// for an input column of the given datatype.
+	resultType func(typ string) (string, error)
+	// newAggregation returns a new aggregation for
+	// an input column of the given datatype.
+	newAggregation func(typ string) aggregation
+}
+
+// As returns a copy of a that gives its result
+// column the given name.
+func (a Aggregator) As(name string) Aggregator {
+	a.name = name
+	return a
+}
+
+type aggregation interface {
+	// add adds a value from a row in the group.
+	// Values in rows without the input column are nil.
+	add(v interface{})
+	result() interface{}
+}
+
+// Count returns an Aggregator that counts the rows in each group.
+// Its result column is named "count" and has the datatype long.
+func Count() Aggregator {
+	return Aggregator{
+		kind: "count",
+		name: "count",
+		resultType: func(string) (string, error) {
+			return "long", nil
+		},
+		newAggregation: func(string) aggregation {
+			return new(countAggregation)
+		},
+	}
+}
+
+type countAggregation int64
+
+func (a *countAggregation) add(interface{}) {
+	*a++
+}
+
+func (a *countAggregation) result() interface{} {
+	return int64(*a)
+}
+
+// Sum returns an Aggregator that sums the non-nil values of the
+// given numeric column. Its result column has the same name and
+// datatype as the input column, and is nil if there are no values.
+func Sum(column string) Aggregator {
+	return Aggregator{
+		kind:       "sum",
+		name:       column,
+		column:     column,
+		resultType: numericType,
+		newAggregation: func(typ string) aggregation {
+			return &sumAggregation{typ: typ}
+		},
+	}
+}
+
+type sumAggregation struct {
+	typ   string
+	found bool
+	i     int64
+	u     uint64
+	f     float64
+	d     Decimal
+}
+
+func (a *sumAggregation) add(v interface{}) {
+	switch v := v.(type) {
+	case int64:
+		a.i += v
+	case uint64:
+		a.u += v
+	case Decimal:
+		a.d = a.d.add(v)
+	case nil:
+		return
+	default:
+		a.f += floatValue(v)
+	}
+	a.found = true
+}
+
+func (a *sumAggregation) result() interface{} {
+	if !a.found {
+		return nil
+	}
+	switch a.typ {
+	case "long":
+		return a.i
+	case "unsignedLong":
+		return a.u
+	case "decimal":
+		return a.d
+	}
+	return doubleValue(a.f)
+}
+
+// Mean returns an Aggregator that computes the mean of the non-nil
+// values of the given numeric column. Its result column has the
+// same name as the input column and the datatype double, and is
+// nil if there are no values.
+func Mean(column string) Aggregator {
+	return Aggregator{
+		kind:   "mean",
+		name:   column,
+		column: column,
+		resultType: func(typ string) (string, error) {
+			if _, err := numericType(typ); err != nil {
+				return "", err
+			}
+			return "double", nil
+		},
+		newAggregation: func(string) aggregation {
+			return new(meanAggregation)
+		},
+	}
+}
+
+type meanAggregation struct {
+	n   int
+	sum float64
+}
+
+func (a *meanAggregation) add(v interface{}) {
+	if v != nil {
+		a.n++
+		a.sum += floatValue(v)
+	}
+}
+
+func (a *meanAggregation) result() interface{} {
+	if a.n == 0 {
+		return nil
+	}
+	return doubleValue(a.sum / float64(a.n))
+}
+
+// Min returns an Aggregator that finds the smallest non-nil value
+// of the given column, which must be numeric, a string or a time.
+// Its result column has the same name and datatype as the input
+// column, and is nil if there are no values. NaN values are
+// ignored.
+func Min(column string) Aggregator {
+	return extremeAggregator("min", column, -1)
+}
+
+// Max is like Min but finds the largest value.
+func Max(column string) Aggregator {
+	return extremeAggregator("max", column, 1)
+}
+
+// First returns an Aggregator that finds the first non-nil value of
+// the given column in each group, in row order. Its result column
+// has the same name and datatype as the input column, and is nil
+// if there are no values.
+func First(column string) Aggregator {
+	return selectorAggregator("first", column, false)
+}
+
+// Last is like First but finds the last value.
+func Last(column string) Aggregator {
+	return selectorAggregator("last", column, true)
+}
+
+func selectorAggregator(kind, column string, last bool) Aggregator {
+	return Aggregator{
+		kind:   kind,
+		name:   column,
+		column: column,
+		resultType: func(typ string) (string, error) {
+			return typ, nil
+		},
+		newAggregation: func(string) aggregation {
+			return &selectorAggregation{last: last}
+		},
+	}
+}
+
+type selectorAggregation struct {
+	last bool
+	v    interface{}
+}
+
+func (a *selectorAggregation) add(v interface{}) {
+	if v != nil && (a.v == nil || a.last) {
+		a.v = v
+	}
+}
+
+func (a *selectorAggregation) result() interface{} {
+	return a.v
+}
+
+func extremeAggregator(kind, column string, sign int) Aggregator {
+	return Aggregator{
+		kind:   kind,
+		name:   column,
+		column: column,
+		resultType: func(typ string) (string, error) {
+			switch DatatypeKind(typ) {
+			case StringKind, DateTimeKind:
+				return typ, nil
+			}
+			return numericType(typ)
+		},
+		newAggregation: func(typ string) aggregation {
+			return &extremeAggregation{
+				sign: sign,
+				typ:  typ,
+			}
+		},
+	}
+}
+
+type extremeAggregation struct {
+	// sign is -1 to find the minimum and 1 to find the maximum.
+	sign int
+	typ  string
+	v    interface{}
+}
+
+func (a *extremeAggregation) add(v interface{}) {
+	if v == nil {
+		return
+	}
+	switch v := v.(type) {
+	case string:
+		if a.typ == "double" && isNaN(v) {
+			return
+		}
+	case float64:
+		if math.IsNaN(v) {
+			return
+		}
+	}
+	if a.v == nil || CompareValues(v, a.v, a.typ)*a.sign > 0 {
+		a.v = v
+	}
+}
+
+func (a *extremeAggregation) result() interface{} {
+	return a.v
+}
+
+// CompareValues returns -1, 0 or 1 according to whether a is
+// less than, equal to or greater than b, which are values from a
+// column of the given datatype as returned by the Reader. Nil
+// values sort before all others, and NaN before all other doubles.
+// Values of unexpected types compare as their string forms.
+func CompareValues(a, b interface{}, typ string) int {
+	switch {
+	case a == nil || b == nil:
+		return compareOrdered(a == nil && b != nil, a != nil && b == nil)
+	case DatatypeKind(typ) == DoubleKind:
+		// Values may be float64 or strings
+		// holding infinities or NaN.
+		return compareFloats(floatValue(a), floatValue(b))
+	}
+	switch a := a.(type) {
+	case int64:
+		if b, ok := b.(int64); ok {
+			return compareOrdered(a < b, a > b)
+		}
+	case uint64:
+		if b, ok := b.(uint64); ok {
+			return compareOrdered(a < b, a > b)
+		}
+	case float64:
+		if b, ok := b.(float64); ok {
+			return compareFloats(a, b)
+		}
+	case bool:
+		if b, ok := b.(bool); ok {
+			return compareOrdered(!a && b, a && !b)
+		}
+	case Decimal:
+		if b, ok := b.(Decimal); ok {
+			return a.Cmp(b)
+		}
+	case time.Time:
+		if b, ok := b.(time.Time); ok {
+			return compareOrdered(a.Before(b), a.After(b))
+		}
+	case netip.Addr:
+		if b, ok := b.(netip.Addr); ok {
+			return a.Compare(b)
+		}
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b)
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func compareFloats(x, y float64) int {
+	if xNaN, yNaN := math.IsNaN(x), math.IsNaN(y); xNaN || yNaN {
+		return compareOrdered(xNaN && !yNaN, !xNaN && yNaN)
+	}
+	return compareOrdered(x < y, x > y)
+}
+
+func compareOrdered(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+// numericType returns typ if it is a numeric datatype.
+func numericType(typ string) (string, error) {
+	switch DatatypeKind(typ) {
+	case LongKind, UnsignedLongKind, DoubleKind, DecimalKind:
+		return typ, nil
+	}
+	return "", fmt.Errorf("datatype %q is not numeric", typ)
+}
+
+// floatValue returns the value of v, which must be
+// a numeric value or a string holding a non-finite double.
+func floatValue(v interface{}) float64 {
+	switch v := v.(type) {
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float64:
+		return v
+	case Decimal:
+		return v.Float64()
+	case string:
+		x, _ := strconv.ParseFloat(v, 64)
+		return x
+	}
+	return math.NaN()
+}
+
+// doubleValue returns x as the Reader represents
+// values of datatype double.
+func doubleValue(x float64) interface{} {
+	if math.IsInf(x, 0) || math.IsNaN(x) {
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	}
+	return x
+}
+
+// isNonFinite reports whether s holds an infinity or NaN.
+func isNonFinite(s string) bool {
+	x, err := strconv.ParseFloat(s, 64)
+	return err == nil && (math.IsInf(x, 0) || math.IsNaN(x))
+}
+
+func isNaN(s string) bool {
+	x, err := strconv.ParseFloat(s, 64)
+	return err == nil && math.IsNaN(x)
+}
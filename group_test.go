@@ -0,0 +1,87 @@
+package annotatedcsv
+
+import (
+	"math"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMinMaxIgnoresNaN(t *testing.T) {
+	// Tables built in code may hold NaN as a float64
+	// rather than as the string that the Reader uses.
+	table := &Table{
+		Columns: []Column{{}, {Name: "k", Type: "string", Group: true}, {Name: "v", Type: "double"}},
+		Rows: [][]interface{}{
+			{nil, "a", math.NaN()},
+			{nil, "a", 2.0},
+			{nil, "a", "NaN"},
+			{nil, "a", -1.0},
+			{nil, "a", math.NaN()},
+			{nil, "b", math.NaN()},
+		},
+	}
+	ts, err := Tables{table}.GroupBy("k").Aggregate(Min("v").As("min"), Max("v").As("max"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got [][]interface{}
+	for _, t := range ts {
+		got = append(got, t.Rows...)
+	}
+	want := [][]interface{}{
+		{nil, "a", -1.0, 2.0},
+		{nil, "b", nil, nil},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected result; got %v want %v", got, want)
+	}
+}
+
+var compareValuesTests = []struct {
+	a, b   interface{}
+	typ    string
+	expect int
+}{
+	{nil, nil, "long", 0},
+	{nil, int64(1), "long", -1},
+	{int64(1), nil, "long", 1},
+	{int64(-2), int64(1), "long", -1},
+	{uint64(3), uint64(3), "unsignedLong", 0},
+	{1.5, "+Inf", "double", -1},
+	{"-Inf", 1.5, "double", -1},
+	{"NaN", "-Inf", "double", -1},
+	{"NaN", "NaN", "double", 0},
+	{1.5, "NaN", "double", 1},
+	{math.NaN(), 1.5, "double", -1},
+	{nil, "NaN", "double", -1},
+	{false, true, "boolean", -1},
+	{true, true, "boolean", 0},
+	{"b", "a", "string", 1},
+	{"b", "a", "enum:x", 1},
+	{mustParseDecimal("1.10"), mustParseDecimal("1.1"), "decimal", 0},
+	{time.Unix(1, 0), time.Unix(2, 0), "dateTime:RFC3339", -1},
+	{netip.MustParseAddr("10.0.0.2"), netip.MustParseAddr("9.0.0.1"), "ip", 1},
+	// Values of unexpected types compare as strings.
+	{int64(10), "9", "long", -1},
+}
+
+func TestCompareValues(t *testing.T) {
+	for _, test := range compareValuesTests {
+		if got := CompareValues(test.a, test.b, test.typ); got != test.expect {
+			t.Errorf("CompareValues(%#v, %#v, %q): got %d want %d", test.a, test.b, test.typ, got, test.expect)
+		}
+		if got := CompareValues(test.b, test.a, test.typ); got != -test.expect {
+			t.Errorf("CompareValues(%#v, %#v, %q): got %d want %d", test.b, test.a, test.typ, got, -test.expect)
+		}
+	}
+}
+
+func mustParseDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
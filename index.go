@@ -0,0 +1,213 @@
+package annotatedcsv
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Index records where each table starts in some annotated CSV
+// input, so that tables can be read without reading all those
+// before them.
+type Index struct {
+	// Size holds the size of the indexed input.
+	Size   int64
+	Tables []IndexEntry
+}
+
+// IndexEntry describes a table in an Index.
+type IndexEntry struct {
+	// Offset holds the byte offset of the start of the table's
+	// annotation rows, and Length the number of bytes up to the
+	// start of the next table.
+	Offset int64
+	Length int64
+	// Schema holds the columns of the table.
+	Schema Schema
+	// GroupKey holds the values of the group columns in the
+	// first row of the table, formatted as they would be written,
+	// keyed by column name. It is empty if the table has no rows.
+	GroupKey map[string]string
+	// Rows holds the number of rows in the table.
+	Rows int
+}
+
+// BuildIndex reads all the tables in the first size bytes of r and
+// returns an index of them. If configure is non-nil, it is called
+// with the Reader before any tables are read, so the index records
+// the schemas as that configuration reads them.
+func BuildIndex(r io.ReaderAt, size int64, configure func(r *Reader)) (*Index, error) {
+	cr := NewReaderAt(r, size)
+	if configure != nil {
+		configure(cr)
+	}
+	ix := &Index{
+		Size: size,
+	}
+	var lines []int
+	for cr.NextTable() {
+		lines = append(lines, cr.tableLine)
+		e := IndexEntry{
+			Schema: cr.Columns(),
+		}
+		for cr.NextRow() {
+			if e.Rows == 0 {
+				e.GroupKey = groupKey(e.Schema, cr.Row())
+			}
+			e.Rows++
+		}
+		ix.Tables = append(ix.Tables, e)
+	}
+	if err := cr.Err(); err != nil {
+		return nil, err
+	}
+	offsets, err := lineOffsets(r, size, lines)
+	if err != nil {
+		return nil, err
+	}
+	for i := range ix.Tables {
+		end := size
+		if i+1 < len(offsets) {
+			end = offsets[i+1]
+		}
+		ix.Tables[i].Offset = offsets[i]
+		ix.Tables[i].Length = end - offsets[i]
+	}
+	return ix, nil
+}
+
+// groupKey returns the formatted values of
+// the group columns in row.
+func groupKey(cols []Column, row []interface{}) map[string]string {
+	key := make(map[string]string)
+	for i, col := range cols {
+		if !col.Group {
+			continue
+		}
+		s, err := formatValue(row[i], col.Type)
+		if err != nil {
+			s = fmt.Sprint(row[i])
+		}
+		key[col.Name] = s
+	}
+	return key
+}
+
+// lineOffsets returns the byte offset in the first size bytes
+// of r of the start of each of the given lines, which must be
+// in ascending order and are counted from 1.
+func lineOffsets(r io.ReaderAt, size int64, lines []int) ([]int64, error) {
+	offsets := make([]int64, 0, len(lines))
+	for len(offsets) < len(lines) && lines[len(offsets)] <= 1 {
+		offsets = append(offsets, 0)
+	}
+	buf := make([]byte, 64*1024)
+	line := 1
+	for off := int64(0); off < size && len(offsets) < len(lines); {
+		if n := size - off; n < int64(len(buf)) {
+			buf = buf[:n]
+		}
+		n, err := r.ReadAt(buf, off)
+		if n == 0 {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		data := buf[:n]
+		for i := 0; len(offsets) < len(lines); {
+			j := bytes.IndexByte(data[i:], '\n')
+			if j < 0 {
+				break
+			}
+			i += j + 1
+			line++
+			for len(offsets) < len(lines) && lines[len(offsets)] == line {
+				offsets = append(offsets, off+int64(i))
+			}
+		}
+		off += int64(n)
+	}
+	if len(offsets) < len(lines) {
+		return nil, fmt.Errorf("line %d not found in input", lines[len(offsets)])
+	}
+	return offsets, nil
+}
+
+// NewReader returns a Reader that reads the table at the given index
+// in ix from r, which must hold the input that ix was built from.
+// The Reader returns false from NextTable after that table.
+func (ix *Index) NewReader(r io.ReaderAt, table int) *Reader {
+	e := ix.Tables[table]
+	return NewReader(io.NewSectionReader(r, e.Offset, e.Length))
+}
+
+// indexJSON holds the JSON representation of an Index.
+type indexJSON struct {
+	Size   int64            `json:"size"`
+	Tables []indexEntryJSON `json:"tables"`
+}
+
+type indexEntryJSON struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+	// Schema holds the canonical representation of the schema.
+	Schema   string            `json:"schema"`
+	GroupKey map[string]string `json:"groupKey,omitempty"`
+	Rows     int               `json:"rows"`
+}
+
+// Write writes ix to w in JSON format, as read by ReadIndex.
+func (ix *Index) Write(w io.Writer) error {
+	v := indexJSON{
+		Size:   ix.Size,
+		Tables: make([]indexEntryJSON, len(ix.Tables)),
+	}
+	for i, e := range ix.Tables {
+		v.Tables[i] = indexEntryJSON{
+			Offset:   e.Offset,
+			Length:   e.Length,
+			Schema:   e.Schema.String(),
+			GroupKey: e.GroupKey,
+			Rows:     e.Rows,
+		}
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// ReadIndex reads an index written by Index.Write.
+func ReadIndex(r io.Reader) (*Index, error) {
+	var v indexJSON
+	if err := json.NewDecoder(r).Decode(&v); err != nil {
+		return nil, fmt.Errorf("cannot decode index: %v", err)
+	}
+	ix := &Index{
+		Size:   v.Size,
+		Tables: make([]IndexEntry, len(v.Tables)),
+	}
+	for i, e := range v.Tables {
+		cr := NewReader(strings.NewReader(e.Schema))
+		if !cr.NextTable() {
+			err := cr.Err()
+			if err == nil {
+				err = fmt.Errorf("no columns")
+			}
+			return nil, fmt.Errorf("invalid schema for table %d in index: %v", i, err)
+		}
+		ix.Tables[i] = IndexEntry{
+			Offset:   e.Offset,
+			Length:   e.Length,
+			Schema:   cr.Columns(),
+			GroupKey: e.GroupKey,
+			Rows:     e.Rows,
+		}
+	}
+	return ix, nil
+}
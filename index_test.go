@@ -0,0 +1,130 @@
+package annotatedcsv
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const indexTestData = `#datatype,string,long
+#group,true,false
+#default,,
+,host,n
+,a,1
+,a,2
+
+#datatype,string,double
+#group,true,false
+#default,,
+,host,v
+,b,1.5
+#datatype,string
+#group,false
+#default,
+,s
+`
+
+func TestIndex(t *testing.T) {
+	data := indexTestData
+	ix, err := BuildIndex(strings.NewReader(data), int64(len(data)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ix.Size != int64(len(data)) {
+		t.Fatalf("unexpected size %d", ix.Size)
+	}
+	second := strings.Index(data, "#datatype,string,double")
+	third := strings.Index(data, "#datatype,string\n")
+	expectEntries := []struct {
+		offset   int
+		length   int
+		rows     int
+		groupKey map[string]string
+	}{
+		{0, second, 2, map[string]string{"host": "a"}},
+		{second, third - second, 1, map[string]string{"host": "b"}},
+		{third, len(data) - third, 0, nil},
+	}
+	if len(ix.Tables) != len(expectEntries) {
+		t.Fatalf("got %d tables, want %d", len(ix.Tables), len(expectEntries))
+	}
+	for i, want := range expectEntries {
+		e := ix.Tables[i]
+		if e.Offset != int64(want.offset) || e.Length != int64(want.length) {
+			t.Errorf("table %d: got offset %d length %d; want offset %d length %d", i, e.Offset, e.Length, want.offset, want.length)
+		}
+		if e.Rows != want.rows || !reflect.DeepEqual(e.GroupKey, want.groupKey) {
+			t.Errorf("table %d: got %d rows group key %v; want %d rows group key %v", i, e.Rows, e.GroupKey, want.rows, want.groupKey)
+		}
+	}
+
+	// Reading a table through the index reads only that table.
+	r := ix.NewReader(strings.NewReader(data), 1)
+	tables, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 1 || !reflect.DeepEqual(tables[0].Rows, [][]interface{}{{nil, "b", 1.5}}) {
+		t.Fatalf("unexpected tables read through index: %#v", tables)
+	}
+	if d := ix.Tables[1].Schema.Diff(tables[0].Columns); len(d) > 0 {
+		t.Fatalf("unexpected columns: %v", d)
+	}
+}
+
+func TestIndexWriteRead(t *testing.T) {
+	data := indexTestData
+	ix, err := BuildIndex(strings.NewReader(data), int64(len(data)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := ix.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	ix1, err := ReadIndex(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ix1, ix) {
+		t.Fatalf("index changed after round trip\ngot  %#v\nwant %#v", ix1, ix)
+	}
+}
+
+func TestIndexConfigure(t *testing.T) {
+	data := indexTestData
+	ix, err := BuildIndex(strings.NewReader(data), int64(len(data)), func(r *Reader) {
+		r.SetIgnoredColumns([]string{"host"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The offsets are unaffected by the configuration.
+	if got, want := ix.Tables[1].Offset, int64(strings.Index(data, "#datatype,string,double")); got != want {
+		t.Fatalf("unexpected offset; got %d want %d", got, want)
+	}
+	if got, want := ix.Tables[0].Schema.String(), "#datatype,long\n#group,false\n#default,\n,n\n"; got != want {
+		t.Fatalf("unexpected schema\ngot  %q\nwant %q", got, want)
+	}
+	if len(ix.Tables[0].GroupKey) != 0 {
+		t.Fatalf("unexpected group key %v", ix.Tables[0].GroupKey)
+	}
+}
+
+func TestReadIndexError(t *testing.T) {
+	_, err := ReadIndex(strings.NewReader(`{"size":1,"tables":[{"offset":0,"length":1,"schema":"","rows":0}]}`))
+	assertErrorMatches(t, err, `invalid schema for table 0 in index: no columns`)
+	_, err = ReadIndex(strings.NewReader(`{`))
+	assertErrorMatches(t, err, `cannot decode index: .*`)
+}
+
+func TestIndexEmptyInput(t *testing.T) {
+	ix, err := BuildIndex(strings.NewReader(""), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ix.Tables) != 0 {
+		t.Fatalf("unexpected tables in index of empty input: %v", ix.Tables)
+	}
+}
@@ -0,0 +1,352 @@
+// Package avro implements a minimal writer for Apache Avro object
+// container files holding records of primitive values, sufficient
+// for writing the kinds of value found in annotated CSV.
+package avro
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kind represents the kind of value held in a field.
+type Kind int
+
+const (
+	// Boolean fields hold bool values.
+	Boolean Kind = iota
+	// Long fields hold int64 values.
+	Long
+	// Double fields hold float64 values.
+	Double
+	// String fields hold string values.
+	String
+	// Timestamp fields hold time.Time values.
+	Timestamp
+)
+
+// Field describes a field in the record schema.
+type Field struct {
+	Name string
+	Kind Kind
+	// Nullable specifies that the field's type is a union
+	// of null and the field's kind, with a default of null.
+	Nullable bool
+	// Props holds additional attributes to include
+	// in the field's schema.
+	Props map[string]string
+}
+
+// Codec represents a block compression codec.
+type Codec int
+
+const (
+	Null Codec = iota
+	Deflate
+)
+
+// TimeUnit represents the unit used to store timestamps.
+type TimeUnit int
+
+const (
+	Micros TimeUnit = iota
+	Millis
+	Nanos
+)
+
+// Options holds options for a Writer.
+type Options struct {
+	// Name holds the name of the record type.
+	// If it's empty, "Record" is used.
+	Name string
+	// Namespace holds the namespace of the record type.
+	Namespace string
+	// Codec holds the codec used to compress blocks.
+	Codec Codec
+	// TimeUnit holds the precision of stored timestamps.
+	TimeUnit TimeUnit
+	// BlockRows holds the maximum number of rows in a block.
+	// If it's zero, DefaultBlockRows is used.
+	BlockRows int
+}
+
+// DefaultBlockRows holds the default maximum number
+// of rows in a block.
+const DefaultBlockRows = 10000
+
+var magic = []byte("Obj\x01")
+
+// validName matches valid Avro names.
+var validName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Writer writes an Avro object container file.
+type Writer struct {
+	w      io.Writer
+	fields []Field
+	opts   Options
+	sync   [16]byte
+	block  bytes.Buffer
+	nrows  int
+	err    error
+}
+
+// NewWriter returns a Writer that writes a container file
+// holding records with the given fields to w. The Close method
+// must be called to write any buffered rows.
+func NewWriter(w io.Writer, fields []Field, opts Options) (*Writer, error) {
+	if opts.Name == "" {
+		opts.Name = "Record"
+	}
+	if opts.BlockRows <= 0 {
+		opts.BlockRows = DefaultBlockRows
+	}
+	if !validName.MatchString(opts.Name) {
+		return nil, fmt.Errorf("invalid record name %q", opts.Name)
+	}
+	for _, part := range strings.Split(opts.Namespace, ".") {
+		if opts.Namespace != "" && !validName.MatchString(part) {
+			return nil, fmt.Errorf("invalid namespace %q", opts.Namespace)
+		}
+	}
+	names := make(map[string]bool)
+	for _, f := range fields {
+		if !validName.MatchString(f.Name) {
+			return nil, fmt.Errorf("invalid field name %q", f.Name)
+		}
+		if names[f.Name] {
+			return nil, fmt.Errorf("duplicate field name %q", f.Name)
+		}
+		names[f.Name] = true
+	}
+	aw := &Writer{
+		w:      w,
+		fields: fields,
+		opts:   opts,
+	}
+	if _, err := rand.Read(aw.sync[:]); err != nil {
+		return nil, err
+	}
+	codec := "null"
+	if opts.Codec == Deflate {
+		codec = "deflate"
+	}
+	var hdr bytes.Buffer
+	hdr.Write(magic)
+	// The metadata map is written as a single block.
+	putLong(&hdr, 2)
+	putString(&hdr, "avro.schema")
+	putString(&hdr, aw.Schema())
+	putString(&hdr, "avro.codec")
+	putString(&hdr, codec)
+	putLong(&hdr, 0)
+	hdr.Write(aw.sync[:])
+	if _, err := w.Write(hdr.Bytes()); err != nil {
+		return nil, err
+	}
+	return aw, nil
+}
+
+// Schema returns the JSON schema of the records written by w.
+func (w *Writer) Schema() string {
+	var b strings.Builder
+	b.WriteString(`{"type":"record","name":`)
+	b.WriteString(jsonString(w.opts.Name))
+	if w.opts.Namespace != "" {
+		b.WriteString(`,"namespace":`)
+		b.WriteString(jsonString(w.opts.Namespace))
+	}
+	b.WriteString(`,"fields":[`)
+	for i, f := range w.fields {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(`{"name":`)
+		b.WriteString(jsonString(f.Name))
+		b.WriteString(`,"type":`)
+		typ := w.typeSchema(f.Kind)
+		if f.Nullable {
+			typ = `["null",` + typ + `]`
+		}
+		b.WriteString(typ)
+		if f.Nullable {
+			b.WriteString(`,"default":null`)
+		}
+		props := make([]string, 0, len(f.Props))
+		for name := range f.Props {
+			props = append(props, name)
+		}
+		sort.Strings(props)
+		for _, name := range props {
+			fmt.Fprintf(&b, ",%s:%s", jsonString(name), jsonString(f.Props[name]))
+		}
+		b.WriteByte('}')
+	}
+	b.WriteString(`]}`)
+	return b.String()
+}
+
+func (w *Writer) typeSchema(k Kind) string {
+	switch k {
+	case Boolean:
+		return `"boolean"`
+	case Long:
+		return `"long"`
+	case Double:
+		return `"double"`
+	case Timestamp:
+		switch w.opts.TimeUnit {
+		case Millis:
+			return `{"type":"long","logicalType":"timestamp-millis"}`
+		case Nanos:
+			return `{"type":"long","logicalType":"timestamp-nanos"}`
+		}
+		return `{"type":"long","logicalType":"timestamp-micros"}`
+	}
+	return `"string"`
+}
+
+// WriteRow writes a row holding one value for each field.
+// A nil value is only allowed in a nullable field.
+func (w *Writer) WriteRow(row []interface{}) error {
+	if w.err != nil {
+		return w.err
+	}
+	if len(row) != len(w.fields) {
+		return fmt.Errorf("row has %d values, want %d", len(row), len(w.fields))
+	}
+	n := w.block.Len()
+	for i, v := range row {
+		if err := w.putValue(w.fields[i], v); err != nil {
+			w.block.Truncate(n)
+			return fmt.Errorf("field %q: %v", w.fields[i].Name, err)
+		}
+	}
+	w.nrows++
+	if w.nrows >= w.opts.BlockRows {
+		return w.flush()
+	}
+	return nil
+}
+
+func (w *Writer) putValue(f Field, v interface{}) error {
+	b := &w.block
+	if f.Nullable {
+		if v == nil {
+			putLong(b, 0)
+			return nil
+		}
+		putLong(b, 1)
+	} else if v == nil {
+		return fmt.Errorf("null value in non-nullable field")
+	}
+	switch f.Kind {
+	case Boolean:
+		x, ok := v.(bool)
+		if !ok {
+			return fmt.Errorf("got %T, want bool", v)
+		}
+		if x {
+			b.WriteByte(1)
+		} else {
+			b.WriteByte(0)
+		}
+	case Long:
+		x, ok := v.(int64)
+		if !ok {
+			return fmt.Errorf("got %T, want int64", v)
+		}
+		putLong(b, x)
+	case Double:
+		x, ok := v.(float64)
+		if !ok {
+			return fmt.Errorf("got %T, want float64", v)
+		}
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(x))
+		b.Write(buf[:])
+	case String:
+		x, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("got %T, want string", v)
+		}
+		putString(b, x)
+	case Timestamp:
+		t, ok := v.(time.Time)
+		if !ok {
+			return fmt.Errorf("got %T, want time.Time", v)
+		}
+		switch w.opts.TimeUnit {
+		case Millis:
+			putLong(b, t.Unix()*1e3+int64(t.Nanosecond())/1e6)
+		case Micros:
+			putLong(b, t.Unix()*1e6+int64(t.Nanosecond())/1e3)
+		case Nanos:
+			putLong(b, t.UnixNano())
+		}
+	default:
+		return fmt.Errorf("unknown kind %d", f.Kind)
+	}
+	return nil
+}
+
+// Close writes any buffered rows. It does not
+// close the underlying writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	return w.flush()
+}
+
+// flush writes the buffered rows as a block.
+func (w *Writer) flush() error {
+	if w.nrows == 0 {
+		return nil
+	}
+	data := w.block.Bytes()
+	if w.opts.Codec == Deflate {
+		var buf bytes.Buffer
+		fw, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+		fw.Write(data)
+		fw.Close()
+		data = buf.Bytes()
+	}
+	var hdr bytes.Buffer
+	putLong(&hdr, int64(w.nrows))
+	putLong(&hdr, int64(len(data)))
+	for _, p := range [][]byte{hdr.Bytes(), data, w.sync[:]} {
+		if _, err := w.w.Write(p); err != nil {
+			w.err = err
+			return err
+		}
+	}
+	w.block.Reset()
+	w.nrows = 0
+	return nil
+}
+
+// putLong writes x in zigzag variable-length encoding.
+func putLong(b *bytes.Buffer, x int64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(buf[:], x)
+	b.Write(buf[:n])
+}
+
+func putString(b *bytes.Buffer, s string) {
+	putLong(b, int64(len(s)))
+	b.WriteString(s)
+}
+
+func jsonString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
@@ -0,0 +1,323 @@
+package avro
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2020, 1, 1, 0, 0, 0, 123456789, time.UTC)
+
+var testFields = []Field{
+	{Name: "b", Kind: Boolean},
+	{Name: "n", Kind: Long, Nullable: true},
+	{Name: "d", Kind: Double, Nullable: true},
+	{Name: "s", Kind: String, Nullable: true, Props: map[string]string{"x.group": "true", "a.type": "tag"}},
+	{Name: "t", Kind: Timestamp},
+}
+
+var testRows = [][]interface{}{
+	{true, int64(-1), 1.5, "a", t0},
+	{false, nil, nil, nil, t0.Add(time.Hour)},
+	{true, int64(math.MinInt64), math.Inf(-1), "", t0.Add(-time.Hour)},
+	{false, int64(math.MaxInt64), -0.25, "héllo\n", time.Unix(0, 0)},
+	{true, int64(300), 0.0, "x", t0.Add(time.Nanosecond)},
+}
+
+var roundTripTests = []struct {
+	testName     string
+	opts         Options
+	expectSchema string
+	// expectTimes holds the encoded values of the
+	// timestamps in testRows.
+	expectTimes  []int64
+	expectBlocks int
+}{{
+	testName:     "default",
+	expectSchema: `{"type":"record","name":"Record","fields":[{"name":"b","type":"boolean"},{"name":"n","type":["null","long"],"default":null},{"name":"d","type":["null","double"],"default":null},{"name":"s","type":["null","string"],"default":null,"a.type":"tag","x.group":"true"},{"name":"t","type":{"type":"long","logicalType":"timestamp-micros"}}]}`,
+	expectTimes:  []int64{1577836800123456, 1577840400123456, 1577833200123456, 0, 1577836800123456},
+	expectBlocks: 1,
+}, {
+	testName: "deflate-blocks",
+	opts: Options{
+		Name:      "Point",
+		Namespace: "com.example",
+		Codec:     Deflate,
+		TimeUnit:  Millis,
+		BlockRows: 2,
+	},
+	expectSchema: `{"type":"record","name":"Point","namespace":"com.example","fields":[{"name":"b","type":"boolean"},{"name":"n","type":["null","long"],"default":null},{"name":"d","type":["null","double"],"default":null},{"name":"s","type":["null","string"],"default":null,"a.type":"tag","x.group":"true"},{"name":"t","type":{"type":"long","logicalType":"timestamp-millis"}}]}`,
+	expectTimes:  []int64{1577836800123, 1577840400123, 1577833200123, 0, 1577836800123},
+	expectBlocks: 3,
+}, {
+	testName: "nanos",
+	opts: Options{
+		TimeUnit: Nanos,
+	},
+	expectSchema: `{"type":"record","name":"Record","fields":[{"name":"b","type":"boolean"},{"name":"n","type":["null","long"],"default":null},{"name":"d","type":["null","double"],"default":null},{"name":"s","type":["null","string"],"default":null,"a.type":"tag","x.group":"true"},{"name":"t","type":{"type":"long","logicalType":"timestamp-nanos"}}]}`,
+	expectTimes:  []int64{1577836800123456789, 1577840400123456789, 1577833200123456789, 0, 1577836800123456790},
+	expectBlocks: 1,
+}}
+
+func TestRoundTrip(t *testing.T) {
+	for _, test := range roundTripTests {
+		t.Run(test.testName, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewWriter(&buf, testFields, test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := w.Schema(); got != test.expectSchema {
+				t.Errorf("unexpected schema; got\n%s\nwant\n%s", got, test.expectSchema)
+			}
+			for _, row := range testRows {
+				if err := w.WriteRow(row); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			f, err := readContainer(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.schema != test.expectSchema {
+				t.Errorf("unexpected schema in file; got\n%s\nwant\n%s", f.schema, test.expectSchema)
+			}
+			if f.blocks != test.expectBlocks {
+				t.Errorf("unexpected block count; got %d want %d", f.blocks, test.expectBlocks)
+			}
+			want := make([][]interface{}, len(testRows))
+			for i, row := range testRows {
+				want[i] = append([]interface{}(nil), row...)
+				want[i][4] = test.expectTimes[i]
+			}
+			if !reflect.DeepEqual(f.rows, want) {
+				t.Errorf("unexpected rows; got\n%v\nwant\n%v", f.rows, want)
+			}
+		})
+	}
+}
+
+func TestWriteRowError(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, testFields, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		row         []interface{}
+		expectError string
+	}{
+		{[]interface{}{true}, "row has 1 values, want 5"},
+		{[]interface{}{nil, nil, nil, nil, t0}, `field "b": null value in non-nullable field`},
+		{[]interface{}{true, 1.5, nil, nil, t0}, `field "n": got float64, want int64`},
+		{[]interface{}{true, nil, nil, nil, "2020"}, `field "t": got string, want time.Time`},
+	} {
+		if err := w.WriteRow(test.row); err == nil || err.Error() != test.expectError {
+			t.Errorf("unexpected error; got %v want %q", err, test.expectError)
+		}
+	}
+	// The failed rows must not leave partial records behind.
+	if err := w.WriteRow(testRows[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := readContainer(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.rows) != 1 {
+		t.Errorf("unexpected row count %d", len(f.rows))
+	}
+}
+
+func TestNewWriterError(t *testing.T) {
+	for _, test := range []struct {
+		fields      []Field
+		opts        Options
+		expectError string
+	}{
+		{nil, Options{Name: "1x"}, `invalid record name "1x"`},
+		{nil, Options{Namespace: "a..b"}, `invalid namespace "a..b"`},
+		{[]Field{{Name: "a-b"}}, Options{}, `invalid field name "a-b"`},
+		{[]Field{{Name: "a"}, {Name: "a"}}, Options{}, `duplicate field name "a"`},
+	} {
+		_, err := NewWriter(ioutil.Discard, test.fields, test.opts)
+		if err == nil || err.Error() != test.expectError {
+			t.Errorf("unexpected error; got %v want %q", err, test.expectError)
+		}
+	}
+}
+
+// container holds the contents of an object container file.
+type container struct {
+	schema string
+	blocks int
+	// rows holds the decoded records, with timestamps
+	// as their encoded int64 values.
+	rows [][]interface{}
+}
+
+// readContainer decodes an object container file as described in
+// the Avro specification, supporting the schemas that Writer writes.
+func readContainer(r io.Reader) (*container, error) {
+	br := bufio.NewReader(r)
+	hdr := make([]byte, 4)
+	if _, err := io.ReadFull(br, hdr); err != nil || string(hdr) != "Obj\x01" {
+		return nil, fmt.Errorf("bad magic %q", hdr)
+	}
+	meta := make(map[string]string)
+	for {
+		n, err := binary.ReadVarint(br)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			break
+		}
+		if n < 0 {
+			// A negative count is followed by the block size.
+			n = -n
+			if _, err := binary.ReadVarint(br); err != nil {
+				return nil, err
+			}
+		}
+		for ; n > 0; n-- {
+			k, err := readBytes(br)
+			if err != nil {
+				return nil, err
+			}
+			v, err := readBytes(br)
+			if err != nil {
+				return nil, err
+			}
+			meta[string(k)] = string(v)
+		}
+	}
+	sync := make([]byte, 16)
+	if _, err := io.ReadFull(br, sync); err != nil {
+		return nil, err
+	}
+	var schema struct {
+		Fields []struct {
+			Type interface{}
+		}
+	}
+	if err := json.Unmarshal([]byte(meta["avro.schema"]), &schema); err != nil {
+		return nil, fmt.Errorf("bad schema: %v", err)
+	}
+	c := &container{
+		schema: meta["avro.schema"],
+	}
+	for {
+		count, err := binary.ReadVarint(br)
+		if err == io.EOF {
+			return c, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := readBytes(br)
+		if err != nil {
+			return nil, err
+		}
+		switch codec := meta["avro.codec"]; codec {
+		case "null":
+		case "deflate":
+			data, err = ioutil.ReadAll(flate.NewReader(bytes.NewReader(data)))
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unknown codec %q", codec)
+		}
+		block := bytes.NewReader(data)
+		for ; count > 0; count-- {
+			var row []interface{}
+			for _, f := range schema.Fields {
+				v, err := readValue(block, f.Type)
+				if err != nil {
+					return nil, err
+				}
+				row = append(row, v)
+			}
+			c.rows = append(c.rows, row)
+		}
+		if block.Len() != 0 {
+			return nil, fmt.Errorf("%d bytes left over in block", block.Len())
+		}
+		blockSync := make([]byte, 16)
+		if _, err := io.ReadFull(br, blockSync); err != nil || !bytes.Equal(blockSync, sync) {
+			return nil, fmt.Errorf("bad sync marker after block")
+		}
+		c.blocks++
+	}
+}
+
+// readValue reads a value with the given type,
+// as decoded from its JSON schema.
+func readValue(r *bytes.Reader, typ interface{}) (interface{}, error) {
+	switch typ := typ.(type) {
+	case []interface{}:
+		index, err := binary.ReadVarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if index < 0 || int(index) >= len(typ) {
+			return nil, fmt.Errorf("bad union index %d", index)
+		}
+		return readValue(r, typ[index])
+	case map[string]interface{}:
+		return readValue(r, typ["type"])
+	case string:
+		switch typ {
+		case "null":
+			return nil, nil
+		case "boolean":
+			b, err := r.ReadByte()
+			return b != 0, err
+		case "long":
+			return binary.ReadVarint(r)
+		case "double":
+			var buf [8]byte
+			if _, err := io.ReadFull(r, buf[:]); err != nil {
+				return nil, err
+			}
+			return math.Float64frombits(binary.LittleEndian.Uint64(buf[:])), nil
+		case "string":
+			s, err := readBytes(r)
+			return string(s), err
+		}
+	}
+	return nil, fmt.Errorf("unsupported type %v", typ)
+}
+
+func readBytes(r io.ByteReader) ([]byte, error) {
+	n, err := binary.ReadVarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("negative length")
+	}
+	buf := make([]byte, n)
+	for i := range buf {
+		if buf[i], err = r.ReadByte(); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
@@ -0,0 +1,175 @@
+// Package annotate implements the annotate command.
+package annotate
+
+import (
+	"bufio"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+)
+
+var flags = flag.NewFlagSet("annotate", flag.ExitOnError)
+
+var (
+	sampleRows = flags.Int("sample", 1000, "number of rows to examine when inferring column types (0 means all rows)")
+	groupFlag  = flags.String("group", "", "comma-separated list of columns to mark as group columns in a #group annotation")
+)
+
+// candidateTypes holds the datatypes that can be inferred,
+// in order of preference.
+var candidateTypes = []string{
+	"long",
+	"unsignedLong",
+	"double",
+	"boolean",
+	"dateTime:RFC3339",
+}
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] [file]\n", flags.Name())
+		fmt.Fprintf(os.Stderr, "Read plain CSV with a header row and write it as annotated CSV with inferred datatypes.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	file := "-"
+	if flags.NArg() == 1 {
+		file = flags.Arg(0)
+	}
+	r, err := input.Open(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	defer r.Close()
+	bw := bufio.NewWriter(os.Stdout)
+	err = annotate(bw, r)
+	if err1 := bw.Flush(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// annotate reads plain CSV from r and writes it to w with
+// annotations. The data is written with an extra
+// empty annotation column at the start of each row.
+func annotate(w io.Writer, r io.Reader) error {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		if err == io.EOF {
+			return fmt.Errorf("no header row found")
+		}
+		return err
+	}
+	var sample [][]string
+	for *sampleRows == 0 || len(sample) < *sampleRows {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		sample = append(sample, rec)
+	}
+	types := inferTypes(len(header), sample)
+	cw := csv.NewWriter(w)
+	cw.Write(append([]string{"#datatype"}, types...))
+	if *groupFlag != "" {
+		group := make([]string, len(header)+1)
+		group[0] = "#group"
+		for i := range header {
+			group[i+1] = "false"
+		}
+		for _, name := range strings.Split(*groupFlag, ",") {
+			i := indexOf(header, name)
+			if i == -1 {
+				return fmt.Errorf("group column %q not found in header", name)
+			}
+			group[i+1] = "true"
+		}
+		cw.Write(group)
+	}
+	cw.Write(append([]string{""}, header...))
+	for _, rec := range sample {
+		cw.Write(append([]string{""}, rec...))
+	}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		for i, val := range rec {
+			if val == "" {
+				continue
+			}
+			if _, err := annotatedcsv.ParseValue(val, types[i]); err != nil {
+				line, _ := cr.FieldPos(i)
+				return fmt.Errorf("value %q in column %q at line %d does not match inferred type %q; use a larger -sample", val, header[i], line, types[i])
+			}
+		}
+		cw.Write(append([]string{""}, rec...))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// inferTypes returns the datatype for each of n columns given
+// a sample of rows. Each column is given the first candidate type
+// that all its non-empty values can be parsed as, or string if
+// there is none.
+func inferTypes(n int, rows [][]string) []string {
+	types := make([]string, n)
+	for i := range types {
+		types[i] = "string"
+	}
+	for i := range types {
+	candidates:
+		for _, typ := range candidateTypes {
+			nvalues := 0
+			for _, row := range rows {
+				if i >= len(row) || row[i] == "" {
+					continue
+				}
+				nvalues++
+				if _, err := annotatedcsv.ParseValue(row[i], typ); err != nil {
+					continue candidates
+				}
+			}
+			if nvalues > 0 {
+				types[i] = typ
+			}
+			break
+		}
+	}
+	return types
+}
+
+func indexOf(ss []string, s string) int {
+	for i, x := range ss {
+		if x == s {
+			return i
+		}
+	}
+	return -1
+}
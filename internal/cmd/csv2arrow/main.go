@@ -0,0 +1,102 @@
+// Package csv2arrow implements the csv2arrow command.
+package csv2arrow
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/arrowconv"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+)
+
+var flags = flag.NewFlagSet("csv2arrow", flag.ExitOnError)
+
+var (
+	outFile   = flags.String("o", "", "output file (default standard output)")
+	stream    = flags.Bool("stream", false, "write the Arrow IPC streaming format instead of the file (Feather) format")
+	batchRows = flags.Int("batch-rows", 65536, "maximum number of rows in each record batch")
+)
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] [file...]\n", flags.Name())
+		fmt.Fprintf(os.Stderr, "All input tables must have the same columns as the first; use csvcat -union to combine tables with different columns.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	files, err := input.Files(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	format := arrowconv.File
+	if *stream {
+		format = arrowconv.Stream
+	}
+	out := os.Stdout
+	if *outFile != "" {
+		out, err = os.Create(*outFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	bw := bufio.NewWriter(out)
+	var aw *arrowconv.Writer
+	err = input.ForEach(files, func(r io.Reader) error {
+		cr := annotatedcsv.NewReader(r)
+		for cr.NextTable() {
+			t := &annotatedcsv.Table{
+				Columns: cr.Columns(),
+			}
+			if aw == nil {
+				w, err := arrowconv.NewWriter(bw, arrowconv.Columns(t.Columns), format)
+				if err != nil {
+					return err
+				}
+				aw = w
+			}
+			// Read the table in chunks so that memory use
+			// is bounded by the batch size.
+			for {
+				t.Rows = t.Rows[:0]
+				for (*batchRows <= 0 || len(t.Rows) < *batchRows) && cr.NextRow() {
+					t.Rows = append(t.Rows, cr.Row())
+				}
+				if len(t.Rows) == 0 {
+					break
+				}
+				if err := aw.WriteTable(t, *batchRows); err != nil {
+					return err
+				}
+			}
+			if err := cr.Err(); err != nil {
+				return err
+			}
+		}
+		return cr.Err()
+	})
+	if err == nil && aw == nil {
+		err = fmt.Errorf("no tables found in input")
+	}
+	if err == nil {
+		err = aw.Close()
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err1 := out.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,261 @@
+// Package csv2avro implements the csv2avro command.
+package csv2avro
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/avro"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+)
+
+var flags = flag.NewFlagSet("csv2avro", flag.ExitOnError)
+
+var (
+	outFile    = flags.String("o", "", "output file (default standard output)")
+	codec      = flags.String("codec", "deflate", "block compression: null or deflate")
+	timeUnit   = flags.String("time-unit", "us", "precision of stored timestamps: ms, us or ns")
+	recordName = flags.String("name", "Row", "name of the Avro record type")
+	namespace  = flags.String("namespace", "", "namespace of the Avro record type")
+	blockRows  = flags.Int("block-rows", avro.DefaultBlockRows, "maximum number of rows in each block")
+)
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] [file...]\n", flags.Name())
+		fmt.Fprintf(os.Stderr, "All input tables must have the same columns as the first; use csvcat -union to combine tables with different columns.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	opts := avro.Options{
+		Name:      *recordName,
+		Namespace: *namespace,
+		BlockRows: *blockRows,
+	}
+	switch *codec {
+	case "null":
+		opts.Codec = avro.Null
+	case "deflate":
+		opts.Codec = avro.Deflate
+	default:
+		fmt.Fprintf(os.Stderr, "error: unknown codec %q\n", *codec)
+		os.Exit(2)
+	}
+	switch *timeUnit {
+	case "ms":
+		opts.TimeUnit = avro.Millis
+	case "us":
+		opts.TimeUnit = avro.Micros
+	case "ns":
+		opts.TimeUnit = avro.Nanos
+	default:
+		fmt.Fprintf(os.Stderr, "error: unknown time unit %q\n", *timeUnit)
+		os.Exit(2)
+	}
+	files, err := input.Files(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	out := os.Stdout
+	if *outFile != "" {
+		out, err = os.Create(*outFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	bw := bufio.NewWriter(out)
+	c := &converter{
+		w:    bw,
+		opts: opts,
+	}
+	err = input.ForEach(files, func(r io.Reader) error {
+		return c.convert(annotatedcsv.NewReader(r))
+	})
+	if err == nil {
+		err = c.Close()
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err1 := out.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// converter writes the rows of all tables to a single Avro file
+// whose schema is taken from the first table.
+type converter struct {
+	w    io.Writer
+	opts avro.Options
+	aw   *avro.Writer
+	// cols holds the columns of the Avro file.
+	cols []annotatedcsv.Column
+}
+
+func (c *converter) convert(r *annotatedcsv.Reader) error {
+	for r.NextTable() {
+		tableCols := r.Columns()
+		if c.aw == nil {
+			if err := c.start(tableCols); err != nil {
+				return err
+			}
+		}
+		// indexes holds the index in tableCols
+		// of each column in the Avro file.
+		indexes := make([]int, len(c.cols))
+		for i, col := range c.cols {
+			indexes[i] = -1
+			for j, tcol := range tableCols {
+				if tcol.Name == col.Name {
+					if tcol.Type != col.Type {
+						return fmt.Errorf("column %q has type %q; want %q as in the first table", col.Name, tcol.Type, col.Type)
+					}
+					indexes[i] = j
+					break
+				}
+			}
+			if indexes[i] == -1 {
+				return fmt.Errorf("column %q not found in table; all tables must have the same columns", col.Name)
+			}
+		}
+		if len(tableCols) != len(c.cols)+1 {
+			return fmt.Errorf("table has %d columns; want %d as in the first table", len(tableCols)-1, len(c.cols))
+		}
+		row := make([]interface{}, len(c.cols))
+		for r.NextRow() {
+			tableRow := r.Row()
+			for i, index := range indexes {
+				v, err := avroValue(tableRow[index], c.cols[i].Type)
+				if err != nil {
+					return fmt.Errorf("column %q: %v", c.cols[i].Name, err)
+				}
+				row[i] = v
+			}
+			if err := c.aw.WriteRow(row); err != nil {
+				return err
+			}
+		}
+	}
+	return r.Err()
+}
+
+// start creates the Avro writer with fields derived from the
+// given table columns. The annotation column is omitted.
+// All columns are nullable because the Reader
+// returns nil for empty cells.
+func (c *converter) start(tableCols []annotatedcsv.Column) error {
+	var fields []avro.Field
+	names := make(map[string]bool)
+	for i, col := range tableCols {
+		if i == 0 && col.Name == "" && col.Default == nil {
+			continue
+		}
+		c.cols = append(c.cols, col)
+		f := avro.Field{
+			Name:     fieldName(col.Name, names),
+			Kind:     avroKind(col.Type),
+			Nullable: true,
+			Props: map[string]string{
+				"annotatedcsv.datatype": col.Type,
+				"annotatedcsv.group":    strconv.FormatBool(col.Group),
+			},
+		}
+		if f.Name != col.Name {
+			f.Props["annotatedcsv.name"] = col.Name
+		}
+		fields = append(fields, f)
+	}
+	aw, err := avro.NewWriter(c.w, fields, c.opts)
+	if err != nil {
+		return err
+	}
+	c.aw = aw
+	return nil
+}
+
+// Close completes the Avro file. If there were
+// no tables, the file has no schema and an error
+// is returned.
+func (c *converter) Close() error {
+	if c.aw == nil {
+		return fmt.Errorf("no tables found in input")
+	}
+	return c.aw.Close()
+}
+
+// fieldName returns a valid Avro field name for the column
+// with the given name that is not already in names, and adds
+// it to names.
+func fieldName(name string, names map[string]bool) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+	if name == "" || '0' <= name[0] && name[0] <= '9' {
+		name = "_" + name
+	}
+	base := name
+	for i := 2; names[name]; i++ {
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+	names[name] = true
+	return name
+}
+
+// avroKind returns the kind of Avro field used
+// to hold values of the given datatype.
+func avroKind(typ string) avro.Kind {
+	switch annotatedcsv.DatatypeKind(typ) {
+	case annotatedcsv.BooleanKind:
+		return avro.Boolean
+	case annotatedcsv.LongKind, annotatedcsv.UnsignedLongKind:
+		return avro.Long
+	case annotatedcsv.DoubleKind:
+		return avro.Double
+	case annotatedcsv.DateTimeKind:
+		return avro.Timestamp
+	}
+	return avro.String
+}
+
+// avroValue returns v as stored in an Avro field
+// for the given datatype.
+func avroValue(v interface{}, typ string) (interface{}, error) {
+	switch x := v.(type) {
+	case uint64:
+		// Avro has no unsigned integer type.
+		if x > math.MaxInt64 {
+			return nil, fmt.Errorf("value %d out of range of Avro long", x)
+		}
+		return int64(x), nil
+	case string:
+		if typ == "double" {
+			// The reader represents infinities and NaN as strings.
+			return strconv.ParseFloat(x, 64)
+		}
+	}
+	if avroKind(typ) == avro.String && v != nil {
+		if _, ok := v.(string); !ok {
+			return fmt.Sprint(v), nil
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,92 @@
+package csv2clickhouse
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// client sends queries to the ClickHouse HTTP interface.
+type client struct {
+	client *http.Client
+	url    *url.URL
+
+	database string
+	username string
+	password string
+}
+
+func newClient(serverURL string) (*client, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid URL %q: scheme must be http or https", serverURL)
+	}
+	c := &client{
+		client: http.DefaultClient,
+		url:    u,
+	}
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+		u.User = nil
+	}
+	return c, nil
+}
+
+// exec runs a statement that takes no data.
+func (c *client) exec(query string) error {
+	return c.post(nil, []byte(query))
+}
+
+// insert runs an INSERT statement, sending data
+// as the statement's input.
+//
+// Inserts are not retried, as the data might be
+// stored twice.
+func (c *client) insert(query string, data []byte) error {
+	return c.post(map[string]string{"query": query}, data)
+}
+
+// post makes a request with the given query parameters
+// and body.
+func (c *client) post(params map[string]string, body []byte) error {
+	u := *c.url
+	q := u.Query()
+	for k, v := range params {
+		q.Set(k, v)
+	}
+	if c.database != "" {
+		q.Set("database", c.database)
+	}
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequest("POST", u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if c.username != "" {
+		req.Header.Set("X-ClickHouse-User", c.username)
+	}
+	if c.password != "" {
+		req.Header.Set("X-ClickHouse-Key", c.password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	if msg = bytes.TrimSpace(msg); len(msg) > 0 {
+		return fmt.Errorf("%s: %s", resp.Status, msg)
+	}
+	return fmt.Errorf("%s", resp.Status)
+}
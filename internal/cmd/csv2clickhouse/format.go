@@ -0,0 +1,207 @@
+package csv2clickhouse
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// appendTSVRow appends row, a row of t, in TabSeparated format.
+func appendTSVRow(buf []byte, t *chTable, row []interface{}) []byte {
+	for i, v := range row {
+		if i > 0 {
+			buf = append(buf, '\t')
+		}
+		if s, ok := v.(string); ok && t.types[i] == "Float64" {
+			// The Reader returns non-finite doubles as strings.
+			x, _ := strconv.ParseFloat(s, 64)
+			switch {
+			case math.IsInf(x, 1):
+				buf = append(buf, "inf"...)
+			case math.IsInf(x, -1):
+				buf = append(buf, "-inf"...)
+			default:
+				buf = append(buf, "nan"...)
+			}
+			continue
+		}
+		switch v := v.(type) {
+		case nil:
+			// ClickHouse inserts the default value for
+			// null in a non-Nullable column.
+			buf = append(buf, `\N`...)
+		case bool:
+			buf = strconv.AppendBool(buf, v)
+		case int64:
+			buf = strconv.AppendInt(buf, v, 10)
+		case uint64:
+			buf = strconv.AppendUint(buf, v, 10)
+		case float64:
+			buf = strconv.AppendFloat(buf, v, 'g', -1, 64)
+		case time.Time:
+			buf = v.UTC().AppendFormat(buf, "2006-01-02 15:04:05.000000000")
+		case string:
+			buf = append(buf, tsvEscaper.Replace(v)...)
+		default:
+			buf = append(buf, tsvEscaper.Replace(fmt.Sprint(v))...)
+		}
+	}
+	return append(buf, '\n')
+}
+
+var tsvEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"\t", `\t`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\x00", `\0`,
+)
+
+// LowCardinality serialization constants.
+const (
+	// lcKeysVersion is the version of the shared
+	// dictionary serialization.
+	lcKeysVersion = 1
+
+	// lcHasAdditionalKeys and lcNeedUpdateDictionary
+	// are flags in the index type, meaning that the
+	// dictionary is sent with each block.
+	lcHasAdditionalKeys    = 1 << 9
+	lcNeedUpdateDictionary = 1 << 10
+)
+
+// appendNativeBlock appends a block holding the given rows
+// of t in ClickHouse Native format, as accepted by the HTTP
+// interface: the number of columns and rows followed by the
+// name, type and data of each column.
+func appendNativeBlock(buf []byte, t *chTable, rows [][]interface{}) []byte {
+	buf = appendUvarint(buf, uint64(len(t.Columns)))
+	buf = appendUvarint(buf, uint64(len(rows)))
+	for i, col := range t.Columns {
+		buf = appendString(buf, col.Name)
+		buf = appendString(buf, t.types[i])
+		switch t.types[i] {
+		case "Bool":
+			for _, row := range rows {
+				v, _ := row[i].(bool)
+				if v {
+					buf = append(buf, 1)
+				} else {
+					buf = append(buf, 0)
+				}
+			}
+		case "Int64":
+			for _, row := range rows {
+				v, _ := row[i].(int64)
+				buf = appendUint64(buf, uint64(v))
+			}
+		case "UInt64":
+			for _, row := range rows {
+				v, _ := row[i].(uint64)
+				buf = appendUint64(buf, v)
+			}
+		case "Float64":
+			for _, row := range rows {
+				var x float64
+				switch v := row[i].(type) {
+				case float64:
+					x = v
+				case string:
+					// The Reader returns non-finite doubles as strings.
+					x, _ = strconv.ParseFloat(v, 64)
+				}
+				buf = appendUint64(buf, math.Float64bits(x))
+			}
+		case "DateTime64(9, 'UTC')":
+			for _, row := range rows {
+				var ns int64
+				if v, ok := row[i].(time.Time); ok {
+					ns = v.UnixNano()
+				}
+				buf = appendUint64(buf, uint64(ns))
+			}
+		case "LowCardinality(String)":
+			buf = appendLowCardinality(buf, rows, i)
+		default:
+			for _, row := range rows {
+				buf = appendString(buf, stringValue(row[i]))
+			}
+		}
+	}
+	return buf
+}
+
+// appendLowCardinality appends column i of rows as a
+// LowCardinality(String) column: a dictionary of the
+// distinct values followed by the index of each row's
+// value in the dictionary.
+func appendLowCardinality(buf []byte, rows [][]interface{}, i int) []byte {
+	var keys []string
+	keyIndex := make(map[string]uint64)
+	indexes := make([]uint64, len(rows))
+	for j, row := range rows {
+		s := stringValue(row[i])
+		index, ok := keyIndex[s]
+		if !ok {
+			index = uint64(len(keys))
+			keyIndex[s] = index
+			keys = append(keys, s)
+		}
+		indexes[j] = index
+	}
+	// The index type holds the size of each index:
+	// 0 for UInt8, 1 for UInt16, 2 for UInt32 and
+	// 3 for UInt64.
+	indexType, size := 0, 1
+	switch n := uint64(len(keys)); {
+	case n > math.MaxUint32:
+		indexType, size = 3, 8
+	case n > math.MaxUint16:
+		indexType, size = 2, 4
+	case n > math.MaxUint8:
+		indexType, size = 1, 2
+	}
+	buf = appendUint64(buf, lcKeysVersion)
+	buf = appendUint64(buf, uint64(indexType|lcHasAdditionalKeys|lcNeedUpdateDictionary))
+	buf = appendUint64(buf, uint64(len(keys)))
+	for _, key := range keys {
+		buf = appendString(buf, key)
+	}
+	buf = appendUint64(buf, uint64(len(indexes)))
+	var tmp [8]byte
+	for _, index := range indexes {
+		binary.LittleEndian.PutUint64(tmp[:], index)
+		buf = append(buf, tmp[:size]...)
+	}
+	return buf
+}
+
+func stringValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = appendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func appendUvarint(buf []byte, x uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], x)
+	return append(buf, tmp[:n]...)
+}
+
+func appendUint64(buf []byte, x uint64) []byte {
+	var tmp [8]byte
+	binary.LittleEndian.PutUint64(tmp[:], x)
+	return append(buf, tmp[:]...)
+}
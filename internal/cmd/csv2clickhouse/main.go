@@ -0,0 +1,327 @@
+// Package csv2clickhouse implements the csv2clickhouse command.
+package csv2clickhouse
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+	"github.com/rogpeppe/annotatedcsv/internal/sqlschema"
+)
+
+var flags = flag.NewFlagSet("csv2clickhouse", flag.ExitOnError)
+
+var (
+	serverURL = flags.String("url", "", "URL of the ClickHouse HTTP interface to insert the data into, such as http://localhost:8123")
+	database  = flags.String("database", "", "database holding the tables (with -url); the default is the user's default database")
+	username  = flags.String("username", "", "user name for -url (default $CLICKHOUSE_USER)")
+	password  = flags.String("password", "", "password for -url (default $CLICKHOUSE_PASSWORD)")
+	tableName = flags.String("table", "data", "name of the SQL table; tables for further distinct schemas have _2, _3 and so on appended")
+	format    = flags.String("format", "tsv", "data format: tsv (TabSeparated) or native")
+	batchRows = flags.Int("batch-rows", 100000, "number of rows to send in each INSERT (with -url) or Native block")
+	noCreate  = flags.Bool("no-create", false, "do not create tables (with -url)")
+	ddlOnly   = flags.Bool("ddl", false, "print the statements that create the tables instead of the data")
+	engine    = flags.String("engine", "MergeTree", "table engine")
+	orderBy   = flags.String("order-by", "", "comma-separated list of columns for the ORDER BY clause; the default is the group columns followed by _time")
+)
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] [file...]\n", flags.Name())
+		fmt.Fprintf(os.Stderr, `
+Without -url, the data is written to the standard output, suitable for
+loading with
+
+	clickhouse-client -q 'INSERT INTO data FORMAT TabSeparated'
+
+or FORMAT Native with -format native. All the input tables must then
+have the same columns. Use -ddl to print the CREATE TABLE statements.
+
+`)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *format != "tsv" && *format != "native" {
+		fmt.Fprintf(os.Stderr, "error: unknown format %q\n", *format)
+		os.Exit(2)
+	}
+	if *batchRows < 1 {
+		fmt.Fprintf(os.Stderr, "error: -batch-rows must be positive\n")
+		os.Exit(2)
+	}
+	if *ddlOnly && (*serverURL != "" || *noCreate) {
+		fmt.Fprintf(os.Stderr, "error: cannot use -ddl with -url or -no-create\n")
+		os.Exit(2)
+	}
+	files, err := input.Files(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	l := &loader{
+		schemas: sqlschema.NewTables(*tableName),
+		tables:  make(map[*sqlschema.Table]*chTable),
+	}
+	var w *bufio.Writer
+	if *serverURL != "" {
+		c, err := newClient(*serverURL)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(2)
+		}
+		c.database = *database
+		// Credentials in the URL are used unless overridden.
+		if u := envDefault(*username, "CLICKHOUSE_USER"); u != "" {
+			c.username = u
+		}
+		if p := envDefault(*password, "CLICKHOUSE_PASSWORD"); p != "" {
+			c.password = p
+		}
+		l.client = c
+	} else {
+		w = bufio.NewWriter(os.Stdout)
+		l.out = w
+	}
+	err = input.ForEach(files, func(r io.Reader) error {
+		return l.load(annotatedcsv.NewReader(r))
+	})
+	if err == nil {
+		err = l.flush()
+	}
+	if w != nil {
+		if err1 := w.Flush(); err == nil {
+			err = err1
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func envDefault(s, envVar string) string {
+	if s == "" {
+		return os.Getenv(envVar)
+	}
+	return s
+}
+
+// loader sends rows to ClickHouse or the standard output,
+// using a table for each distinct schema.
+type loader struct {
+	// client holds the client used to send the data.
+	// It is nil when writing to out.
+	client *client
+	out    io.Writer
+
+	schemas *sqlschema.Tables
+	// tables holds the chTable for each SQL table.
+	tables map[*sqlschema.Table]*chTable
+
+	// batch holds the rows not yet sent, all
+	// destined for batchTable.
+	batch      [][]interface{}
+	batchTable *chTable
+}
+
+// chTable represents a ClickHouse table.
+type chTable struct {
+	*sqlschema.Table
+	// types holds the ClickHouse types
+	// of the columns.
+	types []string
+}
+
+func (l *loader) load(r *annotatedcsv.Reader) error {
+	for r.NextTable() {
+		cols := r.Columns()
+		t, err := l.table(cols)
+		if err != nil {
+			return err
+		}
+		if *ddlOnly {
+			continue
+		}
+		indexes := t.Indexes(cols)
+		for r.NextRow() {
+			row := r.Row()
+			vals := make([]interface{}, len(indexes))
+			for i, index := range indexes {
+				vals[i] = row[index]
+			}
+			if err := l.add(t, vals); err != nil {
+				return err
+			}
+		}
+	}
+	return r.Err()
+}
+
+// add adds a row to the current batch, sending
+// the batch when it is full.
+func (l *loader) add(t *chTable, row []interface{}) error {
+	if l.batchTable != t {
+		if err := l.flush(); err != nil {
+			return err
+		}
+		l.batchTable = t
+	}
+	l.batch = append(l.batch, row)
+	if len(l.batch) >= *batchRows {
+		return l.flush()
+	}
+	return nil
+}
+
+// flush sends the rows in the current batch.
+func (l *loader) flush() error {
+	if len(l.batch) == 0 {
+		return nil
+	}
+	t := l.batchTable
+	var data []byte
+	if *format == "native" {
+		data = appendNativeBlock(nil, t, l.batch)
+	} else {
+		for _, row := range l.batch {
+			data = appendTSVRow(data, t, row)
+		}
+	}
+	l.batch = l.batch[:0]
+	if l.client == nil {
+		_, err := l.out.Write(data)
+		return err
+	}
+	var names []string
+	for _, col := range t.Columns {
+		names = append(names, quoteIdent(col.Name))
+	}
+	formatName := "TabSeparated"
+	if *format == "native" {
+		formatName = "Native"
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) FORMAT %s", quoteIdent(t.Name), strings.Join(names, ", "), formatName)
+	if err := l.client.insert(query, data); err != nil {
+		return fmt.Errorf("cannot insert into %s: %v", t.Name, err)
+	}
+	return nil
+}
+
+// table returns the table used for rows with the given
+// columns, creating it if necessary.
+func (l *loader) table(cols []annotatedcsv.Column) (*chTable, error) {
+	st, isNew, err := l.schemas.Table(cols)
+	if err != nil {
+		return nil, err
+	}
+	if !isNew {
+		return l.tables[st], nil
+	}
+	if l.schemas.Len() > 1 && l.client == nil && !*ddlOnly {
+		return nil, fmt.Errorf("tables with different columns cannot be written to the standard output; use -url")
+	}
+	t := &chTable{
+		Table: st,
+	}
+	for _, col := range st.Columns {
+		t.types = append(t.types, columnType(col))
+	}
+	l.tables[st] = t
+	switch {
+	case *ddlOnly:
+		create, err := createStatement(t)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fmt.Fprintf(l.out, "%s;\n", create); err != nil {
+			return nil, err
+		}
+	case l.client != nil && !*noCreate:
+		create, err := createStatement(t)
+		if err != nil {
+			return nil, err
+		}
+		if err := l.client.exec(create); err != nil {
+			return nil, fmt.Errorf("cannot create table %s: %v", t.Name, err)
+		}
+	}
+	return t, nil
+}
+
+// createStatement returns the statement that creates t.
+func createStatement(t *chTable) (string, error) {
+	var keys []string
+	if *orderBy != "" {
+		for _, name := range strings.Split(*orderBy, ",") {
+			if !hasColumn(t.Columns, name) {
+				return "", fmt.Errorf("cannot create table %s: no column %q for -order-by", t.Name, name)
+			}
+			keys = append(keys, quoteIdent(name))
+		}
+	} else {
+		for _, col := range t.Columns {
+			if col.Group {
+				keys = append(keys, quoteIdent(col.Name))
+			}
+		}
+		if hasColumn(t.Columns, "_time") {
+			keys = append(keys, quoteIdent("_time"))
+		}
+	}
+	create := t.Create(quoteIdent, columnType) + " ENGINE = " + *engine
+	engineName := strings.TrimSpace(strings.SplitN(*engine, "(", 2)[0])
+	if !strings.HasSuffix(engineName, "MergeTree") {
+		// Only the MergeTree family has a sorting key.
+		return create, nil
+	}
+	if len(keys) == 0 {
+		return create + " ORDER BY tuple()", nil
+	}
+	return create + " ORDER BY (" + strings.Join(keys, ", ") + ")", nil
+}
+
+func hasColumn(cols []annotatedcsv.Column, name string) bool {
+	for _, col := range cols {
+		if col.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// columnType returns the ClickHouse type used for the column.
+// Group columns, which usually hold few distinct values, are
+// stored with dictionary encoding.
+func columnType(col annotatedcsv.Column) string {
+	switch annotatedcsv.DatatypeKind(col.Type) {
+	case annotatedcsv.BooleanKind:
+		return "Bool"
+	case annotatedcsv.LongKind:
+		return "Int64"
+	case annotatedcsv.UnsignedLongKind:
+		return "UInt64"
+	case annotatedcsv.DoubleKind:
+		return "Float64"
+	case annotatedcsv.DateTimeKind:
+		return "DateTime64(9, 'UTC')"
+	}
+	if col.Group || col.Type == "tag" {
+		return "LowCardinality(String)"
+	}
+	return "String"
+}
+
+// quoteIdent quotes s as a ClickHouse identifier.
+func quoteIdent(s string) string {
+	return "`" + identEscaper.Replace(s) + "`"
+}
+
+var identEscaper = strings.NewReplacer("\\", "\\\\", "`", "\\`")
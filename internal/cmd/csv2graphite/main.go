@@ -0,0 +1,306 @@
+// Package csv2graphite implements the csv2graphite command.
+package csv2graphite
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/cmdflag"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+	"github.com/rogpeppe/annotatedcsv/internal/series"
+)
+
+var flags = flag.NewFlagSet("csv2graphite", flag.ExitOnError)
+
+var (
+	drops = cmdflag.NameSet{"_start": true, "_stop": true}
+
+	prefix     = flags.String("prefix", "", "dot-separated prefix to add to every metric path")
+	tagged     = flags.Bool("tagged", false, "write tags as Graphite tags (path;tag=value) rather than as path components")
+	carbonAddr = flags.String("carbon", "", "send metrics to the Carbon plaintext listener at this host[:port] (default port 2003) rather than writing them to the standard output")
+)
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Var(drops, "drop", "comma-separated list of columns to omit from the output (can be repeated)")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] [file...]\n", flags.Name())
+		fmt.Fprintf(os.Stderr, `
+Each field becomes a metric in the Graphite plaintext format. The
+metric path is made from the measurement, the values of the tag
+columns in column name order, and the field name, separated by dots;
+with -tagged, the tags are written as Graphite tags instead. Tables
+may hold _field and _value columns, or be pivoted with one column per
+field. Non-numeric and non-finite field values are skipped; booleans
+become 0 or 1. Timestamps are truncated to whole seconds.
+
+`)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	files, err := input.Files(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	var out io.Writer = os.Stdout
+	if *carbonAddr != "" {
+		addr := *carbonAddr
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "2003")
+		}
+		conn, err := net.DialTimeout("tcp", addr, 30*time.Second)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		defer conn.Close()
+		out = conn
+	}
+	w := bufio.NewWriter(out)
+	c := &converter{
+		w: w,
+	}
+	err = input.ForEach(files, func(r io.Reader) error {
+		return c.convert(annotatedcsv.NewReader(r))
+	})
+	if err1 := w.Flush(); err == nil {
+		err = err1
+	}
+	if c.skipped > 0 {
+		fmt.Fprintf(os.Stderr, "skipped %d non-numeric or non-finite values\n", c.skipped)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+type converter struct {
+	w *bufio.Writer
+	// skipped holds the number of values skipped because
+	// they were not numeric or not finite.
+	skipped int
+	buf     []byte
+}
+
+func (c *converter) convert(r *annotatedcsv.Reader) error {
+	for r.NextTable() {
+		info, err := tableInfoForColumns(r.Columns())
+		if err != nil {
+			return fmt.Errorf("cannot get table info for columns: %v", err)
+		}
+		for r.NextRow() {
+			if err := c.convertRow(info, r.Row()); err != nil {
+				return err
+			}
+		}
+	}
+	return r.Err()
+}
+
+// convertRow writes a line for each numeric field in the given row.
+func (c *converter) convertRow(info *tableInfo, row []interface{}) error {
+	t, ok := row[info.Time].(time.Time)
+	if !ok {
+		return nil
+	}
+	measurement := ""
+	if info.Measurement >= 0 {
+		measurement = valueString(row[info.Measurement])
+	}
+	writeLine := func(field string, v interface{}) error {
+		x, ok := numericValue(v)
+		if !ok {
+			if v != nil {
+				c.skipped++
+			}
+			return nil
+		}
+		c.buf = c.appendPath(c.buf[:0], info, row, measurement, field)
+		c.buf = append(c.buf, ' ')
+		c.buf = strconv.AppendFloat(c.buf, x, 'g', -1, 64)
+		c.buf = append(c.buf, ' ')
+		c.buf = strconv.AppendInt(c.buf, t.Unix(), 10)
+		c.buf = append(c.buf, '\n')
+		_, err := c.w.Write(c.buf)
+		return err
+	}
+	if info.Field >= 0 {
+		return writeLine(valueString(row[info.Field]), row[info.Value])
+	}
+	for i, name := range info.FieldNames {
+		if err := writeLine(name, row[info.FieldIndexes[i]]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendPath appends the metric path for the given field.
+func (c *converter) appendPath(buf []byte, info *tableInfo, row []interface{}, measurement, field string) []byte {
+	start := len(buf)
+	addComponent := func(s string) {
+		if len(buf) > start {
+			buf = append(buf, '.')
+		}
+		buf = append(buf, pathComponent(s)...)
+	}
+	if *prefix != "" {
+		buf = append(buf, *prefix...)
+	}
+	if measurement != "" {
+		addComponent(measurement)
+	}
+	if !*tagged {
+		for _, i := range info.tagIndexes {
+			if v := valueString(row[i]); v != "" {
+				addComponent(v)
+			}
+		}
+	}
+	addComponent(field)
+	if *tagged {
+		for j, i := range info.tagIndexes {
+			if v := valueString(row[i]); v != "" {
+				buf = append(buf, ';')
+				buf = append(buf, info.tagNames[j]...)
+				buf = append(buf, '=')
+				buf = append(buf, tagValue(v)...)
+			}
+		}
+	}
+	return buf
+}
+
+// numericValue returns v as a metric value.
+// It reports false if v is not numeric or not finite.
+func numericValue(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	// The reader represents infinities and NaN as strings,
+	// which Graphite cannot store.
+	return 0, false
+}
+
+type tableInfo struct {
+	*series.Columns
+
+	// tagNames and tagIndexes hold the tag
+	// columns, sorted by name.
+	tagNames   []string
+	tagIndexes []int
+}
+
+func tableInfoForColumns(cols []annotatedcsv.Column) (*tableInfo, error) {
+	sc, err := series.Find(cols, func(name string) bool {
+		return drops[name]
+	})
+	if err != nil {
+		return nil, err
+	}
+	info := &tableInfo{
+		Columns: sc,
+	}
+	usedTagNames := make(map[string]string)
+	tags := append([]int(nil), sc.Tags...)
+	for _, i := range tags {
+		name := tagName(cols[i].Name)
+		if other, ok := usedTagNames[name]; ok {
+			return nil, fmt.Errorf("columns %q and %q both map to tag %q", other, cols[i].Name, name)
+		}
+		usedTagNames[name] = cols[i].Name
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return cols[tags[i]].Name < cols[tags[j]].Name
+	})
+	for _, i := range tags {
+		info.tagNames = append(info.tagNames, tagName(cols[i].Name))
+		info.tagIndexes = append(info.tagIndexes, i)
+	}
+	return info, nil
+}
+
+// pathComponent returns s with characters that cannot appear
+// in a component of a Graphite metric path replaced with
+// underscores.
+func pathComponent(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == '_' || r == '-' || r == ':' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' {
+			return r
+		}
+		return '_'
+	}, s)
+	if s == "" {
+		return "_"
+	}
+	return s
+}
+
+// tagName returns the Graphite tag name for a column.
+func tagName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch r {
+		case ';', '!', '^', '=', '~':
+			return '_'
+		}
+		if r <= ' ' {
+			return '_'
+		}
+		return r
+	}, strings.TrimPrefix(name, "_"))
+	if name == "" || name == "name" {
+		// The name tag is reserved for the metric path.
+		name = "_" + name
+	}
+	return name
+}
+
+// tagValue returns s with characters that cannot appear
+// in a Graphite tag value replaced with underscores.
+func tagValue(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == ';' || r <= ' ' {
+			return '_'
+		}
+		return r
+	}, s)
+	if strings.HasPrefix(s, "~") {
+		s = "_" + s[1:]
+	}
+	return s
+}
+
+func valueString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
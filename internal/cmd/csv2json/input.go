@@ -0,0 +1,44 @@
+package csv2json
+
+import (
+	"io"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+)
+
+// inputs calls f with a Reader for each input in turn.
+type inputs func(f func(r *annotatedcsv.Reader) error) error
+
+// fileInputs returns inputs that read the given files. Any
+// error returned is prefixed with the file name.
+func fileInputs(files []string) inputs {
+	return func(f func(r *annotatedcsv.Reader) error) error {
+		return input.ForEach(files, func(r io.Reader) error {
+			return f(newReader(r))
+		})
+	}
+}
+
+// readerInputs returns inputs that read r.
+func readerInputs(r io.Reader) inputs {
+	return func(f func(r *annotatedcsv.Reader) error) error {
+		return f(newReader(r))
+	}
+}
+
+// newReader returns a Reader for r that handles duplicate column
+// names, empty and null cells, non-finite doubles, lists and times
+// without a zone offset as specified by the flags.
+func newReader(r io.Reader) *annotatedcsv.Reader {
+	cr := annotatedcsv.NewReader(r)
+	cr.SetDuplicateColumns(duplicatePolicy)
+	cr.SetEmptyCells(emptyCells)
+	cr.SetNullMarker(*nullMarker)
+	cr.SetListDelimiter(*listDelim)
+	cr.SetLocation(inputLocation)
+	if *nonFinite == "null" {
+		cr.SetNonFinite(annotatedcsv.NonFiniteNull)
+	}
+	return cr
+}
@@ -0,0 +1,475 @@
+// Package csv2json implements the csv2json command.
+package csv2json
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+	"github.com/rogpeppe/annotatedcsv/internal/serve"
+)
+
+var flags = flag.NewFlagSet("csv2json", flag.ExitOnError)
+
+var (
+	arrayRows   = flags.Bool("array-rows", false, "emit rows as arrays of values in column order rather than objects")
+	stream      = flags.Bool("stream", false, "write each row as it is read rather than reading all tables first; output is not indented")
+	columnsFlag = flags.String("columns", "", "comma-separated list of columns to include, in order; each may be renamed with name:newname")
+	timeFormat  = flags.String("time-format", "rfc3339nano", "format for time values: rfc3339, rfc3339nano, unix (seconds) or unixnano")
+	schemaMode  = flags.Bool("schema", false, "write a JSON Schema describing the rows of the input tables instead of the data")
+	merge       = flags.Bool("merge", false, "write a single array holding the rows of all tables, with columns missing from a table set to null")
+	ndjson      = flags.Bool("ndjson", false, "write one JSON object per row, with _table and _group metadata fields added (implies -stream)")
+	serveAddr   = flags.String("serve", "", "listen on this address (for example :8080) and convert annotated CSV POSTed to any path, responding with the JSON")
+	emptyFlag   = flags.String("empty", "null", "how to treat empty cells in columns without a default: null or zero (the zero value of the column's datatype)")
+	nullMarker  = flags.String("null", "", "treat cells holding exactly this string as null, even in columns with a default")
+	nonFinite   = flags.String("non-finite", "string", "how to write infinite and NaN doubles, which JSON numbers cannot represent: string or null")
+	duplicates  = flags.String("duplicate-columns", "rename", "how to handle duplicate column names in a table: error, first (keep the first column) or rename (add a _2, _3, ... suffix)")
+	location    = flags.String("location", "", "time zone location, such as Europe/London, of input times that lack a zone offset")
+	outLocation = flags.String("output-location", "", "convert all output times to this time zone location, such as UTC")
+	listDelim   = flags.String("list-delimiter", annotatedcsv.DefaultListDelimiter, "delimiter between the elements of values of list datatypes such as list:long")
+)
+
+// duplicatePolicy holds the policy specified by the -duplicate-columns flag.
+var duplicatePolicy annotatedcsv.DuplicatePolicy
+
+// inputLocation and outputLocation hold the locations specified
+// by the -location and -output-location flags, or nil if unset.
+var inputLocation, outputLocation *time.Location
+
+// emptyCells holds the mode specified by the -empty flag.
+var emptyCells annotatedcsv.EmptyCells
+
+type table struct {
+	Columns []column      `json:"columns,omitempty"`
+	Rows    []interface{} `json:"rows"`
+}
+
+// selectedColumns holds the columns specified by the -columns flag.
+var selectedColumns []columnSpec
+
+type columnSpec struct {
+	name    string
+	newName string
+}
+
+type column struct {
+	Name    string      `json:"name"`
+	Index   int         `json:"index"`
+	Group   bool        `json:"group,omitempty"`
+	Default interface{} `json:"default,omitempty"`
+	Type    string      `json:"type,omitempty"`
+	Unit    string      `json:"unit,omitempty"`
+
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Parse(args)
+	switch *timeFormat {
+	case "rfc3339", "rfc3339nano", "unix", "unixnano":
+	default:
+		fmt.Fprintf(os.Stderr, "error: unknown time format %q\n", *timeFormat)
+		os.Exit(2)
+	}
+	switch *duplicates {
+	case "error":
+		duplicatePolicy = annotatedcsv.DuplicateError
+	case "first":
+		duplicatePolicy = annotatedcsv.DuplicateKeepFirst
+	case "rename":
+		duplicatePolicy = annotatedcsv.DuplicateRename
+	default:
+		fmt.Fprintf(os.Stderr, "error: unknown -duplicate-columns value %q\n", *duplicates)
+		os.Exit(2)
+	}
+	switch *emptyFlag {
+	case "null":
+		emptyCells = annotatedcsv.EmptyNull
+	case "zero":
+		emptyCells = annotatedcsv.EmptyZero
+	default:
+		fmt.Fprintf(os.Stderr, "error: unknown -empty value %q\n", *emptyFlag)
+		os.Exit(2)
+	}
+	for _, f := range []struct {
+		name string
+		s    string
+		loc  **time.Location
+	}{{"-location", *location, &inputLocation}, {"-output-location", *outLocation, &outputLocation}} {
+		if f.s == "" {
+			continue
+		}
+		loc, err := time.LoadLocation(f.s)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: invalid %s flag: %v\n", f.name, err)
+			os.Exit(2)
+		}
+		*f.loc = loc
+	}
+	switch *nonFinite {
+	case "string", "null":
+	default:
+		fmt.Fprintf(os.Stderr, "error: unknown -non-finite value %q\n", *nonFinite)
+		os.Exit(2)
+	}
+	if *columnsFlag != "" {
+		specs, err := parseColumnSpecs(*columnsFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: invalid -columns flag: %v\n", err)
+			os.Exit(2)
+		}
+		selectedColumns = specs
+	}
+	if *merge && (*stream || *ndjson) {
+		fmt.Fprintf(os.Stderr, "error: cannot use -merge with -stream or -ndjson\n")
+		os.Exit(2)
+	}
+	if *arrayRows && (*ndjson || *merge) {
+		fmt.Fprintf(os.Stderr, "error: cannot use -array-rows with -ndjson or -merge\n")
+		os.Exit(2)
+	}
+	if *serveAddr != "" {
+		if flags.NArg() > 0 {
+			fmt.Fprintf(os.Stderr, "error: cannot use file arguments with -serve\n")
+			os.Exit(2)
+		}
+		contentType := "application/json"
+		if *ndjson {
+			contentType = "application/x-ndjson"
+		}
+		err := serve.ListenAndServe(*serveAddr, contentType, func(w io.Writer, r io.Reader) error {
+			return convert(readerInputs(r), w)
+		})
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	files, err := input.Files(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	if err := convert(fileInputs(files), os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// convert writes the JSON for the tables read from in to w,
+// in the form specified by the flags.
+func convert(in inputs, w io.Writer) error {
+	if *schemaMode {
+		s, err := rowSchemas(in)
+		if err != nil {
+			return err
+		}
+		return writeIndented(w, s)
+	}
+	if *ndjson {
+		return writeNDJSON(in, w)
+	}
+	if *stream {
+		return streamTables(in, w)
+	}
+	var csvTables []*annotatedcsv.Table
+	err := in(func(r *annotatedcsv.Reader) error {
+		for r.NextTable() {
+			t := &annotatedcsv.Table{
+				Columns: r.Columns(),
+			}
+			for r.NextRow() {
+				t.Rows = append(t.Rows, r.Row())
+			}
+			csvTables = append(csvTables, t)
+		}
+		return r.Err()
+	})
+	if err != nil {
+		return err
+	}
+	var result interface{}
+	if *merge {
+		result = mergedRows(csvTables)
+	} else {
+		tables := make([]*table, len(csvTables))
+		for i, t := range csvTables {
+			tables[i] = jsonTable(t)
+		}
+		result = tables
+	}
+	return writeIndented(w, result)
+}
+
+// writeIndented writes v to w as indented JSON.
+func writeIndented(w io.Writer, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return fmt.Errorf("cannot marshal JSON: %v", err)
+	}
+	data = append(data, '\n')
+	_, err = w.Write(data)
+	return err
+}
+
+// streamTables writes the same JSON structure as main does in
+// non-streaming mode, but encodes each row as soon as it is
+// read so that memory usage does not depend on the size of
+// the input.
+func streamTables(in inputs, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	bw.WriteString("[")
+	ntables := 0
+	err := in(func(r *annotatedcsv.Reader) error {
+		for r.NextTable() {
+			if ntables > 0 {
+				bw.WriteString(",")
+			}
+			ntables++
+			cols := jsonColumns(r.Columns())
+			bw.WriteString("\n{\"columns\":")
+			if err := enc.Encode(cols); err != nil {
+				return fmt.Errorf("cannot marshal JSON: %v", err)
+			}
+			bw.WriteString(",\"rows\":[")
+			nrows := 0
+			for r.NextRow() {
+				if nrows > 0 {
+					bw.WriteString(",")
+				}
+				nrows++
+				if err := enc.Encode(jsonRow(cols, r.Row())); err != nil {
+					return fmt.Errorf("cannot marshal JSON: %v", err)
+				}
+			}
+			bw.WriteString("]}")
+		}
+		return r.Err()
+	})
+	if err != nil {
+		bw.Flush()
+		return err
+	}
+	bw.WriteString("\n]\n")
+	return bw.Flush()
+}
+
+// writeNDJSON writes each row read from in as a
+// separate JSON object on its own line. As well as the row's
+// values, each object holds the index of the table it came from
+// in the _table field and the names of the table's group columns
+// in the _group field, unless the table already has columns of
+// those names.
+func writeNDJSON(in inputs, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	tableIndex := 0
+	err := in(func(r *annotatedcsv.Reader) error {
+		for ; r.NextTable(); tableIndex++ {
+			cols := jsonColumns(r.Columns())
+			group := []string{}
+			for _, col := range cols {
+				if col.Group {
+					group = append(group, col.Name)
+				}
+			}
+			for r.NextRow() {
+				row := jsonRow(cols, r.Row()).(map[string]interface{})
+				if _, ok := row["_table"]; !ok {
+					row["_table"] = tableIndex
+				}
+				if _, ok := row["_group"]; !ok {
+					row["_group"] = group
+				}
+				if err := enc.Encode(row); err != nil {
+					return fmt.Errorf("cannot marshal JSON: %v", err)
+				}
+			}
+		}
+		return r.Err()
+	})
+	if err != nil {
+		bw.Flush()
+		return err
+	}
+	return bw.Flush()
+}
+
+// mergedRows returns the rows of all the given tables. Each row
+// holds a value for every column found in any of the tables.
+func mergedRows(csvTables []*annotatedcsv.Table) []interface{} {
+	var allNames []string
+	found := make(map[string]bool)
+	tableCols := make([][]column, len(csvTables))
+	nrows := 0
+	for i, t := range csvTables {
+		tableCols[i] = jsonColumns(t.Columns)
+		for _, col := range tableCols[i] {
+			if !found[col.Name] {
+				found[col.Name] = true
+				allNames = append(allNames, col.Name)
+			}
+		}
+		nrows += len(t.Rows)
+	}
+	rows := make([]interface{}, 0, nrows)
+	for i, t := range csvTables {
+		for _, row := range t.Rows {
+			rowMap := jsonRow(tableCols[i], row).(map[string]interface{})
+			for _, name := range allNames {
+				if _, ok := rowMap[name]; !ok {
+					rowMap[name] = nil
+				}
+			}
+			rows = append(rows, rowMap)
+		}
+	}
+	return rows
+}
+
+func jsonTable(t *annotatedcsv.Table) *table {
+	cols := jsonColumns(t.Columns)
+	rows := make([]interface{}, len(t.Rows))
+	for i, row := range t.Rows {
+		rows[i] = jsonRow(cols, row)
+	}
+	return &table{
+		Rows:    rows,
+		Columns: cols,
+	}
+}
+
+// parseColumnSpecs parses the value of the -columns flag.
+func parseColumnSpecs(s string) ([]columnSpec, error) {
+	var specs []columnSpec
+	for _, f := range strings.Split(s, ",") {
+		name, newName := f, f
+		if i := strings.Index(f, ":"); i >= 0 {
+			name, newName = f[:i], f[i+1:]
+		}
+		if name == "" || newName == "" {
+			return nil, fmt.Errorf("empty column name in %q", f)
+		}
+		specs = append(specs, columnSpec{
+			name:    name,
+			newName: newName,
+		})
+	}
+	return specs, nil
+}
+
+// jsonColumns returns the columns worth including in the
+// output. An unnamed column without a default is the
+// annotation column. If columns have been selected
+// with the -columns flag, only those are returned;
+// selected columns not in the table are omitted.
+func jsonColumns(csvCols []annotatedcsv.Column) []column {
+	var cols []column
+	if selectedColumns != nil {
+		for _, spec := range selectedColumns {
+			for i, col := range csvCols {
+				if col.Name != spec.name {
+					continue
+				}
+				cols = append(cols, column{
+					Name:    spec.newName,
+					Index:   i,
+					Group:   col.Group,
+					Default: jsonValue(col.Default),
+					Type:    col.Type,
+					Unit:    col.Unit,
+
+					Annotations: col.Extra,
+				})
+				break
+			}
+		}
+		return cols
+	}
+	for i, col := range csvCols {
+		if col.Name == "" && col.Default == nil {
+			continue
+		}
+		cols = append(cols, column{
+			Name:    col.Name,
+			Index:   i,
+			Group:   col.Group,
+			Default: jsonValue(col.Default),
+			Type:    col.Type,
+			Unit:    col.Unit,
+
+			Annotations: col.Extra,
+		})
+	}
+	return cols
+}
+
+// jsonRow returns the JSON representation of the given row.
+func jsonRow(cols []column, row []interface{}) interface{} {
+	if *arrayRows {
+		rowVals := make([]interface{}, len(cols))
+		for i, col := range cols {
+			rowVals[i] = jsonValue(row[col.Index])
+		}
+		return rowVals
+	}
+	rowMap := make(map[string]interface{})
+	for _, col := range cols {
+		rowMap[col.Name] = jsonValue(row[col.Index])
+	}
+	return rowMap
+}
+
+// jsonValue returns the value to marshal as JSON for the given
+// value from a row.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []time.Time:
+		vals := make([]interface{}, len(v))
+		for i, t := range v {
+			vals[i] = jsonValue(t)
+		}
+		return vals
+	case []float64:
+		vals := make([]interface{}, len(v))
+		for i, x := range v {
+			vals[i] = x
+			if math.IsInf(x, 0) || math.IsNaN(x) {
+				// Represent non-finite list elements in
+				// the same way as non-finite doubles.
+				vals[i] = nil
+				if *nonFinite == "string" {
+					vals[i] = strconv.FormatFloat(x, 'g', -1, 64)
+				}
+			}
+		}
+		return vals
+	}
+	t, ok := v.(time.Time)
+	if !ok {
+		return v
+	}
+	if outputLocation != nil {
+		t = t.In(outputLocation)
+	}
+	switch *timeFormat {
+	case "rfc3339":
+		return t.Format(time.RFC3339)
+	case "unix":
+		return t.Unix()
+	case "unixnano":
+		return t.UnixNano()
+	}
+	return t.Format(time.RFC3339Nano)
+}
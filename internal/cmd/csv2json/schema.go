@@ -0,0 +1,123 @@
+package csv2json
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/rogpeppe/annotatedcsv"
+)
+
+// rowSchemas returns a JSON Schema describing the row objects
+// produced for the tables read from in. When the tables have
+// differing columns, the schema has a oneOf clause with an entry
+// for each distinct table schema.
+func rowSchemas(in inputs) (map[string]interface{}, error) {
+	var schemas []interface{}
+	found := make(map[string]bool)
+	err := in(func(r *annotatedcsv.Reader) error {
+		for r.NextTable() {
+			schema := rowSchema(jsonColumns(r.Columns()))
+			data, err := json.Marshal(schema)
+			if err != nil {
+				return fmt.Errorf("cannot marshal JSON: %v", err)
+			}
+			if found[string(data)] {
+				continue
+			}
+			found[string(data)] = true
+			schemas = append(schemas, schema)
+		}
+		return r.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	var schema map[string]interface{}
+	switch len(schemas) {
+	case 0:
+		schema = make(map[string]interface{})
+	case 1:
+		schema = schemas[0].(map[string]interface{})
+	default:
+		schema = map[string]interface{}{
+			"oneOf": schemas,
+		}
+	}
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	return schema, nil
+}
+
+// rowSchema returns the JSON Schema for a row of a table with
+// the given columns.
+func rowSchema(cols []column) map[string]interface{} {
+	props := make(map[string]interface{})
+	required := []string{}
+	for _, col := range cols {
+		prop := valueSchema(col.Type)
+		if nullable(col) {
+			prop = map[string]interface{}{
+				"anyOf": []interface{}{prop, map[string]interface{}{"type": "null"}},
+			}
+		}
+		prop["x-datatype"] = col.Type
+		if col.Group {
+			prop["x-group"] = true
+		}
+		props[col.Name] = prop
+		required = append(required, col.Name)
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           props,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// nullable reports whether values in the given column may be null.
+func nullable(col column) bool {
+	switch {
+	case col.Default == nil && emptyCells == annotatedcsv.EmptyNull:
+		return true
+	case *nullMarker != "":
+		return true
+	case col.Type == "double" && *nonFinite == "null":
+		return true
+	}
+	return false
+}
+
+// valueSchema returns the JSON Schema for a value of the given
+// annotated CSV datatype as marshaled by jsonValue.
+func valueSchema(typ string) map[string]interface{} {
+	switch annotatedcsv.DatatypeKind(typ) {
+	case annotatedcsv.BooleanKind:
+		return map[string]interface{}{"type": "boolean"}
+	case annotatedcsv.LongKind:
+		return map[string]interface{}{"type": "integer"}
+	case annotatedcsv.UnsignedLongKind:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case annotatedcsv.DoubleKind:
+		if *nonFinite == "null" {
+			return map[string]interface{}{"type": "number"}
+		}
+		// Infinities and NaN are represented as strings.
+		return map[string]interface{}{"type": []string{"number", "string"}}
+	case annotatedcsv.DecimalKind:
+		return map[string]interface{}{"type": "number"}
+	case annotatedcsv.UUIDKind:
+		return map[string]interface{}{"type": "string", "format": "uuid"}
+	case annotatedcsv.IPKind, annotatedcsv.CIDRKind, annotatedcsv.StringKind:
+		return map[string]interface{}{"type": "string"}
+	case annotatedcsv.ListKind:
+		return map[string]interface{}{"type": "array", "items": valueSchema(strings.TrimPrefix(typ, "list:"))}
+	case annotatedcsv.DateTimeKind:
+		switch *timeFormat {
+		case "unix", "unixnano":
+			return map[string]interface{}{"type": "integer"}
+		}
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	return make(map[string]interface{})
+}
@@ -0,0 +1,148 @@
+package csv2lineprotocol
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv/internal/lineprotocol"
+)
+
+// batchWriter is an io.WriteCloser that groups the lines written
+// to it into batches and calls send for each one. A batch holds
+// only complete lines and is sent when it reaches maxLines lines
+// or maxBytes bytes, or when data has been waiting for longer than
+// flushInterval.
+type batchWriter struct {
+	send          func([]byte) error
+	maxLines      int
+	maxBytes      int
+	flushInterval time.Duration
+
+	mu sync.Mutex
+	// buf holds data not yet sent, and nlines holds
+	// the number of complete lines in buf, which end at
+	// offset complete.
+	buf      bytes.Buffer
+	nlines   int
+	complete int
+	// timer is non-nil when a timed flush is pending.
+	timer *time.Timer
+	// err holds any error from a timed flush.
+	err error
+}
+
+// newBatchWriter returns a batchWriter that calls send for each batch.
+// A zero maxLines or maxBytes means no limit; a zero flushInterval
+// means that partial batches are only sent on Close.
+func newBatchWriter(send func([]byte) error, maxLines, maxBytes int, flushInterval time.Duration) *batchWriter {
+	return &batchWriter{
+		send:          send,
+		maxLines:      maxLines,
+		maxBytes:      maxBytes,
+		flushInterval: flushInterval,
+	}
+}
+
+// Write implements io.Writer.
+func (w *batchWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.buf.Write(p)
+	for {
+		// Newlines inside string fields do not end lines.
+		i := lineprotocol.LineEnd(w.buf.Bytes()[w.complete:])
+		if i < 0 {
+			break
+		}
+		w.complete += i + 1
+		w.nlines++
+	}
+	for w.full() {
+		if err := w.sendLines(w.batchEnd()); err != nil {
+			return 0, err
+		}
+	}
+	if w.nlines > 0 && w.flushInterval > 0 && w.timer == nil {
+		w.timer = time.AfterFunc(w.flushInterval, w.timedFlush)
+	}
+	return len(p), nil
+}
+
+// Close sends any remaining data, including any final
+// incomplete line.
+func (w *batchWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	if w.err != nil {
+		return w.err
+	}
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	err := w.send(w.buf.Bytes())
+	w.buf.Reset()
+	w.nlines = 0
+	w.complete = 0
+	return err
+}
+
+func (w *batchWriter) timedFlush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timer == nil {
+		// Close has been called.
+		return
+	}
+	w.timer = nil
+	for w.err == nil && w.nlines > 0 {
+		w.err = w.sendLines(w.batchEnd())
+	}
+}
+
+// full reports whether the buffered data holds a complete batch.
+func (w *batchWriter) full() bool {
+	if w.nlines == 0 {
+		return false
+	}
+	if w.maxLines > 0 && w.nlines >= w.maxLines {
+		return true
+	}
+	return w.maxBytes > 0 && w.buf.Len() >= w.maxBytes
+}
+
+// batchEnd returns the length of the next batch in the buffer.
+// There must be at least one complete line buffered.
+func (w *batchWriter) batchEnd() int {
+	data := w.buf.Bytes()
+	end := 0
+	for n := 0; n < w.nlines; n++ {
+		if w.maxLines > 0 && n >= w.maxLines {
+			break
+		}
+		next := end + lineprotocol.LineEnd(data[end:]) + 1
+		if w.maxBytes > 0 && next > w.maxBytes && n > 0 {
+			break
+		}
+		end = next
+	}
+	return end
+}
+
+// sendLines sends the first n bytes of the buffer,
+// which must hold only complete lines.
+func (w *batchWriter) sendLines(n int) error {
+	data := w.buf.Next(n)
+	for rest := data; len(rest) > 0; w.nlines-- {
+		rest = rest[lineprotocol.LineEnd(rest)+1:]
+	}
+	w.complete -= n
+	return w.send(data)
+}
@@ -0,0 +1,198 @@
+package csv2lineprotocol
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchRecorder records the batches sent by a batchWriter.
+type batchRecorder struct {
+	mu      sync.Mutex
+	batches []string
+	// err is returned by send when non-nil.
+	err error
+}
+
+func (r *batchRecorder) send(data []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.batches = append(r.batches, string(data))
+	return nil
+}
+
+func (r *batchRecorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.batches...)
+}
+
+var batchWriterTests = []struct {
+	testName      string
+	maxLines      int
+	maxBytes      int
+	writes        []string
+	expectBatches []string
+	// expectClose holds the batches sent after Close.
+	expectClose []string
+}{{
+	testName:      "line-limit",
+	maxLines:      2,
+	writes:        []string{"m a=1\nm a=2\nm a=3\nm a=4\nm a=5\n"},
+	expectBatches: []string{"m a=1\nm a=2\n", "m a=3\nm a=4\n"},
+	expectClose:   []string{"m a=1\nm a=2\n", "m a=3\nm a=4\n", "m a=5\n"},
+}, {
+	testName:      "exact-line-limit",
+	maxLines:      2,
+	writes:        []string{"m a=1\n", "m a=2\n"},
+	expectBatches: []string{"m a=1\nm a=2\n"},
+	expectClose:   []string{"m a=1\nm a=2\n"},
+}, {
+	testName:      "byte-limit",
+	maxBytes:      13,
+	writes:        []string{"m a=1\n", "m a=2\n", "m a=3\n"},
+	expectBatches: []string{"m a=1\nm a=2\n"},
+	expectClose:   []string{"m a=1\nm a=2\n", "m a=3\n"},
+}, {
+	testName:      "exact-byte-limit",
+	maxBytes:      12,
+	writes:        []string{"m a=1\nm a=2\nm a=3\n"},
+	expectBatches: []string{"m a=1\nm a=2\n"},
+	expectClose:   []string{"m a=1\nm a=2\n", "m a=3\n"},
+}, {
+	// A line longer than the byte limit is sent on its own.
+	testName:      "long-line",
+	maxBytes:      8,
+	writes:        []string{"m a=1\nm a=1234567\nm a=2\n"},
+	expectBatches: []string{"m a=1\n", "m a=1234567\n"},
+	expectClose:   []string{"m a=1\n", "m a=1234567\n", "m a=2\n"},
+}, {
+	testName:      "both-limits",
+	maxLines:      3,
+	maxBytes:      100,
+	writes:        []string{"m a=1\nm a=2\nm a=3\nm a=4\n"},
+	expectBatches: []string{"m a=1\nm a=2\nm a=3\n"},
+	expectClose:   []string{"m a=1\nm a=2\nm a=3\n", "m a=4\n"},
+}, {
+	testName:    "no-limits",
+	writes:      []string{"m a=1\n", "m a=2\n"},
+	expectClose: []string{"m a=1\nm a=2\n"},
+}, {
+	// Lines split across writes are only sent once they are complete.
+	testName:      "split-lines",
+	maxLines:      1,
+	writes:        []string{"m a", "=1\nm a=", "2", "\n"},
+	expectBatches: []string{"m a=1\n", "m a=2\n"},
+	expectClose:   []string{"m a=1\n", "m a=2\n"},
+}, {
+	testName:      "newline-in-string-field",
+	maxLines:      1,
+	writes:        []string{"m s=\"a\nb\" 1\nm a=2\n"},
+	expectBatches: []string{"m s=\"a\nb\" 1\n", "m a=2\n"},
+	expectClose:   []string{"m s=\"a\nb\" 1\n", "m a=2\n"},
+}, {
+	// Close sends a final incomplete line.
+	testName:      "incomplete-last-line",
+	maxLines:      1,
+	writes:        []string{"m a=1\nm a=2"},
+	expectBatches: []string{"m a=1\n"},
+	expectClose:   []string{"m a=1\n", "m a=2"},
+}, {
+	testName: "nothing-written",
+	maxLines: 1,
+}}
+
+func TestBatchWriter(t *testing.T) {
+	for _, test := range batchWriterTests {
+		t.Run(test.testName, func(t *testing.T) {
+			var rec batchRecorder
+			w := newBatchWriter(rec.send, test.maxLines, test.maxBytes, 0)
+			for _, s := range test.writes {
+				n, err := w.Write([]byte(s))
+				if err != nil || n != len(s) {
+					t.Fatalf("Write returned %d, %v", n, err)
+				}
+			}
+			if got := rec.get(); !reflect.DeepEqual(got, test.expectBatches) {
+				t.Fatalf("unexpected batches before Close\ngot  %q\nwant %q", got, test.expectBatches)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got := rec.get(); !reflect.DeepEqual(got, test.expectClose) {
+				t.Fatalf("unexpected batches after Close\ngot  %q\nwant %q", got, test.expectClose)
+			}
+		})
+	}
+}
+
+func TestBatchWriterFlushInterval(t *testing.T) {
+	var rec batchRecorder
+	w := newBatchWriter(rec.send, 10, 0, 10*time.Millisecond)
+	if _, err := w.Write([]byte("m a=1\nm a=")); err != nil {
+		t.Fatal(err)
+	}
+	// The complete line is sent when the interval has passed,
+	// leaving the incomplete line buffered.
+	waitForBatches(t, &rec, 1)
+	if got, want := rec.get(), []string{"m a=1\n"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected batches\ngot  %q\nwant %q", got, want)
+	}
+	if _, err := w.Write([]byte("2\n")); err != nil {
+		t.Fatal(err)
+	}
+	waitForBatches(t, &rec, 2)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rec.get(), []string{"m a=1\n", "m a=2\n"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected batches\ngot  %q\nwant %q", got, want)
+	}
+}
+
+// waitForBatches waits until rec has recorded n batches.
+func waitForBatches(t *testing.T, rec *batchRecorder, n int) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for len(rec.get()) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d batches; got %q", n, rec.get())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBatchWriterSendError(t *testing.T) {
+	rec := batchRecorder{err: errors.New("send failed")}
+	w := newBatchWriter(rec.send, 1, 0, 0)
+	_, err := w.Write([]byte("m a=1\n"))
+	if err == nil || err.Error() != "send failed" {
+		t.Fatalf("unexpected error from Write: %v", err)
+	}
+
+	// An error from a timed flush is returned
+	// from later calls to Write and Close.
+	w = newBatchWriter(rec.send, 10, 0, time.Millisecond)
+	if _, err := w.Write([]byte("m a=1\n")); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		_, err = w.Write(nil)
+		if err != nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err == nil || err.Error() != "send failed" {
+		t.Fatalf("unexpected error from Write after timed flush: %v", err)
+	}
+	if err := w.Close(); err == nil || err.Error() != "send failed" {
+		t.Fatalf("unexpected error from Close: %v", err)
+	}
+}
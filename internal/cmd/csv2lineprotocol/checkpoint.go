@@ -0,0 +1,231 @@
+package csv2lineprotocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+)
+
+// checkpoint records how far through each input file the
+// conversion has got, counting only rows whose lines have been
+// sent, so that an interrupted conversion can be resumed
+// without sending any line twice.
+type checkpoint struct {
+	path string
+
+	// mu guards the fields below. It is needed because
+	// batches may be sent by a timed flush.
+	mu    sync.Mutex
+	state checkpointState
+	// written and sent hold the number of bytes
+	// written to the batch writer and sent by it.
+	written int64
+	sent    int64
+	// marks holds the positions reached in the input
+	// whose lines have not all been sent yet, in order.
+	marks []checkpointMark
+}
+
+// checkpointState holds the contents of a checkpoint file.
+type checkpointState struct {
+	Files map[string]*filePosition `json:"files"`
+}
+
+// filePosition holds the position reached in an input file.
+type filePosition struct {
+	// Offset holds the byte offset of the start of the current table.
+	Offset int64 `json:"offset"`
+	// Table holds the index of the current table in the file.
+	Table int `json:"table"`
+	// Rows holds the number of rows of the current table
+	// that have been converted.
+	Rows int `json:"rows"`
+	// Done holds whether the whole file has been converted.
+	Done bool `json:"done,omitempty"`
+}
+
+type checkpointMark struct {
+	// written holds the number of bytes that must
+	// be sent before pos is reached.
+	written int64
+	file    string
+	pos     filePosition
+}
+
+// loadCheckpoint returns a checkpoint that is saved to the given
+// file, starting from the state in the file if it exists.
+func loadCheckpoint(path string) (*checkpoint, error) {
+	cp := &checkpoint{
+		path: path,
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &cp.state); err != nil {
+			return nil, fmt.Errorf("cannot parse checkpoint file %s: %v", path, err)
+		}
+	}
+	if cp.state.Files == nil {
+		cp.state.Files = make(map[string]*filePosition)
+	}
+	return cp, nil
+}
+
+// send returns a function that calls send and then saves the
+// positions in the input that have been reached as a result.
+func (cp *checkpoint) send(send func([]byte) error) func([]byte) error {
+	return func(data []byte) error {
+		if err := send(data); err != nil {
+			return err
+		}
+		cp.mu.Lock()
+		defer cp.mu.Unlock()
+		cp.sent += int64(len(data))
+		n := 0
+		for ; n < len(cp.marks) && cp.marks[n].written <= cp.sent; n++ {
+			m := cp.marks[n]
+			cp.state.Files[m.file] = &m.pos
+		}
+		if n == 0 {
+			return nil
+		}
+		cp.marks = cp.marks[:copy(cp.marks, cp.marks[n:])]
+		return cp.save()
+	}
+}
+
+// mark records that the given position will have been reached in
+// file once all the data written so far, and n more bytes about to
+// be written, have been sent.
+func (cp *checkpoint) mark(file string, n int64, pos filePosition) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.written += n
+	if len(cp.marks) == 0 && cp.sent >= cp.written {
+		cp.state.Files[file] = &pos
+		return
+	}
+	cp.marks = append(cp.marks, checkpointMark{
+		written: cp.written,
+		file:    file,
+		pos:     pos,
+	})
+}
+
+// save writes the checkpoint file. It is called with cp.mu held.
+func (cp *checkpoint) save() error {
+	data, err := json.Marshal(cp.state)
+	if err != nil {
+		return err
+	}
+	// Write the file atomically so that an interruption
+	// cannot leave a partial checkpoint.
+	tmp := cp.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(data, '\n'), 0666); err != nil {
+		return fmt.Errorf("cannot write checkpoint: %v", err)
+	}
+	if err := os.Rename(tmp, cp.path); err != nil {
+		return fmt.Errorf("cannot write checkpoint: %v", err)
+	}
+	return nil
+}
+
+// remove removes the checkpoint file.
+func (cp *checkpoint) remove() error {
+	if err := os.Remove(cp.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// convert writes the line protocol for the given file to w,
+// starting from the position recorded in the checkpoint.
+// The lines must be sent by a function returned by cp.send.
+func (cp *checkpoint) convert(file string, w io.Writer) error {
+	var pos filePosition
+	cp.mu.Lock()
+	if p := cp.state.Files[file]; p != nil {
+		pos = *p
+	}
+	cp.mu.Unlock()
+	if pos.Done {
+		return nil
+	}
+	f, err := input.OpenAt(file, pos.Offset)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := cp.convertTables(file, f, pos, w); err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	cp.mark(file, 0, filePosition{Done: true})
+	return nil
+}
+
+// convertTables converts the tables read from rd, which starts at
+// the given position in file.
+func (cp *checkpoint) convertTables(file string, rd io.Reader, pos filePosition, w io.Writer) error {
+	var nread int64
+	// The CSV reader uses a *bufio.Reader passed to it rather than
+	// adding its own buffering, so the offset of the end of the last
+	// row read is the number of bytes read less the number buffered.
+	br := bufio.NewReader(&countingReader{prog.reader(rd), &nread})
+	offset := func() int64 {
+		return pos.Offset + nread - int64(br.Buffered())
+	}
+	r := newReader(br)
+	tableStart, table, skip := pos.Offset, pos.Table, pos.Rows
+	// end holds the offset of the end of the last row read. It is
+	// also the start of the next table, because the reader has to
+	// read the first row of the next table to find where a table ends.
+	end := tableStart
+	for r.NextTable() {
+		end = offset()
+		info, err := tableInfoForColumns(r.Columns())
+		if err != nil {
+			return fmt.Errorf("cannot get table info for columns: %v", err)
+		}
+		var line bytes.Buffer
+		for nrows := 0; r.NextRow(); nrows++ {
+			end = offset()
+			if nrows < skip {
+				// The row was converted before the checkpoint.
+				continue
+			}
+			if nrows == skip {
+				prog.startTable(r.Columns(), r.Row())
+			}
+			prog.addRows(1)
+			line.Reset()
+			ok, err := appendLine(&line, info, r.Row())
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			// Mark the position before writing, because the
+			// write may send the batch holding the line.
+			cp.mark(file, int64(line.Len()), filePosition{
+				Offset: tableStart,
+				Table:  table,
+				Rows:   nrows + 1,
+			})
+			if _, err := w.Write(line.Bytes()); err != nil {
+				return err
+			}
+		}
+		tableStart, table, skip = end, table+1, 0
+	}
+	return r.Err()
+}
@@ -0,0 +1,194 @@
+package csv2lineprotocol
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const checkpointTestData = `#datatype,measurement,long,dateTime:number
+#group,true,false,false
+#default,,,
+,_measurement,a,_time
+,m,1,1
+,m,2,2
+,m,3,3
+
+#datatype,measurement,long,dateTime:number
+#group,true,false,false
+#default,,,
+,_measurement,a,_time
+,n,4,4
+,n,,5
+,n,6,6
+#datatype,measurement,double,dateTime:number
+#group,true,false,false
+#default,,,
+,_measurement,b,_time
+,o,7.5,7
+`
+
+// expectCheckpointLines holds the lines converted from
+// checkpointTestData. The row with a null value has no line.
+var expectCheckpointLines = []string{
+	"m a=1i 1\n",
+	"m a=2i 2\n",
+	"m a=3i 3\n",
+	"n a=4i 4\n",
+	"n a=6i 6\n",
+	"o b=7.5 7\n",
+}
+
+// runCheckpoint converts the given file with the checkpoint stored
+// in cpFile, sending each line in its own batch. The first maxSends
+// batches are sent, and later sends fail. It returns the lines sent
+// and the error from the conversion.
+func runCheckpoint(t *testing.T, file, cpFile string, maxSends int) ([]string, error) {
+	cp, err := loadCheckpoint(cpFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sent []string
+	send := cp.send(func(data []byte) error {
+		if len(sent) >= maxSends {
+			return errors.New("send failed")
+		}
+		sent = append(sent, string(data))
+		return nil
+	})
+	w := newBatchWriter(send, 1, 0, 0)
+	err = cp.convert(file, w)
+	if err == nil {
+		err = w.Close()
+	}
+	return sent, err
+}
+
+func writeCheckpointTestFile(t *testing.T) (dir, file string) {
+	dir = t.TempDir()
+	file = filepath.Join(dir, "data.csv")
+	if err := os.WriteFile(file, []byte(checkpointTestData), 0666); err != nil {
+		t.Fatal(err)
+	}
+	return dir, file
+}
+
+func TestCheckpointResume(t *testing.T) {
+	// Interrupt the conversion after each number of lines,
+	// including at table boundaries, and check that resuming
+	// sends each line exactly once.
+	for n := 0; n <= len(expectCheckpointLines); n++ {
+		dir, file := writeCheckpointTestFile(t)
+		cpFile := filepath.Join(dir, "checkpoint")
+		sent, err := runCheckpoint(t, file, cpFile, n)
+		if n < len(expectCheckpointLines) {
+			if err == nil || err.Error() != file+": send failed" {
+				t.Fatalf("interrupted after %d lines: unexpected error %v", n, err)
+			}
+			sent1, err := runCheckpoint(t, file, cpFile, len(expectCheckpointLines))
+			if err != nil {
+				t.Fatalf("resumed after %d lines: %v", n, err)
+			}
+			sent = append(sent, sent1...)
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(sent, expectCheckpointLines) {
+			t.Fatalf("interrupted after %d lines: unexpected lines\ngot  %q\nwant %q", n, sent, expectCheckpointLines)
+		}
+		// A completed file is not converted again.
+		sent, err = runCheckpoint(t, file, cpFile, 0)
+		if err != nil || len(sent) != 0 {
+			t.Fatalf("converting completed file sent %q, %v", sent, err)
+		}
+	}
+}
+
+func TestCheckpointState(t *testing.T) {
+	dir, file := writeCheckpointTestFile(t)
+	cpFile := filepath.Join(dir, "checkpoint")
+	if _, err := runCheckpoint(t, file, cpFile, 4); err == nil {
+		t.Fatal("expected error")
+	}
+	cp, err := loadCheckpoint(cpFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Four lines were sent: all of the first table
+	// and the first row of the second.
+	want := &filePosition{
+		Offset: int64(strings.Index(checkpointTestData, "\n\n") + 1),
+		Table:  1,
+		Rows:   1,
+	}
+	if got := cp.state.Files[file]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected position; got %+v want %+v", got, want)
+	}
+	if err := cp.remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(cpFile); !os.IsNotExist(err) {
+		t.Fatalf("checkpoint file not removed: %v", err)
+	}
+	// Removing a checkpoint file that does not exist is OK.
+	if err := cp.remove(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadCheckpointMissing(t *testing.T) {
+	cp, err := loadCheckpoint(filepath.Join(t.TempDir(), "checkpoint"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cp.state.Files) != 0 {
+		t.Fatalf("unexpected state %+v", cp.state)
+	}
+}
+
+func TestLoadCheckpointCorrupt(t *testing.T) {
+	for _, data := range []string{"", "{", `{"files":{"x":{"offset":"a"}}}`} {
+		cpFile := filepath.Join(t.TempDir(), "checkpoint")
+		if err := os.WriteFile(cpFile, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+		_, err := loadCheckpoint(cpFile)
+		if err == nil || !strings.HasPrefix(err.Error(), "cannot parse checkpoint file "+cpFile+": ") {
+			t.Fatalf("unexpected error for %q: %v", data, err)
+		}
+	}
+}
+
+func TestCheckpointAtomicSave(t *testing.T) {
+	dir, file := writeCheckpointTestFile(t)
+	cpFile := filepath.Join(dir, "checkpoint")
+	if _, err := runCheckpoint(t, file, cpFile, 1); err == nil {
+		t.Fatal("expected error")
+	}
+	before, err := os.ReadFile(cpFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(cpFile + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temporary file left behind: %v", err)
+	}
+	// When the new checkpoint cannot be written, the
+	// old one is left intact.
+	if err := os.Mkdir(cpFile+".tmp", 0777); err != nil {
+		t.Fatal(err)
+	}
+	_, err = runCheckpoint(t, file, cpFile, 1)
+	if err == nil || !strings.HasPrefix(err.Error(), file+": cannot write checkpoint: ") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	after, err := os.ReadFile(cpFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Fatalf("checkpoint changed after failed save\ngot  %s\nwant %s", after, before)
+	}
+}
@@ -0,0 +1,77 @@
+package csv2lineprotocol
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadConfig reads the YAML configuration file at path and
+// applies it to the command line flags. The configuration is a
+// mapping from flag names (without the leading hyphen) to values.
+// Repeatable flags may be given a list of values, and the -rename
+// and -add-tag flags may also be given a mapping, for example:
+//
+//	rename:
+//	  _value: value
+//	drop: [_start, _stop]
+//	measurement: cpu
+//	add-tag:
+//	  env: production
+//
+// Flags set on the command line take precedence over single values
+// in the configuration; list and mapping values add to them.
+func loadConfig(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var config map[string]interface{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("cannot parse %s: %v", path, err)
+	}
+	setOnCommandLine := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		setOnCommandLine[f.Name] = true
+	})
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == "config" || flags.Lookup(name) == nil {
+			return fmt.Errorf("%s: unknown configuration key %q", path, name)
+		}
+		var values []string
+		switch v := config[name].(type) {
+		case []interface{}:
+			for _, elem := range v {
+				values = append(values, fmt.Sprint(elem))
+			}
+		case map[string]interface{}:
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				values = append(values, fmt.Sprintf("%s=%v", key, v[key]))
+			}
+		default:
+			if setOnCommandLine[name] {
+				continue
+			}
+			values = []string{fmt.Sprint(v)}
+		}
+		for _, value := range values {
+			if err := flags.Set(name, value); err != nil {
+				return fmt.Errorf("%s: invalid value for %q: %v", path, name, err)
+			}
+		}
+	}
+	return nil
+}
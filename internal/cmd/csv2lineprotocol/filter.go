@@ -0,0 +1,117 @@
+package csv2lineprotocol
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv"
+)
+
+// wherePredicate holds a predicate specified with the -where flag.
+type wherePredicate struct {
+	column string
+	value  string
+	negate bool
+}
+
+// whereFlag implements flag.Value by recording
+// predicates of the form column=value or column!=value.
+type whereFlag []wherePredicate
+
+func (f *whereFlag) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("%q is not in the form column=value or column!=value", s)
+	}
+	p := wherePredicate{
+		column: s[:i],
+		value:  s[i+1:],
+	}
+	if strings.HasSuffix(p.column, "!") {
+		p.column = strings.TrimSuffix(p.column, "!")
+		p.negate = true
+	}
+	*f = append(*f, p)
+	return nil
+}
+
+func (f *whereFlag) String() string {
+	var preds []string
+	for _, p := range *f {
+		op := "="
+		if p.negate {
+			op = "!="
+		}
+		preds = append(preds, p.column+op+p.value)
+	}
+	return strings.Join(preds, " ")
+}
+
+// rowFilter decides which rows of a table are converted.
+type rowFilter struct {
+	// indexes holds the index of the column for each
+	// of the where predicates, or -1 if there is none.
+	indexes []int
+	time    int
+}
+
+// newRowFilter returns a filter for a table with the given columns
+// and time column index (-1 if there is no time column).
+func newRowFilter(cols []annotatedcsv.Column, timeIndex int) *rowFilter {
+	f := &rowFilter{
+		indexes: make([]int, len(where)),
+		time:    timeIndex,
+	}
+	for i, p := range where {
+		f.indexes[i] = -1
+		for j, col := range cols {
+			if col.Name == p.column {
+				f.indexes[i] = j
+				break
+			}
+		}
+	}
+	return f
+}
+
+// match reports whether the given row satisfies the -start, -stop
+// and -where flags.
+func (f *rowFilter) match(row []interface{}) bool {
+	if !startTime.IsZero() || !stopTime.IsZero() {
+		t := defaultTime
+		if f.time >= 0 && row[f.time] != nil {
+			t = row[f.time].(time.Time)
+		}
+		if !startTime.IsZero() && t.Before(startTime) {
+			return false
+		}
+		if !stopTime.IsZero() && !t.Before(stopTime) {
+			return false
+		}
+	}
+	for i, p := range where {
+		val := ""
+		if index := f.indexes[i]; index >= 0 {
+			val = valueString(row[index])
+		}
+		if (val == p.value) == p.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// valueString returns v formatted as it would
+// be in annotated CSV.
+func valueString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
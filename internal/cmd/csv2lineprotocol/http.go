@@ -0,0 +1,208 @@
+package csv2lineprotocol
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv/internal/lineprotocol"
+	"github.com/rogpeppe/annotatedcsv/internal/retry"
+)
+
+// httpWriter sends batches of line protocol to the InfluxDB
+// write API.
+type httpWriter struct {
+	client   *http.Client
+	writeURL string
+
+	// token holds the token used for authenticating
+	// with the v2 API. If it is empty, username and
+	// password are used for basic authentication if set.
+	token    string
+	username string
+	password string
+
+	// tokenScheme holds the authorization scheme
+	// used to send the token.
+	tokenScheme string
+
+	// failedOutput, if non-nil, receives the contents
+	// of all batches that could not be written.
+	failedOutput io.Writer
+
+	// failFast holds whether a batch that cannot be written
+	// is an error when there is no failedOutput to receive it.
+	failFast bool
+
+	// batches and linesSent hold the number of batches and
+	// lines sent so far, whether they failed or not.
+	batches   int
+	linesSent int
+	failures  []batchFailure
+}
+
+// batchFailure records a batch that could not be written.
+type batchFailure struct {
+	batch     int
+	firstLine int
+	lastLine  int
+	err       error
+}
+
+// newHTTPWriter returns an httpWriter that writes to the write
+// endpoint at the given path with the given query parameters
+// on the InfluxDB instance at serverURL.
+func newHTTPWriter(serverURL, path string, query url.Values) (*httpWriter, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid URL %q: scheme must be http or https", serverURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	u.RawQuery = query.Encode()
+	return &httpWriter{
+		client:      http.DefaultClient,
+		writeURL:    u.String(),
+		tokenScheme: "Token",
+	}, nil
+}
+
+// send sends a batch of lines as a single gzip-compressed
+// request, retrying on failure. If the batch still cannot
+// be written, the failure is recorded and send returns nil
+// so that later batches are still attempted, unless the
+// error indicates that no later write can succeed either
+// or failFast is set.
+func (w *httpWriter) send(data []byte) error {
+	nlines := 0
+	for rest := data; len(rest) > 0; nlines++ {
+		i := lineprotocol.LineEnd(rest)
+		if i < 0 {
+			// The final line is incomplete.
+			i = len(rest) - 1
+		}
+		rest = rest[i+1:]
+	}
+	w.batches++
+	failure := batchFailure{
+		batch:     w.batches,
+		firstLine: w.linesSent + 1,
+		lastLine:  w.linesSent + nlines,
+	}
+	w.linesSent += nlines
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	var fatal error
+	err := retry.Do(func() (bool, time.Duration, error) {
+		status, retryAfter, err := w.post(body.Bytes())
+		switch status {
+		case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+			fatal = err
+			return false, 0, err
+		}
+		return retry.Status(status), retryAfter, err
+	})
+	if fatal != nil {
+		return fmt.Errorf("cannot write to InfluxDB: %v", fatal)
+	}
+	if err == nil {
+		return nil
+	}
+	if w.failFast && w.failedOutput == nil {
+		return fmt.Errorf("cannot write batch %d: %v", failure.batch, err)
+	}
+	failure.err = err
+	w.failures = append(w.failures, failure)
+	if w.failedOutput != nil {
+		if _, err := w.failedOutput.Write(data); err != nil {
+			return fmt.Errorf("cannot write failed batch: %v", err)
+		}
+	}
+	return nil
+}
+
+// post makes a single write request with the given gzip-compressed
+// body. On failure, it returns the HTTP status code (zero if there was
+// no response) and the delay requested by any Retry-After header.
+func (w *httpWriter) post(body []byte) (status int, retryAfter time.Duration, err error) {
+	req, err := http.NewRequest("POST", w.writeURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("Content-Encoding", "gzip")
+	if w.token != "" {
+		req.Header.Set("Authorization", w.tokenScheme+" "+w.token)
+	} else if w.username != "" || w.password != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return 0, 0, nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	if msg = bytes.TrimSpace(msg); len(msg) > 0 {
+		err = fmt.Errorf("write failed: %s: %s", resp.Status, msg)
+	} else {
+		err = fmt.Errorf("write failed: %s", resp.Status)
+	}
+	return resp.StatusCode, parseRetryAfter(resp.Header.Get("Retry-After")), err
+}
+
+// parseRetryAfter returns the delay specified by the
+// given Retry-After header value, or zero if there is none.
+func parseRetryAfter(s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(s); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(s); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// failureReport returns an error describing all the batches that
+// could not be written, or nil if there were none. Line numbers
+// refer to lines of line-protocol output.
+func (w *httpWriter) failureReport() error {
+	if len(w.failures) == 0 {
+		return nil
+	}
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%d of %d lines could not be written:", w.failedLines(), w.linesSent)
+	for _, f := range w.failures {
+		fmt.Fprintf(&buf, "\n\tbatch %d (lines %d-%d): %v", f.batch, f.firstLine, f.lastLine, f.err)
+	}
+	return fmt.Errorf("%s", buf.String())
+}
+
+func (w *httpWriter) failedLines() int {
+	n := 0
+	for _, f := range w.failures {
+		n += f.lastLine - f.firstLine + 1
+	}
+	return n
+}
@@ -0,0 +1,187 @@
+package csv2lineprotocol
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strings"
+
+	"github.com/rogpeppe/annotatedcsv/internal/kafka"
+	"github.com/rogpeppe/annotatedcsv/internal/lineprotocol"
+)
+
+// kafkaWriter sends batches of line protocol to a Kafka topic,
+// one message per point.
+type kafkaWriter struct {
+	producer *kafka.Producer
+	topic    string
+
+	// key holds how message keys are chosen: series,
+	// measurement or none.
+	key string
+
+	// format holds the format of the message values:
+	// lineprotocol or json.
+	format string
+}
+
+// newKafkaWriter returns a kafkaWriter configured by the
+// -kafka-* flags.
+func newKafkaWriter() (*kafkaWriter, error) {
+	if *kafkaTopic == "" {
+		return nil, fmt.Errorf("-kafka-topic must be specified with -kafka-brokers")
+	}
+	switch *kafkaKey {
+	case "series", "measurement", "none":
+	default:
+		return nil, fmt.Errorf("invalid -kafka-key flag %q", *kafkaKey)
+	}
+	switch *kafkaFormat {
+	case "lineprotocol", "json":
+	default:
+		return nil, fmt.Errorf("invalid -kafka-format flag %q", *kafkaFormat)
+	}
+	cfg := kafka.Config{
+		ClientID: "csv2lineprotocol",
+		Username: *kafkaUsername,
+		Password: *kafkaPassword,
+	}
+	switch *kafkaAcks {
+	case "all":
+		cfg.Acks = kafka.AcksAll
+	case "leader":
+		cfg.Acks = kafka.AcksLeader
+	case "none":
+		cfg.Acks = kafka.AcksNone
+	default:
+		return nil, fmt.Errorf("invalid -kafka-acks flag %q", *kafkaAcks)
+	}
+	if cfg.Username == "" {
+		cfg.Username = os.Getenv("KAFKA_USERNAME")
+	}
+	if cfg.Password == "" {
+		cfg.Password = os.Getenv("KAFKA_PASSWORD")
+	}
+	if *kafkaTLS {
+		cfg.TLS = &tls.Config{}
+	}
+	producer, err := kafka.NewProducer(strings.Split(*kafkaBrokers, ","), cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &kafkaWriter{
+		producer: producer,
+		topic:    *kafkaTopic,
+		key:      *kafkaKey,
+		format:   *kafkaFormat,
+	}, nil
+}
+
+// send implements the batch send function by producing
+// a message for each line in data.
+func (w *kafkaWriter) send(data []byte) error {
+	var msgs []kafka.Message
+	for len(data) > 0 {
+		line := data
+		if i := lineprotocol.LineEnd(data); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			data = nil
+		}
+		if len(line) == 0 {
+			continue
+		}
+		msg, err := w.message(line)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return w.producer.Produce(w.topic, msgs)
+}
+
+// message returns the message for the given line of line
+// protocol, which does not include its terminating newline.
+func (w *kafkaWriter) message(line []byte) (kafka.Message, error) {
+	var msg kafka.Message
+	switch w.key {
+	case "series":
+		// The series key (the measurement and tag set) is the
+		// part of the line before the first unescaped space,
+		// and identifies the group the point came from.
+		h := fnv.New64a()
+		h.Write(line[:seriesKeyLen(line)])
+		msg.Key = []byte(hex.EncodeToString(h.Sum(nil)))
+	case "measurement":
+		msg.Key = line[:measurementLen(line)]
+	}
+	if w.format == "lineprotocol" {
+		msg.Value = line
+		return msg, nil
+	}
+	p, ok, err := lineprotocol.ParseLine(line)
+	if err != nil || !ok {
+		return kafka.Message{}, fmt.Errorf("cannot convert line %q to JSON: %v", line, err)
+	}
+	tags := make(map[string]string)
+	for _, tag := range p.Tags {
+		tags[tag.Key] = tag.Value
+	}
+	fields := make(map[string]interface{})
+	for _, f := range p.Fields {
+		fields[f.Key] = f.Value
+	}
+	msg.Value, err = json.Marshal(jsonPoint{
+		Measurement: p.Measurement,
+		Tags:        tags,
+		Fields:      fields,
+		Time:        p.Time,
+	})
+	if err != nil {
+		return kafka.Message{}, fmt.Errorf("cannot marshal JSON: %v", err)
+	}
+	return msg, nil
+}
+
+// jsonPoint is the JSON form of a point sent with
+// -kafka-format=json. Time is in units of the -precision flag.
+type jsonPoint struct {
+	Measurement string                 `json:"measurement"`
+	Tags        map[string]string      `json:"tags"`
+	Fields      map[string]interface{} `json:"fields"`
+	Time        int64                  `json:"time"`
+}
+
+// seriesKeyLen returns the length of the series key at the
+// start of the line.
+func seriesKeyLen(line []byte) int {
+	return scanUnescaped(line, " ")
+}
+
+// measurementLen returns the length of the measurement
+// at the start of the line.
+func measurementLen(line []byte) int {
+	return scanUnescaped(line, ", ")
+}
+
+// scanUnescaped returns the index of the first byte in line that
+// is one of the terminators and not escaped with a backslash, or
+// len(line) if there is none.
+func scanUnescaped(line []byte, terminators string) int {
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '\\':
+			i++
+		case bytes.IndexByte([]byte(terminators), c) >= 0:
+			return i
+		}
+	}
+	return len(line)
+}
@@ -0,0 +1,952 @@
+// Package csv2lineprotocol implements the csv2lineprotocol command.
+package csv2lineprotocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/netip"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/cmdflag"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+	"github.com/rogpeppe/annotatedcsv/internal/lineprotocol"
+	"github.com/rogpeppe/annotatedcsv/internal/serve"
+)
+
+var flags = flag.NewFlagSet("csv2lineprotocol", flag.ExitOnError)
+
+var (
+	renames = make(keyValueFlag)
+	addTags = make(keyValueFlag)
+	drops   = make(cmdflag.NameSet)
+	fields  = make(cmdflag.NameSet)
+	where   whereFlag
+
+	measurement     = flags.String("measurement", "", "use this measurement name for all points; any _measurement column is ignored")
+	defaultTimeFlag = flags.String("default-time", "", "timestamp to use for tables without a _time column and for rows with a null time; either \"now\" or an RFC3339 time")
+	serverURL       = flags.String("url", "", "write to the InfluxDB server at this URL rather than to the standard output")
+	org             = flags.String("org", "", "organization to write to (with -url)")
+	bucket          = flags.String("bucket", "", "bucket to write to (with -url)")
+	token           = flags.String("token", "", "authentication token (with -url); defaults to $INFLUX_TOKEN")
+	v1              = flags.Bool("v1", false, "produce output compatible with InfluxDB 1.x, which does not support unsigned integers; with -url, use the 1.x write API")
+	db              = flags.String("db", "", "database to write to (with -v1 and -url)")
+	rp              = flags.String("rp", "", "retention policy to write to (with -v1 and -url)")
+	username        = flags.String("username", "", "user name for authentication (with -v1 and -url); defaults to $INFLUX_USERNAME")
+	password        = flags.String("password", "", "password for authentication (with -v1 and -url); defaults to $INFLUX_PASSWORD")
+	batchLines      = flags.Int("batch-lines", 5000, "maximum number of lines in each batch of output; 0 means no limit")
+	batchBytes      = flags.Int("batch-bytes", 0, "maximum number of bytes in each batch of output; 0 means no limit")
+	flushInterval   = flags.Duration("flush-interval", time.Second, "maximum time to hold output before writing an incomplete batch; 0 means hold until the end of the input")
+	failedOutput    = flags.String("failed-output", "", "with -url, write the line protocol of any batches that could not be written to this file")
+	duplicates      = flags.String("duplicates", "error", "what to do when several columns map to the same tag or field name: error, first (keep the first column) or suffix (add _2, _3, etc to later names)")
+	startFlag       = flags.String("start", "", "omit points with a time before this RFC3339 time")
+	stopFlag        = flags.String("stop", "", "omit points with a time at or after this RFC3339 time")
+	workers         = flags.Int("workers", 1, "number of goroutines used to format rows")
+	unordered       = flags.Bool("unordered", false, "with -workers, allow output lines to be written out of input order")
+	concurrentFiles = flags.Int("concurrent-files", 1, "number of input files to convert concurrently; lines from different files may be interleaved")
+	outDir          = flags.String("out-dir", "", "write output to files in this directory rather than to the standard output")
+	maxFileSize     = flags.Int64("max-file-size", 0, "with -out-dir, start a new file before any file exceeds this many bytes; 0 means no limit")
+	splitBy         = flags.String("split-by", "", "with -out-dir, write separate files for each measurement or day (measurement or day)")
+	progressFlag    = flags.Bool("progress", false, "print progress reports to the standard error")
+	configFile      = flags.String("config", "", "read flag settings from this YAML file")
+	measurementFrom = flags.String("measurement-from", "", "take the measurement name from this column; any _measurement column is ignored")
+	serveAddr       = flags.String("serve", "", "listen on this address (for example :8080) and convert annotated CSV POSTed to any path, responding with the line protocol")
+	kafkaBrokers    = flags.String("kafka-brokers", "", "write to the Kafka cluster with these comma-separated bootstrap brokers (host:port) rather than to the standard output, producing one message per point and one request per batch")
+	kafkaTopic      = flags.String("kafka-topic", "", "topic to write to (with -kafka-brokers)")
+	kafkaKey        = flags.String("kafka-key", "series", "message key (with -kafka-brokers): series (a hash of the measurement and tag set, keeping each series in order in a single partition), measurement or none")
+	kafkaFormat     = flags.String("kafka-format", "lineprotocol", "format of message values (with -kafka-brokers): lineprotocol or json")
+	kafkaAcks       = flags.String("kafka-acks", "all", "acknowledgements required before a batch counts as written (with -kafka-brokers): all, leader or none")
+	kafkaTLS        = flags.Bool("kafka-tls", false, "connect to the Kafka brokers using TLS")
+	kafkaUsername   = flags.String("kafka-username", "", "user name for SASL/PLAIN authentication with the Kafka brokers; defaults to $KAFKA_USERNAME")
+	kafkaPassword   = flags.String("kafka-password", "", "password for SASL/PLAIN authentication with the Kafka brokers; defaults to $KAFKA_PASSWORD")
+	precisionFlag   = flags.String("precision", "", "precision of the timestamps written: ns, us, ms or s; timestamps are truncated to this precision and, with -url, the precision is passed to the server (default ns, or ms with -vm)")
+	vm              = flags.Bool("vm", false, "with -url, write to the line protocol endpoint of VictoriaMetrics (the URL's path with /write appended), which needs no -org or -bucket; -token is sent as a bearer token")
+	questdbAddr     = flags.String("questdb", "", "write to QuestDB over its line protocol TCP interface at this host[:port] (default port 9009) rather than to the standard output; unsigned integers are written as for -v1")
+	questdbKeyID    = flags.String("questdb-key-id", "", "key id for authenticating with QuestDB; defaults to $QUESTDB_KEY_ID")
+	questdbKey      = flags.String("questdb-key", "", "private key for authenticating with QuestDB, as the \"d\" value of its JWK; defaults to $QUESTDB_KEY")
+	questdbTLS      = flags.Bool("questdb-tls", false, "connect to QuestDB using TLS")
+	followFlag      = flags.Bool("follow", false, "keep reading the input files, all at once, as they grow, following them when they are rotated or truncated, until interrupted")
+	checkpointFile  = flags.String("checkpoint", "", "record how far the conversion has got in this file, resuming from the position recorded there if the file exists, so that an interrupted conversion does not send any line twice; the file is removed when the conversion completes")
+	telegrafMode    = flags.String("telegraf", "", "run as a Telegraf input plugin: exec (convert the files once, reporting errors without failing) or execd (keep running, converting new or changed files whenever a line is read from the standard input)")
+	telegrafPoll    = flags.Duration("telegraf-poll", 0, "with -telegraf execd, also look for new or changed files at this interval, for use with signal = \"none\"")
+	location        = flags.String("location", "", "time zone location, such as Europe/London, of input times that lack a zone offset")
+	listDelimiter   = flags.String("list-delimiter", annotatedcsv.DefaultListDelimiter, "delimiter between the elements of values of list datatypes such as list:long, which are written as JSON arrays")
+)
+
+// prog is used to report progress when the -progress flag is set.
+var prog *progress
+
+// noUnsigned holds the name of the destination when it does not
+// support unsigned integers, which are then written as signed
+// integers; it is empty otherwise.
+var noUnsigned string
+
+// precision holds the unit of the timestamps written,
+// as specified by the -precision flag.
+var precision = time.Nanosecond
+
+// precisions maps the values of the -precision flag to
+// their units.
+var precisions = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+}
+
+// followPoll holds how often to check for more data
+// in the input files when the -follow flag is set.
+const followPoll = 250 * time.Millisecond
+
+// defaultTime holds the time specified by the -default-time flag.
+var defaultTime time.Time
+
+// inputLocation holds the location specified by the -location flag.
+var inputLocation *time.Location
+
+// startTime and stopTime hold the times specified by
+// the -start and -stop flags.
+var startTime, stopTime time.Time
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Var(renames, "rename", "rename a column before mapping to line protocol, in the form old=new (can be repeated)")
+	flags.Var(addTags, "add-tag", "add a tag to every point, in the form key=value (can be repeated); this overrides any tag of the same name from the input")
+	flags.Var(drops, "drop", "comma-separated list of columns to omit from the output (can be repeated)")
+	flags.Var(fields, "fields", "comma-separated list of columns to treat as fields in pivoted tables with one column per field (can be repeated); by default, pivoted tables are detected by the absence of _field and _value columns and all non-group columns are treated as fields")
+	flags.Var(&where, "where", "only convert rows where the given column has the given value, in the form column=value or column!=value (can be repeated)")
+	flags.Parse(args)
+	if *configFile != "" {
+		if err := loadConfig(*configFile); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	if *measurement != "" && *measurementFrom != "" {
+		fmt.Fprintf(os.Stderr, "error: cannot use both -measurement and -measurement-from\n")
+		os.Exit(2)
+	}
+	for _, f := range []struct {
+		name string
+		s    string
+		t    *time.Time
+	}{{"-start", *startFlag, &startTime}, {"-stop", *stopFlag, &stopTime}} {
+		if f.s == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, f.s)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: invalid %s flag: %v\n", f.name, err)
+			os.Exit(2)
+		}
+		*f.t = t
+	}
+	if *precisionFlag == "" && *vm {
+		// VictoriaMetrics stores millisecond timestamps,
+		// so there is no point in sending more.
+		*precisionFlag = "ms"
+	}
+	if *precisionFlag != "" {
+		p, ok := precisions[*precisionFlag]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "error: invalid -precision flag %q\n", *precisionFlag)
+			os.Exit(2)
+		}
+		precision = p
+	} else {
+		*precisionFlag = "ns"
+	}
+	switch {
+	case *v1:
+		noUnsigned = "InfluxDB 1.x"
+	case *questdbAddr != "":
+		noUnsigned = "QuestDB"
+	}
+	if *location != "" {
+		loc, err := time.LoadLocation(*location)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: invalid -location flag: %v\n", err)
+			os.Exit(2)
+		}
+		inputLocation = loc
+	}
+	switch *duplicates {
+	case "error", "first", "suffix":
+	default:
+		fmt.Fprintf(os.Stderr, "error: invalid -duplicates flag %q\n", *duplicates)
+		os.Exit(2)
+	}
+	switch *defaultTimeFlag {
+	case "":
+	case "now":
+		defaultTime = time.Now()
+	default:
+		t, err := time.Parse(time.RFC3339Nano, *defaultTimeFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: invalid -default-time flag: %v\n", err)
+			os.Exit(2)
+		}
+		defaultTime = t
+	}
+	if *serveAddr != "" {
+		if *outDir != "" || *serverURL != "" || *kafkaBrokers != "" || *questdbAddr != "" || *telegrafMode != "" || *followFlag || *checkpointFile != "" || flags.NArg() > 0 {
+			fmt.Fprintf(os.Stderr, "error: cannot use -out-dir, -url, -kafka-brokers, -questdb, -telegraf, -follow, -checkpoint or file arguments with -serve\n")
+			os.Exit(2)
+		}
+		err := serve.ListenAndServe(*serveAddr, "text/plain; charset=utf-8", func(w io.Writer, r io.Reader) error {
+			bw := bufio.NewWriter(w)
+			err := writeLineProtocol(newReader(r), bw)
+			if err1 := bw.Flush(); err == nil {
+				err = err1
+			}
+			return err
+		})
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	if *telegrafMode != "" {
+		if *outDir != "" || *serverURL != "" || *kafkaBrokers != "" || *questdbAddr != "" || *followFlag || *checkpointFile != "" {
+			fmt.Fprintf(os.Stderr, "error: cannot use -out-dir, -url, -kafka-brokers, -questdb, -follow or -checkpoint with -telegraf\n")
+			os.Exit(2)
+		}
+		switch *telegrafMode {
+		case "exec":
+		case "execd":
+			// The standard input is used to signal
+			// when to gather metrics.
+			if flags.NArg() == 0 {
+				fmt.Fprintf(os.Stderr, "error: -telegraf execd requires file arguments\n")
+				os.Exit(2)
+			}
+			for _, arg := range flags.Args() {
+				if arg == "-" {
+					fmt.Fprintf(os.Stderr, "error: cannot read the standard input with -telegraf execd\n")
+					os.Exit(2)
+				}
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "error: invalid -telegraf flag %q\n", *telegrafMode)
+			os.Exit(2)
+		}
+		if err := runTelegraf(*telegrafMode, flags.Args(), *telegrafPoll); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	var cp *checkpoint
+	if *checkpointFile != "" {
+		if *followFlag || *workers > 1 || *concurrentFiles > 1 {
+			fmt.Fprintf(os.Stderr, "error: cannot use -follow, -workers or -concurrent-files with -checkpoint\n")
+			os.Exit(2)
+		}
+		var err error
+		cp, err = loadCheckpoint(*checkpointFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	send := func(data []byte) error {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	files, err := input.Files(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	nsinks := 0
+	for _, sink := range []string{*outDir, *serverURL, *kafkaBrokers, *questdbAddr} {
+		if sink != "" {
+			nsinks++
+		}
+	}
+	if nsinks > 1 {
+		fmt.Fprintf(os.Stderr, "error: cannot use more than one of -out-dir, -url, -kafka-brokers and -questdb\n")
+		os.Exit(2)
+	}
+	var sw *splitWriter
+	if *outDir != "" {
+		sw, err = newSplitWriter(*outDir, *splitBy, *maxFileSize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(2)
+		}
+		send = sw.send
+	}
+	var hw *httpWriter
+	if *serverURL != "" {
+		if *vm {
+			query := url.Values{
+				"precision": {*precisionFlag},
+			}
+			if *db != "" {
+				query.Set("db", *db)
+			}
+			hw, err = newHTTPWriter(*serverURL, "/write", query)
+			if hw != nil {
+				hw.token, hw.tokenScheme = *token, "Bearer"
+				hw.username, hw.password = *username, *password
+			}
+		} else if *v1 {
+			if *db == "" {
+				fmt.Fprintf(os.Stderr, "error: -db must be specified with -v1 and -url\n")
+				os.Exit(2)
+			}
+			if *username == "" {
+				*username = os.Getenv("INFLUX_USERNAME")
+			}
+			if *password == "" {
+				*password = os.Getenv("INFLUX_PASSWORD")
+			}
+			hw, err = newHTTPWriter(*serverURL, "/write", url.Values{
+				"db":        {*db},
+				"rp":        {*rp},
+				"precision": {v1Precision(*precisionFlag)},
+			})
+			if hw != nil {
+				hw.username, hw.password = *username, *password
+			}
+		} else {
+			if *bucket == "" {
+				fmt.Fprintf(os.Stderr, "error: -bucket must be specified with -url\n")
+				os.Exit(2)
+			}
+			if *token == "" {
+				*token = os.Getenv("INFLUX_TOKEN")
+			}
+			hw, err = newHTTPWriter(*serverURL, "/api/v2/write", url.Values{
+				"org":       {*org},
+				"bucket":    {*bucket},
+				"precision": {*precisionFlag},
+			})
+			if hw != nil {
+				hw.token = *token
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(2)
+		}
+		if *failedOutput != "" {
+			openFlags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+			if cp != nil {
+				// Keep the batches that failed before
+				// the checkpoint.
+				openFlags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+			}
+			f, err := os.OpenFile(*failedOutput, openFlags, 0666)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(2)
+			}
+			defer f.Close()
+			hw.failedOutput = f
+		}
+		// Carrying on after a failed batch would move the
+		// checkpoint past lines that were never written.
+		hw.failFast = cp != nil
+		send = hw.send
+	}
+	var kw *kafkaWriter
+	if *kafkaBrokers != "" {
+		kw, err = newKafkaWriter()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(2)
+		}
+		defer kw.producer.Close()
+		send = kw.send
+	}
+	var qw *questdbWriter
+	if *questdbAddr != "" {
+		if *questdbKeyID == "" {
+			*questdbKeyID = os.Getenv("QUESTDB_KEY_ID")
+		}
+		if *questdbKey == "" {
+			*questdbKey = os.Getenv("QUESTDB_KEY")
+		}
+		qw, err = newQuestDBWriter(*questdbAddr, *questdbKeyID, *questdbKey, *questdbTLS)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(2)
+		}
+		send = qw.send
+	}
+	if *progressFlag {
+		prog = startProgress(files, 2*time.Second)
+	}
+	send = prog.send(send)
+	if cp != nil {
+		send = cp.send(send)
+	}
+	w := newBatchWriter(send, *batchLines, *batchBytes, *flushInterval)
+	convert := func(rd io.Reader) error {
+		r := newReader(prog.reader(rd))
+		if *workers > 1 {
+			return writeLineProtocolParallel(r, w, *workers, !*unordered)
+		}
+		return writeLineProtocol(r, w)
+	}
+	if cp != nil {
+		for _, file := range files {
+			if err = cp.convert(file, w); err != nil {
+				break
+			}
+		}
+	} else if *followFlag {
+		// Stop following on interrupt so that
+		// any buffered output is written.
+		stop := make(chan struct{})
+		sigc := make(chan os.Signal, 1)
+		signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sigc
+			signal.Stop(sigc)
+			close(stop)
+		}()
+		err = input.Follow(files, followPoll, stop, convert)
+	} else {
+		err = input.ForEachConcurrent(files, *concurrentFiles, convert)
+	}
+	if err != nil {
+		prog.Stop()
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	err = w.Close()
+	prog.Stop()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	if sw != nil {
+		if err := sw.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if qw != nil {
+		if err := qw.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if hw != nil {
+		if err := hw.failureReport(); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if cp != nil {
+		if err := cp.remove(); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// newReader returns a Reader for r that reads
+// values as specified by the flags.
+func newReader(r io.Reader) *annotatedcsv.Reader {
+	cr := annotatedcsv.NewReader(r)
+	cr.SetListDelimiter(*listDelimiter)
+	cr.SetLocation(inputLocation)
+	return cr
+}
+
+func writeLineProtocol(r *annotatedcsv.Reader, output io.Writer) error {
+	for r.NextTable() {
+		info, err := tableInfoForColumns(r.Columns())
+		if err != nil {
+			return fmt.Errorf("cannot get table info for columns: %v", err)
+		}
+		var line bytes.Buffer
+		for nrows := 0; r.NextRow(); nrows++ {
+			if nrows == 0 {
+				prog.startTable(r.Columns(), r.Row())
+			}
+			prog.addRows(1)
+			line.Reset()
+			ok, err := appendLine(&line, info, r.Row())
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			if _, err := output.Write(line.Bytes()); err != nil {
+				return err
+			}
+		}
+	}
+	return r.Err()
+}
+
+// appendLine appends the line-protocol line for the given row to
+// buf. It reports whether the row produced a line; it does not if
+// the row is excluded by a filter, or if it has a null measurement,
+// field name or time or no non-null field values, in which case a
+// warning is printed.
+func appendLine(buf *bytes.Buffer, info *tableInfo, row []interface{}) (bool, error) {
+	if !info.filter.match(row) {
+		return false, nil
+	}
+	if info.measurement >= 0 && isNull(row[info.measurement]) {
+		warnSkipped("null measurement", row, info)
+		return false, nil
+	}
+	if info.field >= 0 && isNull(row[info.field]) {
+		warnSkipped("null _field", row, info)
+		return false, nil
+	}
+	t := defaultTime
+	if info.time >= 0 && row[info.time] != nil {
+		t = row[info.time].(time.Time)
+	}
+	if t.IsZero() {
+		warnSkipped("null time and no -default-time", row, info)
+		return false, nil
+	}
+	start := buf.Len()
+	if info.measurement >= 0 {
+		buf.WriteString(escapeValue(row[info.measurement], lineprotocol.Measurement))
+	} else {
+		buf.WriteString(lineprotocol.Measurement(*measurement))
+	}
+	for i, tagName := range info.tagNames {
+		tagValue := row[info.tagIndexes[i]]
+		if tagValue == nil || tagValue == "" {
+			// Line protocol does not allow empty tag values.
+			continue
+		}
+		buf.WriteByte(',')
+		buf.WriteString(lineprotocol.Key(tagName))
+		buf.WriteByte('=')
+		buf.WriteString(escapeValue(tagValue, lineprotocol.Key))
+	}
+	for _, tagName := range info.addTagNames {
+		buf.WriteByte(',')
+		buf.WriteString(lineprotocol.Key(tagName))
+		buf.WriteByte('=')
+		buf.WriteString(lineprotocol.Key(addTags[tagName]))
+	}
+	buf.WriteByte(' ')
+	if info.field >= 0 {
+		if row[info.value] == nil {
+			buf.Truncate(start)
+			warnSkipped("null _value", row, info)
+			return false, nil
+		}
+		buf.WriteString(escapeValue(row[info.field], lineprotocol.Key))
+		buf.WriteByte('=')
+		if err := writeFieldValue(buf, row[info.value]); err != nil {
+			return false, fmt.Errorf("bad value in _value: %v", err)
+		}
+	} else {
+		nfields := 0
+		for i, fieldName := range info.fieldNames {
+			v := row[info.fieldIndexes[i]]
+			if v == nil {
+				continue
+			}
+			if nfields > 0 {
+				buf.WriteByte(',')
+			}
+			nfields++
+			buf.WriteString(lineprotocol.Key(fieldName))
+			buf.WriteByte('=')
+			if err := writeFieldValue(buf, v); err != nil {
+				return false, fmt.Errorf("bad value in %s: %v", fieldName, err)
+			}
+		}
+		if nfields == 0 {
+			// A point must have at least one field.
+			buf.Truncate(start)
+			warnSkipped("only null field values", row, info)
+			return false, nil
+		}
+	}
+	buf.WriteByte(' ')
+	fmt.Fprintf(buf, "%d\n", timestamp(t))
+	return true, nil
+}
+
+// isNull reports whether v is null or an empty string,
+// neither of which can be written as a measurement
+// or field name.
+func isNull(v interface{}) bool {
+	return v == nil || v == ""
+}
+
+// warnSkipped prints a warning that row was skipped
+// for the given reason.
+func warnSkipped(reason string, row []interface{}, info *tableInfo) {
+	at := ""
+	if info.time >= 0 && row[info.time] != nil {
+		at = " at " + valueString(row[info.time])
+	}
+	fmt.Fprintf(os.Stderr, "warning: skipping row%s with %s\n", at, reason)
+}
+
+// timestamp returns t as a line-protocol timestamp
+// in units of the -precision flag.
+func timestamp(t time.Time) int64 {
+	ns := t.UnixNano()
+	if precision == time.Nanosecond {
+		return ns
+	}
+	ts := ns / int64(precision)
+	if ns%int64(precision) < 0 {
+		// Truncate towards the past.
+		ts--
+	}
+	return ts
+}
+
+// v1Precision returns the InfluxDB 1.x name
+// for the given -precision flag value.
+func v1Precision(p string) string {
+	if p == "us" {
+		return "u"
+	}
+	return p
+}
+
+// writeFieldValue writes v to buf as a line-protocol field value.
+func writeFieldValue(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case int64:
+		fmt.Fprintf(buf, "%di", v)
+	case uint64:
+		if noUnsigned != "" {
+			if v > math.MaxInt64 {
+				return fmt.Errorf("unsigned value %d out of range for %s", v, noUnsigned)
+			}
+			fmt.Fprintf(buf, "%di", v)
+		} else {
+			fmt.Fprintf(buf, "%du", v)
+		}
+	case float64:
+		fmt.Fprint(buf, v)
+	case annotatedcsv.Decimal:
+		// Line protocol has no decimal type.
+		fmt.Fprint(buf, v.Float64())
+	case string:
+		fmt.Fprintf(buf, `"%s"`, lineprotocol.StringField(v))
+	case annotatedcsv.UUID, netip.Addr, netip.Prefix:
+		fmt.Fprintf(buf, `"%s"`, lineprotocol.StringField(fmt.Sprint(v)))
+	case json.Number:
+		fmt.Fprint(buf, v)
+	case map[string]interface{}, []interface{}, []int64, []uint64, []float64, []bool, []string, []time.Time:
+		// Write JSON values and lists as JSON text.
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(buf, `"%s"`, lineprotocol.StringField(string(data)))
+	case bool:
+		fmt.Fprint(buf, v)
+	case time.Time:
+		fmt.Fprintf(buf, "%d", v.UnixNano())
+	default:
+		return fmt.Errorf("unexpected value type %T", v)
+	}
+	return nil
+}
+
+// escapeValue returns v formatted as text and escaped with the
+// given escape function. Unlike field values, measurements and tag
+// values are always text, so numbers have no type suffix.
+func escapeValue(v interface{}, escape func(string) string) string {
+	switch v := v.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return fmt.Sprint(v)
+	case bool:
+		return fmt.Sprint(v)
+	case string:
+		return escape(v)
+	case time.Time:
+		return strconv.FormatInt(v.UnixNano(), 10)
+	case nil:
+		return ""
+	case annotatedcsv.Decimal, annotatedcsv.UUID, netip.Addr, netip.Prefix, json.Number:
+		return escape(fmt.Sprint(v))
+	case map[string]interface{}, []interface{}, []int64, []uint64, []float64, []bool, []string, []time.Time:
+		data, err := json.Marshal(v)
+		if err != nil {
+			// Lists of doubles may hold non-finite values.
+			return escape(fmt.Sprint(v))
+		}
+		return escape(string(data))
+	default:
+		panic(fmt.Errorf("unexpected value type %T", v))
+	}
+}
+
+type tableInfo struct {
+	// measurement holds the index of the measurement column,
+	// or -1 if the -measurement flag is used.
+	measurement int
+	time        int
+
+	// field and value hold the indexes of the _field
+	// and _value columns, or -1 if the table is pivoted.
+	field int
+	value int
+
+	// fieldNames and fieldIndexes hold the field
+	// columns of a pivoted table.
+	fieldNames   []string
+	fieldIndexes []int
+
+	tagNames   []string
+	tagIndexes []int
+
+	// addTagNames holds the names of the tags added
+	// with the -add-tag flag, in sorted order.
+	addTagNames []string
+
+	filter *rowFilter
+}
+
+func tableInfoForColumns(cols []annotatedcsv.Column) (*tableInfo, error) {
+	info := tableInfo{
+		measurement: -1,
+		field:       -1,
+		value:       -1,
+		time:        -1,
+		addTagNames: addTags.keys(),
+	}
+	// Make a copy so that we can rename columns without
+	// affecting the caller.
+	cols = append([]annotatedcsv.Column(nil), cols...)
+	// others holds the indexes of all columns that
+	// may be tags or fields.
+	var others []int
+	for i, col := range cols {
+		if drops[col.Name] {
+			continue
+		}
+		if newName, ok := renames[col.Name]; ok {
+			col.Name = newName
+		}
+		if *measurementFrom != "" {
+			if col.Name == *measurementFrom {
+				info.measurement = i
+				continue
+			}
+			if col.Name == "_measurement" {
+				continue
+			}
+		}
+		if col.Type == "measurement" && *measurement == "" && *measurementFrom == "" {
+			// The extended annotated CSV format read by
+			// "influx write" marks the measurement column
+			// by its datatype rather than its name.
+			info.measurement = i
+			cols[i] = col
+			continue
+		}
+		switch col.Name {
+		case "_measurement":
+			if *measurement != "" {
+				continue
+			}
+			info.measurement = i
+			if col.Type != "string" {
+				return nil, fmt.Errorf("_measurement column has wrong type, got %q want %q", col.Type, "string")
+			}
+		case "_field":
+			info.field = i
+			if col.Type != "string" {
+				return nil, fmt.Errorf("_field column has wrong type, got %q want %q", col.Type, "string")
+			}
+		case "_value":
+			info.value = i
+		case "_time":
+			info.time = i
+			if annotatedcsv.DatatypeKind(col.Type) != annotatedcsv.DateTimeKind {
+				return nil, fmt.Errorf("_time column has wrong type, got %q want %q", col.Type, "dateTime:*")
+			}
+		case "":
+			// Ignore.
+		default:
+			others = append(others, i)
+		}
+		cols[i] = col
+	}
+	if info.time == -1 {
+		// Similarly, in the extended format, the time
+		// column is marked by its datatype.
+		if j := timeColumn(cols, others); j >= 0 {
+			info.time = others[j]
+			others = append(others[:j], others[j+1:]...)
+		}
+	}
+	pivoted := len(fields) > 0 || (info.field == -1 && info.value == -1)
+	usedFieldNames := make(map[string]bool)
+	usedTagNames := make(map[string]bool)
+	for _, i := range others {
+		col := cols[i]
+		if pivoted && isField(col) {
+			fieldName, err := uniqueName(col.Name, col.Name, usedFieldNames)
+			if err != nil {
+				return nil, fmt.Errorf("duplicate field: %v", err)
+			}
+			if fieldName != "" {
+				info.fieldNames = append(info.fieldNames, fieldName)
+				info.fieldIndexes = append(info.fieldIndexes, i)
+			}
+			continue
+		}
+		tagName := strings.TrimPrefix(col.Name, "_")
+		if _, ok := addTags[tagName]; ok {
+			continue
+		}
+		tagName, err := uniqueName(tagName, col.Name, usedTagNames)
+		if err != nil {
+			return nil, fmt.Errorf("duplicate tag: %v", err)
+		}
+		if tagName != "" {
+			info.tagNames = append(info.tagNames, tagName)
+			info.tagIndexes = append(info.tagIndexes, i)
+		}
+	}
+	if info.measurement == -1 {
+		switch {
+		case *measurementFrom != "":
+			return nil, fmt.Errorf("no %s column found in table", *measurementFrom)
+		case *measurement == "":
+			return nil, fmt.Errorf("no _measurement column found in table")
+		}
+	}
+	if pivoted {
+		if len(info.fieldNames) == 0 {
+			return nil, fmt.Errorf("no field columns found in pivoted table")
+		}
+		info.field, info.value = -1, -1
+	} else {
+		if info.field == -1 {
+			return nil, fmt.Errorf("no _field column found in table")
+		}
+		if info.value == -1 {
+			return nil, fmt.Errorf("no _value column found in table")
+		}
+	}
+	if info.time == -1 && defaultTime.IsZero() {
+		return nil, fmt.Errorf("no _time column found in table")
+	}
+	info.filter = newRowFilter(cols, info.time)
+	return &info, nil
+}
+
+// uniqueName returns the name to use for a tag or field derived
+// from the given column, given the names already used, according
+// to the -duplicates flag. It returns the empty string if the
+// column should be omitted.
+func uniqueName(name, colName string, used map[string]bool) (string, error) {
+	if !used[name] {
+		used[name] = true
+		return name, nil
+	}
+	switch *duplicates {
+	case "first":
+		return "", nil
+	case "suffix":
+		for n := 2; ; n++ {
+			newName := fmt.Sprintf("%s_%d", name, n)
+			if !used[newName] {
+				used[newName] = true
+				return newName, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("column %q maps to already used name %q", colName, name)
+}
+
+// timeColumn returns the index into others of the only
+// one of the given columns with a dateTime datatype,
+// or -1 if there is not exactly one.
+func timeColumn(cols []annotatedcsv.Column, others []int) int {
+	found := -1
+	for j, i := range others {
+		if strings.HasPrefix(cols[i].Type, "dateTime") {
+			if found >= 0 {
+				return -1
+			}
+			found = j
+		}
+	}
+	return found
+}
+
+// isField reports whether the given column of a
+// pivoted table holds a field.
+func isField(col annotatedcsv.Column) bool {
+	if len(fields) > 0 {
+		return fields[col.Name]
+	}
+	switch col.Type {
+	case "tag":
+		return false
+	case "field":
+		return true
+	}
+	switch col.Name {
+	case "result", "table":
+		// These are added by Flux and are not fields.
+		return false
+	}
+	return !col.Group
+}
+
+// keyValueFlag implements flag.Value by recording
+// key=value pairs.
+type keyValueFlag map[string]string
+
+func (f keyValueFlag) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 || i == len(s)-1 {
+		return fmt.Errorf("%q is not in the form key=value", s)
+	}
+	f[s[:i]] = s[i+1:]
+	return nil
+}
+
+func (f keyValueFlag) String() string {
+	var pairs []string
+	for _, key := range f.keys() {
+		pairs = append(pairs, key+"="+f[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// keys returns the keys in f in sorted order.
+func (f keyValueFlag) keys() []string {
+	keys := make([]string, 0, len(f))
+	for key := range f {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
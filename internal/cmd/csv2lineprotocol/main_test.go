@@ -0,0 +1,104 @@
+package csv2lineprotocol
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var uniqueNameTests = []struct {
+	duplicates  string
+	expectNames []string
+	expectError string
+}{{
+	duplicates:  "error",
+	expectNames: []string{"a", "a_2"},
+	expectError: `column "c2" maps to already used name "a"`,
+}, {
+	duplicates:  "first",
+	expectNames: []string{"a", "a_2", ""},
+}, {
+	duplicates:  "suffix",
+	expectNames: []string{"a", "a_2", "a_3"},
+}}
+
+func TestUniqueName(t *testing.T) {
+	defer func(old string) {
+		*duplicates = old
+	}(*duplicates)
+	for _, test := range uniqueNameTests {
+		t.Run(test.duplicates, func(t *testing.T) {
+			*duplicates = test.duplicates
+			// The name a_2 is taken by the time
+			// the duplicate a is seen.
+			used := make(map[string]bool)
+			var names []string
+			var err error
+			for _, c := range []struct{ name, colName string }{
+				{"a", "c0"},
+				{"a_2", "c1"},
+				{"a", "c2"},
+			} {
+				var name string
+				name, err = uniqueName(c.name, c.colName, used)
+				if err != nil {
+					break
+				}
+				names = append(names, name)
+			}
+			if !reflect.DeepEqual(names, test.expectNames) {
+				t.Errorf("unexpected names; got %q want %q", names, test.expectNames)
+			}
+			if test.expectError == "" && err != nil || test.expectError != "" && (err == nil || err.Error() != test.expectError) {
+				t.Errorf("unexpected error; got %v want %q", err, test.expectError)
+			}
+		})
+	}
+}
+
+func TestListDelimiter(t *testing.T) {
+	defer func(old string) {
+		*listDelimiter = old
+	}(*listDelimiter)
+	*listDelimiter = "|"
+	const data = `#datatype,measurement,list:long,list:string,dateTime:number
+#group,true,false,false,false
+#default,,,,
+,_measurement,a,b,_time
+,m,1|2,"x,y|z",1
+`
+	var buf bytes.Buffer
+	if err := writeLineProtocol(newReader(strings.NewReader(data)), &buf); err != nil {
+		t.Fatal(err)
+	}
+	const expect = `m a="[1,2]",b="[\"x,y\",\"z\"]" 1` + "\n"
+	if got := buf.String(); got != expect {
+		t.Fatalf("unexpected output\ngot  %q\nwant %q", got, expect)
+	}
+}
+
+func TestLocation(t *testing.T) {
+	defer func(old *time.Location) {
+		inputLocation = old
+	}(inputLocation)
+	inputLocation = time.FixedZone("", 3600)
+	// Only the time without a zone offset is
+	// interpreted in the location.
+	const data = `#datatype,measurement,dateTime:RFC3339,long
+#group,true,false,false
+#default,,,
+,_measurement,_time,v
+,m,1970-01-01T01:00:01,1
+,m,1970-01-01T01:00:01Z,2
+`
+	var buf bytes.Buffer
+	if err := writeLineProtocol(newReader(strings.NewReader(data)), &buf); err != nil {
+		t.Fatal(err)
+	}
+	const expect = "m v=1i 1000000000\nm v=2i 3601000000000\n"
+	if got := buf.String(); got != expect {
+		t.Fatalf("unexpected output\ngot  %q\nwant %q", got, expect)
+	}
+}
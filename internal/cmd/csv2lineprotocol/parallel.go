@@ -0,0 +1,145 @@
+package csv2lineprotocol
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/rogpeppe/annotatedcsv"
+)
+
+// chunkRows holds the maximum number of rows
+// formatted together by a worker.
+const chunkRows = 1000
+
+// chunk holds a set of consecutive rows from a table
+// and the line protocol formatted from them.
+type chunk struct {
+	info *tableInfo
+	rows [][]interface{}
+
+	// ready is closed when out and err are valid.
+	ready chan struct{}
+	out   bytes.Buffer
+	err   error
+}
+
+func (c *chunk) format() {
+	for _, row := range c.rows {
+		if _, err := appendLine(&c.out, c.info, row); err != nil {
+			c.err = err
+			break
+		}
+	}
+	c.rows = nil
+	close(c.ready)
+}
+
+// writeLineProtocolParallel is like writeLineProtocol except
+// that rows are formatted by the given number of concurrent
+// workers. The CSV itself is still parsed sequentially. If
+// ordered is false, the output from different chunks of rows may
+// be written in a different order from the input.
+func writeLineProtocolParallel(r *annotatedcsv.Reader, output io.Writer, workers int, ordered bool) error {
+	work := make(chan *chunk)
+	// done holds chunks in the order they are to be written.
+	done := make(chan *chunk, workers)
+	// stop is closed when writing has failed.
+	stop := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range work {
+				c.format()
+				if !ordered {
+					done <- c
+				}
+			}
+		}()
+	}
+	var readErr error
+	go func() {
+		readErr = readChunks(r, work, done, stop, ordered)
+		close(work)
+		wg.Wait()
+		close(done)
+	}()
+	var writeErr error
+	for c := range done {
+		if writeErr != nil {
+			// Drain the remaining chunks.
+			continue
+		}
+		<-c.ready
+		if c.err != nil {
+			writeErr = c.err
+		} else if _, err := output.Write(c.out.Bytes()); err != nil {
+			writeErr = err
+		}
+		if writeErr != nil {
+			close(stop)
+		}
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	return readErr
+}
+
+// readChunks reads rows from r and sends them in chunks to work.
+// If ordered is true, it also sends each chunk to done so that
+// they will be written in order.
+func readChunks(r *annotatedcsv.Reader, work, done chan<- *chunk, stop <-chan struct{}, ordered bool) error {
+	send := func(c *chunk) bool {
+		if ordered {
+			select {
+			case done <- c:
+			case <-stop:
+				return false
+			}
+		}
+		select {
+		case work <- c:
+			return true
+		case <-stop:
+			return false
+		}
+	}
+	for r.NextTable() {
+		info, err := tableInfoForColumns(r.Columns())
+		if err != nil {
+			return fmt.Errorf("cannot get table info for columns: %v", err)
+		}
+		var rows [][]interface{}
+		for nrows := 0; r.NextRow(); nrows++ {
+			if nrows == 0 {
+				prog.startTable(r.Columns(), r.Row())
+			}
+			prog.addRows(1)
+			rows = append(rows, r.Row())
+			if len(rows) < chunkRows {
+				continue
+			}
+			if !send(newChunk(info, rows)) {
+				return nil
+			}
+			rows = nil
+		}
+		if len(rows) > 0 && !send(newChunk(info, rows)) {
+			return nil
+		}
+	}
+	return r.Err()
+}
+
+func newChunk(info *tableInfo, rows [][]interface{}) *chunk {
+	return &chunk{
+		info:  info,
+		rows:  rows,
+		ready: make(chan struct{}),
+	}
+}
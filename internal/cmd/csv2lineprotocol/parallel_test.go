@@ -0,0 +1,137 @@
+package csv2lineprotocol
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/rogpeppe/annotatedcsv"
+)
+
+// parallelTestData returns annotated CSV data holding tables with
+// the given numbers of rows. If badRow is non-empty, it is used as
+// the last row of the last table.
+func parallelTestData(nrows []int, badRow string) string {
+	var buf strings.Builder
+	for ti, n := range nrows {
+		if ti > 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString("#datatype,measurement,tag,long,unsignedLong,dateTime:number\n#group,true,true,false,false,false\n#default,,,,,\n,_measurement,host,a,u,_time\n")
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(&buf, ",m,h%d,%d,%d,%d\n", ti, i, i, i+1)
+		}
+	}
+	buf.WriteString(badRow)
+	return buf.String()
+}
+
+func TestWriteLineProtocolParallel(t *testing.T) {
+	// The tables hold several chunks, with partial
+	// chunks at the end of each table.
+	data := parallelTestData([]int{2*chunkRows + 1, 0, 1, chunkRows}, "")
+	var expect bytes.Buffer
+	if err := writeLineProtocol(annotatedcsv.NewReader(strings.NewReader(data)), &expect); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(expect.String(), "\n"); n != 3*chunkRows+2 {
+		t.Fatalf("unexpected line count %d", n)
+	}
+	for _, workers := range []int{1, 2, 5} {
+		t.Run(fmt.Sprintf("ordered-%d", workers), func(t *testing.T) {
+			var got bytes.Buffer
+			if err := writeLineProtocolParallel(annotatedcsv.NewReader(strings.NewReader(data)), &got, workers, true); err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != expect.String() {
+				t.Fatalf("output differs from sequential output")
+			}
+		})
+		t.Run(fmt.Sprintf("unordered-%d", workers), func(t *testing.T) {
+			var got bytes.Buffer
+			if err := writeLineProtocolParallel(annotatedcsv.NewReader(strings.NewReader(data)), &got, workers, false); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(sortedLines(got.String()), sortedLines(expect.String())) {
+				t.Fatalf("output has different lines from sequential output")
+			}
+		})
+	}
+}
+
+func sortedLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	sort.Strings(lines)
+	return lines
+}
+
+func TestWriteLineProtocolParallelFormatError(t *testing.T) {
+	defer func(old string) {
+		noUnsigned = old
+	}(noUnsigned)
+	noUnsigned = "test"
+	// The error is in the second chunk.
+	data := parallelTestData([]int{chunkRows + 1}, ",m,h0,1,18446744073709551615,1\n")
+	for _, ordered := range []bool{true, false} {
+		t.Run(fmt.Sprint("ordered-", ordered), func(t *testing.T) {
+			var buf bytes.Buffer
+			err := writeLineProtocolParallel(annotatedcsv.NewReader(strings.NewReader(data)), &buf, 3, ordered)
+			if err == nil || err.Error() != "bad value in u: unsigned value 18446744073709551615 out of range for test" {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if ordered && strings.Count(buf.String(), "\n") != chunkRows {
+				t.Fatalf("unexpected output before error: %d lines", strings.Count(buf.String(), "\n"))
+			}
+		})
+	}
+}
+
+func TestWriteLineProtocolParallelReadError(t *testing.T) {
+	data := parallelTestData([]int{chunkRows + 1}, ",m,h0,x,1,1\n")
+	var buf bytes.Buffer
+	expectErr := writeLineProtocol(annotatedcsv.NewReader(strings.NewReader(data)), &buf)
+	if expectErr == nil {
+		t.Fatal("no error from sequential conversion")
+	}
+	for _, ordered := range []bool{true, false} {
+		t.Run(fmt.Sprint("ordered-", ordered), func(t *testing.T) {
+			var buf bytes.Buffer
+			err := writeLineProtocolParallel(annotatedcsv.NewReader(strings.NewReader(data)), &buf, 3, ordered)
+			if err == nil || err.Error() != expectErr.Error() {
+				t.Fatalf("unexpected error; got %v want %v", err, expectErr)
+			}
+			// All the rows read before the error are written.
+			if n := strings.Count(buf.String(), "\n"); n != chunkRows+1 {
+				t.Fatalf("unexpected output before error: %d lines", n)
+			}
+		})
+	}
+}
+
+func TestWriteLineProtocolParallelWriteError(t *testing.T) {
+	data := parallelTestData([]int{10 * chunkRows}, "")
+	for _, ordered := range []bool{true, false} {
+		t.Run(fmt.Sprint("ordered-", ordered), func(t *testing.T) {
+			nwrites := 0
+			w := writerFunc(func(p []byte) (int, error) {
+				nwrites++
+				if nwrites > 1 {
+					return 0, errors.New("write failed")
+				}
+				return len(p), nil
+			})
+			err := writeLineProtocolParallel(annotatedcsv.NewReader(strings.NewReader(data)), w, 3, ordered)
+			if err == nil || err.Error() != "write failed" {
+				t.Fatalf("unexpected error %v", err)
+			}
+			// Writing stops at the first error.
+			if nwrites != 2 {
+				t.Fatalf("got %d writes, want 2", nwrites)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package csv2lineprotocol
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv"
+)
+
+// progress tracks and reports the progress of a conversion.
+// All methods may be called concurrently, and on a nil
+// *progress, in which case they do nothing.
+type progress struct {
+	// totalBytes holds the total size of the input,
+	// or -1 if it is not known.
+	totalBytes int64
+
+	rows     int64
+	bytesIn  int64
+	bytesOut int64
+	start    time.Time
+
+	mu       sync.Mutex
+	groupKey string
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// startProgress starts printing progress reports to the standard
+// error at the given interval. The total size of the input is
+// computed from the given files.
+func startProgress(files []string, interval time.Duration) *progress {
+	p := &progress{
+		start: time.Now(),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if file == "-" || err != nil || !info.Mode().IsRegular() {
+			p.totalBytes = -1
+			break
+		}
+		p.totalBytes += info.Size()
+	}
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.report(false)
+			case <-p.stop:
+				p.report(true)
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// Stop stops the progress reports, printing a final summary.
+func (p *progress) Stop() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	<-p.done
+}
+
+// reader returns a reader that counts the bytes read from r.
+func (p *progress) reader(r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+	return &countingReader{r, &p.bytesIn}
+}
+
+// send returns a function that calls send and counts the bytes
+// passed to it.
+func (p *progress) send(send func([]byte) error) func([]byte) error {
+	if p == nil {
+		return send
+	}
+	return func(data []byte) error {
+		atomic.AddInt64(&p.bytesOut, int64(len(data)))
+		return send(data)
+	}
+}
+
+// startTable records the start of a table with the given columns
+// and first row.
+func (p *progress) startTable(cols []annotatedcsv.Column, row []interface{}) {
+	if p == nil {
+		return
+	}
+	var keys []string
+	for i, col := range cols {
+		if col.Group {
+			keys = append(keys, col.Name+"="+valueString(row[i]))
+		}
+	}
+	p.mu.Lock()
+	p.groupKey = strings.Join(keys, ",")
+	p.mu.Unlock()
+}
+
+// addRows records that n rows have been read.
+func (p *progress) addRows(n int) {
+	if p == nil {
+		return
+	}
+	atomic.AddInt64(&p.rows, int64(n))
+}
+
+func (p *progress) report(final bool) {
+	elapsed := time.Since(p.start)
+	rows := atomic.LoadInt64(&p.rows)
+	bytesIn := atomic.LoadInt64(&p.bytesIn)
+	bytesOut := atomic.LoadInt64(&p.bytesOut)
+	rate := float64(rows) / elapsed.Seconds()
+	if final {
+		fmt.Fprintf(os.Stderr, "progress: done: %d rows in %v (%.0f rows/s), %s read, %s written\n",
+			rows, elapsed.Round(time.Millisecond), rate, byteCount(bytesIn), byteCount(bytesOut))
+		return
+	}
+	p.mu.Lock()
+	groupKey := p.groupKey
+	p.mu.Unlock()
+	eta := "unknown"
+	if p.totalBytes > 0 && bytesIn > 0 {
+		remaining := time.Duration(float64(elapsed) * float64(p.totalBytes-bytesIn) / float64(bytesIn))
+		eta = remaining.Round(time.Second).String()
+	}
+	fmt.Fprintf(os.Stderr, "progress: %d rows (%.0f rows/s), %s read, %s written, ETA %s, table %s\n",
+		rows, rate, byteCount(bytesIn), byteCount(bytesOut), eta, groupKey)
+}
+
+// byteCount returns n formatted in human-readable units.
+func byteCount(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+type countingReader struct {
+	r     io.Reader
+	count *int64
+}
+
+func (r *countingReader) Read(buf []byte) (int, error) {
+	n, err := r.r.Read(buf)
+	atomic.AddInt64(r.count, int64(n))
+	return n, err
+}
@@ -0,0 +1,154 @@
+package csv2lineprotocol
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv/internal/retry"
+)
+
+// questdbWriter sends batches of line protocol to QuestDB over
+// its InfluxDB line protocol (ILP) TCP interface.
+//
+// QuestDB does not acknowledge writes over TCP, so send can only
+// report errors in sending the data; lines that QuestDB rejects
+// are reported in the server's log.
+type questdbWriter struct {
+	addr   string
+	keyID  string
+	key    *ecdsa.PrivateKey
+	useTLS bool
+
+	conn net.Conn
+}
+
+// newQuestDBWriter returns a questdbWriter that writes to the
+// QuestDB server at addr. If keyID is non-empty, the connection is
+// authenticated with the given private key, which is the "d"
+// value of the key's JWK, encoded as unpadded URL-safe base64.
+func newQuestDBWriter(addr, keyID, key string, useTLS bool) (*questdbWriter, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "9009")
+	}
+	w := &questdbWriter{
+		addr:   addr,
+		keyID:  keyID,
+		useTLS: useTLS,
+	}
+	if keyID != "" {
+		d, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(key, "="))
+		if err != nil || len(d) == 0 {
+			return nil, fmt.Errorf("invalid QuestDB private key")
+		}
+		curve := elliptic.P256()
+		k := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(d)}
+		k.PublicKey.Curve = curve
+		k.PublicKey.X, k.PublicKey.Y = curve.ScalarBaseMult(d)
+		w.key = k
+	} else if key != "" {
+		return nil, fmt.Errorf("QuestDB private key given without key id")
+	}
+	// Connect now so that configuration errors
+	// are reported before any input is read.
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// send writes a batch of lines, reconnecting and retrying
+// if the write fails.
+func (w *questdbWriter) send(data []byte) error {
+	err := retry.Do(func() (bool, time.Duration, error) {
+		return true, 0, w.write(data)
+	})
+	if err != nil {
+		return fmt.Errorf("cannot write to QuestDB: %v", err)
+	}
+	return nil
+}
+
+func (w *questdbWriter) write(data []byte) error {
+	if w.conn == nil {
+		if err := w.connect(); err != nil {
+			return err
+		}
+	}
+	w.conn.SetWriteDeadline(time.Now().Add(time.Minute))
+	if _, err := w.conn.Write(data); err != nil {
+		w.conn.Close()
+		w.conn = nil
+		return err
+	}
+	return nil
+}
+
+// connect connects to the server, authenticating if
+// a key has been provided.
+func (w *questdbWriter) connect() error {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if w.useTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", w.addr, &tls.Config{})
+	} else {
+		conn, err = dialer.Dial("tcp", w.addr)
+	}
+	if err != nil {
+		return err
+	}
+	if w.key != nil {
+		if err := w.authenticate(conn); err != nil {
+			conn.Close()
+			return fmt.Errorf("cannot authenticate to QuestDB: %v", err)
+		}
+	}
+	w.conn = conn
+	return nil
+}
+
+// authenticate performs QuestDB's challenge-response
+// authentication: the client sends its key id, and signs
+// the challenge that the server sends back.
+func (w *questdbWriter) authenticate(conn net.Conn) error {
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	defer conn.SetDeadline(time.Time{})
+	if _, err := conn.Write([]byte(w.keyID + "\n")); err != nil {
+		return err
+	}
+	// The server sends nothing after the challenge until the
+	// client responds, so reading through a buffer is safe.
+	challenge, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return fmt.Errorf("cannot read challenge: %v", err)
+	}
+	hash := sha256.Sum256(challenge[:len(challenge)-1])
+	sig, err := ecdsa.SignASN1(rand.Reader, w.key, hash[:])
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write([]byte(base64.StdEncoding.EncodeToString(sig) + "\n"))
+	return err
+}
+
+// Close closes the connection to the server.
+func (w *questdbWriter) Close() error {
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
@@ -0,0 +1,170 @@
+package csv2lineprotocol
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv/internal/lineprotocol"
+)
+
+// splitWriter writes batches of line protocol to files in a
+// directory, splitting the output by measurement or by day
+// and starting a new file whenever a file would grow beyond
+// a maximum size.
+type splitWriter struct {
+	dir         string
+	splitBy     string
+	maxFileSize int64
+	files       map[string]*outputFile
+}
+
+type outputFile struct {
+	f     *os.File
+	w     *bufio.Writer
+	size  int64
+	index int
+}
+
+// newSplitWriter returns a splitWriter that writes files to dir.
+// splitBy may be "measurement", "day" or empty, in which case
+// all lines are written to the same sequence of files. A zero
+// maxFileSize means no limit.
+func newSplitWriter(dir, splitBy string, maxFileSize int64) (*splitWriter, error) {
+	switch splitBy {
+	case "", "measurement", "day":
+	default:
+		return nil, fmt.Errorf("invalid split %q; must be measurement or day", splitBy)
+	}
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+	return &splitWriter{
+		dir:         dir,
+		splitBy:     splitBy,
+		maxFileSize: maxFileSize,
+		files:       make(map[string]*outputFile),
+	}, nil
+}
+
+// send writes the given lines to their files.
+func (w *splitWriter) send(data []byte) error {
+	for len(data) > 0 {
+		end := lineprotocol.LineEnd(data) + 1
+		if end == 0 {
+			end = len(data)
+		}
+		line := data[:end]
+		data = data[end:]
+		if err := w.writeLine(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *splitWriter) writeLine(line []byte) error {
+	key, err := w.key(line)
+	if err != nil {
+		return err
+	}
+	of := w.files[key]
+	if of != nil && w.maxFileSize > 0 && of.size > 0 && of.size+int64(len(line)) > w.maxFileSize {
+		if err := of.close(); err != nil {
+			return err
+		}
+		of, err = w.create(key, of.index+1)
+	} else if of == nil {
+		of, err = w.create(key, 1)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := of.w.Write(line); err != nil {
+		return err
+	}
+	of.size += int64(len(line))
+	return nil
+}
+
+func (w *splitWriter) create(key string, index int) (*outputFile, error) {
+	f, err := os.Create(filepath.Join(w.dir, fmt.Sprintf("%s-%04d.lp", key, index)))
+	if err != nil {
+		return nil, err
+	}
+	of := &outputFile{
+		f:     f,
+		w:     bufio.NewWriter(f),
+		index: index,
+	}
+	w.files[key] = of
+	return of, nil
+}
+
+// key returns the file name prefix for the given line.
+func (w *splitWriter) key(line []byte) (string, error) {
+	switch w.splitBy {
+	case "measurement":
+		return fileNameSafe(measurementOf(line)), nil
+	case "day":
+		fields := bytes.Fields(line)
+		ts, err := strconv.ParseInt(string(fields[len(fields)-1]), 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("cannot find timestamp in line %q", line)
+		}
+		return time.Unix(0, ts*int64(precision)).UTC().Format("2006-01-02"), nil
+	}
+	return "points", nil
+}
+
+// Close closes all the output files.
+func (w *splitWriter) Close() error {
+	var firstErr error
+	for _, of := range w.files {
+		if err := of.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (of *outputFile) close() error {
+	err := of.w.Flush()
+	if err1 := of.f.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// measurementOf returns the escaped measurement
+// name at the start of the given line.
+func measurementOf(line []byte) []byte {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case ',', ' ':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// fileNameSafe returns s with any characters that might
+// cause problems in a file name replaced with underscores.
+func fileNameSafe(s []byte) string {
+	buf := make([]byte, len(s))
+	for i, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '.' && i > 0:
+			buf[i] = c
+		default:
+			buf[i] = '_'
+		}
+	}
+	return string(buf)
+}
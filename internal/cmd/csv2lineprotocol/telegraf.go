@@ -0,0 +1,159 @@
+package csv2lineprotocol
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+)
+
+// telegrafInput converts files for Telegraf's exec and execd
+// input plugins, which read line protocol from the standard
+// output and log anything written to the standard error.
+type telegrafInput struct {
+	// patterns holds the file arguments, which are
+	// expanded afresh for each gather.
+	patterns []string
+	w        *bufio.Writer
+
+	// seen holds the state of each file when it was
+	// last converted. It is nil if files are always converted.
+	seen map[string]fileState
+}
+
+type fileState struct {
+	size  int64
+	mtime time.Time
+}
+
+// runTelegraf runs the command in the given -telegraf mode.
+//
+// In exec mode, the files are converted once. Errors in the
+// files are reported but do not cause the command to fail,
+// because Telegraf discards all the output of a failed command.
+//
+// In execd mode, the command keeps running, converting each file
+// that is new or has changed since it was last converted. It does
+// this on start, when Telegraf asks for metrics by writing a line
+// to the standard input, and every pollInterval if that is non-zero.
+// It returns when the standard input is closed.
+func runTelegraf(mode string, patterns []string, pollInterval time.Duration) error {
+	t := &telegrafInput{
+		patterns: patterns,
+		w:        bufio.NewWriter(os.Stdout),
+	}
+	if mode == "exec" {
+		return t.gather()
+	}
+	t.seen = make(map[string]fileState)
+	signals := make(chan error)
+	go func() {
+		br := bufio.NewReader(os.Stdin)
+		for {
+			_, err := br.ReadString('\n')
+			signals <- err
+			if err != nil {
+				return
+			}
+		}
+	}()
+	var poll <-chan time.Time
+	if pollInterval > 0 {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+	for {
+		if err := t.gather(); err != nil {
+			return err
+		}
+		select {
+		case err := <-signals:
+			if err != nil {
+				// Telegraf closes the standard input
+				// to stop the plugin.
+				return nil
+			}
+		case <-poll:
+		}
+	}
+}
+
+// gather converts the files and flushes the output, so that
+// Telegraf receives complete lines only. It returns an error
+// only if the output cannot be written.
+func (t *telegrafInput) gather() error {
+	present := make(map[string]bool)
+	for _, file := range t.files() {
+		if t.seen != nil {
+			info, err := os.Stat(file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				continue
+			}
+			present[file] = true
+			st := fileState{info.Size(), info.ModTime()}
+			if old, ok := t.seen[file]; ok && old == st {
+				continue
+			}
+			t.seen[file] = st
+		}
+		// Errors in the file are reported, but an error writing
+		// the output is fatal.
+		var writeErr error
+		err := input.ForEach([]string{file}, func(r io.Reader) error {
+			return writeLineProtocol(newReader(r), writerFunc(func(p []byte) (int, error) {
+				n, err := t.w.Write(p)
+				writeErr = err
+				return n, err
+			}))
+		})
+		if writeErr != nil {
+			return writeErr
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		}
+	}
+	for file := range t.seen {
+		if !present[file] {
+			// Forget files that have been removed, so
+			// that the map does not grow as exports rotate.
+			delete(t.seen, file)
+		}
+	}
+	return t.w.Flush()
+}
+
+// files returns the files named by the patterns. A pattern that
+// matches no files is not an error, as exports may not have been
+// written yet.
+func (t *telegrafInput) files() []string {
+	var files []string
+	for _, arg := range t.patterns {
+		if strings.ContainsAny(arg, `*?[\`) {
+			if matches, _ := filepath.Glob(arg); len(matches) == 0 {
+				continue
+			}
+		}
+		argFiles, err := input.Files([]string{arg})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			continue
+		}
+		files = append(files, argFiles...)
+	}
+	return files
+}
+
+// writerFunc implements io.Writer by calling the function.
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
@@ -0,0 +1,60 @@
+// Package csv2md implements the csv2md command.
+package csv2md
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+	"github.com/rogpeppe/annotatedcsv/internal/render"
+)
+
+var flags = flag.NewFlagSet("csv2md", flag.ExitOnError)
+
+var (
+	columnsFlag = flags.String("columns", "", "comma-separated list of columns to show, in order (default all)")
+	maxRows     = flags.Int("max-rows", 0, "maximum number of rows to show for each table (0 means no limit)")
+	maxWidth    = flags.Int("max-width", 0, "truncate cells longer than this many characters (0 means no limit)")
+)
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] [file...]\n", flags.Name())
+		fmt.Fprintf(os.Stderr, "Each table is written as a GitHub-flavoured Markdown table.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	opts := render.Options{
+		MaxRows:  *maxRows,
+		MaxWidth: *maxWidth,
+	}
+	for _, name := range strings.Split(*columnsFlag, ",") {
+		if name != "" {
+			opts.Columns = append(opts.Columns, name)
+		}
+	}
+	files, err := input.Files(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	bw := bufio.NewWriter(os.Stdout)
+	err = input.ForEach(files, func(r io.Reader) error {
+		return render.Render(bw, annotatedcsv.NewReader(r), render.Markdown, opts)
+	})
+	if err1 := bw.Flush(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,298 @@
+package csv2otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv/internal/retry"
+)
+
+// grpcExportPath holds the path of the gRPC Export method.
+const grpcExportPath = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+
+// exporter sends export requests to an OTLP receiver.
+type exporter struct {
+	client *http.Client
+	url    string
+	grpc   bool
+	// rejected holds the total number of data points
+	// that the receiver reported as rejected.
+	rejected int64
+}
+
+func newExporter(endpoint, protocol string) (*exporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid endpoint %q: scheme must be http or https", endpoint)
+	}
+	e := &exporter{
+		client: http.DefaultClient,
+	}
+	if protocol == "grpc" {
+		e.grpc = true
+		u.Path = grpcExportPath
+		t := &http.Transport{
+			Proxy:             http.ProxyFromEnvironment,
+			ForceAttemptHTTP2: true,
+		}
+		if u.Scheme == "http" {
+			// gRPC needs HTTP/2, which requires prior
+			// knowledge without TLS.
+			if err := enableH2C(t); err != nil {
+				return nil, err
+			}
+		}
+		e.client = &http.Client{
+			Transport: t,
+		}
+	} else if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/metrics"
+	}
+	e.url = u.String()
+	return e, nil
+}
+
+// export sends the given encoded ExportMetricsServiceRequest,
+// retrying if the receiver reports a transient failure.
+func (e *exporter) export(req []byte) error {
+	body := req
+	if *gzipFlag {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(req)
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+	if e.grpc {
+		// Add the message prefix: a compressed flag
+		// followed by the length of the message.
+		prefix := make([]byte, 5, 5+len(body))
+		if *gzipFlag {
+			prefix[0] = 1
+		}
+		binary.BigEndian.PutUint32(prefix[1:], uint32(len(body)))
+		body = append(prefix, body...)
+	}
+	return retry.Do(func() (bool, time.Duration, error) {
+		resp, retriable, err := e.post(body)
+		if err == nil {
+			e.rejected += rejectedPoints(resp)
+		}
+		return retriable, 0, err
+	})
+}
+
+// post makes a single export request, returning the
+// encoded ExportMetricsServiceResponse. On failure,
+// it reports whether the request may be retried.
+func (e *exporter) post(body []byte) (_ []byte, retry bool, _ error) {
+	req, err := http.NewRequest("POST", e.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, false, err
+	}
+	for _, key := range headers.keys() {
+		req.Header.Set(key, headers[key])
+	}
+	if e.grpc {
+		req.Header.Set("Content-Type", "application/grpc")
+		req.Header.Set("TE", "trailers")
+		if *gzipFlag {
+			req.Header.Set("Grpc-Encoding", "gzip")
+		}
+	} else {
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		if *gzipFlag {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, err
+	}
+	if e.grpc {
+		return grpcResponse(resp, data)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return data, false, nil
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		retry = true
+	}
+	// The body should hold a google.rpc.Status message,
+	// whose message field is more useful than the raw body.
+	msg := statusMessage(data)
+	if msg == "" {
+		return nil, retry, fmt.Errorf("export failed: %s", resp.Status)
+	}
+	return nil, retry, fmt.Errorf("export failed: %s: %s", resp.Status, msg)
+}
+
+// retriableCodes holds the gRPC status codes that the
+// OTLP specification says may be retried.
+var retriableCodes = map[int]bool{
+	1:  true, // CANCELLED
+	4:  true, // DEADLINE_EXCEEDED
+	8:  true, // RESOURCE_EXHAUSTED
+	10: true, // ABORTED
+	11: true, // OUT_OF_RANGE
+	14: true, // UNAVAILABLE
+	15: true, // DATA_LOSS
+}
+
+// grpcResponse returns the message in a gRPC response
+// with the given body.
+func grpcResponse(resp *http.Response, body []byte) (_ []byte, retry bool, _ error) {
+	if resp.StatusCode != http.StatusOK {
+		retry := resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusTooManyRequests
+		return nil, retry, fmt.Errorf("export failed: %s", resp.Status)
+	}
+	// The status is in the trailers, or in the headers
+	// when the response holds no messages.
+	status := resp.Trailer.Get("Grpc-Status")
+	msg := resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+		msg = resp.Header.Get("Grpc-Message")
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return nil, true, fmt.Errorf("export failed: invalid gRPC status %q", status)
+	}
+	if code != 0 {
+		if m, err := url.PathUnescape(msg); err == nil {
+			msg = m
+		}
+		return nil, retriableCodes[code], fmt.Errorf("export failed: gRPC status %d: %s", code, msg)
+	}
+	if len(body) < 5 {
+		return nil, false, nil
+	}
+	n := binary.BigEndian.Uint32(body[1:])
+	if body[0] != 0 || int64(n) > int64(len(body)-5) {
+		// A compressed or truncated response only matters
+		// for the partial success information in it.
+		return nil, false, nil
+	}
+	return body[5 : 5+n], false, nil
+}
+
+// rejectedPoints returns the number of rejected data points
+// recorded in the partial_success field of the given
+// ExportMetricsServiceResponse.
+func rejectedPoints(resp []byte) int64 {
+	partial := protoField(resp, 1)
+	if partial == nil {
+		return 0
+	}
+	d := protoDecoder{buf: partial}
+	for {
+		field, wireType, ok := d.next()
+		if !ok {
+			return 0
+		}
+		if field == 1 && wireType == wireVarint {
+			return int64(d.uvarint())
+		}
+		d.skip(wireType)
+	}
+}
+
+// statusMessage returns the message field of an
+// encoded google.rpc.Status message.
+func statusMessage(data []byte) string {
+	return string(protoField(data, 2))
+}
+
+// protoField returns the contents of the first length-delimited
+// field with the given number in the encoded message, or nil if
+// there is none.
+func protoField(msg []byte, field int) []byte {
+	d := protoDecoder{buf: msg}
+	for {
+		f, wireType, ok := d.next()
+		if !ok {
+			return nil
+		}
+		if f == field && wireType == wireBytes {
+			return d.bytes()
+		}
+		d.skip(wireType)
+	}
+}
+
+// protoDecoder reads protocol buffer fields. Any malformed
+// data causes next to return false.
+type protoDecoder struct {
+	buf []byte
+	bad bool
+}
+
+func (d *protoDecoder) next() (field int, wireType int, ok bool) {
+	if len(d.buf) == 0 || d.bad {
+		return 0, 0, false
+	}
+	tag := d.uvarint()
+	return int(tag >> 3), int(tag & 7), !d.bad
+}
+
+func (d *protoDecoder) uvarint() uint64 {
+	x, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.bad = true
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return x
+}
+
+func (d *protoDecoder) bytes() []byte {
+	n := d.uvarint()
+	if d.bad || n > uint64(len(d.buf)) {
+		d.bad = true
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *protoDecoder) skip(wireType int) {
+	var n int
+	switch wireType {
+	case wireVarint:
+		d.uvarint()
+		return
+	case wireFixed64:
+		n = 8
+	case wireBytes:
+		d.bytes()
+		return
+	case 5: // 32-bit
+		n = 4
+	default:
+		d.bad = true
+		return
+	}
+	if n > len(d.buf) {
+		d.bad = true
+		return
+	}
+	d.buf = d.buf[n:]
+}
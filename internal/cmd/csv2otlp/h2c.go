@@ -0,0 +1,13 @@
+//go:build go1.24
+// +build go1.24
+
+package csv2otlp
+
+import "net/http"
+
+// enableH2C makes t use HTTP/2 without TLS.
+func enableH2C(t *http.Transport) error {
+	t.Protocols = new(http.Protocols)
+	t.Protocols.SetUnencryptedHTTP2(true)
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build !go1.24
+// +build !go1.24
+
+package csv2otlp
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// enableH2C makes t use HTTP/2 without TLS, which
+// net/http supports only from Go 1.24.
+func enableH2C(t *http.Transport) error {
+	return fmt.Errorf("gRPC without TLS requires building with Go 1.24 or later; use an https endpoint or the http/protobuf protocol")
+}
@@ -0,0 +1,374 @@
+// Package csv2otlp implements the csv2otlp command.
+package csv2otlp
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/cmdflag"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+	"github.com/rogpeppe/annotatedcsv/internal/series"
+)
+
+var flags = flag.NewFlagSet("csv2otlp", flag.ExitOnError)
+
+var (
+	drops     = cmdflag.NameSet{"_stop": true}
+	sums      = make(cmdflag.NameSet)
+	gauges    = make(cmdflag.NameSet)
+	resource  = make(keyValueFlag)
+	headers   = make(keyValueFlag)
+	endpoint  = flags.String("endpoint", "", "URL of the OTLP receiver; the default is $OTEL_EXPORTER_OTLP_ENDPOINT, or http://localhost:4318 (http://localhost:4317 for grpc); with http/protobuf, /v1/metrics is appended to a URL with no path")
+	protocol  = flags.String("protocol", "", "OTLP protocol: http/protobuf or grpc (default $OTEL_EXPORTER_OTLP_PROTOCOL or http/protobuf)")
+	kind      = flags.String("kind", "auto", "kind of metric to create: gauge, sum (a cumulative monotonic sum) or auto, which makes sums of fields whose names end in _total or _count and gauges of the rest")
+	scopeName = flags.String("scope", "csv2otlp", "name of the instrumentation scope of the metrics")
+	gzipFlag  = flags.Bool("gzip", true, "compress requests with gzip")
+	batchSize = flags.Int("batch-points", 5000, "maximum number of data points in each export request")
+)
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Var(drops, "drop", "comma-separated list of columns to omit from the output (can be repeated)")
+	flags.Var(sums, "sum", "comma-separated list of fields to export as sums whatever the -kind flag (can be repeated)")
+	flags.Var(gauges, "gauge", "comma-separated list of fields to export as gauges whatever the -kind flag (can be repeated)")
+	flags.Var(resource, "resource", "add a resource attribute, in the form key=value (can be repeated), such as service.name=myservice; $OTEL_RESOURCE_ATTRIBUTES is also used")
+	flags.Var(headers, "header", "add a header to each request, in the form key=value (can be repeated); $OTEL_EXPORTER_OTLP_HEADERS is also used")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] [file...]\n", flags.Name())
+		fmt.Fprintf(os.Stderr, `
+Each field becomes a metric named after the measurement and field,
+joined with a dot, and tag columns become data point attributes.
+Tables may hold _field and _value columns, or be pivoted with one
+column per field. Non-numeric field values are skipped; booleans
+become 0 or 1. The _start column, if present, holds the start time
+of sums.
+
+`)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *protocol == "" {
+		*protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+	if *protocol == "" {
+		*protocol = "http/protobuf"
+	}
+	if *protocol != "http/protobuf" && *protocol != "grpc" {
+		fmt.Fprintf(os.Stderr, "error: unsupported protocol %q\n", *protocol)
+		os.Exit(2)
+	}
+	switch *kind {
+	case "auto", "gauge", "sum":
+	default:
+		fmt.Fprintf(os.Stderr, "error: invalid -kind flag %q\n", *kind)
+		os.Exit(2)
+	}
+	if *batchSize < 1 {
+		fmt.Fprintf(os.Stderr, "error: -batch-points must be positive\n")
+		os.Exit(2)
+	}
+	for _, env := range []struct {
+		name string
+		f    keyValueFlag
+	}{{"OTEL_RESOURCE_ATTRIBUTES", resource}, {"OTEL_EXPORTER_OTLP_HEADERS", headers}} {
+		if err := env.f.setFromEnv(os.Getenv(env.name)); err != nil {
+			fmt.Fprintf(os.Stderr, "error: invalid $%s: %v\n", env.name, err)
+			os.Exit(2)
+		}
+	}
+	if *endpoint == "" {
+		*endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	if *endpoint == "" {
+		if *protocol == "grpc" {
+			*endpoint = "http://localhost:4317"
+		} else {
+			*endpoint = "http://localhost:4318"
+		}
+	}
+	files, err := input.Files(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	e, err := newExporter(*endpoint, *protocol)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	c := &converter{
+		batch: newBatch(),
+		exp:   e,
+	}
+	err = input.ForEach(files, func(r io.Reader) error {
+		return c.convert(annotatedcsv.NewReader(r))
+	})
+	if err == nil {
+		err = c.flush()
+	}
+	if c.skipped > 0 {
+		fmt.Fprintf(os.Stderr, "skipped %d non-numeric values\n", c.skipped)
+	}
+	if e.rejected > 0 {
+		fmt.Fprintf(os.Stderr, "receiver rejected %d data points\n", e.rejected)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+type converter struct {
+	batch *batch
+	exp   *exporter
+	// skipped holds the number of values skipped
+	// because they were not numeric.
+	skipped int
+}
+
+func (c *converter) convert(r *annotatedcsv.Reader) error {
+	for r.NextTable() {
+		info, err := tableInfoForColumns(r.Columns())
+		if err != nil {
+			return fmt.Errorf("cannot get table info for columns: %v", err)
+		}
+		for r.NextRow() {
+			if err := c.convertRow(info, r.Row()); err != nil {
+				return err
+			}
+		}
+	}
+	return r.Err()
+}
+
+// convertRow adds a data point for each numeric field in the given row.
+func (c *converter) convertRow(info *tableInfo, row []interface{}) error {
+	t, ok := row[info.Time].(time.Time)
+	if !ok {
+		return nil
+	}
+	var start time.Time
+	if info.start >= 0 {
+		start, _ = row[info.start].(time.Time)
+	}
+	attrs := make([]attribute, 0, len(info.attrNames))
+	for i, name := range info.attrNames {
+		v := row[info.attrIndexes[i]]
+		if v == nil || v == "" {
+			continue
+		}
+		attrs = append(attrs, attribute{name, v})
+	}
+	measurement := ""
+	if info.Measurement >= 0 {
+		measurement = valueString(row[info.Measurement])
+	}
+	addPoint := func(field string, v interface{}) error {
+		p, ok := pointValue(v)
+		if !ok {
+			if v != nil {
+				c.skipped++
+			}
+			return nil
+		}
+		p.attrs = attrs
+		p.time = t
+		m := metric{
+			name: metricName(measurement, field),
+			sum:  isSum(field),
+		}
+		if m.sum {
+			p.start = start
+		}
+		c.batch.add(m, p)
+		if c.batch.npoints >= *batchSize {
+			return c.flush()
+		}
+		return nil
+	}
+	if info.Field >= 0 {
+		return addPoint(valueString(row[info.Field]), row[info.Value])
+	}
+	for i, name := range info.FieldNames {
+		if err := addPoint(name, row[info.FieldIndexes[i]]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flush exports the current batch.
+func (c *converter) flush() error {
+	if c.batch.npoints == 0 {
+		return nil
+	}
+	req := c.batch.exportRequest(resource, *scopeName)
+	c.batch = newBatch()
+	return c.exp.export(req)
+}
+
+// isSum reports whether the given field
+// should be exported as a sum.
+func isSum(field string) bool {
+	switch {
+	case sums[field]:
+		return true
+	case gauges[field]:
+		return false
+	case *kind == "auto":
+		return strings.HasSuffix(field, "_total") || strings.HasSuffix(field, "_count")
+	}
+	return *kind == "sum"
+}
+
+// metricName returns the metric name for
+// the given measurement and field.
+func metricName(measurement, field string) string {
+	if measurement == "" {
+		return field
+	}
+	return measurement + "." + field
+}
+
+// pointValue returns a data point holding v.
+// It reports false if v is not numeric.
+func pointValue(v interface{}) (point, bool) {
+	switch v := v.(type) {
+	case int64:
+		return point{isInt: true, intValue: v}, true
+	case uint64:
+		if v <= math.MaxInt64 {
+			return point{isInt: true, intValue: int64(v)}, true
+		}
+		return point{doubleValue: float64(v)}, true
+	case float64:
+		return point{doubleValue: v}, true
+	case bool:
+		if v {
+			return point{isInt: true, intValue: 1}, true
+		}
+		return point{isInt: true}, true
+	case string:
+		// The reader represents infinities and NaN as strings.
+		if x, ok := nonFinite(v); ok {
+			return point{doubleValue: x}, true
+		}
+	}
+	return point{}, false
+}
+
+type tableInfo struct {
+	*series.Columns
+
+	// start holds the index of the _start column,
+	// or -1 if there is none.
+	start int
+
+	attrNames   []string
+	attrIndexes []int
+}
+
+func tableInfoForColumns(cols []annotatedcsv.Column) (*tableInfo, error) {
+	sc, err := series.Find(cols, func(name string) bool {
+		return drops[name] || name == "_start"
+	})
+	if err != nil {
+		return nil, err
+	}
+	info := &tableInfo{
+		Columns: sc,
+		start:   -1,
+	}
+	for i, col := range cols {
+		if col.Name != "_start" || drops[col.Name] {
+			continue
+		}
+		if annotatedcsv.DatatypeKind(col.Type) != annotatedcsv.DateTimeKind {
+			return nil, fmt.Errorf("_start column has wrong type, got %q want %q", col.Type, "dateTime:*")
+		}
+		info.start = i
+	}
+	for _, i := range sc.Tags {
+		info.attrNames = append(info.attrNames, cols[i].Name)
+		info.attrIndexes = append(info.attrIndexes, i)
+	}
+	return info, nil
+}
+
+// keyValueFlag implements flag.Value by recording
+// key=value pairs.
+type keyValueFlag map[string]string
+
+func (f keyValueFlag) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("%q is not in the form key=value", s)
+	}
+	f[s[:i]] = s[i+1:]
+	return nil
+}
+
+func (f keyValueFlag) String() string {
+	var pairs []string
+	for _, key := range f.keys() {
+		pairs = append(pairs, key+"="+f[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// setFromEnv sets entries from s, the value of an
+// environment variable holding comma-separated key=value
+// pairs with percent-encoded values, as used by the
+// OpenTelemetry SDKs. Entries already in f take precedence.
+func (f keyValueFlag) setFromEnv(s string) error {
+	if s == "" {
+		return nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		i := strings.Index(pair, "=")
+		if i <= 0 {
+			return fmt.Errorf("%q is not in the form key=value", pair)
+		}
+		key := strings.TrimSpace(pair[:i])
+		value, err := url.PathUnescape(strings.TrimSpace(pair[i+1:]))
+		if err != nil {
+			return err
+		}
+		if _, ok := f[key]; !ok {
+			f[key] = value
+		}
+	}
+	return nil
+}
+
+// keys returns the keys in f in sorted order.
+func (f keyValueFlag) keys() []string {
+	keys := make([]string, 0, len(f))
+	for key := range f {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func valueString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
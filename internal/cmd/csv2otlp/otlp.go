@@ -0,0 +1,207 @@
+package csv2otlp
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+	"time"
+)
+
+// attribute is a data point or resource attribute.
+type attribute struct {
+	key   string
+	value interface{}
+}
+
+// metric identifies a metric in a batch.
+type metric struct {
+	name string
+	// sum holds whether the metric is a cumulative
+	// monotonic sum rather than a gauge.
+	sum bool
+}
+
+// point is a number data point.
+type point struct {
+	attrs []attribute
+	// start holds the start time of a sum,
+	// or the zero time if it is unknown.
+	start time.Time
+	time  time.Time
+
+	// isInt holds whether the value is intValue
+	// rather than doubleValue.
+	isInt       bool
+	intValue    int64
+	doubleValue float64
+}
+
+// batch holds the data points of a single export request.
+type batch struct {
+	points map[metric][]point
+	// order holds the metrics in the order they were added.
+	order   []metric
+	npoints int
+}
+
+func newBatch() *batch {
+	return &batch{
+		points: make(map[metric][]point),
+	}
+}
+
+func (b *batch) add(m metric, p point) {
+	if _, ok := b.points[m]; !ok {
+		b.order = append(b.order, m)
+	}
+	b.points[m] = append(b.points[m], p)
+	b.npoints++
+}
+
+// OTLP aggregation temporality for cumulative sums.
+const temporalityCumulative = 2
+
+// exportRequest returns the protobuf encoding of an
+// opentelemetry.proto.collector.metrics.v1.ExportMetricsServiceRequest
+// message holding the batch, with the given resource attributes
+// and instrumentation scope name.
+func (b *batch) exportRequest(resource keyValueFlag, scopeName string) []byte {
+	var res, scope, scopeMetrics, msg, data, dp []byte
+	// Resource.
+	for _, key := range resource.keys() {
+		res = appendBytes(res, 1, appendKeyValue(nil, attribute{key, resource[key]}))
+	}
+	// InstrumentationScope.
+	scope = appendString(scope, 1, scopeName)
+	scopeMetrics = appendBytes(scopeMetrics, 1, scope)
+	for _, m := range b.order {
+		// Gauge or Sum.
+		data = data[:0]
+		for _, p := range b.points[m] {
+			dp = appendDataPoint(dp[:0], p)
+			data = appendBytes(data, 1, dp)
+		}
+		msg = appendString(msg[:0], 1, m.name)
+		if m.sum {
+			data = appendTag(data, 2, wireVarint)
+			data = appendUvarint(data, temporalityCumulative)
+			data = appendTag(data, 3, wireVarint)
+			data = appendUvarint(data, 1) // is_monotonic
+			msg = appendBytes(msg, 7, data)
+		} else {
+			msg = appendBytes(msg, 5, data)
+		}
+		scopeMetrics = appendBytes(scopeMetrics, 2, msg)
+	}
+	// ResourceMetrics.
+	msg = appendBytes(msg[:0], 1, res)
+	msg = appendBytes(msg, 2, scopeMetrics)
+	return appendBytes(nil, 1, msg)
+}
+
+// appendDataPoint appends the fields of a NumberDataPoint message.
+func appendDataPoint(buf []byte, p point) []byte {
+	if !p.start.IsZero() {
+		buf = appendTag(buf, 2, wireFixed64)
+		buf = appendFixed64(buf, uint64(p.start.UnixNano()))
+	}
+	buf = appendTag(buf, 3, wireFixed64)
+	buf = appendFixed64(buf, uint64(p.time.UnixNano()))
+	if p.isInt {
+		buf = appendTag(buf, 6, wireFixed64)
+		buf = appendFixed64(buf, uint64(p.intValue))
+	} else {
+		buf = appendTag(buf, 4, wireFixed64)
+		buf = appendFixed64(buf, math.Float64bits(p.doubleValue))
+	}
+	var kv []byte
+	for _, a := range p.attrs {
+		kv = appendKeyValue(kv[:0], a)
+		buf = appendBytes(buf, 7, kv)
+	}
+	return buf
+}
+
+// appendKeyValue appends the fields of a KeyValue message.
+func appendKeyValue(buf []byte, a attribute) []byte {
+	buf = appendString(buf, 1, a.key)
+	var v []byte
+	switch x := a.value.(type) {
+	case bool:
+		v = appendTag(v, 2, wireVarint)
+		if x {
+			v = appendUvarint(v, 1)
+		} else {
+			v = appendUvarint(v, 0)
+		}
+	case int64:
+		v = appendTag(v, 3, wireVarint)
+		v = appendUvarint(v, uint64(x))
+	case uint64:
+		if x <= math.MaxInt64 {
+			v = appendTag(v, 3, wireVarint)
+			v = appendUvarint(v, x)
+		} else {
+			v = appendTag(v, 4, wireFixed64)
+			v = appendFixed64(v, math.Float64bits(float64(x)))
+		}
+	case float64:
+		v = appendTag(v, 4, wireFixed64)
+		v = appendFixed64(v, math.Float64bits(x))
+	case string:
+		if f, ok := nonFinite(x); ok {
+			v = appendTag(v, 4, wireFixed64)
+			v = appendFixed64(v, math.Float64bits(f))
+		} else {
+			v = appendString(v, 1, x)
+		}
+	case time.Time:
+		v = appendString(v, 1, x.Format(time.RFC3339Nano))
+	}
+	return appendBytes(buf, 2, v)
+}
+
+// nonFinite reports whether s represents
+// an infinity or NaN, and returns its value.
+func nonFinite(s string) (float64, bool) {
+	x, err := strconv.ParseFloat(s, 64)
+	if err != nil || !math.IsInf(x, 0) && !math.IsNaN(x) {
+		return 0, false
+	}
+	return x, true
+}
+
+// Protocol buffer wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+func appendTag(buf []byte, field int, wireType int) []byte {
+	return appendUvarint(buf, uint64(field)<<3|uint64(wireType))
+}
+
+func appendUvarint(buf []byte, x uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], x)
+	return append(buf, b[:n]...)
+}
+
+func appendFixed64(buf []byte, x uint64) []byte {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], x)
+	return append(buf, b[:]...)
+}
+
+func appendBytes(buf []byte, field int, data []byte) []byte {
+	buf = appendTag(buf, field, wireBytes)
+	buf = appendUvarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
+
+func appendString(buf []byte, field int, s string) []byte {
+	buf = appendTag(buf, field, wireBytes)
+	buf = appendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
@@ -0,0 +1,178 @@
+package csv2otlp
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+var t0 = time.Date(2020, 1, 1, 0, 0, 0, 123456789, time.UTC)
+
+// The golden file testdata/export.pb was checked by decoding it
+// with the generated OTLP Go protobuf types. Run the tests with
+// -update to rewrite it after changing the encoder, and check it
+// again.
+func TestExportRequestGolden(t *testing.T) {
+	b := newBatch()
+	cpu := metric{name: "cpu_usage"}
+	requests := metric{name: "http_requests_total", sum: true}
+	b.add(cpu, point{
+		attrs: []attribute{
+			{"host", "a"},
+			{"up", true},
+			{"cores", int64(-4)},
+			{"big", uint64(math.MaxUint64)},
+			{"small", uint64(7)},
+			{"load", 0.5},
+			{"inf", "+Inf"},
+			{"since", t0},
+		},
+		time:        t0,
+		doubleValue: 1.5,
+	})
+	b.add(requests, point{
+		start:    t0.Add(-time.Hour),
+		time:     t0,
+		isInt:    true,
+		intValue: -2,
+	})
+	b.add(cpu, point{
+		attrs:       []attribute{{"host", "b"}},
+		time:        t0.Add(time.Second),
+		doubleValue: math.Inf(-1),
+	})
+	got := b.exportRequest(keyValueFlag{
+		"service.name": "annotatedcsv",
+		"env":          "test",
+	}, "csv2otlp")
+	file := filepath.Join("testdata", "export.pb")
+	if *update {
+		if err := ioutil.WriteFile(file, got, 0666); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("export request differs from %s; got %q", file, got)
+	}
+}
+
+var appendKeyValueTests = []struct {
+	testName string
+	attr     attribute
+	expect   string
+}{{
+	testName: "string",
+	attr:     attribute{"k", "v"},
+	expect:   "\x0a\x01k" + "\x12\x03" + "\x0a\x01v",
+}, {
+	testName: "bool",
+	attr:     attribute{"k", true},
+	expect:   "\x0a\x01k" + "\x12\x02" + "\x10\x01",
+}, {
+	testName: "negative-int",
+	attr:     attribute{"k", int64(-1)},
+	expect:   "\x0a\x01k" + "\x12\x0b" + "\x18\xff\xff\xff\xff\xff\xff\xff\xff\xff\x01",
+}, {
+	testName: "large-uint",
+	attr:     attribute{"k", uint64(1 << 63)},
+	expect:   "\x0a\x01k" + "\x12\x09" + "\x21\x00\x00\x00\x00\x00\x00\xe0\x43",
+}, {
+	testName: "double",
+	attr:     attribute{"k", 1.0},
+	expect:   "\x0a\x01k" + "\x12\x09" + "\x21\x00\x00\x00\x00\x00\x00\xf0\x3f",
+}, {
+	testName: "nan-string",
+	attr:     attribute{"k", "NaN"},
+	expect:   "\x0a\x01k" + "\x12\x09" + "\x21\x01\x00\x00\x00\x00\x00\xf8\x7f",
+}, {
+	testName: "time",
+	attr:     attribute{"k", time.Unix(0, 0).UTC()},
+	expect:   "\x0a\x01k" + "\x12\x16" + "\x0a\x141970-01-01T00:00:00Z",
+}}
+
+func TestAppendKeyValue(t *testing.T) {
+	for _, test := range appendKeyValueTests {
+		t.Run(test.testName, func(t *testing.T) {
+			if got := string(appendKeyValue(nil, test.attr)); got != test.expect {
+				t.Errorf("unexpected encoding; got %q want %q", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestRejectedPoints(t *testing.T) {
+	// ExportMetricsServiceResponse{partial_success: {rejected_data_points: 300, error_message: "x"}}
+	resp := []byte("\x0a\x05" + "\x08\xac\x02" + "\x12\x01x")
+	if got := rejectedPoints(resp); got != 300 {
+		t.Errorf("unexpected rejected points %d", got)
+	}
+	if got := rejectedPoints(nil); got != 0 {
+		t.Errorf("unexpected rejected points %d for empty response", got)
+	}
+	if got := rejectedPoints([]byte("\x0a\x05\x08")); got != 0 {
+		t.Errorf("unexpected rejected points %d for malformed response", got)
+	}
+}
+
+func TestStatusMessage(t *testing.T) {
+	// google.rpc.Status{code: 3, message: "bad"}, with an
+	// unknown fixed32 field before the message.
+	status := []byte("\x08\x03" + "\x2d\x01\x02\x03\x04" + "\x12\x03bad")
+	if got := statusMessage(status); got != "bad" {
+		t.Errorf("unexpected status message %q", got)
+	}
+}
+
+func TestTableInfoStart(t *testing.T) {
+	const data = `#datatype,string,long,dateTime:RFC3339,dateTime:RFC3339,dateTime:RFC3339,double,string,string,string
+#group,false,false,true,true,false,false,true,true,true
+#default,_result,,,,,,,,
+,result,table,_start,_stop,_time,_value,_field,_measurement,host
+`
+	r := annotatedcsv.NewReader(strings.NewReader(data))
+	if !r.NextTable() {
+		t.Fatalf("no table: %v", r.Err())
+	}
+	info, err := tableInfoForColumns(r.Columns())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.start != 3 || info.Time != 5 || info.Field != 7 || info.Value != 6 || info.Measurement != 8 {
+		t.Fatalf("unexpected column indexes: %+v %+v", info, info.Columns)
+	}
+	// _start is not an attribute even though
+	// it is in the group key.
+	if !reflect.DeepEqual(info.attrNames, []string{"host"}) {
+		t.Fatalf("unexpected attributes %q", info.attrNames)
+	}
+
+	const bad = `#datatype,long,dateTime:RFC3339,string,double
+#group,true,false,true,false
+#default,,,,
+,_start,_time,_field,_value
+`
+	r = annotatedcsv.NewReader(strings.NewReader(bad))
+	if !r.NextTable() {
+		t.Fatalf("no table: %v", r.Err())
+	}
+	_, err = tableInfoForColumns(r.Columns())
+	want := `_start column has wrong type, got "long" want "dateTime:*"`
+	if err == nil || err.Error() != want {
+		t.Fatalf("unexpected error; got %v want %q", err, want)
+	}
+}
@@ -0,0 +1,221 @@
+// Package csv2parquet implements the csv2parquet command.
+package csv2parquet
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+	"github.com/rogpeppe/annotatedcsv/internal/parquet"
+)
+
+var flags = flag.NewFlagSet("csv2parquet", flag.ExitOnError)
+
+var (
+	outFile      = flags.String("o", "", "output file (default standard output)")
+	rowGroupRows = flags.Int("row-group-rows", parquet.DefaultRowGroupRows, "maximum number of rows in each row group")
+	compression  = flags.String("compression", "gzip", "page compression: none or gzip")
+	timeUnit     = flags.String("time-unit", "ns", "precision of stored timestamps: ms, us or ns")
+	dictionary   = flags.Bool("dictionary", true, "dictionary-encode tag columns and string group columns")
+)
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] [file...]\n", flags.Name())
+		fmt.Fprintf(os.Stderr, "All input tables must have the same columns as the first; use csvcat -union to combine tables with different columns.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	opts := parquet.Options{
+		RowGroupRows: *rowGroupRows,
+		CreatedBy:    "annotatedcsv csv2parquet",
+	}
+	switch *compression {
+	case "none":
+		opts.Codec = parquet.Uncompressed
+	case "gzip":
+		opts.Codec = parquet.Gzip
+	default:
+		fmt.Fprintf(os.Stderr, "error: unknown compression %q\n", *compression)
+		os.Exit(2)
+	}
+	switch *timeUnit {
+	case "ms":
+		opts.TimeUnit = parquet.Millis
+	case "us":
+		opts.TimeUnit = parquet.Micros
+	case "ns":
+		opts.TimeUnit = parquet.Nanos
+	default:
+		fmt.Fprintf(os.Stderr, "error: unknown time unit %q\n", *timeUnit)
+		os.Exit(2)
+	}
+	files, err := input.Files(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	out := os.Stdout
+	if *outFile != "" {
+		out, err = os.Create(*outFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	bw := bufio.NewWriter(out)
+	c := &converter{
+		w:    bw,
+		opts: opts,
+	}
+	err = input.ForEach(files, func(r io.Reader) error {
+		return c.convert(annotatedcsv.NewReader(r))
+	})
+	if err == nil {
+		err = c.Close()
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err1 := out.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// converter writes the rows of all tables to a single Parquet file
+// whose schema is taken from the first table.
+type converter struct {
+	w    io.Writer
+	opts parquet.Options
+	pw   *parquet.Writer
+	// cols holds the columns of the Parquet file.
+	cols []annotatedcsv.Column
+}
+
+func (c *converter) convert(r *annotatedcsv.Reader) error {
+	for r.NextTable() {
+		tableCols := r.Columns()
+		if c.pw == nil {
+			if err := c.start(tableCols); err != nil {
+				return err
+			}
+		}
+		// indexes holds the index in tableCols
+		// of each column in the Parquet file.
+		indexes := make([]int, len(c.cols))
+		for i, col := range c.cols {
+			indexes[i] = -1
+			for j, tcol := range tableCols {
+				if tcol.Name == col.Name {
+					if tcol.Type != col.Type {
+						return fmt.Errorf("column %q has type %q; want %q as in the first table", col.Name, tcol.Type, col.Type)
+					}
+					indexes[i] = j
+					break
+				}
+			}
+			if indexes[i] == -1 {
+				return fmt.Errorf("column %q not found in table; all tables must have the same columns", col.Name)
+			}
+		}
+		if len(tableCols) != len(c.cols)+1 {
+			return fmt.Errorf("table has %d columns; want %d as in the first table", len(tableCols)-1, len(c.cols))
+		}
+		row := make([]interface{}, len(c.cols))
+		for r.NextRow() {
+			tableRow := r.Row()
+			for i, index := range indexes {
+				v, err := parquetValue(tableRow[index], c.cols[i].Type)
+				if err != nil {
+					return fmt.Errorf("column %q: %v", c.cols[i].Name, err)
+				}
+				row[i] = v
+			}
+			if err := c.pw.WriteRow(row); err != nil {
+				return err
+			}
+		}
+	}
+	return r.Err()
+}
+
+// start creates the Parquet writer with columns derived from the
+// given table columns. The annotation column is omitted.
+func (c *converter) start(tableCols []annotatedcsv.Column) error {
+	var pcols []parquet.Column
+	for i, col := range tableCols {
+		if i == 0 && col.Name == "" && col.Default == nil {
+			continue
+		}
+		c.cols = append(c.cols, col)
+		pcol := parquet.Column{
+			Name: col.Name,
+			Kind: parquetKind(col.Type),
+		}
+		if pcol.Kind == parquet.String && *dictionary && (col.Type == "tag" || col.Group) {
+			pcol.Dictionary = true
+		}
+		pcols = append(pcols, pcol)
+	}
+	pw, err := parquet.NewWriter(c.w, pcols, c.opts)
+	if err != nil {
+		return err
+	}
+	c.pw = pw
+	return nil
+}
+
+// Close completes the Parquet file. If there were
+// no tables, the file has no columns and an error
+// is returned.
+func (c *converter) Close() error {
+	if c.pw == nil {
+		return fmt.Errorf("no tables found in input")
+	}
+	return c.pw.Close()
+}
+
+// parquetKind returns the kind of Parquet column used
+// to hold values of the given datatype.
+func parquetKind(typ string) parquet.Kind {
+	switch annotatedcsv.DatatypeKind(typ) {
+	case annotatedcsv.BooleanKind:
+		return parquet.Boolean
+	case annotatedcsv.LongKind:
+		return parquet.Int64
+	case annotatedcsv.UnsignedLongKind:
+		return parquet.Uint64
+	case annotatedcsv.DoubleKind:
+		return parquet.Double
+	case annotatedcsv.DateTimeKind:
+		return parquet.Timestamp
+	}
+	return parquet.String
+}
+
+// parquetValue returns v as stored in a Parquet column
+// for the given datatype.
+func parquetValue(v interface{}, typ string) (interface{}, error) {
+	if s, ok := v.(string); ok && typ == "double" {
+		// The reader represents infinities and NaN as strings.
+		return strconv.ParseFloat(s, 64)
+	}
+	if parquetKind(typ) == parquet.String && v != nil {
+		if _, ok := v.(string); !ok {
+			return fmt.Sprint(v), nil
+		}
+	}
+	return v, nil
+}
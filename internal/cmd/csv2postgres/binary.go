@@ -0,0 +1,114 @@
+package csv2postgres
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv"
+)
+
+// pgEpoch holds the zero time of Postgres timestamps.
+var pgEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// appendField appends v, a value from a column with the given
+// datatype, as a field in the COPY binary format: its length
+// followed by its value in the binary form of the column's
+// SQL type (see sqlType).
+func appendField(buf []byte, v interface{}, typ string) ([]byte, error) {
+	if v == nil {
+		return appendInt32(buf, -1), nil
+	}
+	switch annotatedcsv.DatatypeKind(typ) {
+	case annotatedcsv.BooleanKind:
+		if v, ok := v.(bool); ok {
+			buf = appendInt32(buf, 1)
+			if v {
+				return append(buf, 1), nil
+			}
+			return append(buf, 0), nil
+		}
+	case annotatedcsv.LongKind:
+		if v, ok := v.(int64); ok {
+			buf = appendInt32(buf, 8)
+			return appendInt64(buf, v), nil
+		}
+	case annotatedcsv.UnsignedLongKind:
+		if v, ok := v.(uint64); ok {
+			return appendNumeric(buf, v), nil
+		}
+	case annotatedcsv.DoubleKind:
+		var x float64
+		switch v := v.(type) {
+		case float64:
+			x = v
+		case string:
+			// The Reader returns non-finite doubles as strings.
+			var err error
+			if x, err = strconv.ParseFloat(v, 64); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unexpected value %#v for datatype %q", v, typ)
+		}
+		buf = appendInt32(buf, 8)
+		return appendInt64(buf, int64(math.Float64bits(x))), nil
+	case annotatedcsv.DateTimeKind:
+		if v, ok := v.(time.Time); ok {
+			// Timestamps are in microseconds since pgEpoch;
+			// any finer precision is truncated.
+			usec := (v.Unix()-pgEpoch.Unix())*1e6 + int64(v.Nanosecond()/1e3)
+			buf = appendInt32(buf, 8)
+			return appendInt64(buf, usec), nil
+		}
+	default:
+		s, ok := v.(string)
+		if !ok {
+			s = fmt.Sprint(v)
+		}
+		buf = appendInt32(buf, int32(len(s)))
+		return append(buf, s...), nil
+	}
+	return nil, fmt.Errorf("unexpected value %#v for datatype %q", v, typ)
+}
+
+// appendNumeric appends x as a field holding a NUMERIC value. Its
+// binary form is the number of base-10000 digits, the weight of
+// the first digit, the sign and the display scale, followed by
+// the digits themselves, most significant first.
+func appendNumeric(buf []byte, x uint64) []byte {
+	var digits []int16
+	for ; x > 0; x /= 10000 {
+		digits = append(digits, int16(x%10000))
+	}
+	weight := len(digits) - 1
+	// Trailing zero digits are implied by the weight.
+	for len(digits) > 0 && digits[0] == 0 {
+		digits = digits[1:]
+	}
+	buf = appendInt32(buf, int32(8+2*len(digits)))
+	buf = appendInt16(buf, int16(len(digits)))
+	if weight < 0 {
+		weight = 0
+	}
+	buf = appendInt16(buf, int16(weight))
+	buf = appendInt16(buf, 0) // sign: positive
+	buf = appendInt16(buf, 0) // display scale
+	for i := len(digits) - 1; i >= 0; i-- {
+		buf = appendInt16(buf, digits[i])
+	}
+	return buf
+}
+
+func appendInt16(buf []byte, x int16) []byte {
+	return append(buf, byte(x>>8), byte(x))
+}
+
+func appendInt32(buf []byte, x int32) []byte {
+	return append(buf, byte(x>>24), byte(x>>16), byte(x>>8), byte(x))
+}
+
+func appendInt64(buf []byte, x int64) []byte {
+	return append(buf, byte(x>>56), byte(x>>48), byte(x>>40), byte(x>>32), byte(x>>24), byte(x>>16), byte(x>>8), byte(x))
+}
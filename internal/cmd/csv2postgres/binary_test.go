@@ -0,0 +1,106 @@
+package csv2postgres
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+)
+
+// The expected values are in the binary form produced by the
+// PostgreSQL send functions for each type (boolsend, int8send,
+// float8send, timestamptz_send, numeric_send and textsend),
+// preceded by the field length.
+var appendFieldTests = []struct {
+	testName string
+	typ      string
+	value    interface{}
+	expect   string
+}{{
+	testName: "null",
+	typ:      "long",
+	value:    nil,
+	expect:   "\xff\xff\xff\xff",
+}, {
+	testName: "true",
+	typ:      "boolean",
+	value:    true,
+	expect:   "\x00\x00\x00\x01\x01",
+}, {
+	testName: "false",
+	typ:      "boolean",
+	value:    false,
+	expect:   "\x00\x00\x00\x01\x00",
+}, {
+	testName: "long",
+	typ:      "long",
+	value:    int64(-2),
+	expect:   "\x00\x00\x00\x08\xff\xff\xff\xff\xff\xff\xff\xfe",
+}, {
+	testName: "double",
+	typ:      "double",
+	value:    1.5,
+	expect:   "\x00\x00\x00\x08\x3f\xf8\x00\x00\x00\x00\x00\x00",
+}, {
+	testName: "double-infinity",
+	typ:      "double",
+	value:    "+Inf",
+	expect:   "\x00\x00\x00\x08\x7f\xf0\x00\x00\x00\x00\x00\x00",
+}, {
+	testName: "time",
+	typ:      "dateTime:RFC3339",
+	value:    time.Date(2000, 1, 1, 0, 0, 1, 500000999, time.UTC),
+	expect:   "\x00\x00\x00\x08\x00\x00\x00\x00\x00\x16\xe3\x60",
+}, {
+	testName: "time-before-epoch",
+	typ:      "dateTime:RFC3339Nano",
+	value:    time.Date(1999, 12, 31, 23, 59, 59, 0, time.UTC),
+	expect:   "\x00\x00\x00\x08\xff\xff\xff\xff\xff\xf0\xbd\xc0",
+}, {
+	testName: "unsigned-zero",
+	typ:      "unsignedLong",
+	value:    uint64(0),
+	expect:   "\x00\x00\x00\x08\x00\x00\x00\x00\x00\x00\x00\x00",
+}, {
+	testName: "unsigned",
+	typ:      "unsignedLong",
+	value:    uint64(12345678),
+	expect:   "\x00\x00\x00\x0c\x00\x02\x00\x01\x00\x00\x00\x00\x04\xd2\x16\x2e",
+}, {
+	testName: "unsigned-trailing-zeros",
+	typ:      "unsignedLong",
+	value:    uint64(10000),
+	expect:   "\x00\x00\x00\x0a\x00\x01\x00\x01\x00\x00\x00\x00\x00\x01",
+}, {
+	testName: "unsigned-max",
+	typ:      "unsignedLong",
+	value:    uint64(math.MaxUint64),
+	expect:   "\x00\x00\x00\x12\x00\x05\x00\x04\x00\x00\x00\x00\x07\x34\x1a\x58\x02\xe1\x03\xbb\x06\x4f",
+}, {
+	testName: "string",
+	typ:      "string",
+	value:    "héllo",
+	expect:   "\x00\x00\x00\x06h\xc3\xa9llo",
+}}
+
+func TestAppendField(t *testing.T) {
+	for _, test := range appendFieldTests {
+		t.Run(test.testName, func(t *testing.T) {
+			got, err := appendField([]byte("x"), test.value, test.typ)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "x" + test.expect; !bytes.Equal(got, []byte(want)) {
+				t.Errorf("unexpected encoding; got %q want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestAppendFieldError(t *testing.T) {
+	_, err := appendField(nil, "x", "long")
+	want := `unexpected value "x" for datatype "long"`
+	if err == nil || err.Error() != want {
+		t.Fatalf("unexpected error; got %v want %q", err, want)
+	}
+}
@@ -0,0 +1,444 @@
+// Package csv2prom implements the csv2prom command.
+package csv2prom
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/cmdflag"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+	"github.com/rogpeppe/annotatedcsv/internal/series"
+)
+
+var flags = flag.NewFlagSet("csv2prom", flag.ExitOnError)
+
+var (
+	drops     = cmdflag.NameSet{"_start": true, "_stop": true}
+	addLabels = make(keyValueFlag)
+
+	serverURL    = flags.String("url", "", "send samples to this Prometheus remote-write endpoint rather than writing OpenMetrics text to the standard output")
+	batchSamples = flags.Int("batch-samples", 10000, "maximum number of samples in each remote-write request")
+	token        = flags.String("token", "", "bearer token for authentication (with -url); defaults to $PROM_TOKEN")
+	username     = flags.String("username", "", "user name for basic authentication (with -url); defaults to $PROM_USERNAME")
+	password     = flags.String("password", "", "password for basic authentication (with -url); defaults to $PROM_PASSWORD")
+	vmImport     = flags.Bool("vm-import", false, "write the JSON line format of the VictoriaMetrics /api/v1/import endpoint rather than OpenMetrics text; with -url, send it to the URL, which should be that endpoint, rather than making remote-write requests")
+)
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Var(drops, "drop", "comma-separated list of columns to omit from the output (can be repeated)")
+	flags.Var(addLabels, "label", "add a label to every sample, in the form name=value (can be repeated); this overrides any label of the same name from the input")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] [file...]\n", flags.Name())
+		fmt.Fprintf(os.Stderr, `
+Each field becomes a metric named after the measurement and field,
+joined with an underscore, and tag columns become labels. Tables may
+hold _field and _value columns, or be pivoted with one column per
+field. Non-numeric field values are skipped; booleans become 0 or 1.
+
+Without -url, all samples are held in memory so that each metric
+family can be written contiguously, as OpenMetrics requires, unless
+-vm-import is used.
+
+`)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	for _, name := range addLabels.keys() {
+		if !validLabelName(name) {
+			fmt.Fprintf(os.Stderr, "error: invalid label name %q\n", name)
+			os.Exit(2)
+		}
+	}
+	if *batchSamples < 1 {
+		fmt.Fprintf(os.Stderr, "error: -batch-samples must be positive\n")
+		os.Exit(2)
+	}
+	files, err := input.Files(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	var s sink
+	if *serverURL != "" {
+		rw, err := newRemoteWriter(*serverURL)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(2)
+		}
+		rw.token = envDefault(*token, "PROM_TOKEN")
+		rw.username = envDefault(*username, "PROM_USERNAME")
+		rw.password = envDefault(*password, "PROM_PASSWORD")
+		rw.vmImport = *vmImport
+		s = rw
+	} else if *vmImport {
+		s = &remoteWriter{
+			vmImport: true,
+			out:      os.Stdout,
+			series:   make(map[string]*remoteSeries),
+		}
+	} else {
+		s = newTextWriter(os.Stdout)
+	}
+	c := &converter{
+		sink: s,
+	}
+	err = input.ForEach(files, func(r io.Reader) error {
+		return c.convert(annotatedcsv.NewReader(r))
+	})
+	if err1 := s.close(); err == nil {
+		err = err1
+	}
+	if c.skipped > 0 {
+		fmt.Fprintf(os.Stderr, "skipped %d non-numeric values\n", c.skipped)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func envDefault(s, envVar string) string {
+	if s == "" {
+		return os.Getenv(envVar)
+	}
+	return s
+}
+
+// sink is implemented by the destinations for samples.
+type sink interface {
+	// add adds a sample for the series with the given labels,
+	// which are sorted by name and include the metric name.
+	add(labels []label, value float64, t time.Time) error
+	close() error
+}
+
+type label struct {
+	name, value string
+}
+
+type converter struct {
+	sink sink
+	// skipped holds the number of values skipped
+	// because they were not numeric.
+	skipped int
+}
+
+func (c *converter) convert(r *annotatedcsv.Reader) error {
+	for r.NextTable() {
+		info, err := tableInfoForColumns(r.Columns())
+		if err != nil {
+			return fmt.Errorf("cannot get table info for columns: %v", err)
+		}
+		for r.NextRow() {
+			if err := c.convertRow(info, r.Row()); err != nil {
+				return err
+			}
+		}
+	}
+	return r.Err()
+}
+
+// convertRow adds a sample for each numeric field in the given row.
+func (c *converter) convertRow(info *tableInfo, row []interface{}) error {
+	t, ok := row[info.Time].(time.Time)
+	if !ok {
+		return nil
+	}
+	labels := make([]label, 0, len(info.labelNames)+len(addLabels)+1)
+	labels = append(labels, label{name: "__name__"})
+	for i, name := range info.labelNames {
+		v := row[info.labelIndexes[i]]
+		if v == nil || v == "" {
+			// Prometheus treats empty labels as absent.
+			continue
+		}
+		labels = append(labels, label{name, valueString(v)})
+	}
+	for _, name := range addLabels.keys() {
+		labels = append(labels, label{name, addLabels[name]})
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].name < labels[j].name
+	})
+	measurement := ""
+	if info.Measurement >= 0 {
+		measurement = valueString(row[info.Measurement])
+	}
+	addSample := func(field string, v interface{}) error {
+		x, ok := numericValue(v)
+		if !ok {
+			if v != nil {
+				c.skipped++
+			}
+			return nil
+		}
+		// The labels are sorted, so the name is always first.
+		labels[0].value = metricName(measurement, field)
+		return c.sink.add(labels, x, t)
+	}
+	if info.Field >= 0 {
+		return addSample(valueString(row[info.Field]), row[info.Value])
+	}
+	for i, name := range info.FieldNames {
+		if err := addSample(name, row[info.FieldIndexes[i]]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// numericValue returns v as a sample value.
+// It reports false if v is not numeric.
+func numericValue(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		// The reader represents infinities and NaN as strings.
+		if x, err := strconv.ParseFloat(v, 64); err == nil && (math.IsInf(x, 0) || math.IsNaN(x)) {
+			return x, true
+		}
+	}
+	return 0, false
+}
+
+type tableInfo struct {
+	*series.Columns
+
+	labelNames   []string
+	labelIndexes []int
+}
+
+func tableInfoForColumns(cols []annotatedcsv.Column) (*tableInfo, error) {
+	sc, err := series.Find(cols, func(name string) bool {
+		return drops[name]
+	})
+	if err != nil {
+		return nil, err
+	}
+	info := &tableInfo{
+		Columns: sc,
+	}
+	usedLabelNames := make(map[string]string)
+	for _, i := range sc.Tags {
+		col := cols[i]
+		name := labelName(strings.TrimPrefix(col.Name, "_"))
+		if _, ok := addLabels[name]; ok {
+			continue
+		}
+		if other, ok := usedLabelNames[name]; ok {
+			return nil, fmt.Errorf("columns %q and %q both map to label %q", other, col.Name, name)
+		}
+		usedLabelNames[name] = col.Name
+		info.labelNames = append(info.labelNames, name)
+		info.labelIndexes = append(info.labelIndexes, i)
+	}
+	return info, nil
+}
+
+// metricName returns the Prometheus metric name
+// for the given measurement and field.
+func metricName(measurement, field string) string {
+	name := field
+	if measurement != "" {
+		name = measurement + "_" + field
+	}
+	return sanitizeName(name, true)
+}
+
+// labelName returns a valid Prometheus label name
+// derived from the given column name.
+func labelName(name string) string {
+	name = sanitizeName(name, false)
+	if strings.HasPrefix(name, "__") {
+		// Names starting with __ are reserved.
+		name = "x" + name
+	}
+	return name
+}
+
+func validLabelName(name string) bool {
+	return name != "" && sanitizeName(name, false) == name && !strings.HasPrefix(name, "__")
+}
+
+// sanitizeName replaces characters not allowed in Prometheus
+// metric names (or label names if colon is false) with
+// underscores.
+func sanitizeName(name string, colon bool) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || colon && r == ':' {
+			return r
+		}
+		return '_'
+	}, name)
+	if name == "" || '0' <= name[0] && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+func valueString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
+
+// textWriter writes samples in OpenMetrics text format.
+type textWriter struct {
+	w io.Writer
+	// families holds the series in each metric family,
+	// keyed by metric name.
+	families map[string]*family
+}
+
+type family struct {
+	series map[string]*textSeries
+	// order holds the series in the order they were created.
+	order []*textSeries
+}
+
+type textSeries struct {
+	// text holds the metric name and labels
+	// as written in the output.
+	text    string
+	samples []textSample
+}
+
+type textSample struct {
+	value float64
+	time  time.Time
+}
+
+func newTextWriter(w io.Writer) *textWriter {
+	return &textWriter{
+		w:        w,
+		families: make(map[string]*family),
+	}
+}
+
+func (w *textWriter) add(labels []label, value float64, t time.Time) error {
+	name := labels[0].value
+	f := w.families[name]
+	if f == nil {
+		f = &family{
+			series: make(map[string]*textSeries),
+		}
+		w.families[name] = f
+	}
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 1 {
+		b.WriteByte('{')
+		for i, l := range labels[1:] {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(&b, "%s=\"%s\"", l.name, labelValueEscaper.Replace(l.value))
+		}
+		b.WriteByte('}')
+	}
+	key := b.String()
+	s := f.series[key]
+	if s == nil {
+		s = &textSeries{
+			text: key,
+		}
+		f.series[key] = s
+		f.order = append(f.order, s)
+	}
+	s.samples = append(s.samples, textSample{value, t})
+	return nil
+}
+
+var labelValueEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\n", `\n`,
+)
+
+// close writes all the metric families, sorted by name.
+func (w *textWriter) close() error {
+	names := make([]string, 0, len(w.families))
+	for name := range w.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	bw := bufio.NewWriter(w.w)
+	for _, name := range names {
+		fmt.Fprintf(bw, "# TYPE %s unknown\n", name)
+		for _, s := range w.families[name].order {
+			sort.SliceStable(s.samples, func(i, j int) bool {
+				return s.samples[i].time.Before(s.samples[j].time)
+			})
+			for _, sample := range s.samples {
+				// OpenMetrics timestamps are in seconds.
+				t := sample.time
+				ts := strconv.FormatInt(t.Unix(), 10)
+				if ns := t.Nanosecond(); ns != 0 {
+					ts += strings.TrimRight(fmt.Sprintf(".%09d", ns), "0")
+				}
+				fmt.Fprintf(bw, "%s %s %s\n", s.text, strconv.FormatFloat(sample.value, 'g', -1, 64), ts)
+			}
+		}
+	}
+	bw.WriteString("# EOF\n")
+	return bw.Flush()
+}
+
+// keyValueFlag implements flag.Value by recording
+// key=value pairs.
+type keyValueFlag map[string]string
+
+func (f keyValueFlag) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 || i == len(s)-1 {
+		return fmt.Errorf("%q is not in the form key=value", s)
+	}
+	f[s[:i]] = s[i+1:]
+	return nil
+}
+
+func (f keyValueFlag) String() string {
+	var pairs []string
+	for _, key := range f.keys() {
+		pairs = append(pairs, key+"="+f[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// keys returns the keys in f in sorted order.
+func (f keyValueFlag) keys() []string {
+	keys := make([]string, 0, len(f))
+	for key := range f {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
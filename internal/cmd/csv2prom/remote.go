@@ -0,0 +1,292 @@
+package csv2prom
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+
+	"github.com/rogpeppe/annotatedcsv/internal/retry"
+)
+
+// remoteWriter sends batches of samples to a Prometheus
+// remote-write endpoint, or in the JSON line format of the
+// VictoriaMetrics /api/v1/import endpoint.
+type remoteWriter struct {
+	client   *http.Client
+	writeURL string
+
+	// vmImport holds whether to use the VictoriaMetrics
+	// import format rather than a remote-write request.
+	vmImport bool
+	// out, if non-nil, receives each batch rather than
+	// it being sent to writeURL.
+	out io.Writer
+	// nonFinite holds the number of infinite or NaN samples
+	// skipped because the import format cannot hold them.
+	nonFinite int
+
+	// token holds the bearer token used for authentication.
+	// If it is empty, username and password are used for
+	// basic authentication if set.
+	token    string
+	username string
+	password string
+
+	// series holds the series in the current batch,
+	// keyed by seriesKey.
+	series map[string]*remoteSeries
+	// order holds the series in the order they were added.
+	order    []*remoteSeries
+	nsamples int
+}
+
+type remoteSeries struct {
+	labels  []label
+	samples []remoteSample
+}
+
+type remoteSample struct {
+	value float64
+	// time holds the time in milliseconds since the epoch.
+	time int64
+}
+
+func newRemoteWriter(serverURL string) (*remoteWriter, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid URL %q: scheme must be http or https", serverURL)
+	}
+	return &remoteWriter{
+		client:   http.DefaultClient,
+		writeURL: u.String(),
+		series:   make(map[string]*remoteSeries),
+	}, nil
+}
+
+func (w *remoteWriter) add(labels []label, value float64, t time.Time) error {
+	if w.vmImport && (math.IsInf(value, 0) || math.IsNaN(value)) {
+		w.nonFinite++
+		return nil
+	}
+	key := seriesKey(labels)
+	s := w.series[key]
+	if s == nil {
+		s = &remoteSeries{
+			labels: append([]label(nil), labels...),
+		}
+		w.series[key] = s
+		w.order = append(w.order, s)
+	}
+	s.samples = append(s.samples, remoteSample{
+		value: value,
+		time:  t.Unix()*1e3 + int64(t.Nanosecond())/1e6,
+	})
+	w.nsamples++
+	if w.nsamples >= *batchSamples {
+		return w.flush()
+	}
+	return nil
+}
+
+func (w *remoteWriter) close() error {
+	if w.nonFinite > 0 {
+		fmt.Fprintf(os.Stderr, "skipped %d infinite or NaN values\n", w.nonFinite)
+	}
+	return w.flush()
+}
+
+// flush sends all the samples in the current batch.
+func (w *remoteWriter) flush() error {
+	if w.nsamples == 0 {
+		return nil
+	}
+	var body []byte
+	if w.vmImport {
+		body = w.importLines()
+	} else {
+		body = snappy.Encode(nil, w.writeRequest())
+	}
+	w.series = make(map[string]*remoteSeries)
+	w.order = w.order[:0]
+	w.nsamples = 0
+	if w.out != nil {
+		_, err := w.out.Write(body)
+		return err
+	}
+	if w.vmImport {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(body)
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+	return retry.Do(func() (bool, time.Duration, error) {
+		status, err := w.post(body)
+		return retry.Status(status), 0, err
+	})
+}
+
+// post makes a single write request with the given compressed
+// body. On failure, it returns the HTTP status code, or zero
+// if there was no response.
+func (w *remoteWriter) post(body []byte) (status int, err error) {
+	req, err := http.NewRequest("POST", w.writeURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	if w.vmImport {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Encoding", "gzip")
+	} else {
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		req.Header.Set("Content-Encoding", "snappy")
+		req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	}
+	if w.token != "" {
+		req.Header.Set("Authorization", "Bearer "+w.token)
+	} else if w.username != "" || w.password != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return 0, nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	if msg = bytes.TrimSpace(msg); len(msg) > 0 {
+		err = fmt.Errorf("write failed: %s: %s", resp.Status, msg)
+	} else {
+		err = fmt.Errorf("write failed: %s", resp.Status)
+	}
+	return resp.StatusCode, err
+}
+
+// writeRequest returns the protobuf encoding of a
+// prometheus.WriteRequest message holding the current batch.
+func (w *remoteWriter) writeRequest() []byte {
+	var req, ts, msg []byte
+	for _, s := range w.order {
+		ts = ts[:0]
+		for _, l := range s.labels {
+			msg = msg[:0]
+			msg = appendString(msg, 1, l.name)
+			msg = appendString(msg, 2, l.value)
+			ts = appendBytes(ts, 1, msg)
+		}
+		for _, sample := range s.samples {
+			msg = msg[:0]
+			msg = appendTag(msg, 1, wireFixed64)
+			var buf [8]byte
+			binary.LittleEndian.PutUint64(buf[:], math.Float64bits(sample.value))
+			msg = append(msg, buf[:]...)
+			msg = appendTag(msg, 2, wireVarint)
+			msg = appendUvarint(msg, uint64(sample.time))
+			ts = appendBytes(ts, 2, msg)
+		}
+		req = appendBytes(req, 1, ts)
+	}
+	return req
+}
+
+// importLines returns the current batch in the JSON line format
+// of the VictoriaMetrics /api/v1/import endpoint, with one line
+// holding all the samples of each series.
+func (w *remoteWriter) importLines() []byte {
+	var buf bytes.Buffer
+	for _, s := range w.order {
+		buf.WriteString(`{"metric":{`)
+		for i, l := range s.labels {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(&buf, l.name)
+			buf.WriteByte(':')
+			writeJSONString(&buf, l.value)
+		}
+		buf.WriteString(`},"values":[`)
+		for i, sample := range s.samples {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(strconv.FormatFloat(sample.value, 'g', -1, 64))
+		}
+		buf.WriteString(`],"timestamps":[`)
+		for i, sample := range s.samples {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(strconv.FormatInt(sample.time, 10))
+		}
+		buf.WriteString("]}\n")
+	}
+	return buf.Bytes()
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	data, _ := json.Marshal(s)
+	buf.Write(data)
+}
+
+// Protocol buffer wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+func appendTag(buf []byte, field int, wireType int) []byte {
+	return appendUvarint(buf, uint64(field)<<3|uint64(wireType))
+}
+
+func appendUvarint(buf []byte, x uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], x)
+	return append(buf, b[:n]...)
+}
+
+func appendBytes(buf []byte, field int, data []byte) []byte {
+	buf = appendTag(buf, field, wireBytes)
+	buf = appendUvarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
+
+func appendString(buf []byte, field int, s string) []byte {
+	buf = appendTag(buf, field, wireBytes)
+	buf = appendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// seriesKey returns a string that uniquely identifies
+// the series with the given labels.
+func seriesKey(labels []label) string {
+	var b strings.Builder
+	for _, l := range labels {
+		b.WriteString(l.name)
+		b.WriteByte(0)
+		b.WriteString(strconv.Quote(l.value))
+		b.WriteByte(0)
+	}
+	return b.String()
+}
@@ -0,0 +1,349 @@
+// Package csv2sql implements the csv2sql command.
+package csv2sql
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+	"github.com/rogpeppe/annotatedcsv/internal/sqlschema"
+)
+
+var flags = flag.NewFlagSet("csv2sql", flag.ExitOnError)
+
+var (
+	dialectFlag = flags.String("dialect", "postgres", "SQL dialect to generate: postgres, mysql or sqlite")
+	tableName   = flags.String("table", "data", "name of the SQL table; tables for further distinct schemas have _2, _3 and so on appended")
+	batchRows   = flags.Int("batch-rows", 1000, "maximum number of rows in each INSERT statement")
+	copyFlag    = flags.Bool("copy", false, "use COPY FROM stdin instead of INSERT (postgres only)")
+	noCreate    = flags.Bool("no-create", false, "do not emit CREATE TABLE statements")
+)
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] [file...]\n", flags.Name())
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	d := dialect(*dialectFlag)
+	switch d {
+	case postgres, mysql, sqlite:
+	default:
+		fmt.Fprintf(os.Stderr, "error: unknown dialect %q\n", d)
+		os.Exit(2)
+	}
+	if *copyFlag && d != postgres {
+		fmt.Fprintf(os.Stderr, "error: -copy is only supported by the postgres dialect\n")
+		os.Exit(2)
+	}
+	if *batchRows < 1 {
+		fmt.Fprintf(os.Stderr, "error: -batch-rows must be positive\n")
+		os.Exit(2)
+	}
+	files, err := input.Files(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	w := bufio.NewWriter(os.Stdout)
+	g := &generator{
+		w:       w,
+		dialect: d,
+		schemas: sqlschema.NewTables(*tableName),
+	}
+	err = input.ForEach(files, func(r io.Reader) error {
+		return g.generate(annotatedcsv.NewReader(r))
+	})
+	g.flush()
+	if err1 := w.Flush(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+type dialect string
+
+const (
+	postgres dialect = "postgres"
+	mysql    dialect = "mysql"
+	sqlite   dialect = "sqlite"
+)
+
+// generator writes SQL statements for annotated CSV tables.
+type generator struct {
+	w       *bufio.Writer
+	dialect dialect
+	schemas *sqlschema.Tables
+	// current holds the table that pending rows
+	// are destined for.
+	current *sqlschema.Table
+	// pending holds rows, formatted as VALUES tuples,
+	// that have not yet been written.
+	pending []string
+}
+
+func (g *generator) generate(r *annotatedcsv.Reader) error {
+	for r.NextTable() {
+		cols := r.Columns()
+		t, err := g.table(cols)
+		if err != nil {
+			return err
+		}
+		indexes := t.Indexes(cols)
+		if g.current != t {
+			g.flush()
+			g.current = t
+			if *copyFlag {
+				fmt.Fprintf(g.w, "COPY %s (%s) FROM stdin;\n", g.quoteIdent(t.Name), g.columnList(t))
+			}
+		}
+		vals := make([]string, len(t.Columns))
+		for r.NextRow() {
+			row := r.Row()
+			if *copyFlag {
+				for i, index := range indexes {
+					vals[i] = copyValue(row[index], t.Columns[i].Type)
+				}
+				g.w.WriteString(strings.Join(vals, "\t"))
+				g.w.WriteByte('\n')
+				continue
+			}
+			for i, index := range indexes {
+				vals[i] = g.literal(row[index], t.Columns[i].Type)
+			}
+			g.pending = append(g.pending, "("+strings.Join(vals, ", ")+")")
+			if len(g.pending) >= *batchRows {
+				g.flush()
+			}
+		}
+	}
+	return r.Err()
+}
+
+// flush writes any pending rows for the current table.
+func (g *generator) flush() {
+	t := g.current
+	if t == nil {
+		return
+	}
+	if *copyFlag {
+		g.w.WriteString("\\.\n")
+		g.current = nil
+		return
+	}
+	if len(g.pending) == 0 {
+		return
+	}
+	fmt.Fprintf(g.w, "INSERT INTO %s (%s) VALUES\n", g.quoteIdent(t.Name), g.columnList(t))
+	for i, row := range g.pending {
+		g.w.WriteString(row)
+		if i < len(g.pending)-1 {
+			g.w.WriteString(",\n")
+		}
+	}
+	g.w.WriteString(";\n")
+	g.pending = g.pending[:0]
+}
+
+// table returns the SQL table used for rows with the given
+// columns, writing its definition if it has not been seen before.
+func (g *generator) table(cols []annotatedcsv.Column) (*sqlschema.Table, error) {
+	t, isNew, err := g.schemas.Table(cols)
+	if err != nil || !isNew || *noCreate {
+		return t, err
+	}
+	g.flush()
+	g.current = nil
+	fmt.Fprintf(g.w, "%s;\n", t.Create(g.quoteIdent, func(col annotatedcsv.Column) string {
+		return g.sqlType(col.Type)
+	}))
+	return t, nil
+}
+
+func (g *generator) columnList(t *sqlschema.Table) string {
+	names := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		names[i] = g.quoteIdent(col.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// sqlType returns the SQL column type used
+// for the given datatype.
+func (g *generator) sqlType(typ string) string {
+	kind := annotatedcsv.DatatypeKind(typ)
+	switch g.dialect {
+	case postgres:
+		switch kind {
+		case annotatedcsv.BooleanKind:
+			return "BOOLEAN"
+		case annotatedcsv.LongKind:
+			return "BIGINT"
+		case annotatedcsv.UnsignedLongKind:
+			return "NUMERIC(20)"
+		case annotatedcsv.DoubleKind:
+			return "DOUBLE PRECISION"
+		case annotatedcsv.DateTimeKind:
+			return "TIMESTAMPTZ"
+		}
+	case mysql:
+		switch kind {
+		case annotatedcsv.BooleanKind:
+			return "BOOLEAN"
+		case annotatedcsv.LongKind:
+			return "BIGINT"
+		case annotatedcsv.UnsignedLongKind:
+			return "BIGINT UNSIGNED"
+		case annotatedcsv.DoubleKind:
+			return "DOUBLE"
+		case annotatedcsv.DateTimeKind:
+			return "DATETIME(6)"
+		}
+	case sqlite:
+		switch kind {
+		case annotatedcsv.BooleanKind, annotatedcsv.LongKind, annotatedcsv.UnsignedLongKind:
+			return "INTEGER"
+		case annotatedcsv.DoubleKind:
+			return "REAL"
+		}
+	}
+	return "TEXT"
+}
+
+func (g *generator) quoteIdent(s string) string {
+	if g.dialect == mysql {
+		return "`" + strings.ReplaceAll(s, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// literal returns v, a value from a column with the given
+// datatype, formatted as an SQL literal.
+func (g *generator) literal(v interface{}, typ string) string {
+	if s, ok := v.(string); ok && typ == "double" {
+		// The Reader returns non-finite doubles as strings.
+		return g.nonFinite(s)
+	}
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if g.dialect == sqlite {
+			if v {
+				return "1"
+			}
+			return "0"
+		}
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case time.Time:
+		v = v.UTC()
+		if g.dialect == mysql {
+			return g.quoteString(v.Format("2006-01-02 15:04:05.000000"))
+		}
+		return g.quoteString(v.Format(time.RFC3339Nano))
+	case string:
+		return g.quoteString(v)
+	}
+	return g.quoteString(fmt.Sprint(v))
+}
+
+// nonFinite returns the SQL representation of the
+// non-finite double value s.
+func (g *generator) nonFinite(s string) string {
+	x, _ := strconv.ParseFloat(s, 64)
+	switch g.dialect {
+	case postgres:
+		return g.quoteString(pgFloat(x)) + "::DOUBLE PRECISION"
+	case sqlite:
+		// SQLite reads out-of-range literals as infinities.
+		switch {
+		case math.IsInf(x, 1):
+			return "9e999"
+		case math.IsInf(x, -1):
+			return "-9e999"
+		}
+	}
+	// MySQL has no representation for non-finite values.
+	return "NULL"
+}
+
+// pgFloat returns the Postgres spelling of x.
+func pgFloat(x float64) string {
+	switch {
+	case math.IsInf(x, 1):
+		return "Infinity"
+	case math.IsInf(x, -1):
+		return "-Infinity"
+	case math.IsNaN(x):
+		return "NaN"
+	}
+	return strconv.FormatFloat(x, 'g', -1, 64)
+}
+
+func (g *generator) quoteString(s string) string {
+	s = strings.ReplaceAll(s, "'", "''")
+	if g.dialect == mysql {
+		// MySQL treats backslash as an escape character by default.
+		s = strings.ReplaceAll(s, `\`, `\\`)
+	}
+	return "'" + s + "'"
+}
+
+// copyValue returns v, a value from a column with the given
+// datatype, formatted as a field in Postgres COPY text format.
+func copyValue(v interface{}, typ string) string {
+	if s, ok := v.(string); ok && typ == "double" {
+		x, _ := strconv.ParseFloat(s, 64)
+		return pgFloat(x)
+	}
+	switch v := v.(type) {
+	case nil:
+		return `\N`
+	case bool:
+		if v {
+			return "t"
+		}
+		return "f"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case string:
+		return copyEscaper.Replace(v)
+	}
+	return copyEscaper.Replace(fmt.Sprint(v))
+}
+
+var copyEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"\t", `\t`,
+	"\n", `\n`,
+	"\r", `\r`,
+)
@@ -0,0 +1,246 @@
+// Package csv2sqlite implements the csv2sqlite command.
+package csv2sqlite
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+	"github.com/rogpeppe/annotatedcsv/internal/sqlschema"
+)
+
+var flags = flag.NewFlagSet("csv2sqlite", flag.ExitOnError)
+
+var (
+	dbFile     = flags.String("db", "", "SQLite database file to write to (required)")
+	tableName  = flags.String("table", "data", "name of the SQL table; tables for further distinct schemas have _2, _3 and so on appended")
+	batchRows  = flags.Int("batch-rows", 10000, "number of rows to insert in each transaction")
+	timeFormat = flags.String("time-format", "rfc3339nano", "how to store time values: rfc3339nano (TEXT) or unixnano (INTEGER)")
+)
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s -db file [flags] [file...]\n", flags.Name())
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *dbFile == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *timeFormat != "rfc3339nano" && *timeFormat != "unixnano" {
+		fmt.Fprintf(os.Stderr, "error: unknown time format %q\n", *timeFormat)
+		os.Exit(2)
+	}
+	if *batchRows < 1 {
+		fmt.Fprintf(os.Stderr, "error: -batch-rows must be positive\n")
+		os.Exit(2)
+	}
+	files, err := input.Files(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	db, err := sql.Open("sqlite3", *dbFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	l := &loader{
+		db:      db,
+		schemas: sqlschema.NewTables(*tableName),
+		tables:  make(map[*sqlschema.Table]*sqlTable),
+	}
+	err = input.ForEach(files, func(r io.Reader) error {
+		return l.load(annotatedcsv.NewReader(r))
+	})
+	if err1 := l.commit(); err == nil {
+		err = err1
+	}
+	if err1 := db.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// loader inserts rows into SQL tables, creating
+// a table for each distinct schema.
+type loader struct {
+	db      *sql.DB
+	schemas *sqlschema.Tables
+	// tables holds the sqlTable for each SQL table.
+	tables map[*sqlschema.Table]*sqlTable
+	tx     *sql.Tx
+	nrows  int
+}
+
+// sqlTable represents a table in the database.
+type sqlTable struct {
+	*sqlschema.Table
+	insert string
+	stmt   *sql.Stmt
+}
+
+func (l *loader) load(r *annotatedcsv.Reader) error {
+	for r.NextTable() {
+		cols := r.Columns()
+		t, err := l.table(cols)
+		if err != nil {
+			return err
+		}
+		indexes := t.Indexes(cols)
+		args := make([]interface{}, len(t.Columns))
+		for r.NextRow() {
+			row := r.Row()
+			for i, index := range indexes {
+				args[i] = sqlValue(row[index])
+			}
+			if err := l.insert(t, args); err != nil {
+				return err
+			}
+		}
+	}
+	return r.Err()
+}
+
+// insert inserts a row into t, committing the current
+// transaction when it holds enough rows.
+func (l *loader) insert(t *sqlTable, args []interface{}) error {
+	if l.tx == nil {
+		tx, err := l.db.Begin()
+		if err != nil {
+			return err
+		}
+		l.tx = tx
+	}
+	if t.stmt == nil {
+		stmt, err := l.tx.Prepare(t.insert)
+		if err != nil {
+			return err
+		}
+		t.stmt = stmt
+	}
+	if _, err := t.stmt.Exec(args...); err != nil {
+		return fmt.Errorf("cannot insert into %s: %v", t.Name, err)
+	}
+	l.nrows++
+	if l.nrows >= *batchRows {
+		return l.commit()
+	}
+	return nil
+}
+
+// commit commits the current transaction, if any.
+func (l *loader) commit() error {
+	if l.tx == nil {
+		return nil
+	}
+	// Prepared statements belong to the transaction.
+	for _, t := range l.tables {
+		t.stmt = nil
+	}
+	err := l.tx.Commit()
+	l.tx = nil
+	l.nrows = 0
+	return err
+}
+
+// table returns the SQL table used for rows with the given
+// columns, creating it if necessary.
+func (l *loader) table(cols []annotatedcsv.Column) (*sqlTable, error) {
+	st, isNew, err := l.schemas.Table(cols)
+	if err != nil {
+		return nil, err
+	}
+	if !isNew {
+		return l.tables[st], nil
+	}
+	var names, params []string
+	for _, col := range st.Columns {
+		names = append(names, quoteIdent(col.Name))
+		params = append(params, "?")
+	}
+	if l.tx != nil {
+		// Avoid mixing schema changes with a pending batch.
+		if err := l.commit(); err != nil {
+			return nil, err
+		}
+	}
+	create := st.Create(quoteIdent, func(col annotatedcsv.Column) string {
+		return sqlType(col.Type)
+	})
+	if _, err := l.db.Exec(create); err != nil {
+		return nil, fmt.Errorf("cannot create table %s: %v", st.Name, err)
+	}
+	t := &sqlTable{
+		Table:  st,
+		insert: fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", quoteIdent(st.Name), strings.Join(names, ", "), strings.Join(params, ", ")),
+	}
+	l.tables[st] = t
+	return t, nil
+}
+
+// sqlType returns the SQLite column type used
+// for the given datatype.
+func sqlType(typ string) string {
+	switch annotatedcsv.DatatypeKind(typ) {
+	case annotatedcsv.BooleanKind, annotatedcsv.LongKind, annotatedcsv.UnsignedLongKind:
+		return "INTEGER"
+	case annotatedcsv.DoubleKind:
+		return "REAL"
+	case annotatedcsv.DateTimeKind:
+		if *timeFormat == "unixnano" {
+			return "INTEGER"
+		}
+	}
+	return "TEXT"
+}
+
+// sqlValue returns v converted to a value
+// suitable for passing to SQLite.
+func sqlValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return int64(1)
+		}
+		return int64(0)
+	case uint64:
+		if v > math.MaxInt64 {
+			// SQLite integers are signed. Column affinity
+			// converts the text to REAL.
+			return strconv.FormatUint(v, 10)
+		}
+		return int64(v)
+	case time.Time:
+		if *timeFormat == "unixnano" {
+			return v.UnixNano()
+		}
+		return v.UTC().Format(time.RFC3339Nano)
+	case int64, float64, string, nil:
+		return v
+	}
+	// Store other values, such as decimals, UUIDs and
+	// addresses, as text, as the other commands do.
+	return fmt.Sprint(v)
+}
+
+func quoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
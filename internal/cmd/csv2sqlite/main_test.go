@@ -0,0 +1,35 @@
+package csv2sqlite
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/rogpeppe/annotatedcsv"
+)
+
+func TestSQLValue(t *testing.T) {
+	d, err := annotatedcsv.ParseDecimal("-12.50")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		v      interface{}
+		expect interface{}
+	}{
+		{nil, nil},
+		{true, int64(1)},
+		{false, int64(0)},
+		{int64(-3), int64(-3)},
+		{uint64(5), int64(5)},
+		{uint64(math.MaxUint64), "18446744073709551615"},
+		{1.5, 1.5},
+		{"s", "s"},
+		{d, "-12.50"},
+		{[]int64{1, 2}, "[1 2]"},
+	} {
+		if got := sqlValue(test.v); !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("sqlValue(%#v) = %#v; want %#v", test.v, got, test.expect)
+		}
+	}
+}
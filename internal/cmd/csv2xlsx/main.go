@@ -0,0 +1,144 @@
+// Package csv2xlsx implements the csv2xlsx command.
+package csv2xlsx
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+	"github.com/rogpeppe/annotatedcsv/internal/xlsx"
+)
+
+var flags = flag.NewFlagSet("csv2xlsx", flag.ExitOnError)
+
+var (
+	outFile    = flags.String("o", "", "output .xlsx file (required)")
+	nameColumn = flags.String("name-column", "", "name each sheet after the value of this column in the table's first row")
+)
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s -o file.xlsx [flags] [file...]\n", flags.Name())
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *outFile == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	files, err := input.Files(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	if err := run(files); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(files []string) error {
+	f, err := os.Create(*outFile)
+	if err != nil {
+		return err
+	}
+	c := &converter{
+		w: xlsx.NewWriter(f),
+	}
+	err = input.ForEach(files, func(r io.Reader) error {
+		return c.convert(annotatedcsv.NewReader(r))
+	})
+	if err1 := c.w.Close(); err == nil {
+		err = err1
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		os.Remove(*outFile)
+	}
+	return err
+}
+
+// converter writes each annotated CSV table to
+// a sheet in a workbook.
+type converter struct {
+	w       *xlsx.Writer
+	ntables int
+}
+
+func (c *converter) convert(r *annotatedcsv.Reader) error {
+	for r.NextTable() {
+		c.ntables++
+		cols := r.Columns()
+		// Omit the annotation column.
+		var indexes []int
+		var sheetCols []xlsx.Column
+		nameIndex := -1
+		for i, col := range cols {
+			if col.Name == "" {
+				continue
+			}
+			if col.Name == *nameColumn {
+				nameIndex = i
+			}
+			indexes = append(indexes, i)
+			sheetCols = append(sheetCols, xlsx.Column{
+				Name:  col.Name,
+				Width: columnWidth(col),
+			})
+		}
+		name := fmt.Sprintf("Table %d", c.ntables)
+		// Read the first row so that it can be used
+		// to name the sheet.
+		hasRow := r.NextRow()
+		if hasRow && nameIndex >= 0 {
+			if v := r.Row()[nameIndex]; v != nil {
+				name = valueString(v)
+			}
+		}
+		if err := c.w.AddSheet(name, sheetCols); err != nil {
+			return err
+		}
+		vals := make([]interface{}, len(indexes))
+		for ; hasRow; hasRow = r.NextRow() {
+			row := r.Row()
+			for i, index := range indexes {
+				vals[i] = row[index]
+			}
+			if err := c.w.WriteRow(vals); err != nil {
+				return err
+			}
+		}
+	}
+	return r.Err()
+}
+
+// columnWidth returns the display width for the given column:
+// wide enough for its name and for date-times.
+func columnWidth(col annotatedcsv.Column) float64 {
+	width := len(col.Name) + 2
+	if annotatedcsv.DatatypeKind(col.Type) == annotatedcsv.DateTimeKind && width < 20 {
+		width = 20
+	}
+	if width < 10 {
+		return 0
+	}
+	return float64(width)
+}
+
+func valueString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,316 @@
+// Package csvcat implements the csvcat command.
+package csvcat
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/cmdflag"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+)
+
+var flags = flag.NewFlagSet("csvcat", flag.ExitOnError)
+
+var (
+	enums  = make(enumFlag)
+	redact = make(cmdflag.NameSet)
+	ignore = make(cmdflag.NameSet)
+	units  = make(unitFlag)
+
+	union          = flags.Bool("union", false, "allow tables with different columns, writing the union of all their columns; cells for columns missing from a table are left empty")
+	keepTables     = flags.Bool("keep-tables", false, "write each table with its own header rather than combining all rows under a single header")
+	location       = flags.String("location", "", "time zone location, such as Europe/London, of input times that lack a zone offset")
+	outputLocation = flags.String("output-location", "", "convert all output times to this time zone location, such as UTC")
+	relaxedNumbers = flags.Bool("relaxed-numbers", false, "accept long and unsignedLong values in hexadecimal, decimal or scientific notation, such as 0x1F or 1e6")
+	redactMode     = flags.String("redact-mode", "hash", "how to redact the columns named by -redact; hash replaces values with salted hashes, keeping equal values equal, and mask hides them")
+	salt           = flags.String("salt", "", "salt for -redact-mode=hash; defaults to $CSV_REDACT_SALT")
+	epochUnit      = flags.String("epoch-unit", "ns", "unit of dateTime:number values, which count units since the Unix epoch; one of s, ms, us or ns")
+	listDelimiter  = flags.String("list-delimiter", annotatedcsv.DefaultListDelimiter, "delimiter between the elements of values of list datatypes such as list:long, in the input and the output")
+	workers        = flags.Int("workers", 1, "number of input files to parse in parallel")
+)
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Var(redact, "redact", "comma-separated list of columns whose values to redact, such as user IDs or IP addresses (can be repeated)")
+	flags.Var(ignore, "ignore", "comma-separated list of columns to drop when reading, as if they had the ignored datatype (can be repeated)")
+	flags.Var(units, "unit", "convert the values of a column from the unit in its #unit annotation, in the form column=unit (can be repeated); for example, size=MiB or elapsed=s")
+	flags.Var(enums, "enum", "set the allowed values of an enum datatype, in the form name=value,value... (can be repeated); values of enum:name columns must be one of them")
+	flags.Parse(args)
+	if *union && *keepTables {
+		fmt.Fprintf(os.Stderr, "error: cannot use -union with -keep-tables\n")
+		os.Exit(2)
+	}
+	inLoc, err := loadLocation(*location)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: invalid -location: %v\n", err)
+		os.Exit(2)
+	}
+	outLoc, err := loadLocation(*outputLocation)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: invalid -output-location: %v\n", err)
+		os.Exit(2)
+	}
+	unit, ok := epochUnits[*epochUnit]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "error: invalid -epoch-unit %q\n", *epochUnit)
+		os.Exit(2)
+	}
+	var redactor func(interface{}) (interface{}, error)
+	if len(redact) > 0 {
+		switch *redactMode {
+		case "hash":
+			key := *salt
+			if key == "" {
+				key = os.Getenv("CSV_REDACT_SALT")
+			}
+			if key == "" {
+				fmt.Fprintf(os.Stderr, "error: -redact-mode=hash requires -salt or $CSV_REDACT_SALT\n")
+				os.Exit(2)
+			}
+			redactor = annotatedcsv.Redact(annotatedcsv.RedactHash, []byte(key))
+		case "mask":
+			redactor = annotatedcsv.Redact(annotatedcsv.RedactMask, nil)
+		default:
+			fmt.Fprintf(os.Stderr, "error: invalid -redact-mode %q\n", *redactMode)
+			os.Exit(2)
+		}
+	}
+	files, err := input.Files(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	var tables []*annotatedcsv.Table
+	fr := annotatedcsv.NewFileReader(files, *workers)
+	fr.SetOpen(input.Open)
+	fr.SetConfigure(func(cr *annotatedcsv.Reader) {
+		cr.SetLocation(inLoc)
+		cr.SetEpochUnit(unit)
+		cr.SetListDelimiter(*listDelimiter)
+		cr.SetRelaxedNumbers(*relaxedNumbers)
+		if len(ignore) > 0 {
+			names := make([]string, 0, len(ignore))
+			for name := range ignore {
+				names = append(names, name)
+			}
+			cr.SetIgnoredColumns(names)
+		}
+		for name, values := range enums {
+			cr.SetEnum(name, values)
+		}
+		for name, unit := range units {
+			cr.SetUnit(name, unit)
+		}
+		for name := range redact {
+			cr.SetColumnHook(name, redactor)
+		}
+	})
+	for fr.Next() {
+		tables = append(tables, fr.Table())
+	}
+	if err := fr.Err(); err != nil {
+		if ferr, ok := err.(*annotatedcsv.FileError); ok && ferr.File == "-" {
+			err = ferr.Err
+		}
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	if !*keepTables {
+		tables, err = combine(tables, *union)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	bw := bufio.NewWriter(os.Stdout)
+	cw := annotatedcsv.NewWriter(bw)
+	cw.SetLocation(outLoc)
+	cw.SetEpochUnit(unit)
+	cw.SetListDelimiter(*listDelimiter)
+	err = cw.WriteAll(tables)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+var epochUnits = map[string]time.Duration{
+	"s":  time.Second,
+	"ms": time.Millisecond,
+	"us": time.Microsecond,
+	"ns": time.Nanosecond,
+}
+
+// enumFlag implements flag.Value by recording the
+// allowed values of each enum datatype.
+type enumFlag map[string][]string
+
+func (f enumFlag) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("%q is not in the form name=value,value...", s)
+	}
+	f[s[:i]] = strings.Split(s[i+1:], ",")
+	return nil
+}
+
+func (f enumFlag) String() string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = name + "=" + strings.Join(f[name], ",")
+	}
+	return strings.Join(names, " ")
+}
+
+// unitFlag implements flag.Value by recording
+// the unit to convert each column to.
+type unitFlag map[string]string
+
+func (f unitFlag) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 || i == len(s)-1 {
+		return fmt.Errorf("%q is not in the form column=unit", s)
+	}
+	f[s[:i]] = s[i+1:]
+	return nil
+}
+
+func (f unitFlag) String() string {
+	var pairs []string
+	for name, unit := range f {
+		pairs = append(pairs, name+"="+unit)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// loadLocation returns the time zone location with the
+// given name, or nil if the name is empty.
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return nil, nil
+	}
+	return time.LoadLocation(name)
+}
+
+// combine returns a single table holding the rows of all the given
+// tables. Unless union is true, all tables must have the same
+// columns; otherwise the columns of the result are the union of
+// the columns of all the tables.
+func combine(tables []*annotatedcsv.Table, union bool) ([]*annotatedcsv.Table, error) {
+	if len(tables) == 0 {
+		return nil, nil
+	}
+	cols := append([]annotatedcsv.Column(nil), tables[0].Columns...)
+	for i, t := range tables[1:] {
+		if union {
+			var err error
+			cols, err = unionColumns(cols, t.Columns)
+			if err != nil {
+				return nil, fmt.Errorf("table %d: %v", i+1, err)
+			}
+			continue
+		}
+		if err := sameColumns(cols, t.Columns); err != nil {
+			return nil, fmt.Errorf("table %d does not match the first table: %v", i+1, err)
+		}
+	}
+	result := &annotatedcsv.Table{
+		Columns: cols,
+	}
+	for _, t := range tables {
+		// indexes maps from result column index
+		// to the column index in t.
+		indexes := make([]int, len(cols))
+		for i, col := range cols {
+			indexes[i] = columnIndex(t.Columns, col.Name)
+		}
+		for _, row := range t.Rows {
+			newRow := make([]interface{}, len(cols))
+			for i, index := range indexes {
+				if index >= 0 {
+					newRow[i] = row[index]
+				} else {
+					newRow[i] = cols[i].Default
+				}
+			}
+			result.Rows = append(result.Rows, newRow)
+		}
+	}
+	return []*annotatedcsv.Table{result}, nil
+}
+
+// sameColumns returns an error if the two sets of columns differ.
+func sameColumns(cols0, cols1 []annotatedcsv.Column) error {
+	if len(cols0) != len(cols1) {
+		return fmt.Errorf("got %d columns want %d", len(cols1), len(cols0))
+	}
+	for i := range cols0 {
+		if err := compatible(cols0[i], cols1[i]); err != nil {
+			return err
+		}
+		if cols0[i].Group != cols1[i].Group {
+			return fmt.Errorf("column %q has inconsistent group flags", cols0[i].Name)
+		}
+	}
+	return nil
+}
+
+// unionColumns returns cols with any columns from newCols
+// that are not already present added to the end.
+func unionColumns(cols, newCols []annotatedcsv.Column) ([]annotatedcsv.Column, error) {
+	for _, col := range newCols {
+		i := columnIndex(cols, col.Name)
+		if i == -1 {
+			cols = append(cols, col)
+			continue
+		}
+		if err := compatible(cols[i], col); err != nil {
+			return nil, err
+		}
+		cols[i].Group = cols[i].Group && col.Group
+	}
+	return cols, nil
+}
+
+// compatible returns an error if col0 and col1 cannot
+// be treated as the same column.
+func compatible(col0, col1 annotatedcsv.Column) error {
+	if col0.Name != col1.Name {
+		return fmt.Errorf("column %q does not match column %q", col1.Name, col0.Name)
+	}
+	if col0.Type != col1.Type {
+		return fmt.Errorf("column %q has inconsistent types %q and %q", col0.Name, col0.Type, col1.Type)
+	}
+	if col0.Unit != col1.Unit {
+		return fmt.Errorf("column %q has inconsistent units %q and %q", col0.Name, col0.Unit, col1.Unit)
+	}
+	if col0.Default != col1.Default {
+		return fmt.Errorf("column %q has inconsistent defaults %v and %v", col0.Name, col0.Default, col1.Default)
+	}
+	return nil
+}
+
+func columnIndex(cols []annotatedcsv.Column, name string) int {
+	for i, col := range cols {
+		if col.Name == name {
+			return i
+		}
+	}
+	return -1
+}
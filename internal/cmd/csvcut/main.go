@@ -0,0 +1,145 @@
+// Package csvcut implements the csvcut command.
+package csvcut
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+)
+
+var flags = flag.NewFlagSet("csvcut", flag.ExitOnError)
+
+var (
+	columnsFlag = flags.String("columns", "", "comma-separated list of columns to keep, in order; each may be renamed with name:newname")
+	dropFlag    = flags.String("drop", "", "comma-separated list of columns to remove")
+)
+
+type columnSpec struct {
+	name    string
+	newName string
+}
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Parse(args)
+	if (*columnsFlag == "") == (*dropFlag == "") {
+		fmt.Fprintf(os.Stderr, "error: exactly one of -columns or -drop must be specified\n")
+		os.Exit(2)
+	}
+	specs, err := parseColumnSpecs(*columnsFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: invalid -columns flag: %v\n", err)
+		os.Exit(2)
+	}
+	drop := make(map[string]bool)
+	for _, name := range strings.Split(*dropFlag, ",") {
+		if name != "" {
+			drop[name] = true
+		}
+	}
+	files, err := input.Files(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	bw := bufio.NewWriter(os.Stdout)
+	w := annotatedcsv.NewWriter(bw)
+	err = input.ForEach(files, func(r io.Reader) error {
+		return cut(annotatedcsv.NewReader(r), w, specs, drop)
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// cut writes the selected columns of all the tables in r to w.
+// Columns selected but not present in a table are ignored.
+func cut(r *annotatedcsv.Reader, w *annotatedcsv.Writer, specs []columnSpec, drop map[string]bool) error {
+	for r.NextTable() {
+		inCols := r.Columns()
+		var (
+			cols    []annotatedcsv.Column
+			indexes []int
+		)
+		if len(inCols) > 0 && inCols[0].Name == "" {
+			// Always keep the annotation column.
+			cols = append(cols, inCols[0])
+			indexes = append(indexes, 0)
+		} else {
+			cols = append(cols, annotatedcsv.Column{})
+			indexes = append(indexes, -1)
+		}
+		if specs != nil {
+			for _, spec := range specs {
+				for i, col := range inCols {
+					if col.Name == spec.name && i != indexes[0] {
+						col.Name = spec.newName
+						cols = append(cols, col)
+						indexes = append(indexes, i)
+						break
+					}
+				}
+			}
+		} else {
+			for i, col := range inCols {
+				if i != indexes[0] && !drop[col.Name] {
+					cols = append(cols, col)
+					indexes = append(indexes, i)
+				}
+			}
+		}
+		if err := w.WriteHeader(cols); err != nil {
+			return err
+		}
+		outRow := make([]interface{}, len(cols))
+		for r.NextRow() {
+			row := r.Row()
+			for i, index := range indexes {
+				if index >= 0 {
+					outRow[i] = row[index]
+				}
+			}
+			if err := w.WriteRow(outRow); err != nil {
+				return err
+			}
+		}
+	}
+	return r.Err()
+}
+
+// parseColumnSpecs parses the value of the -columns flag.
+func parseColumnSpecs(s string) ([]columnSpec, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var specs []columnSpec
+	for _, f := range strings.Split(s, ",") {
+		name, newName := f, f
+		if i := strings.Index(f, ":"); i >= 0 {
+			name, newName = f[:i], f[i+1:]
+		}
+		if name == "" || newName == "" {
+			return nil, fmt.Errorf("empty column name in %q", f)
+		}
+		specs = append(specs, columnSpec{
+			name:    name,
+			newName: newName,
+		})
+	}
+	return specs, nil
+}
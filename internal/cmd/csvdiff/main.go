@@ -0,0 +1,330 @@
+// Package csvdiff implements the csvdiff command.
+package csvdiff
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+)
+
+var flags = flag.NewFlagSet("csvdiff", flag.ExitOnError)
+
+var (
+	keyFlag    = flags.String("key", "", "comma-separated list of columns identifying a row (default is the group columns and the time column)")
+	timeColumn = flags.String("time-column", "_time", "name of the time column included in the default row key")
+	ignoreFlag = flags.String("ignore", "result,table", "comma-separated list of columns to ignore")
+	schemaOnly = flags.Bool("schema-only", false, "compare only the column schemas, not the rows")
+)
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] old.csv new.csv\n", flags.Name())
+		fmt.Fprintf(os.Stderr, "The exit status is 0 if there are no differences, 1 if there are some, and 2 on error.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	d := &differ{
+		ignore: make(map[string]bool),
+	}
+	if *keyFlag != "" {
+		d.key = strings.Split(*keyFlag, ",")
+	}
+	if *ignoreFlag != "" {
+		for _, name := range strings.Split(*ignoreFlag, ",") {
+			d.ignore[name] = true
+		}
+	}
+	old, err := readFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	new, err := readFile(flags.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	bw := bufio.NewWriter(os.Stdout)
+	d.w = bw
+	d.diffSchemas(old, new)
+	if !*schemaOnly {
+		if err := d.diffRows(old, new); err != nil {
+			bw.Flush()
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	if d.ndiffs > 0 {
+		os.Exit(1)
+	}
+}
+
+func readFile(file string) ([]*annotatedcsv.Table, error) {
+	var tables []*annotatedcsv.Table
+	err := input.ForEach([]string{file}, func(r io.Reader) error {
+		var err error
+		tables, err = annotatedcsv.ReadAll(r)
+		return err
+	})
+	return tables, err
+}
+
+// differ reports differences between two sets of tables.
+type differ struct {
+	w      io.Writer
+	key    []string
+	ignore map[string]bool
+	ndiffs int
+}
+
+func (d *differ) printf(f string, a ...interface{}) {
+	d.ndiffs++
+	fmt.Fprintf(d.w, f, a...)
+}
+
+// diffSchemas reports differences between the columns of the two
+// sets of tables. Columns are matched by name; where a column
+// occurs in more than one table, the first occurrence is used.
+func (d *differ) diffSchemas(old, new []*annotatedcsv.Table) {
+	oldCols, oldNames := d.columns(old)
+	newCols, newNames := d.columns(new)
+	for _, name := range oldNames {
+		oldCol := oldCols[name]
+		newCol, ok := newCols[name]
+		if !ok {
+			d.printf("schema: column %q removed\n", name)
+			continue
+		}
+		if oldCol.Type != newCol.Type {
+			d.printf("schema: column %q type changed from %q to %q\n", name, oldCol.Type, newCol.Type)
+		}
+		if oldCol.Group != newCol.Group {
+			d.printf("schema: column %q group changed from %v to %v\n", name, oldCol.Group, newCol.Group)
+		}
+		if oldDefault, newDefault := valueString(oldCol.Default), valueString(newCol.Default); oldDefault != newDefault {
+			d.printf("schema: column %q default changed from %q to %q\n", name, oldDefault, newDefault)
+		}
+	}
+	for _, name := range newNames {
+		if _, ok := oldCols[name]; !ok {
+			d.printf("schema: column %q added\n", name)
+		}
+	}
+}
+
+// columns returns all the columns in the given tables by
+// name, and the names in order of first appearance.
+func (d *differ) columns(tables []*annotatedcsv.Table) (map[string]annotatedcsv.Column, []string) {
+	cols := make(map[string]annotatedcsv.Column)
+	var names []string
+	for _, t := range tables {
+		for _, col := range t.Columns {
+			if col.Name == "" || d.ignore[col.Name] {
+				continue
+			}
+			if _, ok := cols[col.Name]; !ok {
+				cols[col.Name] = col
+				names = append(names, col.Name)
+			}
+		}
+	}
+	return cols, names
+}
+
+// row holds the formatted values of a row by column name.
+type row map[string]string
+
+// diffRows reports rows that have been added, removed or
+// changed between the two sets of tables.
+func (d *differ) diffRows(old, new []*annotatedcsv.Table) error {
+	oldRows, err := d.rows(old)
+	if err != nil {
+		return fmt.Errorf("%s: %v", flags.Arg(0), err)
+	}
+	newRows, err := d.rows(new)
+	if err != nil {
+		return fmt.Errorf("%s: %v", flags.Arg(1), err)
+	}
+	keys := make([]string, 0, len(oldRows))
+	for key := range oldRows {
+		keys = append(keys, key)
+	}
+	for key := range newRows {
+		if _, ok := oldRows[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		oldRs, newRs := oldRows[key], newRows[key]
+		n := len(oldRs)
+		if len(newRs) < n {
+			n = len(newRs)
+		}
+		for i := 0; i < n; i++ {
+			d.diffRow(key, oldRs[i], newRs[i])
+		}
+		for _, r := range oldRs[n:] {
+			d.printf("- %s %s\n", key, r)
+		}
+		for _, r := range newRs[n:] {
+			d.printf("+ %s %s\n", key, r)
+		}
+	}
+	return nil
+}
+
+// diffRow reports any differences between two rows with the same key.
+func (d *differ) diffRow(key string, old, new row) {
+	var changes []string
+	for _, name := range sortedNames(old, new) {
+		oldVal, oldOK := old[name]
+		newVal, newOK := new[name]
+		if oldOK == newOK && oldVal == newVal {
+			continue
+		}
+		switch {
+		case !oldOK:
+			changes = append(changes, fmt.Sprintf("%s: added %q", name, newVal))
+		case !newOK:
+			changes = append(changes, fmt.Sprintf("%s: removed %q", name, oldVal))
+		default:
+			changes = append(changes, fmt.Sprintf("%s: %q -> %q", name, oldVal, newVal))
+		}
+	}
+	if len(changes) > 0 {
+		d.printf("~ %s %s\n", key, strings.Join(changes, ", "))
+	}
+}
+
+// rows returns all the rows in the given tables indexed by key.
+// Rows with the same key are held in the order they were read.
+func (d *differ) rows(tables []*annotatedcsv.Table) (map[string][]row, error) {
+	rows := make(map[string][]row)
+	for i, t := range tables {
+		var keyNames []string
+		if d.key != nil {
+			keyNames = d.key
+		} else {
+			for _, col := range t.Columns {
+				if col.Group && !d.ignore[col.Name] {
+					keyNames = append(keyNames, col.Name)
+				}
+			}
+			sort.Strings(keyNames)
+			for _, col := range t.Columns {
+				if col.Name == *timeColumn {
+					keyNames = append(keyNames, col.Name)
+					break
+				}
+			}
+		}
+		isKey := make(map[string]bool)
+		for _, name := range keyNames {
+			isKey[name] = true
+		}
+		for _, name := range d.key {
+			if !hasColumn(t.Columns, name) {
+				return nil, fmt.Errorf("no key column %q in table %d", name, i)
+			}
+		}
+		for _, tr := range t.Rows {
+			keyVals := make(row)
+			r := make(row)
+			for j, col := range t.Columns {
+				if col.Name == "" || d.ignore[col.Name] {
+					continue
+				}
+				if isKey[col.Name] {
+					keyVals[col.Name] = valueString(tr[j])
+				} else {
+					r[col.Name] = valueString(tr[j])
+				}
+			}
+			var key strings.Builder
+			for j, name := range keyNames {
+				if j > 0 {
+					key.WriteByte(',')
+				}
+				fmt.Fprintf(&key, "%s=%s", name, keyVals[name])
+			}
+			rows[key.String()] = append(rows[key.String()], r)
+		}
+	}
+	return rows, nil
+}
+
+// String returns the row formatted as comma-separated
+// name=value pairs in name order.
+func (r row) String() string {
+	var buf strings.Builder
+	for i, name := range sortedNames(r) {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(&buf, "%s=%s", name, r[name])
+	}
+	return buf.String()
+}
+
+// sortedNames returns the names in all the given rows in order.
+func sortedNames(rows ...row) []string {
+	found := make(map[string]bool)
+	var names []string
+	for _, r := range rows {
+		for name := range r {
+			if !found[name] {
+				found[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func hasColumn(cols []annotatedcsv.Column, name string) bool {
+	for _, col := range cols {
+		if col.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// valueString returns v formatted for comparison. Times are
+// converted to UTC so that equal times in different locations
+// compare equal.
+func valueString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,85 @@
+// Package csvgrep implements the csvgrep command.
+package csvgrep
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+)
+
+var flags = flag.NewFlagSet("csvgrep", flag.ExitOnError)
+
+var invert = flags.Bool("v", false, "write rows that do not match the expression")
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] expr [file...]\n", flags.Name())
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	expr, err := annotatedcsv.ParseExpr(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: invalid expression: %v\n", err)
+		os.Exit(2)
+	}
+	files, err := input.Files(flags.Args()[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	bw := bufio.NewWriter(os.Stdout)
+	w := annotatedcsv.NewWriter(bw)
+	err = input.ForEach(files, func(r io.Reader) error {
+		return grep(annotatedcsv.NewReader(r), w, expr)
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// grep writes the rows of each table in r that match expr to w.
+// Tables with no matching rows are omitted.
+func grep(r *annotatedcsv.Reader, w *annotatedcsv.Writer, expr *annotatedcsv.Expr) error {
+	for r.NextTable() {
+		match, err := expr.Predicate(r.Columns())
+		if err != nil {
+			return err
+		}
+		wroteHeader := false
+		for r.NextRow() {
+			row := r.Row()
+			if match(annotatedcsv.Row{Columns: r.Columns(), Values: row}) == *invert {
+				continue
+			}
+			if !wroteHeader {
+				if err := w.WriteHeader(r.Columns()); err != nil {
+					return err
+				}
+				wroteHeader = true
+			}
+			if err := w.WriteRow(row); err != nil {
+				return err
+			}
+		}
+	}
+	return r.Err()
+}
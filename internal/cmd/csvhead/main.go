@@ -0,0 +1,64 @@
+// Package csvhead implements the csvhead command.
+package csvhead
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+)
+
+var flags = flag.NewFlagSet("csvhead", flag.ExitOnError)
+
+var n = flags.Int("n", 10, "number of rows to print from the start of each table")
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [-n rows] [file...]\n", flags.Name())
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *n < 0 {
+		fmt.Fprintf(os.Stderr, "error: -n must not be negative\n")
+		os.Exit(2)
+	}
+	files, err := input.Files(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	bw := bufio.NewWriter(os.Stdout)
+	w := annotatedcsv.NewWriter(bw)
+	err = input.ForEach(files, func(r io.Reader) error {
+		cr := annotatedcsv.NewReader(r)
+		for cr.NextTable() {
+			if err := w.WriteHeader(cr.Columns()); err != nil {
+				return err
+			}
+			// Rows after the first n are skipped by NextTable.
+			for i := 0; i < *n && cr.NextRow(); i++ {
+				if err := w.WriteRow(cr.Row()); err != nil {
+					return err
+				}
+			}
+		}
+		return cr.Err()
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,178 @@
+// Package csvindex implements the csvindex command.
+package csvindex
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rogpeppe/annotatedcsv"
+)
+
+var flags = flag.NewFlagSet("csvindex", flag.ExitOnError)
+
+var groups = make(groupFlag)
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Var(groups, "group", "instead of indexing the files, print the tables whose group key has the given value for a column, in the form column=value (can be repeated), using the existing indexes")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [-group column=value]... file...\n", flags.Name())
+		fmt.Fprintf(os.Stderr, "\nWithout -group, write an index of the tables in each file to file.index.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	var err error
+	if len(groups) == 0 {
+		for _, file := range flags.Args() {
+			if err = writeIndex(file); err != nil {
+				break
+			}
+		}
+	} else {
+		err = printTables(flags.Args())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// indexFile returns the name of the index file for file.
+func indexFile(file string) string {
+	return file + ".index"
+}
+
+// writeIndex indexes the given file.
+func writeIndex(file string) error {
+	f, err := annotatedcsv.MapFile(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	ix, err := annotatedcsv.BuildIndex(f, f.Size(), nil)
+	if err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	out, err := os.Create(indexFile(file))
+	if err != nil {
+		return err
+	}
+	if err := ix.Write(out); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// printTables prints the tables in the given files that match
+// the -group flags.
+func printTables(files []string) error {
+	bw := bufio.NewWriter(os.Stdout)
+	w := annotatedcsv.NewWriter(bw)
+	for _, file := range files {
+		if err := printMatching(w, file); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// printMatching writes the tables in file that
+// match the -group flags to w.
+func printMatching(w *annotatedcsv.Writer, file string) error {
+	f, err := annotatedcsv.MapFile(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	ix, err := readIndex(file)
+	if err != nil {
+		return err
+	}
+	if ix.Size != f.Size() {
+		return fmt.Errorf("index for %s is out of date; run %s %s to update it", file, flags.Name(), file)
+	}
+	for i, e := range ix.Tables {
+		if !matches(e.GroupKey) {
+			continue
+		}
+		cr := ix.NewReader(f, i)
+		for cr.NextTable() {
+			if err := w.WriteHeader(cr.Columns()); err != nil {
+				return err
+			}
+			for cr.NextRow() {
+				if err := w.WriteRow(cr.Row()); err != nil {
+					return err
+				}
+			}
+		}
+		if err := cr.Err(); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+	}
+	return nil
+}
+
+// readIndex reads the index for file.
+func readIndex(file string) (*annotatedcsv.Index, error) {
+	f, err := os.Open(indexFile(file))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no index for %s; run %s %s to create one", file, flags.Name(), file)
+		}
+		return nil, err
+	}
+	defer f.Close()
+	ix, err := annotatedcsv.ReadIndex(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", indexFile(file), err)
+	}
+	return ix, nil
+}
+
+// matches reports whether the given group key
+// matches all the -group flags.
+func matches(key map[string]string) bool {
+	for name, value := range groups {
+		if v, ok := key[name]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// groupFlag implements flag.Value by recording
+// the value required for each group column.
+type groupFlag map[string]string
+
+func (f groupFlag) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("%q is not in the form column=value", s)
+	}
+	f[s[:i]] = s[i+1:]
+	return nil
+}
+
+func (f groupFlag) String() string {
+	var pairs []string
+	for name, value := range f {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
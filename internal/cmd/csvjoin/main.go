@@ -0,0 +1,283 @@
+// Package csvjoin implements the csvjoin command.
+package csvjoin
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+)
+
+var flags = flag.NewFlagSet("csvjoin", flag.ExitOnError)
+
+var (
+	onFlag   = flags.String("on", "", "comma-separated list of key columns to join on; use left:right when the columns have different names in the two files")
+	joinType = flags.String("type", "inner", "join type: inner or left")
+	suffix   = flags.String("suffix", "_right", "suffix added to the names of columns from the right file that conflict with columns in the left file")
+)
+
+// keySpec holds one element of the -on flag.
+type keySpec struct {
+	left  string
+	right string
+}
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s -on columns [flags] left.csv right.csv\n", flags.Name())
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *onFlag == "" || flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *joinType != "inner" && *joinType != "left" {
+		fmt.Fprintf(os.Stderr, "error: unknown join type %q\n", *joinType)
+		os.Exit(2)
+	}
+	keys, err := parseKeySpecs(*onFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: invalid -on flag: %v\n", err)
+		os.Exit(2)
+	}
+	right, err := readRight(flags.Arg(1), keys)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	bw := bufio.NewWriter(os.Stdout)
+	w := annotatedcsv.NewWriter(bw)
+	err = input.ForEach([]string{flags.Arg(0)}, func(r io.Reader) error {
+		return join(w, annotatedcsv.NewReader(r), right, keys)
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// rightTable holds the rows of the right file indexed by key.
+type rightTable struct {
+	// keyCols holds the key columns in -on flag order.
+	keyCols []annotatedcsv.Column
+	// cols holds the columns to add to each left row.
+	cols []annotatedcsv.Column
+	// rows maps from a key to the values
+	// for cols in all rows with that key.
+	rows map[string][][]interface{}
+}
+
+// readRight reads all the tables from the given file
+// into memory. All the tables must have the same columns.
+// The annotation, result and table columns are not added
+// to the joined rows.
+func readRight(file string, keys []keySpec) (*rightTable, error) {
+	var tables []*annotatedcsv.Table
+	err := input.ForEach([]string{file}, func(r io.Reader) error {
+		var err error
+		tables, err = annotatedcsv.ReadAll(r)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	rt := &rightTable{
+		rows: make(map[string][][]interface{}),
+	}
+	for i, t := range tables {
+		if i > 0 && !sameColumns(tables[0].Columns, t.Columns) {
+			return nil, fmt.Errorf("%s: table %d has different columns from the first table", file, i)
+		}
+		keyIndexes := make([]int, len(keys))
+		for j, key := range keys {
+			keyIndexes[j] = columnIndex(t.Columns, key.right)
+			if keyIndexes[j] == -1 {
+				return nil, fmt.Errorf("%s: no key column %q in table %d", file, key.right, i)
+			}
+		}
+		var colIndexes []int
+		for j, col := range t.Columns {
+			if !isKey(j, keyIndexes) && col.Name != "" && col.Name != "result" && col.Name != "table" {
+				colIndexes = append(colIndexes, j)
+			}
+		}
+		if i == 0 {
+			for _, j := range keyIndexes {
+				rt.keyCols = append(rt.keyCols, t.Columns[j])
+			}
+			for _, j := range colIndexes {
+				col := t.Columns[j]
+				// Values from the right file may vary within
+				// a left table, so they cannot be group columns.
+				col.Group = false
+				rt.cols = append(rt.cols, col)
+			}
+		}
+		for _, row := range t.Rows {
+			key, ok := rowKey(row, keyIndexes)
+			if !ok {
+				continue
+			}
+			vals := make([]interface{}, len(colIndexes))
+			for k, j := range colIndexes {
+				vals[k] = row[j]
+			}
+			rt.rows[key] = append(rt.rows[key], vals)
+		}
+	}
+	return rt, nil
+}
+
+// join writes each table read from r joined with the
+// rows in right.
+func join(w *annotatedcsv.Writer, r *annotatedcsv.Reader, right *rightTable, keys []keySpec) error {
+	for r.NextTable() {
+		cols := r.Columns()
+		keyIndexes := make([]int, len(keys))
+		for i, key := range keys {
+			keyIndexes[i] = columnIndex(cols, key.left)
+			if keyIndexes[i] == -1 {
+				return fmt.Errorf("no key column %q in left table", key.left)
+			}
+			if right.keyCols == nil {
+				continue
+			}
+			leftType, rightType := cols[keyIndexes[i]].Type, right.keyCols[i].Type
+			if typeKind(leftType) != typeKind(rightType) {
+				return fmt.Errorf("key column %q has type %q but right key column %q has type %q", key.left, leftType, key.right, rightType)
+			}
+		}
+		outCols := append([]annotatedcsv.Column(nil), cols...)
+		for _, col := range right.cols {
+			for columnIndex(outCols, col.Name) != -1 {
+				col.Name += *suffix
+			}
+			outCols = append(outCols, col)
+		}
+		if err := w.WriteHeader(outCols); err != nil {
+			return err
+		}
+		for r.NextRow() {
+			row := r.Row()
+			var matches [][]interface{}
+			if key, ok := rowKey(row, keyIndexes); ok {
+				matches = right.rows[key]
+			}
+			if len(matches) == 0 {
+				if *joinType == "inner" {
+					continue
+				}
+				vals := make([]interface{}, len(right.cols))
+				for i, col := range right.cols {
+					vals[i] = col.Default
+				}
+				matches = [][]interface{}{vals}
+			}
+			for _, vals := range matches {
+				outRow := make([]interface{}, 0, len(outCols))
+				outRow = append(outRow, row...)
+				outRow = append(outRow, vals...)
+				if err := w.WriteRow(outRow); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return r.Err()
+}
+
+// rowKey returns a string that uniquely identifies the values of
+// the given columns in row. It returns false if any of the values
+// are missing, because missing values never match.
+func rowKey(row []interface{}, indexes []int) (string, bool) {
+	var buf strings.Builder
+	for _, i := range indexes {
+		switch v := row[i].(type) {
+		case nil:
+			return "", false
+		case time.Time:
+			// Equal times in different locations must match.
+			fmt.Fprintf(&buf, "%d\x00", v.UnixNano())
+		default:
+			fmt.Fprintf(&buf, "%v\x00", v)
+		}
+	}
+	return buf.String(), true
+}
+
+// typeKind returns the kind of value held by a column of the
+// given type. All dateTime columns hold the same kind of value.
+func typeKind(typ string) string {
+	switch annotatedcsv.DatatypeKind(typ) {
+	case annotatedcsv.DateTimeKind:
+		return "dateTime"
+	case annotatedcsv.StringKind:
+		return "string"
+	}
+	return typ
+}
+
+func isKey(i int, keyIndexes []int) bool {
+	for _, j := range keyIndexes {
+		if i == j {
+			return true
+		}
+	}
+	return false
+}
+
+func sameColumns(cols0, cols1 []annotatedcsv.Column) bool {
+	if len(cols0) != len(cols1) {
+		return false
+	}
+	for i := range cols0 {
+		if cols0[i].Name != cols1[i].Name || cols0[i].Type != cols1[i].Type {
+			return false
+		}
+	}
+	return true
+}
+
+func columnIndex(cols []annotatedcsv.Column, name string) int {
+	for i, col := range cols {
+		if col.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseKeySpecs parses the value of the -on flag.
+func parseKeySpecs(s string) ([]keySpec, error) {
+	var specs []keySpec
+	for _, f := range strings.Split(s, ",") {
+		left, right := f, f
+		if i := strings.Index(f, ":"); i >= 0 {
+			left, right = f[:i], f[i+1:]
+		}
+		if left == "" || right == "" {
+			return nil, fmt.Errorf("empty column name in %q", f)
+		}
+		specs = append(specs, keySpec{
+			left:  left,
+			right: right,
+		})
+	}
+	return specs, nil
+}
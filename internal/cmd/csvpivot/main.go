@@ -0,0 +1,419 @@
+// Package csvpivot implements the csvpivot command.
+package csvpivot
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+)
+
+var flags = flag.NewFlagSet("csvpivot", flag.ExitOnError)
+
+var (
+	rowKeyFlag  = flags.String("row-key", "_time", "comma-separated list of columns that identify an output row")
+	columnKey   = flags.String("column-key", "_field", "column whose values name the pivoted columns")
+	valueColumn = flags.String("value-column", "_value", "column holding the pivoted values")
+	unpivot     = flags.Bool("unpivot", false, "convert pivoted tables back into one table per field")
+)
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] [file...]\n", flags.Name())
+		fmt.Fprintf(os.Stderr, `
+By default, csvpivot produces one row for each distinct row key and
+group key, with one column for each value of the column key. The
+column key is removed from the group key.
+
+With -unpivot, each column of a pivoted table that is not in the group
+key or row key becomes a separate table, with the column name in the
+column key and the values in the value column.
+
+`)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	var rowKey []string
+	for _, name := range strings.Split(*rowKeyFlag, ",") {
+		if name != "" {
+			rowKey = append(rowKey, name)
+		}
+	}
+	if len(rowKey) == 0 {
+		fmt.Fprintf(os.Stderr, "error: no row key columns specified\n")
+		os.Exit(2)
+	}
+	files, err := input.Files(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	bw := bufio.NewWriter(os.Stdout)
+	w := annotatedcsv.NewWriter(bw)
+	if *unpivot {
+		u := &unpivoter{
+			w:      w,
+			rowKey: rowKey,
+		}
+		err = input.ForEach(files, func(r io.Reader) error {
+			return u.unpivot(annotatedcsv.NewReader(r))
+		})
+	} else {
+		p := &pivoter{
+			rowKey: rowKey,
+			tables: make(map[string]*pivotTable),
+		}
+		err = input.ForEach(files, func(r io.Reader) error {
+			return p.add(annotatedcsv.NewReader(r))
+		})
+		if err == nil {
+			err = p.write(w)
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// pivoter accumulates rows from all input tables into
+// pivoted tables.
+type pivoter struct {
+	rowKey []string
+	// tables holds the output tables keyed by group key.
+	tables map[string]*pivotTable
+	// order holds the tables in the order they were created.
+	order []*pivotTable
+}
+
+// pivotTable holds the rows of a pivoted table.
+type pivotTable struct {
+	groupCols  []annotatedcsv.Column
+	groupVals  []interface{}
+	rowKeyCols []annotatedcsv.Column
+	// fields maps from the name of each pivoted
+	// column to its datatype.
+	fields map[string]string
+	rows   map[string]*pivotRow
+}
+
+// pivotRow holds a row of a pivoted table.
+type pivotRow struct {
+	key    []interface{}
+	values map[string]interface{}
+}
+
+func (p *pivoter) add(r *annotatedcsv.Reader) error {
+	for r.NextTable() {
+		cols := r.Columns()
+		rowKeyIndexes := make([]int, len(p.rowKey))
+		for i, name := range p.rowKey {
+			rowKeyIndexes[i] = columnIndex(cols, name)
+			if rowKeyIndexes[i] == -1 {
+				return fmt.Errorf("row key column %q not found", name)
+			}
+		}
+		columnKeyIndex := columnIndex(cols, *columnKey)
+		if columnKeyIndex == -1 {
+			return fmt.Errorf("column key %q not found", *columnKey)
+		}
+		valueIndex := columnIndex(cols, *valueColumn)
+		if valueIndex == -1 {
+			return fmt.Errorf("value column %q not found", *valueColumn)
+		}
+		// The group key of the pivoted table is the group
+		// key of the input table without the column key.
+		var groupIndexes []int
+		for i, col := range cols {
+			if col.Group && i != columnKeyIndex && !isRowKey(i, rowKeyIndexes) {
+				groupIndexes = append(groupIndexes, i)
+			}
+		}
+		valueType := cols[valueIndex].Type
+		for r.NextRow() {
+			row := r.Row()
+			t, err := p.table(cols, row, groupIndexes, rowKeyIndexes)
+			if err != nil {
+				return err
+			}
+			field := row[columnKeyIndex]
+			if field == nil {
+				continue
+			}
+			name := valueString(field)
+			if typ, ok := t.fields[name]; !ok {
+				if columnIndex(t.groupCols, name) != -1 || columnIndex(t.rowKeyCols, name) != -1 {
+					return fmt.Errorf("pivoted column %q clashes with existing column", name)
+				}
+				t.fields[name] = valueType
+			} else if typ != valueType {
+				return fmt.Errorf("values for %q have inconsistent types %q and %q", name, typ, valueType)
+			}
+			key := make([]interface{}, len(rowKeyIndexes))
+			for i, index := range rowKeyIndexes {
+				key[i] = row[index]
+			}
+			k := valuesKey(key)
+			pr := t.rows[k]
+			if pr == nil {
+				pr = &pivotRow{
+					key:    key,
+					values: make(map[string]interface{}),
+				}
+				t.rows[k] = pr
+			}
+			pr.values[name] = row[valueIndex]
+		}
+	}
+	return r.Err()
+}
+
+// table returns the pivoted table that the given input
+// row belongs to, creating it if necessary.
+func (p *pivoter) table(cols []annotatedcsv.Column, row []interface{}, groupIndexes, rowKeyIndexes []int) (*pivotTable, error) {
+	groupVals := make([]interface{}, len(groupIndexes))
+	var key strings.Builder
+	for i, index := range groupIndexes {
+		groupVals[i] = row[index]
+		fmt.Fprintf(&key, "%s\x00%s\x00", cols[index].Name, cols[index].Type)
+	}
+	key.WriteString(valuesKey(groupVals))
+	t := p.tables[key.String()]
+	if t == nil {
+		t = &pivotTable{
+			groupVals: groupVals,
+			fields:    make(map[string]string),
+			rows:      make(map[string]*pivotRow),
+		}
+		for _, index := range groupIndexes {
+			t.groupCols = append(t.groupCols, cols[index])
+		}
+		for _, index := range rowKeyIndexes {
+			col := cols[index]
+			col.Group = false
+			t.rowKeyCols = append(t.rowKeyCols, col)
+		}
+		p.tables[key.String()] = t
+		p.order = append(p.order, t)
+		return t, nil
+	}
+	for i, index := range rowKeyIndexes {
+		if cols[index].Type != t.rowKeyCols[i].Type {
+			return nil, fmt.Errorf("row key column %q has inconsistent types %q and %q", cols[index].Name, t.rowKeyCols[i].Type, cols[index].Type)
+		}
+	}
+	return t, nil
+}
+
+// write writes all the pivoted tables to w, with
+// rows sorted by row key.
+func (p *pivoter) write(w *annotatedcsv.Writer) error {
+	for i, t := range p.order {
+		fields := make([]string, 0, len(t.fields))
+		for name := range t.fields {
+			fields = append(fields, name)
+		}
+		sort.Strings(fields)
+		cols := []annotatedcsv.Column{
+			{Name: ""},
+			{Name: "result", Type: "string", Default: "_result"},
+			{Name: "table", Type: "long"},
+		}
+		cols = append(cols, t.groupCols...)
+		cols = append(cols, t.rowKeyCols...)
+		for _, name := range fields {
+			cols = append(cols, annotatedcsv.Column{
+				Name: name,
+				Type: t.fields[name],
+			})
+		}
+		if err := w.WriteHeader(cols); err != nil {
+			return err
+		}
+		rows := make([]*pivotRow, 0, len(t.rows))
+		for _, pr := range t.rows {
+			rows = append(rows, pr)
+		}
+		sort.Slice(rows, func(a, b int) bool {
+			for j := range rows[a].key {
+				if c := annotatedcsv.CompareValues(rows[a].key[j], rows[b].key[j], t.rowKeyCols[j].Type); c != 0 {
+					return c < 0
+				}
+			}
+			return false
+		})
+		row := make([]interface{}, len(cols))
+		row[1] = "_result"
+		row[2] = int64(i)
+		n := copy(row[3:], t.groupVals) + 3
+		for _, pr := range rows {
+			m := copy(row[n:], pr.key) + n
+			for j, name := range fields {
+				row[m+j] = pr.values[name]
+			}
+			if err := w.WriteRow(row); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// unpivoter writes one table for each pivoted column
+// of its input tables.
+type unpivoter struct {
+	w      *annotatedcsv.Writer
+	rowKey []string
+	// ntables holds the number of tables written.
+	ntables int
+}
+
+func (u *unpivoter) unpivot(r *annotatedcsv.Reader) error {
+	for r.NextTable() {
+		cols := r.Columns()
+		rowKeyIndexes := make([]int, len(u.rowKey))
+		for i, name := range u.rowKey {
+			rowKeyIndexes[i] = columnIndex(cols, name)
+			if rowKeyIndexes[i] == -1 {
+				return fmt.Errorf("row key column %q not found", name)
+			}
+		}
+		var groupIndexes, fieldIndexes []int
+		for i, col := range cols {
+			switch {
+			case col.Name == "" || isRowKey(i, rowKeyIndexes):
+			case col.Group:
+				groupIndexes = append(groupIndexes, i)
+			case col.Name != "result" && col.Name != "table":
+				// The result and table columns are added by
+				// Flux and do not hold values.
+				fieldIndexes = append(fieldIndexes, i)
+			}
+		}
+		// Read all the rows so that each field
+		// can be written as a separate table.
+		var rows [][]interface{}
+		for r.NextRow() {
+			rows = append(rows, r.Row())
+		}
+		for _, fieldIndex := range fieldIndexes {
+			if err := u.writeField(cols, rows, fieldIndex, groupIndexes, rowKeyIndexes); err != nil {
+				return err
+			}
+		}
+	}
+	return r.Err()
+}
+
+// writeField writes a table holding the values of the
+// given column of rows. Null values are omitted.
+func (u *unpivoter) writeField(cols []annotatedcsv.Column, rows [][]interface{}, fieldIndex int, groupIndexes, rowKeyIndexes []int) error {
+	outCols := []annotatedcsv.Column{
+		{Name: ""},
+		{Name: "result", Type: "string", Default: "_result"},
+		{Name: "table", Type: "long"},
+	}
+	for _, index := range rowKeyIndexes {
+		outCols = append(outCols, cols[index])
+	}
+	outCols = append(outCols, annotatedcsv.Column{
+		Name: *valueColumn,
+		Type: cols[fieldIndex].Type,
+	}, annotatedcsv.Column{
+		Name:  *columnKey,
+		Type:  "string",
+		Group: true,
+	})
+	for _, index := range groupIndexes {
+		outCols = append(outCols, cols[index])
+	}
+	if err := u.w.WriteHeader(outCols); err != nil {
+		return err
+	}
+	out := make([]interface{}, len(outCols))
+	out[1] = "_result"
+	out[2] = int64(u.ntables)
+	u.ntables++
+	n := 3 + len(rowKeyIndexes)
+	out[n+1] = cols[fieldIndex].Name
+	for _, row := range rows {
+		if row[fieldIndex] == nil {
+			continue
+		}
+		for i, index := range rowKeyIndexes {
+			out[3+i] = row[index]
+		}
+		out[n] = row[fieldIndex]
+		for i, index := range groupIndexes {
+			out[n+2+i] = row[index]
+		}
+		if err := u.w.WriteRow(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func columnIndex(cols []annotatedcsv.Column, name string) int {
+	for i, col := range cols {
+		if col.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func isRowKey(i int, rowKeyIndexes []int) bool {
+	for _, index := range rowKeyIndexes {
+		if i == index {
+			return true
+		}
+	}
+	return false
+}
+
+// valuesKey returns a string that uniquely identifies
+// the given values.
+func valuesKey(vals []interface{}) string {
+	var b strings.Builder
+	for _, v := range vals {
+		switch v := v.(type) {
+		case nil:
+			b.WriteString("\x01")
+		case time.Time:
+			// Equal times in different locations
+			// must have the same key.
+			fmt.Fprintf(&b, "%d", v.UnixNano())
+		default:
+			fmt.Fprintf(&b, "%T:%v", v, v)
+		}
+		b.WriteString("\x00")
+	}
+	return b.String()
+}
+
+func valueString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,53 @@
+package csvpivot
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/rogpeppe/annotatedcsv"
+)
+
+func TestPivotNonFiniteRowKey(t *testing.T) {
+	// The row key column mixes numbers, infinities,
+	// NaN and nulls, all of which sort.
+	const data = `#datatype,double,string,long
+#group,false,false,false
+#default,,,
+,k,_field,_value
+,2,a,1
+,+Inf,a,2
+,NaN,b,3
+,,a,4
+,-Inf,b,5
+,2,b,6
+`
+	p := &pivoter{
+		rowKey: []string{"k"},
+		tables: make(map[string]*pivotTable),
+	}
+	if err := p.add(annotatedcsv.NewReader(strings.NewReader(data))); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w := annotatedcsv.NewWriter(&buf)
+	if err := p.write(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	const expect = `#datatype,string,long,double,long,long
+#group,false,false,false,false,false
+#default,_result,,,,
+,result,table,k,a,b
+,,0,,4,
+,,0,NaN,,3
+,,0,-Inf,,5
+,,0,2,1,6
+,,0,+Inf,2,
+`
+	if got := buf.String(); got != expect {
+		t.Fatalf("unexpected output\ngot:\n%s\nwant:\n%s", got, expect)
+	}
+}
@@ -0,0 +1,119 @@
+// Package csvsample implements the csvsample command.
+package csvsample
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+)
+
+var flags = flag.NewFlagSet("csvsample", flag.ExitOnError)
+
+var (
+	n       = flags.Int("n", 0, "number of rows to sample from each table")
+	percent = flags.Float64("p", 0, "percentage of rows to sample from each table")
+	seed    = flags.Int64("seed", 0, "random seed, for repeatable samples (default is based on the current time)")
+)
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s (-n rows | -p percent) [flags] [file...]\n", flags.Name())
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if (*n > 0) == (*percent > 0) {
+		fmt.Fprintf(os.Stderr, "error: exactly one of -n or -p must be specified\n")
+		os.Exit(2)
+	}
+	if *n < 0 || *percent < 0 || *percent > 100 {
+		fmt.Fprintf(os.Stderr, "error: -n must be positive and -p must be between 0 and 100\n")
+		os.Exit(2)
+	}
+	files, err := input.Files(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	rnd := rand.New(rand.NewSource(*seed))
+	bw := bufio.NewWriter(os.Stdout)
+	w := annotatedcsv.NewWriter(bw)
+	err = input.ForEach(files, func(r io.Reader) error {
+		cr := annotatedcsv.NewReader(r)
+		for cr.NextTable() {
+			if err := w.WriteHeader(cr.Columns()); err != nil {
+				return err
+			}
+			var rows [][]interface{}
+			if *n > 0 {
+				rows = reservoirSample(cr, rnd, *n)
+			} else {
+				for cr.NextRow() {
+					if rnd.Float64()*100 < *percent {
+						rows = append(rows, cr.Row())
+					}
+				}
+			}
+			if err := cr.Err(); err != nil {
+				return err
+			}
+			for _, row := range rows {
+				if err := w.WriteRow(row); err != nil {
+					return err
+				}
+			}
+		}
+		return cr.Err()
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// reservoirSample returns a uniformly random sample of at most n
+// rows from the current table in r. The rows are returned in the
+// order they were read.
+func reservoirSample(r *annotatedcsv.Reader, rnd *rand.Rand, n int) [][]interface{} {
+	type sampledRow struct {
+		index int
+		row   []interface{}
+	}
+	var sample []sampledRow
+	for i := 0; r.NextRow(); i++ {
+		if i < n {
+			sample = append(sample, sampledRow{i, r.Row()})
+			continue
+		}
+		if j := rnd.Intn(i + 1); j < n {
+			sample[j] = sampledRow{i, r.Row()}
+		}
+	}
+	sort.Slice(sample, func(i, j int) bool {
+		return sample[i].index < sample[j].index
+	})
+	rows := make([][]interface{}, len(sample))
+	for i, s := range sample {
+		rows[i] = s.row
+	}
+	return rows
+}
@@ -0,0 +1,331 @@
+// Package csvsort implements the csvsort command.
+package csvsort
+
+import (
+	"bufio"
+	"container/heap"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+)
+
+var flags = flag.NewFlagSet("csvsort", flag.ExitOnError)
+
+var (
+	keysFlag = flags.String("k", "", "comma-separated list of columns to sort by; prefix a column name with - to sort it in descending order")
+	maxRows  = flags.Int("max-rows", 1000000, "maximum number of rows to hold in memory; larger tables are sorted in chunks written to temporary files and then merged")
+	tempDir  = flags.String("temp-dir", "", "directory for temporary files (default is the system temporary directory)")
+)
+
+// sortKey holds one element of the -k flag.
+type sortKey struct {
+	name       string
+	descending bool
+}
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s -k columns [flags] [file...]\n", flags.Name())
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *keysFlag == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	keys, err := parseKeys(*keysFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: invalid -k flag: %v\n", err)
+		os.Exit(2)
+	}
+	if *maxRows < 1 {
+		fmt.Fprintf(os.Stderr, "error: -max-rows must be positive\n")
+		os.Exit(2)
+	}
+	files, err := input.Files(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	bw := bufio.NewWriter(os.Stdout)
+	w := annotatedcsv.NewWriter(bw)
+	err = input.ForEach(files, func(r io.Reader) error {
+		return sortTables(w, annotatedcsv.NewReader(r), keys)
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// sortTables writes the tables read from r to w with the rows
+// of each table sorted.
+func sortTables(w *annotatedcsv.Writer, r *annotatedcsv.Reader, keys []sortKey) error {
+	for r.NextTable() {
+		cols := r.Columns()
+		less, err := rowLess(cols, keys)
+		if err != nil {
+			return err
+		}
+		if err := w.WriteHeader(cols); err != nil {
+			return err
+		}
+		s := &sorter{
+			cols: cols,
+			less: less,
+		}
+		for r.NextRow() {
+			if err := s.add(r.Row()); err != nil {
+				s.cleanup()
+				return err
+			}
+		}
+		if err := r.Err(); err != nil {
+			s.cleanup()
+			return err
+		}
+		err = s.write(w)
+		s.cleanup()
+		if err != nil {
+			return err
+		}
+	}
+	return r.Err()
+}
+
+// sorter sorts the rows of a single table. When there are more
+// rows than will fit in memory, sorted chunks are written to
+// temporary files which are merged when the rows are written.
+type sorter struct {
+	cols   []annotatedcsv.Column
+	less   func(row0, row1 []interface{}) bool
+	rows   [][]interface{}
+	chunks []string
+}
+
+func (s *sorter) add(row []interface{}) error {
+	s.rows = append(s.rows, row)
+	if len(s.rows) < *maxRows {
+		return nil
+	}
+	return s.spill()
+}
+
+// spill writes the current rows in sorted order
+// to a temporary file.
+func (s *sorter) spill() error {
+	s.sortRows()
+	f, err := os.CreateTemp(*tempDir, "csvsort")
+	if err != nil {
+		return err
+	}
+	s.chunks = append(s.chunks, f.Name())
+	bw := bufio.NewWriter(f)
+	err = annotatedcsv.WriteAll(bw, []*annotatedcsv.Table{{
+		Columns: s.cols,
+		Rows:    s.rows,
+	}})
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return fmt.Errorf("cannot write temporary file: %v", err)
+	}
+	s.rows = s.rows[:0]
+	return nil
+}
+
+func (s *sorter) sortRows() {
+	sort.SliceStable(s.rows, func(i, j int) bool {
+		return s.less(s.rows[i], s.rows[j])
+	})
+}
+
+// write writes all the rows to w in sorted order.
+func (s *sorter) write(w *annotatedcsv.Writer) error {
+	if len(s.chunks) == 0 {
+		s.sortRows()
+		for _, row := range s.rows {
+			if err := w.WriteRow(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(s.rows) > 0 {
+		if err := s.spill(); err != nil {
+			return err
+		}
+	}
+	return s.merge(w)
+}
+
+// merge writes the rows from all the chunk files to w in order.
+func (s *sorter) merge(w *annotatedcsv.Writer) error {
+	h := &chunkHeap{
+		less: s.less,
+	}
+	for i, name := range s.chunks {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		c := &chunk{
+			index: i,
+			r:     annotatedcsv.NewReader(bufio.NewReader(f)),
+		}
+		if !c.r.NextTable() {
+			return fmt.Errorf("no table found in temporary file: %v", c.r.Err())
+		}
+		if c.next() {
+			h.chunks = append(h.chunks, c)
+		} else if err := c.r.Err(); err != nil {
+			return err
+		}
+	}
+	heap.Init(h)
+	for len(h.chunks) > 0 {
+		c := h.chunks[0]
+		if err := w.WriteRow(c.row); err != nil {
+			return err
+		}
+		if c.next() {
+			heap.Fix(h, 0)
+			continue
+		}
+		if err := c.r.Err(); err != nil {
+			return fmt.Errorf("cannot read temporary file: %v", err)
+		}
+		heap.Pop(h)
+	}
+	return nil
+}
+
+// cleanup removes any temporary files.
+func (s *sorter) cleanup() {
+	for _, name := range s.chunks {
+		os.Remove(name)
+	}
+	s.chunks = nil
+}
+
+// chunk represents a sorted chunk file being merged.
+type chunk struct {
+	index int
+	r     *annotatedcsv.Reader
+	row   []interface{}
+}
+
+func (c *chunk) next() bool {
+	if !c.r.NextRow() {
+		return false
+	}
+	c.row = c.r.Row()
+	return true
+}
+
+// chunkHeap implements heap.Interface, ordering chunks by their
+// current row. Chunks with equal rows are ordered by index so that
+// the sort remains stable.
+type chunkHeap struct {
+	chunks []*chunk
+	less   func(row0, row1 []interface{}) bool
+}
+
+func (h *chunkHeap) Len() int {
+	return len(h.chunks)
+}
+
+func (h *chunkHeap) Less(i, j int) bool {
+	c0, c1 := h.chunks[i], h.chunks[j]
+	if h.less(c0.row, c1.row) {
+		return true
+	}
+	if h.less(c1.row, c0.row) {
+		return false
+	}
+	return c0.index < c1.index
+}
+
+func (h *chunkHeap) Swap(i, j int) {
+	h.chunks[i], h.chunks[j] = h.chunks[j], h.chunks[i]
+}
+
+func (h *chunkHeap) Push(x interface{}) {
+	h.chunks = append(h.chunks, x.(*chunk))
+}
+
+func (h *chunkHeap) Pop() interface{} {
+	c := h.chunks[len(h.chunks)-1]
+	h.chunks = h.chunks[:len(h.chunks)-1]
+	return c
+}
+
+// parseKeys parses the value of the -k flag.
+func parseKeys(s string) ([]sortKey, error) {
+	var keys []sortKey
+	for _, f := range strings.Split(s, ",") {
+		key := sortKey{
+			name: f,
+		}
+		if strings.HasPrefix(f, "-") {
+			key.name = f[1:]
+			key.descending = true
+		}
+		if key.name == "" {
+			return nil, fmt.Errorf("empty column name in %q", s)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// rowLess returns a function that reports whether one row
+// sorts before another in a table with the given columns.
+func rowLess(cols []annotatedcsv.Column, keys []sortKey) (func(row0, row1 []interface{}) bool, error) {
+	indexes := make([]int, len(keys))
+	for i, key := range keys {
+		indexes[i] = -1
+		for j, col := range cols {
+			if col.Name == key.name {
+				indexes[i] = j
+				break
+			}
+		}
+		if indexes[i] == -1 {
+			return nil, fmt.Errorf("no column %q found in table", key.name)
+		}
+	}
+	return func(row0, row1 []interface{}) bool {
+		for i, index := range indexes {
+			c := annotatedcsv.CompareValues(row0[index], row1[index], cols[index].Type)
+			if c == 0 {
+				continue
+			}
+			if keys[i].descending {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	}, nil
+}
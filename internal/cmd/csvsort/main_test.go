@@ -0,0 +1,112 @@
+package csvsort
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/rogpeppe/annotatedcsv"
+)
+
+const sortTestData = `#datatype,double,string
+#group,false,false
+#default,,
+,n,s
+,2,a
+,NaN,b
+,1,d
+,-Inf,c
+,,e
+,+Inf,f
+,1,c
+`
+
+var sortTests = []struct {
+	testName string
+	keys     string
+	expect   string
+}{{
+	testName: "ascending",
+	keys:     "n,s",
+	expect: `#datatype,double,string
+#group,false,false
+#default,,
+,n,s
+,,e
+,NaN,b
+,-Inf,c
+,1,c
+,1,d
+,2,a
+,+Inf,f
+`,
+}, {
+	testName: "descending",
+	keys:     "-n,s",
+	expect: `#datatype,double,string
+#group,false,false
+#default,,
+,n,s
+,+Inf,f
+,2,a
+,1,c
+,1,d
+,-Inf,c
+,NaN,b
+,,e
+`,
+}, {
+	testName: "string-key",
+	keys:     "-s,n",
+	expect: `#datatype,double,string
+#group,false,false
+#default,,
+,n,s
+,+Inf,f
+,,e
+,1,d
+,-Inf,c
+,1,c
+,NaN,b
+,2,a
+`,
+}}
+
+func TestSortTables(t *testing.T) {
+	defer func(old int) {
+		*maxRows = old
+	}(*maxRows)
+	for _, test := range sortTests {
+		// A small -max-rows value makes the rows
+		// be sorted in chunks that are then merged.
+		for _, n := range []int{1000, 2} {
+			*maxRows = n
+			keys, err := parseKeys(test.keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			w := annotatedcsv.NewWriter(&buf)
+			if err := sortTables(w, annotatedcsv.NewReader(strings.NewReader(sortTestData)), keys); err != nil {
+				t.Fatalf("%s, max rows %d: %v", test.testName, n, err)
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != test.expect {
+				t.Errorf("%s, max rows %d: unexpected output\ngot:\n%s\nwant:\n%s", test.testName, n, got, test.expect)
+			}
+		}
+	}
+}
+
+func TestSortTablesMissingKey(t *testing.T) {
+	keys, err := parseKeys("x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sortTables(annotatedcsv.NewWriter(&bytes.Buffer{}), annotatedcsv.NewReader(strings.NewReader(sortTestData)), keys)
+	if err == nil || err.Error() != `no column "x" found in table` {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,241 @@
+// Package csvsplit implements the csvsplit command.
+package csvsplit
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+)
+
+var flags = flag.NewFlagSet("csvsplit", flag.ExitOnError)
+
+var (
+	template = flags.String("template", "table-{#}.csv", "template for output file names; {name} is replaced by the value of column name in each row and {#} by the index of the row's table")
+	outDir   = flags.String("out-dir", ".", "directory to write files to")
+)
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Parse(args)
+	parts, err := parseTemplate(*template)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: invalid -template flag: %v\n", err)
+		os.Exit(2)
+	}
+	files, err := input.Files(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	s := &splitter{
+		parts: parts,
+		files: make(map[string]*outputFile),
+	}
+	err = input.ForEach(files, func(r io.Reader) error {
+		return s.split(annotatedcsv.NewReader(r))
+	})
+	if err1 := s.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// templatePart holds one part of a parsed file name template.
+// If column is true, text holds a column name; otherwise
+// it holds literal text.
+type templatePart struct {
+	text   string
+	column bool
+}
+
+// parseTemplate parses the value of the -template flag.
+func parseTemplate(s string) ([]templatePart, error) {
+	var parts []templatePart
+	for s != "" {
+		i := strings.Index(s, "{")
+		if i == -1 {
+			parts = append(parts, templatePart{text: s})
+			break
+		}
+		if i > 0 {
+			parts = append(parts, templatePart{text: s[:i]})
+		}
+		s = s[i+1:]
+		i = strings.Index(s, "}")
+		if i == -1 {
+			return nil, fmt.Errorf("unterminated {")
+		}
+		if i == 0 {
+			return nil, fmt.Errorf("empty column name")
+		}
+		parts = append(parts, templatePart{
+			text:   s[:i],
+			column: true,
+		})
+		s = s[i+1:]
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("empty template")
+	}
+	return parts, nil
+}
+
+// splitter writes rows to files named from a template.
+type splitter struct {
+	parts  []templatePart
+	files  map[string]*outputFile
+	ntable int
+}
+
+type outputFile struct {
+	f    *os.File
+	bw   *bufio.Writer
+	w    *annotatedcsv.Writer
+	cols []annotatedcsv.Column
+}
+
+// split writes all the rows read from r to their files.
+func (s *splitter) split(r *annotatedcsv.Reader) error {
+	for ; r.NextTable(); s.ntable++ {
+		cols := r.Columns()
+		// indexes holds the column index for each
+		// part of the template, or -1 for literal text.
+		indexes := make([]int, len(s.parts))
+		for i, part := range s.parts {
+			indexes[i] = -1
+			if !part.column || part.text == "#" {
+				continue
+			}
+			for j, col := range cols {
+				if col.Name == part.text {
+					indexes[i] = j
+					break
+				}
+			}
+			if indexes[i] == -1 {
+				return fmt.Errorf("no column %q found for template", part.text)
+			}
+		}
+		for r.NextRow() {
+			row := r.Row()
+			of, err := s.file(s.fileName(row, indexes))
+			if err != nil {
+				return err
+			}
+			if !sameColumns(of.cols, cols) {
+				if err := of.w.WriteHeader(cols); err != nil {
+					return err
+				}
+				of.cols = cols
+			}
+			if err := of.w.WriteRow(row); err != nil {
+				return err
+			}
+		}
+	}
+	return r.Err()
+}
+
+// fileName returns the name of the file to write the given row to.
+func (s *splitter) fileName(row []interface{}, indexes []int) string {
+	var buf strings.Builder
+	for i, part := range s.parts {
+		switch {
+		case !part.column:
+			buf.WriteString(part.text)
+		case part.text == "#":
+			fmt.Fprintf(&buf, "%04d", s.ntable)
+		default:
+			buf.WriteString(fileNameSafe(valueString(row[indexes[i]])))
+		}
+	}
+	return filepath.Join(*outDir, filepath.FromSlash(buf.String()))
+}
+
+// file returns the output file with the given name,
+// creating it if needed.
+func (s *splitter) file(name string) (*outputFile, error) {
+	if of := s.files[name]; of != nil {
+		return of, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	bw := bufio.NewWriter(f)
+	of := &outputFile{
+		f:  f,
+		bw: bw,
+		w:  annotatedcsv.NewWriter(bw),
+	}
+	s.files[name] = of
+	return of, nil
+}
+
+// Close flushes and closes all the output files.
+func (s *splitter) Close() error {
+	var firstErr error
+	for name, of := range s.files {
+		err := of.w.Flush()
+		if err == nil {
+			err = of.bw.Flush()
+		}
+		if err1 := of.f.Close(); err == nil {
+			err = err1
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("cannot write %s: %v", name, err)
+		}
+	}
+	return firstErr
+}
+
+// valueString returns the text used for v in a file name.
+func valueString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// fileNameSafe returns s with any characters that might
+// cause problems in a file name replaced with underscores.
+func fileNameSafe(s string) string {
+	buf := []byte(s)
+	for i, c := range buf {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '.' && i > 0:
+		default:
+			buf[i] = '_'
+		}
+	}
+	return string(buf)
+}
+
+func sameColumns(cols0, cols1 []annotatedcsv.Column) bool {
+	return annotatedcsv.Schema(cols0).Equal(cols1)
+}
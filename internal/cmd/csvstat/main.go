@@ -0,0 +1,221 @@
+// Package csvstat implements the csvstat command.
+package csvstat
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+)
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+var flags = flag.NewFlagSet("csvstat", flag.ExitOnError)
+
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [file...]\n", flags.Name())
+		fmt.Fprintf(os.Stderr, "Print summary statistics for each column of each table.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	files, err := input.Files(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	bw := bufio.NewWriter(os.Stdout)
+	ntable := 0
+	err = input.ForEach(files, func(r io.Reader) error {
+		cr := annotatedcsv.NewReader(r)
+		for ; cr.NextTable(); ntable++ {
+			stats := newTableStats(cr.Columns())
+			for cr.NextRow() {
+				stats.add(cr.Row())
+			}
+			if err := cr.Err(); err != nil {
+				return err
+			}
+			if ntable > 0 {
+				bw.WriteString("\n")
+			}
+			fmt.Fprintf(bw, "table %d: %d rows\n", ntable, stats.rows)
+			stats.write(bw)
+		}
+		return cr.Err()
+	})
+	if err1 := bw.Flush(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// tableStats holds statistics for all the columns of a table.
+type tableStats struct {
+	cols []*columnStats
+	rows int
+}
+
+// columnStats holds statistics for a single column.
+type columnStats struct {
+	col   annotatedcsv.Column
+	index int
+	count int
+	nulls int
+
+	// min and max hold the smallest and largest
+	// values seen for numeric and time columns.
+	min, max interface{}
+
+	// mean and m2 hold the running mean and sum of squares
+	// of differences from the mean for numeric columns.
+	mean, m2 float64
+
+	// distinct holds all the values seen for
+	// string and tag columns.
+	distinct map[string]bool
+}
+
+func newTableStats(cols []annotatedcsv.Column) *tableStats {
+	ts := &tableStats{}
+	for i, col := range cols {
+		if col.Name == "" && col.Default == nil {
+			// The annotation column.
+			continue
+		}
+		cs := &columnStats{
+			col:   col,
+			index: i,
+		}
+		if annotatedcsv.DatatypeKind(col.Type) == annotatedcsv.StringKind {
+			cs.distinct = make(map[string]bool)
+		}
+		ts.cols = append(ts.cols, cs)
+	}
+	return ts
+}
+
+func (ts *tableStats) add(row []interface{}) {
+	ts.rows++
+	for _, cs := range ts.cols {
+		cs.add(row[cs.index])
+	}
+}
+
+func (cs *columnStats) add(v interface{}) {
+	if v == nil {
+		cs.nulls++
+		return
+	}
+	cs.count++
+	var x float64
+	switch v := v.(type) {
+	case string:
+		if cs.distinct != nil {
+			cs.distinct[v] = true
+		}
+		return
+	case bool:
+		return
+	case time.Time:
+		if cs.min == nil || v.Before(cs.min.(time.Time)) {
+			cs.min = v
+		}
+		if cs.max == nil || v.After(cs.max.(time.Time)) {
+			cs.max = v
+		}
+		return
+	case int64:
+		if cs.min == nil || v < cs.min.(int64) {
+			cs.min = v
+		}
+		if cs.max == nil || v > cs.max.(int64) {
+			cs.max = v
+		}
+		x = float64(v)
+	case uint64:
+		if cs.min == nil || v < cs.min.(uint64) {
+			cs.min = v
+		}
+		if cs.max == nil || v > cs.max.(uint64) {
+			cs.max = v
+		}
+		x = float64(v)
+	case float64:
+		if cs.min == nil || v < cs.min.(float64) {
+			cs.min = v
+		}
+		if cs.max == nil || v > cs.max.(float64) {
+			cs.max = v
+		}
+		x = v
+	default:
+		return
+	}
+	// Welford's algorithm for a numerically stable
+	// running mean and variance.
+	delta := x - cs.mean
+	cs.mean += delta / float64(cs.count)
+	cs.m2 += delta * (x - cs.mean)
+}
+
+// write writes the statistics as a table to w.
+func (ts *tableStats) write(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "column\ttype\tgroup\tcount\tnulls\tmin\tmax\tmean\tstddev\tdistinct\n")
+	for _, cs := range ts.cols {
+		mean, stddev, distinct := "", "", ""
+		switch cs.min.(type) {
+		case int64, uint64, float64:
+			mean = formatFloat(cs.mean)
+			stddev = "0"
+			if cs.count > 1 {
+				stddev = formatFloat(math.Sqrt(cs.m2 / float64(cs.count-1)))
+			}
+		}
+		if cs.distinct != nil {
+			distinct = strconv.Itoa(len(cs.distinct))
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%v\t%d\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			cs.col.Name,
+			cs.col.Type,
+			cs.col.Group,
+			cs.count,
+			cs.nulls,
+			formatValue(cs.min),
+			formatValue(cs.max),
+			mean,
+			stddev,
+			distinct,
+		)
+	}
+	tw.Flush()
+}
+
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case float64:
+		return formatFloat(v)
+	}
+	return fmt.Sprint(v)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', 6, 64)
+}
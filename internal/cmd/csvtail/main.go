@@ -0,0 +1,81 @@
+// Package csvtail implements the csvtail command.
+package csvtail
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+)
+
+var flags = flag.NewFlagSet("csvtail", flag.ExitOnError)
+
+var n = flags.Int("n", 10, "number of rows to print from the end of each table")
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [-n rows] [file...]\n", flags.Name())
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *n < 0 {
+		fmt.Fprintf(os.Stderr, "error: -n must not be negative\n")
+		os.Exit(2)
+	}
+	files, err := input.Files(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	bw := bufio.NewWriter(os.Stdout)
+	w := annotatedcsv.NewWriter(bw)
+	// rows holds the last n rows of the current table in
+	// a ring buffer starting at rows[next % n].
+	rows := make([][]interface{}, *n)
+	err = input.ForEach(files, func(r io.Reader) error {
+		cr := annotatedcsv.NewReader(r)
+		for cr.NextTable() {
+			if err := w.WriteHeader(cr.Columns()); err != nil {
+				return err
+			}
+			next := 0
+			for cr.NextRow() {
+				if *n == 0 {
+					continue
+				}
+				rows[next%*n] = cr.Row()
+				next++
+			}
+			if err := cr.Err(); err != nil {
+				return err
+			}
+			start := 0
+			if next > *n {
+				start = next - *n
+			}
+			for i := start; i < next; i++ {
+				if err := w.WriteRow(rows[i%*n]); err != nil {
+					return err
+				}
+			}
+		}
+		return cr.Err()
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
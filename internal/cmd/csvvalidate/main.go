@@ -0,0 +1,331 @@
+// Package csvvalidate implements the csvvalidate command.
+package csvvalidate
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+)
+
+var flags = flag.NewFlagSet("csvvalidate", flag.ExitOnError)
+
+var (
+	jsonOutput  = flags.Bool("json", false, "write the report as JSON")
+	maxProblems = flags.Int("max-problems", 100, "stop checking a file after this many problems (0 means no limit)")
+)
+
+// problem describes a single way in which a file does not
+// conform to the annotated CSV specification.
+type problem struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] [file...]\n", flags.Name())
+		fmt.Fprintf(os.Stderr, "The exit status is 1 if any file is invalid.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	files, err := input.Files(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	problems := []problem{}
+	for _, file := range files {
+		name := file
+		if name == "-" {
+			name = "<stdin>"
+		}
+		err := input.ForEach([]string{file}, func(r io.Reader) error {
+			v := &validator{
+				file: name,
+				r:    csv.NewReader(r),
+			}
+			v.r.FieldsPerRecord = -1
+			v.validate()
+			problems = append(problems, v.problems...)
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *jsonOutput {
+		data, err := json.MarshalIndent(struct {
+			Valid    bool      `json:"valid"`
+			Problems []problem `json:"problems"`
+		}{len(problems) == 0, problems}, "", "\t")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: cannot marshal JSON: %v\n", err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(data)
+		os.Stdout.Write([]byte{'\n'})
+	} else {
+		for _, p := range problems {
+			if p.Column > 0 {
+				fmt.Printf("%s:%d: column %d: %s\n", p.File, p.Line, p.Column, p.Message)
+			} else {
+				fmt.Printf("%s:%d: %s\n", p.File, p.Line, p.Message)
+			}
+		}
+	}
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+}
+
+// errTooManyProblems is used to stop validation
+// when -max-problems is reached.
+var errTooManyProblems = fmt.Errorf("too many problems")
+
+// validator checks a single file.
+type validator struct {
+	file     string
+	r        *csv.Reader
+	problems []problem
+
+	// peeked holds a record that has been read but not consumed.
+	peeked     []string
+	peekedLine int
+}
+
+// validate checks all the tables in the file,
+// recording any problems found.
+func (v *validator) validate() {
+	defer func() {
+		if e := recover(); e != nil && e != errTooManyProblems {
+			panic(e)
+		}
+	}()
+	for v.table() {
+	}
+}
+
+func (v *validator) addProblem(line, column int, f string, a ...interface{}) {
+	v.problems = append(v.problems, problem{
+		File:    v.file,
+		Line:    line,
+		Column:  column,
+		Message: fmt.Sprintf(f, a...),
+	})
+	if *maxProblems > 0 && len(v.problems) >= *maxProblems {
+		v.problems = append(v.problems, problem{
+			File:    v.file,
+			Line:    line,
+			Message: "too many problems; giving up",
+		})
+		panic(errTooManyProblems)
+	}
+}
+
+// next returns the next record and its line number. It returns
+// nil at the end of the file or if the CSV cannot be parsed.
+func (v *validator) next() ([]string, int) {
+	if v.peeked != nil {
+		rec, line := v.peeked, v.peekedLine
+		v.peeked = nil
+		return rec, line
+	}
+	rec, err := v.r.Read()
+	if err != nil {
+		if err != io.EOF {
+			line := 0
+			if err, ok := err.(*csv.ParseError); ok {
+				line = err.Line
+			}
+			v.addProblem(line, 0, "invalid CSV: %v", err)
+		}
+		return nil, 0
+	}
+	line, _ := v.r.FieldPos(0)
+	return rec, line
+}
+
+func (v *validator) unread(rec []string, line int) {
+	v.peeked, v.peekedLine = rec, line
+}
+
+// table checks the next table in the file and reports
+// whether there was one.
+func (v *validator) table() bool {
+	rec, line := v.next()
+	if rec == nil {
+		return false
+	}
+	if !strings.HasPrefix(rec[0], "#") {
+		v.addProblem(line, 0, "table does not start with an annotation row")
+	}
+	ncols := len(rec)
+	// annotations holds the annotation rows by name.
+	annotations := make(map[string][]string)
+	defaultLine := 0
+	for ; rec != nil && strings.HasPrefix(rec[0], "#"); rec, line = v.next() {
+		if len(rec) != ncols {
+			v.addProblem(line, 0, "annotation row has %d columns, want %d", len(rec), ncols)
+			continue
+		}
+		switch rec[0] {
+		case "#datatype", "#group", "#default", "#unit":
+		default:
+			v.addProblem(line, 1, "unknown annotation %q", rec[0])
+			continue
+		}
+		if annotations[rec[0]] != nil {
+			v.addProblem(line, 1, "duplicate %s annotation", rec[0])
+			continue
+		}
+		annotations[rec[0]] = rec
+		if rec[0] == "#default" {
+			defaultLine = line
+		}
+		v.checkAnnotation(rec, line)
+	}
+	if rec == nil {
+		v.addProblem(line, 0, "missing header row")
+		return false
+	}
+	if annotations["#datatype"] == nil {
+		v.addProblem(line, 0, "no #datatype annotation")
+	}
+	if len(rec) != ncols {
+		v.addProblem(line, 0, "header row has %d columns, want %d", len(rec), ncols)
+		// The rest of the table cannot be checked meaningfully.
+		v.skipTable()
+		return true
+	}
+	names := make(map[string]bool)
+	for i := 1; i < len(rec); i++ {
+		name := rec[i]
+		switch {
+		case name == "":
+			v.addProblem(line, i+1, "empty column name")
+		case names[name]:
+			v.addProblem(line, i+1, "duplicate column name %q", name)
+		}
+		names[name] = true
+	}
+	cols := make([]string, ncols)
+	group := make([]bool, ncols)
+	defaults := make([]string, ncols)
+	for i := 1; i < ncols; i++ {
+		if a := annotations["#datatype"]; a != nil {
+			cols[i] = a[i]
+		}
+		if a := annotations["#group"]; a != nil {
+			group[i] = a[i] == "true"
+		}
+		if a := annotations["#default"]; a != nil {
+			defaults[i] = a[i]
+		}
+	}
+	v.checkDefaults(rec, cols, defaults, defaultLine)
+	v.checkRows(rec, cols, group, defaults)
+	return true
+}
+
+// checkAnnotation checks the values in an annotation row.
+func (v *validator) checkAnnotation(rec []string, line int) {
+	for i := 1; i < len(rec); i++ {
+		switch rec[0] {
+		case "#datatype":
+			if !annotatedcsv.KnownDatatype(rec[i]) || rec[i] == "" {
+				v.addProblem(line, i+1, "invalid datatype %q", rec[i])
+			}
+		case "#group":
+			if rec[i] != "true" && rec[i] != "false" {
+				v.addProblem(line, i+1, "invalid group value %q", rec[i])
+			}
+		}
+	}
+}
+
+// checkDefaults checks that the default values found
+// on the given line can be parsed.
+func (v *validator) checkDefaults(header, types, defaults []string, line int) {
+	for i := 1; i < len(defaults); i++ {
+		if defaults[i] == "" || !annotatedcsv.KnownDatatype(types[i]) {
+			continue
+		}
+		if _, err := annotatedcsv.ParseValue(defaults[i], types[i]); err != nil {
+			v.addProblem(line, i+1, "invalid default value %q for column %q: %v", defaults[i], header[i], err)
+		}
+	}
+}
+
+// checkRows checks the data rows of a table with the given header,
+// datatypes, group flags and defaults.
+func (v *validator) checkRows(header, types []string, group []bool, defaults []string) {
+	// groupValues holds the value of each group column
+	// in the first row of the table.
+	var groupValues []string
+	for {
+		rec, line := v.next()
+		if rec == nil {
+			return
+		}
+		if strings.HasPrefix(rec[0], "#") {
+			v.unread(rec, line)
+			return
+		}
+		if len(rec) != len(header) {
+			v.addProblem(line, 0, "row has %d columns, want %d", len(rec), len(header))
+			continue
+		}
+		for i := 1; i < len(rec); i++ {
+			if rec[i] == "" {
+				rec[i] = defaults[i]
+			}
+			if rec[i] == "" {
+				// Empty cells without a default are null.
+				continue
+			}
+			if !annotatedcsv.KnownDatatype(types[i]) {
+				continue
+			}
+			if _, err := annotatedcsv.ParseValue(rec[i], types[i]); err != nil {
+				v.addProblem(line, i+1, "cannot parse %q as %s for column %q", rec[i], types[i], header[i])
+			}
+		}
+		if groupValues == nil {
+			groupValues = rec
+			continue
+		}
+		for i := 1; i < len(rec); i++ {
+			if !group[i] || rec[i] == groupValues[i] {
+				continue
+			}
+			v.addProblem(line, i+1, "group column %q has value %q, different from %q earlier in the table", header[i], rec[i], groupValues[i])
+		}
+	}
+}
+
+// skipTable skips the data rows of the current table.
+func (v *validator) skipTable() {
+	for {
+		rec, line := v.next()
+		if rec == nil {
+			return
+		}
+		if strings.HasPrefix(rec[0], "#") {
+			v.unread(rec, line)
+			return
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// Package json2annotatedcsv implements the json2annotatedcsv command.
+package json2annotatedcsv
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+)
+
+var flags = flag.NewFlagSet("json2annotatedcsv", flag.ExitOnError)
+
+var timeFormat = flags.String("time-format", "rfc3339nano", "format of time values in the JSON: rfc3339, rfc3339nano, unix (seconds) or unixnano")
+
+// table and column mirror the JSON format written by csv2json.
+type table struct {
+	Columns []column          `json:"columns"`
+	Rows    []json.RawMessage `json:"rows"`
+}
+
+type column struct {
+	Name    string      `json:"name"`
+	Index   int         `json:"index"`
+	Group   bool        `json:"group"`
+	Default interface{} `json:"default"`
+	Type    string      `json:"type"`
+}
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] [file...]\n", flags.Name())
+		fmt.Fprintf(os.Stderr, "Convert JSON in the format written by csv2json back to annotated CSV.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	switch *timeFormat {
+	case "rfc3339", "rfc3339nano", "unix", "unixnano":
+	default:
+		fmt.Fprintf(os.Stderr, "error: unknown time format %q\n", *timeFormat)
+		os.Exit(2)
+	}
+	files, err := input.Files(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	bw := bufio.NewWriter(os.Stdout)
+	w := annotatedcsv.NewWriter(bw)
+	err = input.ForEach(files, func(r io.Reader) error {
+		dec := json.NewDecoder(r)
+		dec.UseNumber()
+		var tables []table
+		if err := dec.Decode(&tables); err != nil {
+			return fmt.Errorf("cannot decode JSON: %v", err)
+		}
+		for i, t := range tables {
+			if err := writeTable(w, t); err != nil {
+				return fmt.Errorf("table %d: %v", i, err)
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// writeTable writes a single table to w. The annotation column,
+// which csv2json omits, is added back at the start of each row.
+func writeTable(w *annotatedcsv.Writer, t table) error {
+	if len(t.Columns) == 0 {
+		return fmt.Errorf("no columns")
+	}
+	hasAnnotationColumn := t.Columns[0].Name == "" && t.Columns[0].Index == 0
+	var cols []annotatedcsv.Column
+	if !hasAnnotationColumn {
+		cols = append(cols, annotatedcsv.Column{})
+	}
+	for _, col := range t.Columns {
+		def, err := convertValue(col.Default, col.Type)
+		if err != nil {
+			return fmt.Errorf("invalid default for column %q: %v", col.Name, err)
+		}
+		cols = append(cols, annotatedcsv.Column{
+			Name:    col.Name,
+			Group:   col.Group,
+			Default: def,
+			Type:    col.Type,
+		})
+	}
+	// offset holds the index in cols of the first JSON column.
+	offset := len(cols) - len(t.Columns)
+	if err := w.WriteHeader(cols); err != nil {
+		return err
+	}
+	for i, data := range t.Rows {
+		vals, err := rowValues(data, t.Columns)
+		if err != nil {
+			return fmt.Errorf("row %d: %v", i, err)
+		}
+		row := make([]interface{}, len(cols))
+		for j, col := range t.Columns {
+			v, err := convertValue(vals[j], col.Type)
+			if err != nil {
+				return fmt.Errorf("row %d: invalid value for column %q: %v", i, col.Name, err)
+			}
+			row[offset+j] = v
+		}
+		if err := w.WriteRow(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rowValues returns the values in the given row in column
+// order. The row may be an object keyed by column name or
+// an array of values in column order.
+func rowValues(data json.RawMessage, cols []column) ([]interface{}, error) {
+	var v interface{}
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case []interface{}:
+		if len(v) != len(cols) {
+			return nil, fmt.Errorf("got %d values want %d", len(v), len(cols))
+		}
+		return v, nil
+	case map[string]interface{}:
+		vals := make([]interface{}, len(cols))
+		for i, col := range cols {
+			vals[i] = v[col.Name]
+		}
+		return vals, nil
+	}
+	return nil, fmt.Errorf("row is not an object or array")
+}
+
+// convertValue converts a value decoded from JSON to the
+// value held in a column of the given datatype.
+func convertValue(v interface{}, typ string) (interface{}, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case json.Number:
+		switch annotatedcsv.DatatypeKind(typ) {
+		case annotatedcsv.DateTimeKind:
+			return numberToTime(v)
+		case annotatedcsv.LongKind:
+			return strconv.ParseInt(string(v), 10, 64)
+		case annotatedcsv.UnsignedLongKind:
+			return strconv.ParseUint(string(v), 10, 64)
+		case annotatedcsv.DoubleKind:
+			return strconv.ParseFloat(string(v), 64)
+		case annotatedcsv.StringKind:
+			return string(v), nil
+		}
+	case string:
+		// Values such as times, and doubles holding Inf or NaN,
+		// are represented as strings, so parse them as the
+		// Reader would.
+		return annotatedcsv.ParseValue(v, typ)
+	case bool:
+		if typ == "boolean" {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected value %v for datatype %q", v, typ)
+}
+
+func numberToTime(n json.Number) (time.Time, error) {
+	i, err := strconv.ParseInt(string(n), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch *timeFormat {
+	case "unix":
+		return time.Unix(i, 0).UTC(), nil
+	case "unixnano":
+		return time.Unix(0, i).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("numeric time value %v found with -time-format=%s", n, *timeFormat)
+}
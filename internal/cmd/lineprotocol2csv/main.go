@@ -0,0 +1,244 @@
+// Package lineprotocol2csv implements the lineprotocol2csv command.
+package lineprotocol2csv
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv"
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+	"github.com/rogpeppe/annotatedcsv/internal/lineprotocol"
+)
+
+var flags = flag.NewFlagSet("lineprotocol2csv", flag.ExitOnError)
+
+var precision = flags.String("precision", "ns", "precision of the input timestamps: ns, us, ms or s")
+
+// series holds all the values for a single field
+// of a single series, which become one output table.
+type series struct {
+	measurement string
+	tags        []lineprotocol.Tag
+	field       string
+	datatype    string
+	times       []time.Time
+	values      []interface{}
+}
+
+// Main runs the command with the given arguments, not including
+// the command name. The name is used in usage messages.
+func Main(name string, args []string) {
+	flags.Init(name, flag.ExitOnError)
+	flags.Parse(args)
+	var unit time.Duration
+	switch *precision {
+	case "ns":
+		unit = time.Nanosecond
+	case "us":
+		unit = time.Microsecond
+	case "ms":
+		unit = time.Millisecond
+	case "s":
+		unit = time.Second
+	default:
+		fmt.Fprintf(os.Stderr, "error: invalid precision %q\n", *precision)
+		os.Exit(2)
+	}
+	files, err := input.Files(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	sr := newSeriesReader(unit, time.Now())
+	err = input.ForEach(files, sr.read)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := writeTables(os.Stdout, sr.series); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// seriesReader reads line protocol, grouping
+// the values into series.
+type seriesReader struct {
+	unit time.Duration
+	// now holds the time of points without a timestamp.
+	now         time.Time
+	series      []*series
+	seriesByKey map[string]*series
+}
+
+func newSeriesReader(unit time.Duration, now time.Time) *seriesReader {
+	return &seriesReader{
+		unit:        unit,
+		now:         now,
+		seriesByKey: make(map[string]*series),
+	}
+}
+
+// read reads all the points from r.
+func (sr *seriesReader) read(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*1024*1024)
+	scanner.Split(lineprotocol.ScanLines)
+	// Points may span several lines when
+	// string fields hold newlines.
+	for lineNum := 1; scanner.Scan(); lineNum += bytes.Count(scanner.Bytes(), []byte("\n")) + 1 {
+		p, ok, err := lineprotocol.ParseLine(scanner.Bytes())
+		if err != nil {
+			return fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		if !ok {
+			continue
+		}
+		if err := checkTags(p.Tags); err != nil {
+			return fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		t := sr.now
+		if p.HasTime {
+			t = time.Unix(0, p.Time*int64(sr.unit)).UTC()
+		}
+		sort.Slice(p.Tags, func(i, j int) bool {
+			return p.Tags[i].Key < p.Tags[j].Key
+		})
+		for _, f := range p.Fields {
+			key, s := seriesKey(p, f), (*series)(nil)
+			if s = sr.seriesByKey[key]; s == nil {
+				s = &series{
+					measurement: p.Measurement,
+					tags:        p.Tags,
+					field:       f.Key,
+					datatype:    datatype(f.Value),
+				}
+				sr.seriesByKey[key] = s
+				sr.series = append(sr.series, s)
+			}
+			s.times = append(s.times, t)
+			s.values = append(s.values, f.Value)
+		}
+	}
+	return scanner.Err()
+}
+
+// checkTags returns an error if any of the tags cannot be
+// represented as a column. Tags named result and table, as
+// written by csv2lineprotocol, set the values of those
+// columns rather than adding columns.
+func checkTags(tags []lineprotocol.Tag) error {
+	for _, tag := range tags {
+		switch tag.Key {
+		case "result":
+		case "table":
+			if _, err := strconv.ParseInt(tag.Value, 10, 64); err != nil {
+				return fmt.Errorf("table tag has non-integer value %q", tag.Value)
+			}
+		case "_time", "_value", "_field", "_measurement":
+			return fmt.Errorf("tag %q clashes with the %s column", tag.Key, tag.Key)
+		}
+	}
+	return nil
+}
+
+// writeTables writes each series as a table in the same form as
+// the output of an InfluxDB query, with rows sorted by time.
+func writeTables(w io.Writer, allSeries []*series) error {
+	bw := bufio.NewWriter(w)
+	cw := annotatedcsv.NewWriter(bw)
+	for i, s := range allSeries {
+		cols := []annotatedcsv.Column{
+			{Name: ""},
+			{Name: "result", Type: "string", Default: "_result"},
+			{Name: "table", Type: "long"},
+			{Name: "_time", Type: "dateTime:RFC3339Nano"},
+			{Name: "_value", Type: s.datatype},
+			{Name: "_field", Type: "string", Group: true},
+			{Name: "_measurement", Type: "string", Group: true},
+		}
+		row := make([]interface{}, len(cols), len(cols)+len(s.tags))
+		row[1] = "_result"
+		row[2] = int64(i)
+		row[5] = s.field
+		row[6] = s.measurement
+		for _, tag := range s.tags {
+			switch tag.Key {
+			case "result":
+				row[1] = tag.Value
+			case "table":
+				row[2], _ = strconv.ParseInt(tag.Value, 10, 64)
+			default:
+				cols = append(cols, annotatedcsv.Column{
+					Name:  tag.Key,
+					Type:  "string",
+					Group: true,
+				})
+				row = append(row, tag.Value)
+			}
+		}
+		if err := cw.WriteHeader(cols); err != nil {
+			return err
+		}
+		indexes := make([]int, len(s.times))
+		for j := range indexes {
+			indexes[j] = j
+		}
+		sort.SliceStable(indexes, func(a, b int) bool {
+			return s.times[indexes[a]].Before(s.times[indexes[b]])
+		})
+		for _, j := range indexes {
+			row[3] = s.times[j]
+			row[4] = s.values[j]
+			if err := cw.WriteRow(row); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cw.Flush(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// seriesKey returns a key that uniquely identifies the table for
+// the given field of the given point. The point's tags must be
+// sorted.
+func seriesKey(p lineprotocol.Point, f lineprotocol.Field) string {
+	var buf strings.Builder
+	buf.WriteString(p.Measurement)
+	for _, tag := range p.Tags {
+		buf.WriteString("\x00")
+		buf.WriteString(tag.Key)
+		buf.WriteString("\x00")
+		buf.WriteString(tag.Value)
+	}
+	buf.WriteString("\x01")
+	buf.WriteString(f.Key)
+	buf.WriteString("\x01")
+	buf.WriteString(datatype(f.Value))
+	return buf.String()
+}
+
+// datatype returns the annotated CSV datatype for a field value.
+func datatype(v interface{}) string {
+	switch v.(type) {
+	case int64:
+		return "long"
+	case uint64:
+		return "unsignedLong"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	}
+	return "double"
+}
@@ -0,0 +1,79 @@
+package lineprotocol2csv
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+var convertTests = []struct {
+	testName    string
+	input       string
+	expect      string
+	expectError string
+}{{
+	testName: "plain",
+	input:    "m,host=h f=1.5 1577836800000000000\n",
+	expect: `#datatype,string,long,dateTime:RFC3339Nano,double,string,string,string
+#group,false,false,false,false,true,true,true
+#default,_result,,,,,,
+,result,table,_time,_value,_field,_measurement,host
+,,0,2020-01-01T00:00:00Z,1.5,f,m,h
+`,
+}, {
+	// This is the output of csv2lineprotocol for the tables
+	// in the expected output, so the result and table tags
+	// map back onto their columns.
+	testName: "round-trip",
+	input: `m,result=_result,table=3,host=h f=1.5 1577836800000000000
+m,result=r2,table=1 g="x\"y\"
+z" 1577836800000000000
+`,
+	expect: `#datatype,string,long,dateTime:RFC3339Nano,double,string,string,string
+#group,false,false,false,false,true,true,true
+#default,_result,,,,,,
+,result,table,_time,_value,_field,_measurement,host
+,,3,2020-01-01T00:00:00Z,1.5,f,m,h
+
+#datatype,string,long,dateTime:RFC3339Nano,string,string,string
+#group,false,false,false,false,true,true
+#default,_result,,,,,
+,result,table,_time,_value,_field,_measurement
+,r2,1,2020-01-01T00:00:00Z,"x""y""
+z",g,m
+`,
+}, {
+	testName:    "non-integer-table",
+	input:       "m,table=x f=1 1577836800000000000\n",
+	expectError: `line 1: table tag has non-integer value "x"`,
+}, {
+	testName:    "clashing-tag",
+	input:       "m,_field=x f=1 1577836800000000000\n",
+	expectError: `line 1: tag "_field" clashes with the _field column`,
+}}
+
+func TestConvert(t *testing.T) {
+	for _, test := range convertTests {
+		t.Run(test.testName, func(t *testing.T) {
+			sr := newSeriesReader(time.Nanosecond, time.Time{})
+			err := sr.read(strings.NewReader(test.input))
+			if test.expectError != "" {
+				if err == nil || err.Error() != test.expectError {
+					t.Fatalf("unexpected error; got %v want %q", err, test.expectError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := writeTables(&buf, sr.series); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != test.expect {
+				t.Errorf("unexpected output; got\n%s\nwant\n%s", got, test.expect)
+			}
+		})
+	}
+}
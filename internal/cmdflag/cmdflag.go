@@ -0,0 +1,27 @@
+// Package cmdflag implements flag values common to the commands.
+package cmdflag
+
+import (
+	"sort"
+	"strings"
+)
+
+// NameSet implements flag.Value by recording
+// a set of comma-separated names.
+type NameSet map[string]bool
+
+func (f NameSet) Set(s string) error {
+	for _, name := range strings.Split(s, ",") {
+		f[name] = true
+	}
+	return nil
+}
+
+func (f NameSet) String() string {
+	var names []string
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,23 @@
+package cmdflag
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestNameSet(t *testing.T) {
+	f := NameSet{"_start": true}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(f, "drop", "")
+	if err := fs.Parse([]string{"-drop", "a,b", "-drop", "c"}); err != nil {
+		t.Fatal(err)
+	}
+	want := NameSet{"_start": true, "a": true, "b": true, "c": true}
+	if !reflect.DeepEqual(f, want) {
+		t.Fatalf("unexpected names; got %v want %v", f, want)
+	}
+	if got, want := f.String(), "_start,a,b,c"; got != want {
+		t.Fatalf("unexpected String result; got %q want %q", got, want)
+	}
+}
@@ -0,0 +1,178 @@
+package input
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Follow is like ForEachConcurrent except that f is called for
+// all the files at once and each file is read as it grows, like
+// "tail -F". The reader passed to f only returns complete lines;
+// it waits for more data at the end of the file, checking every
+// poll interval.
+//
+// When the file is replaced, for example by log rotation, the
+// rest of the old file is read and the new file is then read from
+// its start. When the file is truncated, it is read again from its
+// start. In both cases, any incomplete line at the end of the data
+// read so far is discarded.
+//
+// When stop is closed, the readers return io.EOF when they next
+// reach the end of the data, discarding any incomplete last line,
+// and Follow returns when all the calls to f have returned.
+// Otherwise, Follow returns only when f fails, in which case it
+// returns the error without waiting for the other calls to f.
+//
+// The standard input is read as by ForEach. Follow does not
+// decompress files and cannot follow URLs.
+func Follow(files []string, poll time.Duration, stop <-chan struct{}, f func(r io.Reader) error) error {
+	for _, file := range files {
+		if isURL(file) {
+			return fmt.Errorf("cannot follow URL %s", file)
+		}
+	}
+	errc := make(chan error, len(files))
+	for _, file := range files {
+		go func(file string) {
+			if file == "-" {
+				errc <- read(file, f)
+				return
+			}
+			errc <- follow(file, poll, stop, f)
+		}(file)
+	}
+	for range files {
+		if err := <-errc; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func follow(file string, poll time.Duration, stop <-chan struct{}, f func(r io.Reader) error) error {
+	fr := &follower{
+		name: file,
+		poll: poll,
+		stop: stop,
+	}
+	if err := fr.open(); err != nil {
+		return err
+	}
+	defer fr.f.Close()
+	if err := f(fr); err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	return nil
+}
+
+// follower implements io.Reader by following a growing file.
+type follower struct {
+	name string
+	poll time.Duration
+	stop <-chan struct{}
+
+	f    *os.File
+	info os.FileInfo
+	// size holds the number of bytes read from f.
+	size int64
+
+	// buf holds data read from the file but not yet returned.
+	// Only the first avail bytes, which end in a newline,
+	// may be returned.
+	buf   []byte
+	avail int
+	chunk []byte
+}
+
+func (fr *follower) open() error {
+	f, err := os.Open(fr.name)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if fr.f != nil {
+		fr.f.Close()
+	}
+	fr.f, fr.info, fr.size = f, info, 0
+	return nil
+}
+
+func (fr *follower) Read(p []byte) (int, error) {
+	for fr.avail == 0 {
+		if err := fr.fill(); err != nil {
+			return 0, err
+		}
+	}
+	if len(p) > fr.avail {
+		p = p[:fr.avail]
+	}
+	n := copy(p, fr.buf)
+	fr.buf = fr.buf[:copy(fr.buf, fr.buf[n:])]
+	fr.avail -= n
+	return n, nil
+}
+
+// fill reads more data into fr.buf, waiting
+// for the file to grow if necessary.
+func (fr *follower) fill() error {
+	if fr.chunk == nil {
+		fr.chunk = make([]byte, 32*1024)
+	}
+	for {
+		n, err := fr.f.Read(fr.chunk)
+		if n > 0 {
+			fr.size += int64(n)
+			fr.buf = append(fr.buf, fr.chunk[:n]...)
+			fr.avail = bytes.LastIndexByte(fr.buf, '\n') + 1
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		// At the end of the file: see whether it has
+		// been replaced or truncated.
+		info, err := os.Stat(fr.name)
+		switch {
+		case err != nil:
+			// The file may be in the process of being
+			// replaced, so keep reading the old one.
+		case !os.SameFile(info, fr.info):
+			// Read anything written to the old file
+			// since we last reached its end.
+			if n, _ := fr.f.Read(fr.chunk); n > 0 {
+				fr.size += int64(n)
+				fr.buf = append(fr.buf, fr.chunk[:n]...)
+				fr.avail = bytes.LastIndexByte(fr.buf, '\n') + 1
+				return nil
+			}
+			if err := fr.open(); err != nil {
+				if os.IsNotExist(err) {
+					break
+				}
+				return err
+			}
+			fr.buf = fr.buf[:0]
+			continue
+		case info.Size() < fr.size:
+			if _, err := fr.f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			fr.size = 0
+			fr.buf = fr.buf[:0]
+			continue
+		}
+		select {
+		case <-fr.stop:
+			fr.buf = fr.buf[:0]
+			return io.EOF
+		case <-time.After(fr.poll):
+		}
+	}
+}
@@ -0,0 +1,237 @@
+// Package input implements the handling of input file
+// arguments common to the commands.
+package input
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Files returns the names of the files to read given the
+// command line arguments. Arguments may be file names, glob
+// patterns or directories, in which case all the regular files
+// in the directory are read in name order. The name "-" stands
+// for the standard input, which is also read when there are no
+// arguments.
+//
+// Arguments may also be http://, https://, s3:// or gs:// URLs.
+// An s3:// or gs:// URL ending in "/" stands for all the objects
+// under that prefix. S3 requests are signed using the standard
+// AWS_* environment variables, and Google Cloud Storage requests
+// use the token in $GOOGLE_OAUTH_ACCESS_TOKEN if set.
+func Files(args []string) ([]string, error) {
+	if len(args) == 0 {
+		return []string{"-"}, nil
+	}
+	var files []string
+	for _, arg := range args {
+		if arg == "-" {
+			files = append(files, arg)
+			continue
+		}
+		if isURL(arg) {
+			urls, err := urlFiles(arg)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, urls...)
+			continue
+		}
+		matches := []string{arg}
+		if strings.ContainsAny(arg, `*?[\`) {
+			var err error
+			matches, err = filepath.Glob(arg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %v", arg, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match %q", arg)
+			}
+		}
+		for _, m := range matches {
+			info, err := os.Stat(m)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				files = append(files, m)
+				continue
+			}
+			entries, err := ioutil.ReadDir(m)
+			if err != nil {
+				return nil, err
+			}
+			var dirFiles []string
+			for _, entry := range entries {
+				if entry.Mode().IsRegular() {
+					dirFiles = append(dirFiles, filepath.Join(m, entry.Name()))
+				}
+			}
+			sort.Strings(dirFiles)
+			files = append(files, dirFiles...)
+		}
+	}
+	return files, nil
+}
+
+// Open opens the named file for reading. The name "-"
+// stands for the standard input, and URLs are read as described
+// for Files. Gzip-compressed files are decompressed.
+func Open(file string) (io.ReadCloser, error) {
+	var f io.ReadCloser
+	if file == "-" {
+		f = ioutil.NopCloser(os.Stdin)
+	} else if isURL(file) {
+		var err error
+		f, err = openURL(file)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		f, err = os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+	}
+	r, err := Decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return readCloser{r, f}, nil
+}
+
+// OpenAt is like Open except that reading starts at the given
+// offset in the decompressed contents of the file. Uncompressed
+// local files are read from the offset directly; other files are
+// read from the start and the data before the offset is discarded.
+func OpenAt(file string, offset int64) (io.ReadCloser, error) {
+	if offset > 0 && file != "-" && !isURL(file) {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		var magic [2]byte
+		if n, _ := io.ReadFull(f, magic[:]); n < 2 || magic[0] != 0x1f || magic[1] != 0x8b {
+			info, err := f.Stat()
+			if err != nil {
+				f.Close()
+				return nil, err
+			}
+			if info.Size() < offset {
+				f.Close()
+				return nil, fmt.Errorf("%s: offset %d is beyond the end of the file", file, offset)
+			}
+			if _, err := f.Seek(offset, io.SeekStart); err != nil {
+				f.Close()
+				return nil, err
+			}
+			return f, nil
+		}
+		f.Close()
+	}
+	r, err := Open(file)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(ioutil.Discard, r, offset); err != nil {
+		r.Close()
+		if err == io.EOF {
+			err = fmt.Errorf("%s: offset %d is beyond the end of the file", file, offset)
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+// Decompress returns a reader that reads the contents of r,
+// decompressing them if they are gzip-compressed.
+func Decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(br)
+	}
+	return br, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// ForEach calls f with the contents of each of the given files
+// in turn. Any error returned by f is prefixed with the file
+// name, unless the file is the standard input.
+func ForEach(files []string, f func(r io.Reader) error) error {
+	for _, file := range files {
+		if err := read(file, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForEachConcurrent is like ForEach except that it calls f
+// concurrently for up to n files at a time. It returns the
+// error from the first file to fail, after waiting for
+// all calls to f to return.
+func ForEachConcurrent(files []string, n int, f func(r io.Reader) error) error {
+	if n <= 1 {
+		return ForEach(files, f)
+	}
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	sem := make(chan struct{}, n)
+	for _, file := range files {
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(file string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := read(file, f); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(file)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+func read(file string, f func(r io.Reader) error) error {
+	r, err := Open(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := f(r); err != nil {
+		if file == "-" {
+			return err
+		}
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	return nil
+}
@@ -0,0 +1,542 @@
+package input
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxAttempts holds the number of times a request for a remote
+// object is tried before giving up. A read that fails after
+// some data has been received starts the count again.
+const maxAttempts = 5
+
+// isURL reports whether the argument names a remote object
+// rather than a local file.
+func isURL(arg string) bool {
+	for _, scheme := range []string{"http://", "https://", "s3://", "gs://"} {
+		if strings.HasPrefix(arg, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// urlFiles returns the URLs to read for the given URL argument.
+// An s3:// or gs:// URL that ends in "/" or names only a bucket
+// stands for all the objects with that prefix, in name order.
+func urlFiles(arg string) ([]string, error) {
+	u, err := url.Parse(arg)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "s3" && u.Scheme != "gs") || !strings.HasSuffix("/"+u.Path, "/") {
+		return []string{arg}, nil
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("no bucket in %q", arg)
+	}
+	prefix := strings.TrimPrefix(u.Path, "/")
+	var keys []string
+	if u.Scheme == "s3" {
+		keys, err = listS3(u.Host, prefix)
+	} else {
+		keys, err = listGCS(u.Host, prefix)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot list %s: %v", arg, err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no objects match %q", arg)
+	}
+	sort.Strings(keys)
+	files := make([]string, len(keys))
+	for i, key := range keys {
+		files[i] = u.Scheme + "://" + u.Host + "/" + key
+	}
+	return files, nil
+}
+
+// openURL opens the remote object with the given URL. The
+// object is streamed rather than downloaded first; if reading
+// fails part way through, the rest of the object is requested
+// again from where the read left off.
+func openURL(rawURL string) (io.ReadCloser, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	var newRequest func(header http.Header) (*http.Request, error)
+	switch u.Scheme {
+	case "http", "https":
+		newRequest = func(header http.Header) (*http.Request, error) {
+			req, err := http.NewRequest("GET", rawURL, nil)
+			if err != nil {
+				return nil, err
+			}
+			addHeader(req, header)
+			return req, nil
+		}
+	case "s3":
+		key := strings.TrimPrefix(u.Path, "/")
+		if u.Host == "" || key == "" {
+			return nil, fmt.Errorf("no bucket or key in %q", rawURL)
+		}
+		newRequest = func(header http.Header) (*http.Request, error) {
+			return newS3Request(u.Host, key, header)
+		}
+	case "gs":
+		object := strings.TrimPrefix(u.Path, "/")
+		if u.Host == "" || object == "" {
+			return nil, fmt.Errorf("no bucket or object in %q", rawURL)
+		}
+		newRequest = func(header http.Header) (*http.Request, error) {
+			req, err := newGCSRequest("https://storage.googleapis.com/" + u.Host + "/" + escapePath(object))
+			if err != nil {
+				return nil, err
+			}
+			addHeader(req, header)
+			return req, nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+	r := &remoteReader{
+		newRequest: newRequest,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// remoteReader reads the body of a remote object, resuming with
+// a range request when a read fails.
+type remoteReader struct {
+	// newRequest returns a request for the object with
+	// the given extra headers.
+	newRequest func(header http.Header) (*http.Request, error)
+
+	body   io.ReadCloser
+	offset int64
+
+	// etag and lastModified hold the validators from the first
+	// response, used to make sure that a resumed read sees the
+	// same object.
+	etag         string
+	lastModified string
+}
+
+func (r *remoteReader) Read(buf []byte) (int, error) {
+	for attempt := 1; ; attempt++ {
+		if r.body == nil {
+			if err := r.open(); err != nil {
+				return 0, err
+			}
+		}
+		n, err := r.body.Read(buf)
+		r.offset += int64(n)
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+		r.body.Close()
+		r.body = nil
+		if n > 0 {
+			// Report the data we have; the next Read will resume.
+			return n, nil
+		}
+		if attempt >= maxAttempts {
+			return 0, err
+		}
+		time.Sleep(backoff(attempt))
+	}
+}
+
+func (r *remoteReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
+
+// open issues the request for the object starting at the
+// current offset, retrying on failure.
+func (r *remoteReader) open() error {
+	for attempt := 1; ; attempt++ {
+		err := r.get()
+		if err == nil {
+			return nil
+		}
+		if _, ok := err.(permanentError); ok || attempt >= maxAttempts {
+			return err
+		}
+		time.Sleep(backoff(attempt))
+	}
+}
+
+// permanentError is returned by get for failures that are not
+// worth retrying.
+type permanentError struct {
+	error
+}
+
+func (r *remoteReader) get() error {
+	header := make(http.Header)
+	if r.offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", r.offset))
+		if r.etag != "" {
+			header.Set("If-Match", r.etag)
+		} else if r.lastModified != "" {
+			header.Set("If-Unmodified-Since", r.lastModified)
+		}
+	}
+	req, err := r.newRequest(header)
+	if err != nil {
+		return permanentError{err}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && r.offset > 0:
+	case resp.StatusCode == http.StatusOK:
+		if r.offset == 0 {
+			r.etag = resp.Header.Get("ETag")
+			r.lastModified = resp.Header.Get("Last-Modified")
+			break
+		}
+		// The server ignored the range, so skip the
+		// data that has already been read.
+		if _, err := io.CopyN(ioutil.Discard, resp.Body, r.offset); err != nil {
+			resp.Body.Close()
+			return err
+		}
+	case resp.StatusCode == http.StatusPreconditionFailed:
+		resp.Body.Close()
+		return permanentError{fmt.Errorf("%s changed while it was being read", req.URL.Redacted())}
+	default:
+		err := responseError(req, resp)
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return permanentError{err}
+		}
+		return err
+	}
+	r.body = resp.Body
+	return nil
+}
+
+// addHeader adds the given headers to req.
+func addHeader(req *http.Request, header http.Header) {
+	for k, v := range header {
+		req.Header[k] = v
+	}
+}
+
+// responseError returns an error describing the unsuccessful
+// response resp, closing its body.
+func responseError(req *http.Request, resp *http.Response) error {
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	msg := strings.TrimSpace(string(data))
+	if i := strings.IndexByte(msg, '\n'); i >= 0 {
+		msg = msg[:i]
+	}
+	if msg != "" {
+		return fmt.Errorf("GET %s: %s: %s", req.URL.Redacted(), resp.Status, msg)
+	}
+	return fmt.Errorf("GET %s: %s", req.URL.Redacted(), resp.Status)
+}
+
+// backoff returns how long to wait before the given attempt
+// to retry.
+func backoff(attempt int) time.Duration {
+	return time.Duration(1<<uint(attempt-1)) * 500 * time.Millisecond
+}
+
+// escapePath escapes each element of a slash-separated path.
+func escapePath(p string) string {
+	elems := strings.Split(p, "/")
+	for i, e := range elems {
+		elems[i] = uriEncode(e)
+	}
+	return strings.Join(elems, "/")
+}
+
+// uriEncode escapes all bytes of s except the unreserved
+// characters, as required by AWS signatures.
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// newGCSRequest returns a GET request for a Google Cloud Storage
+// URL. If the GOOGLE_OAUTH_ACCESS_TOKEN environment variable is
+// set, it is sent as a bearer token; otherwise the request is
+// anonymous, which works only for public objects.
+func newGCSRequest(rawURL string) (*http.Request, error) {
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// listGCS returns the names of the objects in the given
+// bucket that start with prefix.
+func listGCS(bucket, prefix string) ([]string, error) {
+	var names []string
+	pageToken := ""
+	for {
+		q := url.Values{"prefix": {prefix}, "fields": {"items(name),nextPageToken"}}
+		if pageToken != "" {
+			q.Set("pageToken", pageToken)
+		}
+		req, err := newGCSRequest("https://storage.googleapis.com/storage/v1/b/" + uriEncode(bucket) + "/o?" + q.Encode())
+		if err != nil {
+			return nil, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, responseError(req, resp)
+		}
+		var result struct {
+			Items []struct {
+				Name string `json:"name"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode object list: %v", err)
+		}
+		for _, item := range result.Items {
+			if !strings.HasSuffix(item.Name, "/") {
+				names = append(names, item.Name)
+			}
+		}
+		if result.NextPageToken == "" {
+			return names, nil
+		}
+		pageToken = result.NextPageToken
+	}
+}
+
+// listS3 returns the keys of the objects in the given bucket
+// that start with prefix.
+func listS3(bucket, prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		req, err := newS3ListRequest(bucket, prefix, token)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, responseError(req, resp)
+		}
+		var result struct {
+			Contents []struct {
+				Key string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode object list: %v", err)
+		}
+		for _, c := range result.Contents {
+			if !strings.HasSuffix(c.Key, "/") {
+				keys = append(keys, c.Key)
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// s3Config holds the S3 settings taken from the environment.
+type s3Config struct {
+	region       string
+	endpoint     string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+// s3Env returns the S3 settings from the standard AWS
+// environment variables. If AWS_ENDPOINT_URL is set, requests
+// go to that endpoint using path-style URLs, as needed by most
+// S3-compatible stores.
+func s3Env() s3Config {
+	cfg := s3Config{
+		region:       os.Getenv("AWS_REGION"),
+		endpoint:     strings.TrimSuffix(os.Getenv("AWS_ENDPOINT_URL"), "/"),
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if cfg.region == "" {
+		cfg.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if cfg.region == "" {
+		cfg.region = "us-east-1"
+	}
+	return cfg
+}
+
+// s3URL returns the HTTP URL for the given bucket and
+// escaped object path.
+func (cfg s3Config) s3URL(bucket, path string) string {
+	if cfg.endpoint != "" {
+		return cfg.endpoint + "/" + uriEncode(bucket) + "/" + path
+	}
+	return "https://" + bucket + ".s3." + cfg.region + ".amazonaws.com/" + path
+}
+
+// newS3Request returns a GET request for the given object with
+// the given extra headers, signed if AWS credentials are set.
+func newS3Request(bucket, key string, header http.Header) (*http.Request, error) {
+	cfg := s3Env()
+	req, err := http.NewRequest("GET", cfg.s3URL(bucket, escapePath(key)), nil)
+	if err != nil {
+		return nil, err
+	}
+	addHeader(req, header)
+	cfg.sign(req, time.Now())
+	return req, nil
+}
+
+// newS3ListRequest returns a ListObjectsV2 request for the
+// given bucket.
+func newS3ListRequest(bucket, prefix, token string) (*http.Request, error) {
+	cfg := s3Env()
+	q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	if token != "" {
+		q.Set("continuation-token", token)
+	}
+	req, err := http.NewRequest("GET", cfg.s3URL(bucket, "")+"?"+canonicalQuery(q), nil)
+	if err != nil {
+		return nil, err
+	}
+	cfg.sign(req, time.Now())
+	return req, nil
+}
+
+// emptyHash holds the hex SHA-256 hash of an empty payload.
+const emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// sign signs the body-less request req with AWS Signature
+// Version 4. It does nothing when there are no credentials,
+// so that public buckets can be read anonymously.
+func (cfg s3Config) sign(req *http.Request, now time.Time) {
+	if cfg.accessKey == "" || cfg.secretKey == "" {
+		return
+	}
+	now = now.UTC()
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", emptyHash)
+	if cfg.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", cfg.sessionToken)
+	}
+	headers := map[string]string{
+		"host": req.URL.Host,
+	}
+	for k, v := range req.Header {
+		k = strings.ToLower(k)
+		if k == "range" || strings.HasPrefix(k, "x-amz-") || strings.HasPrefix(k, "if-") {
+			headers[k] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyHash,
+	}, "\n")
+	scope := date + "/" + cfg.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + scope + "\n" + hashHex(canonicalRequest)
+	key := hmacSHA256([]byte("AWS4"+cfg.secretKey), date)
+	key = hmacSHA256(key, cfg.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+cfg.accessKey+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// canonicalQuery returns the query parameters in the sorted,
+// strictly escaped form used by AWS signatures.
+func canonicalQuery(q url.Values) string {
+	var params []string
+	for k, vs := range q {
+		for _, v := range vs {
+			params = append(params, uriEncode(k)+"="+uriEncode(v))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+func hashHex(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
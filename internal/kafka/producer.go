@@ -0,0 +1,571 @@
+// Package kafka implements a minimal Kafka producer, enough to
+// write messages to a topic using the standard partitioning
+// scheme, with optional TLS and SASL/PLAIN authentication.
+package kafka
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Message holds a message to produce. A nil Key means
+// that messages are spread across all partitions.
+type Message struct {
+	Key   []byte
+	Value []byte
+}
+
+// Acks values for Config.Acks.
+const (
+	AcksNone   = 0
+	AcksLeader = 1
+	AcksAll    = -1
+)
+
+// Config holds the configuration of a Producer.
+type Config struct {
+	// ClientID is sent to the brokers to identify the client.
+	ClientID string
+
+	// Acks holds the number of acknowledgements the leader must
+	// receive before responding to a produce request: AcksNone,
+	// AcksLeader or AcksAll.
+	Acks int
+
+	// Timeout holds the time the broker waits for the
+	// acknowledgements, and the time allowed for each network
+	// operation. If it is zero, 30 seconds is used.
+	Timeout time.Duration
+
+	// TLS, if non-nil, holds the TLS configuration used
+	// to connect to the brokers.
+	TLS *tls.Config
+
+	// Username and Password hold credentials for SASL/PLAIN
+	// authentication. Authentication is used only when
+	// Username is non-empty.
+	Username string
+	Password string
+
+	// MaxRequestBytes holds the approximate maximum size of
+	// the messages in a single produce request. If it is zero,
+	// DefaultMaxRequestBytes is used. Brokers reject requests
+	// larger than their message.max.bytes setting.
+	MaxRequestBytes int
+}
+
+// DefaultMaxRequestBytes holds the default value of
+// Config.MaxRequestBytes.
+const DefaultMaxRequestBytes = 900 * 1024
+
+const (
+	// maxAttempts holds the number of times a request is tried
+	// before giving up.
+	maxAttempts = 5
+
+	// retryBackoff holds the delay before the first retry.
+	// It doubles after each attempt.
+	retryBackoff = 250 * time.Millisecond
+)
+
+// Producer produces messages to Kafka topics. Its methods may
+// not be called concurrently.
+type Producer struct {
+	bootstrap []string
+	cfg       Config
+
+	// brokers maps broker ids to their addresses.
+	brokers map[int32]string
+	// conns holds the open connections by broker id.
+	conns map[int32]*conn
+	// leaders maps each topic to the leader of each of its
+	// partitions, indexed by partition number.
+	leaders map[string][]int32
+	// next holds the partition to use for the next unkeyed
+	// message for each topic.
+	next map[string]int
+}
+
+// NewProducer returns a Producer that finds the cluster
+// through the given bootstrap brokers, each in host:port form.
+// No connections are made until the first call to Produce.
+func NewProducer(bootstrap []string, cfg Config) (*Producer, error) {
+	if len(bootstrap) == 0 {
+		return nil, fmt.Errorf("no Kafka brokers specified")
+	}
+	switch cfg.Acks {
+	case AcksNone, AcksLeader, AcksAll:
+	default:
+		return nil, fmt.Errorf("invalid acks value %d", cfg.Acks)
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.MaxRequestBytes == 0 {
+		cfg.MaxRequestBytes = DefaultMaxRequestBytes
+	}
+	return &Producer{
+		bootstrap: bootstrap,
+		cfg:       cfg,
+		brokers:   make(map[int32]string),
+		conns:     make(map[int32]*conn),
+		leaders:   make(map[string][]int32),
+		next:      make(map[string]int),
+	}, nil
+}
+
+// Produce writes the given messages to the topic. Messages with
+// the same key go to the same partition, chosen as the Java client
+// would choose it. It returns when all the messages have been
+// acknowledged as required by Config.Acks.
+func (p *Producer) Produce(topic string, msgs []Message) error {
+	for len(msgs) > 0 {
+		n, size := 0, 0
+		for n < len(msgs) && (n == 0 || size+len(msgs[n].Key)+len(msgs[n].Value) <= p.cfg.MaxRequestBytes) {
+			size += len(msgs[n].Key) + len(msgs[n].Value)
+			n++
+		}
+		if err := p.produce(topic, msgs[:n]); err != nil {
+			return err
+		}
+		msgs = msgs[n:]
+	}
+	return nil
+}
+
+// produce writes msgs to the topic, retrying the partitions
+// that fail with retriable errors.
+func (p *Producer) produce(topic string, msgs []Message) error {
+	leaders, err := p.topicLeaders(topic)
+	if err != nil {
+		return err
+	}
+	pending := make(map[int32][]Message)
+	unkeyed := false
+	for _, m := range msgs {
+		var part int
+		if m.Key != nil {
+			part = keyPartition(m.Key, len(leaders))
+		} else {
+			part = p.next[topic] % len(leaders)
+			unkeyed = true
+		}
+		pending[int32(part)] = append(pending[int32(part)], m)
+	}
+	if unkeyed {
+		// Unkeyed messages go to the same partition for a
+		// whole batch, and to the next partition for the next.
+		p.next[topic]++
+	}
+	for attempt := 1; ; attempt++ {
+		var lastErr error
+		failed := make(map[int32][]Message)
+		for leader, parts := range partitionsByLeader(pending, leaders) {
+			errs, err := p.produceToBroker(leader, topic, pending, parts)
+			if err != nil {
+				p.closeConn(leader)
+				lastErr = err
+				for _, part := range parts {
+					failed[part] = pending[part]
+				}
+				continue
+			}
+			for part, err := range errs {
+				if kerr, ok := err.(Error); !ok || !kerr.Retriable() {
+					return fmt.Errorf("cannot produce to %s partition %d: %v", topic, part, err)
+				}
+				lastErr = err
+				failed[part] = pending[part]
+			}
+		}
+		if len(failed) == 0 {
+			return nil
+		}
+		if attempt >= maxAttempts {
+			return fmt.Errorf("cannot produce to %s: %v", topic, lastErr)
+		}
+		time.Sleep(retryBackoff << uint(attempt-1))
+		// The leaders may have moved, so fetch them again.
+		delete(p.leaders, topic)
+		if leaders, err = p.topicLeaders(topic); err != nil {
+			return err
+		}
+		pending = failed
+	}
+}
+
+// keyPartition returns the partition for messages with the
+// given key in a topic with n partitions.
+func keyPartition(key []byte, n int) int {
+	return int(murmur2(key)&0x7fffffff) % n
+}
+
+// partitionsByLeader returns the partitions in pending grouped
+// by the broker that leads them.
+func partitionsByLeader(pending map[int32][]Message, leaders []int32) map[int32][]int32 {
+	m := make(map[int32][]int32)
+	for part := range pending {
+		leader := leaders[part]
+		m[leader] = append(m[leader], part)
+	}
+	for _, parts := range m {
+		sort.Slice(parts, func(i, j int) bool { return parts[i] < parts[j] })
+	}
+	return m
+}
+
+// produceToBroker sends a produce request for the given
+// partitions to a broker. It returns any per-partition errors
+// from the response.
+func (p *Producer) produceToBroker(broker int32, topic string, pending map[int32][]Message, parts []int32) (map[int32]error, error) {
+	c, err := p.conn(broker)
+	if err != nil {
+		return nil, err
+	}
+	var e encoder
+	e.nullString() // transactional id
+	e.int16(int16(p.cfg.Acks))
+	e.int32(int32(p.cfg.Timeout / time.Millisecond))
+	e.int32(1) // topics
+	e.string(topic)
+	e.int32(int32(len(parts)))
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	var batch []byte
+	for _, part := range parts {
+		e.int32(part)
+		batch = appendRecordBatch(batch[:0], pending[part], now)
+		e.bytes(batch)
+	}
+	if p.cfg.Acks == AcksNone {
+		// The broker does not respond.
+		return nil, c.send(apiProduce, produceVersion, e.buf)
+	}
+	resp, err := c.roundTrip(apiProduce, produceVersion, e.buf)
+	if err != nil {
+		return nil, err
+	}
+	errs := make(map[int32]error)
+	d := &decoder{buf: resp}
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		d.string()
+		for j, m := 0, d.arrayLen(); j < m; j++ {
+			part := d.int32()
+			code := d.int16()
+			d.int64() // base offset
+			d.int64() // log append time
+			if code != 0 {
+				errs[part] = Error(code)
+			}
+		}
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("bad produce response: %v", d.err)
+	}
+	return errs, nil
+}
+
+// topicLeaders returns the leader of each partition of the
+// topic, fetching the cluster metadata if needed.
+func (p *Producer) topicLeaders(topic string) ([]int32, error) {
+	if leaders := p.leaders[topic]; leaders != nil {
+		return leaders, nil
+	}
+	var lastErr error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(retryBackoff << uint(attempt-2))
+		}
+		leaders, err := p.fetchMetadata(topic)
+		if err == nil {
+			p.leaders[topic] = leaders
+			return leaders, nil
+		}
+		if kerr, ok := err.(Error); ok && !kerr.Retriable() {
+			return nil, fmt.Errorf("cannot get metadata for topic %s: %v", topic, err)
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("cannot get metadata for topic %s: %v", topic, lastErr)
+}
+
+// fetchMetadata asks any reachable broker for the metadata of
+// the topic, updating the known broker addresses.
+func (p *Producer) fetchMetadata(topic string) ([]int32, error) {
+	var e encoder
+	e.int32(1)
+	e.string(topic)
+	resp, err := p.metadataRequest(e.buf)
+	if err != nil {
+		return nil, err
+	}
+	d := &decoder{buf: resp}
+	brokers := make(map[int32]string)
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.string() // rack
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.int32() // controller id
+	var (
+		leaders  []int32
+		topicErr int16
+	)
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		code := d.int16()
+		name := d.string()
+		d.int8() // is internal
+		var parts []int32
+		var partErr int16
+		for j, m := 0, d.arrayLen(); j < m; j++ {
+			code := d.int16()
+			index := d.int32()
+			leader := d.int32()
+			for k, l := 0, d.arrayLen(); k < l; k++ {
+				d.int32() // replica
+			}
+			for k, l := 0, d.arrayLen(); k < l; k++ {
+				d.int32() // in-sync replica
+			}
+			if index < 0 || int(index) >= m {
+				d.err = fmt.Errorf("partition index %d out of range", index)
+				continue
+			}
+			if parts == nil {
+				parts = make([]int32, m)
+			}
+			parts[index] = leader
+			if leader < 0 && partErr == 0 {
+				partErr = 5 // LEADER_NOT_AVAILABLE
+				if code != 0 {
+					partErr = code
+				}
+			}
+		}
+		if name == topic {
+			leaders, topicErr = parts, code
+			if topicErr == 0 {
+				topicErr = partErr
+			}
+		}
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("bad metadata response: %v", d.err)
+	}
+	for id, addr := range brokers {
+		if old, ok := p.brokers[id]; ok && old != addr {
+			p.closeConn(id)
+		}
+		p.brokers[id] = addr
+	}
+	if topicErr != 0 {
+		return nil, Error(topicErr)
+	}
+	if len(leaders) == 0 {
+		return nil, Error(3) // UNKNOWN_TOPIC_OR_PARTITION
+	}
+	for _, leader := range leaders {
+		if _, ok := p.brokers[leader]; !ok {
+			return nil, fmt.Errorf("no address for broker %d", leader)
+		}
+	}
+	return leaders, nil
+}
+
+// metadataRequest sends a metadata request to the first broker
+// that responds, trying the known brokers before the bootstrap
+// brokers.
+func (p *Producer) metadataRequest(req []byte) ([]byte, error) {
+	lastErr := fmt.Errorf("no brokers available")
+	ids := make([]int32, 0, len(p.brokers))
+	for id := range p.brokers {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		c, err := p.conn(id)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp, err := c.roundTrip(apiMetadata, metadataVersion, req)
+		if err == nil {
+			return resp, nil
+		}
+		p.closeConn(id)
+		lastErr = err
+	}
+	for _, addr := range p.bootstrap {
+		c, err := p.dial(addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp, err := c.roundTrip(apiMetadata, metadataVersion, req)
+		c.Close()
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// conn returns a connection to the broker with the given id.
+func (p *Producer) conn(id int32) (*conn, error) {
+	if c := p.conns[id]; c != nil {
+		return c, nil
+	}
+	addr, ok := p.brokers[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown broker %d", id)
+	}
+	c, err := p.dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	p.conns[id] = c
+	return c, nil
+}
+
+func (p *Producer) closeConn(id int32) {
+	if c := p.conns[id]; c != nil {
+		c.Close()
+		delete(p.conns, id)
+	}
+}
+
+// Close closes all connections to the brokers.
+func (p *Producer) Close() error {
+	for id := range p.conns {
+		p.closeConn(id)
+	}
+	return nil
+}
+
+// dial connects to the broker at addr, authenticating if
+// configured to.
+func (p *Producer) dial(addr string) (*conn, error) {
+	dialer := &net.Dialer{Timeout: p.cfg.Timeout}
+	var (
+		nc  net.Conn
+		err error
+	)
+	if p.cfg.TLS != nil {
+		nc, err = tls.DialWithDialer(dialer, "tcp", addr, p.cfg.TLS)
+	} else {
+		nc, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{
+		Conn:     nc,
+		clientID: p.cfg.ClientID,
+		timeout:  p.cfg.Timeout,
+	}
+	if p.cfg.Username != "" {
+		if err := c.authenticate(p.cfg.Username, p.cfg.Password); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("cannot authenticate to %s: %v", addr, err)
+		}
+	}
+	return c, nil
+}
+
+// conn is a connection to a broker.
+type conn struct {
+	net.Conn
+	clientID      string
+	timeout       time.Duration
+	correlationID int32
+}
+
+// send sends a request without waiting for a response.
+func (c *conn) send(apiKey, version int16, body []byte) error {
+	_, err := c.write(apiKey, version, body)
+	return err
+}
+
+// roundTrip sends a request and returns the body of
+// the response.
+func (c *conn) roundTrip(apiKey, version int16, body []byte) ([]byte, error) {
+	id, err := c.write(apiKey, version, body)
+	if err != nil {
+		return nil, err
+	}
+	c.SetReadDeadline(time.Now().Add(2 * c.timeout))
+	var size [4]byte
+	if _, err := io.ReadFull(c, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n < 4 || n > 100<<20 {
+		return nil, fmt.Errorf("invalid response size %d", n)
+	}
+	resp := make([]byte, n)
+	if _, err := io.ReadFull(c, resp); err != nil {
+		return nil, err
+	}
+	if got := int32(binary.BigEndian.Uint32(resp)); got != id {
+		return nil, fmt.Errorf("unexpected correlation id %d in response (want %d)", got, id)
+	}
+	return resp[4:], nil
+}
+
+// write writes a request with the given body and returns its
+// correlation id.
+func (c *conn) write(apiKey, version int16, body []byte) (int32, error) {
+	c.correlationID++
+	var e encoder
+	e.int32(0) // size, filled in below
+	e.int16(apiKey)
+	e.int16(version)
+	e.int32(c.correlationID)
+	e.string(c.clientID)
+	e.buf = append(e.buf, body...)
+	binary.BigEndian.PutUint32(e.buf, uint32(len(e.buf)-4))
+	c.SetWriteDeadline(time.Now().Add(c.timeout))
+	_, err := c.Write(e.buf)
+	return c.correlationID, err
+}
+
+// authenticate performs SASL/PLAIN authentication.
+func (c *conn) authenticate(username, password string) error {
+	var e encoder
+	e.string("PLAIN")
+	resp, err := c.roundTrip(apiSaslHandshake, saslHandshakeVersion, e.buf)
+	if err != nil {
+		return err
+	}
+	d := &decoder{buf: resp}
+	if code := d.int16(); code != 0 {
+		return Error(code)
+	}
+	e = encoder{}
+	e.bytes([]byte("\x00" + username + "\x00" + password))
+	resp, err = c.roundTrip(apiSaslAuthenticate, saslAuthenticateVersion, e.buf)
+	if err != nil {
+		return err
+	}
+	d = &decoder{buf: resp}
+	code := d.int16()
+	msg := d.string()
+	if d.err != nil {
+		return fmt.Errorf("bad authentication response: %v", d.err)
+	}
+	if code != 0 {
+		if msg != "" {
+			return fmt.Errorf("%v: %s", Error(code), msg)
+		}
+		return Error(code)
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+// API keys and versions of the requests used.
+const (
+	apiProduce          = 0
+	apiMetadata         = 3
+	apiSaslHandshake    = 17
+	apiSaslAuthenticate = 36
+
+	produceVersion          = 3
+	metadataVersion         = 1
+	saslHandshakeVersion    = 1
+	saslAuthenticateVersion = 0
+)
+
+// Error codes that mean that the request may succeed when
+// retried, possibly after refreshing the metadata.
+var retriableErrors = map[int16]bool{
+	5:  true, // LEADER_NOT_AVAILABLE
+	6:  true, // NOT_LEADER_OR_FOLLOWER
+	7:  true, // REQUEST_TIMED_OUT
+	13: true, // NETWORK_EXCEPTION
+	14: true, // COORDINATOR_LOAD_IN_PROGRESS
+	15: true, // COORDINATOR_NOT_AVAILABLE
+	19: true, // NOT_ENOUGH_REPLICAS
+	20: true, // NOT_ENOUGH_REPLICAS_AFTER_APPEND
+}
+
+// errorNames holds the names of the error codes most likely
+// to be seen when producing.
+var errorNames = map[int16]string{
+	1:  "OFFSET_OUT_OF_RANGE",
+	2:  "CORRUPT_MESSAGE",
+	3:  "UNKNOWN_TOPIC_OR_PARTITION",
+	5:  "LEADER_NOT_AVAILABLE",
+	6:  "NOT_LEADER_OR_FOLLOWER",
+	7:  "REQUEST_TIMED_OUT",
+	10: "MESSAGE_TOO_LARGE",
+	13: "NETWORK_EXCEPTION",
+	17: "INVALID_TOPIC_EXCEPTION",
+	18: "RECORD_LIST_TOO_LARGE",
+	19: "NOT_ENOUGH_REPLICAS",
+	20: "NOT_ENOUGH_REPLICAS_AFTER_APPEND",
+	21: "INVALID_REQUIRED_ACKS",
+	29: "TOPIC_AUTHORIZATION_FAILED",
+	33: "UNSUPPORTED_SASL_MECHANISM",
+	34: "ILLEGAL_SASL_STATE",
+	35: "UNSUPPORTED_VERSION",
+	58: "SASL_AUTHENTICATION_FAILED",
+	87: "INVALID_RECORD",
+}
+
+// Error is an error code returned by a broker.
+type Error int16
+
+func (e Error) Error() string {
+	if name := errorNames[int16(e)]; name != "" {
+		return fmt.Sprintf("kafka error %d (%s)", int16(e), name)
+	}
+	return fmt.Sprintf("kafka error %d", int16(e))
+}
+
+// Retriable reports whether the request that failed with the
+// error may succeed if tried again.
+func (e Error) Retriable() bool {
+	return retriableErrors[int16(e)]
+}
+
+// encoder appends Kafka protocol primitives to a byte slice.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) int8(x int8) {
+	e.buf = append(e.buf, byte(x))
+}
+
+func (e *encoder) int16(x int16) {
+	e.buf = append(e.buf, byte(x>>8), byte(x))
+}
+
+func (e *encoder) int32(x int32) {
+	e.buf = append(e.buf, byte(x>>24), byte(x>>16), byte(x>>8), byte(x))
+}
+
+func (e *encoder) int64(x int64) {
+	e.int32(int32(x >> 32))
+	e.int32(int32(x))
+}
+
+func (e *encoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) nullString() {
+	e.int16(-1)
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.int32(int32(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+// varint appends x as a zigzag-encoded variable-length integer.
+func (e *encoder) varint(x int64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(tmp[:], x)
+	e.buf = append(e.buf, tmp[:n]...)
+}
+
+// varBytes appends b preceded by its length as a varint.
+// A nil b is encoded as null.
+func (e *encoder) varBytes(b []byte) {
+	if b == nil {
+		e.varint(-1)
+		return
+	}
+	e.varint(int64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+// decoder reads Kafka protocol primitives from a byte slice.
+// After the first error, all reads return zero values.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.buf) {
+		d.err = fmt.Errorf("truncated response")
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) int8() int8 {
+	b := d.next(1)
+	if b == nil {
+		return 0
+	}
+	return int8(b[0])
+}
+
+func (d *decoder) int16() int16 {
+	b := d.next(2)
+	if b == nil {
+		return 0
+	}
+	return int16(binary.BigEndian.Uint16(b))
+}
+
+func (d *decoder) int32() int32 {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(b))
+}
+
+func (d *decoder) int64() int64 {
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+func (d *decoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.next(int(n)))
+}
+
+// arrayLen reads the length of an array. A null array
+// has length zero.
+func (d *decoder) arrayLen() int {
+	n := d.int32()
+	if n < 0 || int(n) > len(d.buf) {
+		// Each element takes at least one byte.
+		if n > 0 && d.err == nil {
+			d.err = fmt.Errorf("truncated response")
+		}
+		return 0
+	}
+	return int(n)
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// appendRecordBatch appends a record batch in the version 2
+// (magic 2) format holding the given messages, all with the
+// given timestamp in milliseconds.
+func appendRecordBatch(buf []byte, msgs []Message, timestamp int64) []byte {
+	var e encoder
+	e.buf = buf
+	e.int64(0) // base offset
+	lengthPos := len(e.buf)
+	e.int32(0)  // batch length, filled in below
+	e.int32(-1) // partition leader epoch
+	e.int8(2)   // magic
+	crcPos := len(e.buf)
+	e.int32(0) // crc, filled in below
+	e.int16(0) // attributes: no compression, create time
+	e.int32(int32(len(msgs) - 1))
+	e.int64(timestamp) // first timestamp
+	e.int64(timestamp) // max timestamp
+	e.int64(-1)        // producer id
+	e.int16(-1)        // producer epoch
+	e.int32(-1)        // base sequence
+	e.int32(int32(len(msgs)))
+	var rec encoder
+	for i, m := range msgs {
+		rec.buf = rec.buf[:0]
+		rec.int8(0)   // attributes
+		rec.varint(0) // timestamp delta
+		rec.varint(int64(i))
+		rec.varBytes(m.Key)
+		rec.varBytes(m.Value)
+		rec.varint(0) // headers
+		e.varint(int64(len(rec.buf)))
+		e.buf = append(e.buf, rec.buf...)
+	}
+	binary.BigEndian.PutUint32(e.buf[lengthPos:], uint32(len(e.buf)-lengthPos-4))
+	binary.BigEndian.PutUint32(e.buf[crcPos:], crc32.Checksum(e.buf[crcPos+4:], castagnoli))
+	return e.buf
+}
+
+// murmur2 returns the hash of data used by the Java client's
+// default partitioner, so that messages with the same key go
+// to the same partition whichever client produces them.
+func murmur2(data []byte) int32 {
+	const (
+		seed = 0x9747b28c
+		m    = 0x5bd1e995
+		r    = 24
+	)
+	n := len(data)
+	h := uint32(seed) ^ uint32(n)
+	for i := 0; i+4 <= n; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+	tail := data[n&^3:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
@@ -0,0 +1,189 @@
+package kafka
+
+import (
+	"bytes"
+	"testing"
+)
+
+// recordBatch holds a record batch as encoded by appendRecordBatch,
+// checked by decoding it with another Kafka client implementation.
+const recordBatch = "" +
+	// Base offset, batch length, partition leader epoch and magic.
+	"\x00\x00\x00\x00\x00\x00\x00\x00" + "\x00\x00\x00M" + "\xff\xff\xff\xff" + "\x02" +
+	// CRC-32C of the rest of the batch.
+	"\x89#\x16\x92" +
+	// Attributes and last offset delta.
+	"\x00\x00" + "\x00\x00\x00\x02" +
+	// First and max timestamps.
+	"\x00\x00\x01o^f\xe8\x00" + "\x00\x00\x01o^f\xe8\x00" +
+	// Producer id, producer epoch and base sequence.
+	"\xff\xff\xff\xff\xff\xff\xff\xff" + "\xff\xff" + "\xff\xff\xff\xff" +
+	// Record count.
+	"\x00\x00\x00\x03" +
+	// Records: length, attributes, timestamp delta, offset delta,
+	// key, value and header count, with varints zigzag-encoded.
+	"\x1a" + "\x00" + "\x00" + "\x00" + "\x04k1" + "\nhello" + "\x00" +
+	"\f" + "\x00" + "\x00" + "\x02" + "\x01" + "\x00" + "\x00" +
+	"\f" + "\x00" + "\x00" + "\x04" + "\x00" + "\x01" + "\x00"
+
+func TestAppendRecordBatch(t *testing.T) {
+	msgs := []Message{{
+		Key:   []byte("k1"),
+		Value: []byte("hello"),
+	}, {
+		Value: []byte{},
+	}, {
+		Key: []byte{},
+	}}
+	got := appendRecordBatch([]byte("x"), msgs, 1577836800000)
+	if want := "x" + recordBatch; !bytes.Equal(got, []byte(want)) {
+		t.Errorf("unexpected record batch; got %q want %q", got, want)
+	}
+}
+
+var encoderTests = []struct {
+	testName string
+	encode   func(e *encoder)
+	expect   string
+}{{
+	testName: "int16",
+	encode:   func(e *encoder) { e.int16(-2) },
+	expect:   "\xff\xfe",
+}, {
+	testName: "int64",
+	encode:   func(e *encoder) { e.int64(0x0102030405060708) },
+	expect:   "\x01\x02\x03\x04\x05\x06\x07\x08",
+}, {
+	testName: "string",
+	encode:   func(e *encoder) { e.string("abc") },
+	expect:   "\x00\x03abc",
+}, {
+	testName: "null-string",
+	encode:   func(e *encoder) { e.nullString() },
+	expect:   "\xff\xff",
+}, {
+	testName: "bytes",
+	encode:   func(e *encoder) { e.bytes([]byte("ab")) },
+	expect:   "\x00\x00\x00\x02ab",
+}, {
+	testName: "varint",
+	encode: func(e *encoder) {
+		e.varint(0)
+		e.varint(-1)
+		e.varint(1)
+		e.varint(-64)
+		e.varint(64)
+		e.varint(300)
+	},
+	expect: "\x00\x01\x02\x7f\x80\x01\xd8\x04",
+}, {
+	testName: "var-bytes",
+	encode: func(e *encoder) {
+		e.varBytes(nil)
+		e.varBytes([]byte{})
+		e.varBytes([]byte("ab"))
+	},
+	expect: "\x01\x00\x04ab",
+}}
+
+func TestEncoder(t *testing.T) {
+	for _, test := range encoderTests {
+		t.Run(test.testName, func(t *testing.T) {
+			var e encoder
+			test.encode(&e)
+			if got := string(e.buf); got != test.expect {
+				t.Errorf("unexpected encoding; got %q want %q", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	d := &decoder{
+		buf: []byte("\x00\x00\x00\x02" + "\x00\x03abc" + "\xff\xff" + "\x00\x07"),
+	}
+	if got := d.arrayLen(); got != 2 {
+		t.Errorf("unexpected array length %d", got)
+	}
+	if got := d.string(); got != "abc" {
+		t.Errorf("unexpected string %q", got)
+	}
+	if got := d.string(); got != "" {
+		t.Errorf("unexpected null string %q", got)
+	}
+	if d.err != nil {
+		t.Fatalf("unexpected error: %v", d.err)
+	}
+	if got := d.int32(); got != 0 {
+		t.Errorf("unexpected value %d from truncated input", got)
+	}
+	if d.err == nil || d.err.Error() != "truncated response" {
+		t.Errorf("unexpected error %v", d.err)
+	}
+}
+
+// The hashes are those in the Java client's tests for
+// its murmur2 implementation.
+var murmur2Tests = []struct {
+	key    string
+	expect int32
+}{
+	{"21", -973932308},
+	{"foobar", -790332482},
+	{"a-little-bit-long-string", -985981536},
+	{"a-little-bit-longer-string", -1486304829},
+	{"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8", -58897971},
+	{"abc", 479470107},
+}
+
+func TestMurmur2(t *testing.T) {
+	for _, test := range murmur2Tests {
+		if got := murmur2([]byte(test.key)); got != test.expect {
+			t.Errorf("murmur2(%q): got %d want %d", test.key, got, test.expect)
+		}
+	}
+}
+
+func TestKeyPartition(t *testing.T) {
+	for _, test := range murmur2Tests {
+		for _, n := range []int{1, 3, 7, 100} {
+			// The Java client's default partitioner masks off
+			// the sign bit of the hash.
+			want := int(test.expect&0x7fffffff) % n
+			if got := keyPartition([]byte(test.key), n); got != want {
+				t.Errorf("keyPartition(%q, %d): got %d want %d", test.key, n, got, want)
+			}
+		}
+	}
+	if got := keyPartition([]byte("foobar"), 7); got != 0 {
+		t.Errorf("unexpected partition %d for foobar", got)
+	}
+	if got := keyPartition([]byte("21"), 7); got != 3 {
+		t.Errorf("unexpected partition %d for 21", got)
+	}
+}
+
+func TestPartitionsByLeader(t *testing.T) {
+	pending := map[int32][]Message{
+		0: nil,
+		1: nil,
+		2: nil,
+		3: nil,
+	}
+	got := partitionsByLeader(pending, []int32{5, 6, 5, 5})
+	if len(got) != 2 || !equalInt32s(got[5], []int32{0, 2, 3}) || !equalInt32s(got[6], []int32{1}) {
+		t.Errorf("unexpected partitions by leader %v", got)
+	}
+}
+
+func equalInt32s(a, b []int32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,60 @@
+// Package lineprotocol implements the escaping rules of the
+// InfluxDB line protocol.
+//
+// See https://docs.influxdata.com/influxdb/v2/reference/syntax/line-protocol/#special-characters
+package lineprotocol
+
+import (
+	"strings"
+)
+
+// Two contiguous backslashes are interpreted as a single literal
+// backslash in every element of a line, so escaping backslashes
+// everywhere means that a backslash can never be mistaken for
+// the start of another escape sequence, even when it is the last
+// character of an element.
+//
+// Line protocol has no way of representing a newline or carriage
+// return outside of a string field, so they are replaced by \n and
+// \r sequences, which read back as literal text. String fields may
+// hold them unescaped, so a point can span more than one line; use
+// LineEnd or ScanLines to split line protocol into points.
+var (
+	measurementEscaper = strings.NewReplacer(
+		`\`, `\\`,
+		`,`, `\,`,
+		` `, `\ `,
+		"\n", `\n`,
+		"\r", `\r`,
+	)
+	keyEscaper = strings.NewReplacer(
+		`\`, `\\`,
+		`,`, `\,`,
+		`=`, `\=`,
+		` `, `\ `,
+		"\n", `\n`,
+		"\r", `\r`,
+	)
+	stringFieldEscaper = strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+	)
+)
+
+// Measurement returns s escaped for use as a measurement name.
+// Equals signs do not need escaping in measurement names.
+func Measurement(s string) string {
+	return measurementEscaper.Replace(s)
+}
+
+// Key returns s escaped for use as a tag key, tag value
+// or field key.
+func Key(s string) string {
+	return keyEscaper.Replace(s)
+}
+
+// StringField returns s escaped for use inside the double
+// quotes of a string field value.
+func StringField(s string) string {
+	return stringFieldEscaper.Replace(s)
+}
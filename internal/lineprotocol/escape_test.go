@@ -0,0 +1,130 @@
+package lineprotocol
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+var escapeTests = []struct {
+	testName string
+	s        string
+	// measurement, key and stringField hold the expected
+	// results of Measurement, Key and StringField.
+	measurement string
+	key         string
+	stringField string
+	// lossy is true if the escaped text does not
+	// read back as s outside a string field.
+	lossy bool
+}{{
+	testName:    "plain",
+	s:           "cpu",
+	measurement: "cpu",
+	key:         "cpu",
+	stringField: "cpu",
+}, {
+	testName:    "comma",
+	s:           "a,b",
+	measurement: `a\,b`,
+	key:         `a\,b`,
+	stringField: "a,b",
+}, {
+	testName:    "space",
+	s:           "a b",
+	measurement: `a\ b`,
+	key:         `a\ b`,
+	stringField: "a b",
+}, {
+	testName:    "equals",
+	s:           "a=b",
+	measurement: "a=b",
+	key:         `a\=b`,
+	stringField: "a=b",
+}, {
+	testName:    "backslash",
+	s:           `a\b`,
+	measurement: `a\\b`,
+	key:         `a\\b`,
+	stringField: `a\\b`,
+}, {
+	testName:    "trailing-backslash",
+	s:           `a\`,
+	measurement: `a\\`,
+	key:         `a\\`,
+	stringField: `a\\`,
+}, {
+	testName:    "escaped-space",
+	s:           `a\ b`,
+	measurement: `a\\\ b`,
+	key:         `a\\\ b`,
+	stringField: `a\\ b`,
+}, {
+	testName:    "quotes",
+	s:           `"a"`,
+	measurement: `"a"`,
+	key:         `"a"`,
+	stringField: `\"a\"`,
+}, {
+	testName:    "newline",
+	s:           "a\nb\r",
+	measurement: `a\nb\r`,
+	key:         `a\nb\r`,
+	stringField: "a\nb\r",
+	lossy:       true,
+}, {
+	testName:    "all",
+	s:           "x, =\\\"\ny",
+	measurement: `x\,\ =\\"\ny`,
+	key:         `x\,\ \=\\"\ny`,
+	stringField: "x, =\\\\\\\"\ny",
+	lossy:       true,
+}}
+
+func TestEscape(t *testing.T) {
+	for _, test := range escapeTests {
+		t.Run(test.testName, func(t *testing.T) {
+			if got := Measurement(test.s); got != test.measurement {
+				t.Errorf("Measurement(%q) = %q; want %q", test.s, got, test.measurement)
+			}
+			if got := Key(test.s); got != test.key {
+				t.Errorf("Key(%q) = %q; want %q", test.s, got, test.key)
+			}
+			if got := StringField(test.s); got != test.stringField {
+				t.Errorf("StringField(%q) = %q; want %q", test.s, got, test.stringField)
+			}
+		})
+	}
+}
+
+func TestEscapeRoundTrip(t *testing.T) {
+	for _, test := range escapeTests {
+		t.Run(test.testName, func(t *testing.T) {
+			line := fmt.Sprintf(`%s,%s=%s %s="%s",x=1i 123`,
+				Measurement(test.s),
+				Key(test.s), Key(test.s),
+				Key(test.s), StringField(test.s),
+			)
+			p, ok, err := ParseLine([]byte(line))
+			if err != nil || !ok {
+				t.Fatalf("cannot parse %q: %v", line, err)
+			}
+			if got := p.Fields[0].Value; got != test.s {
+				t.Errorf("string field in %q reads as %q; want %q", line, got, test.s)
+			}
+			if test.lossy {
+				return
+			}
+			want := Point{
+				Measurement: test.s,
+				Tags:        []Tag{{test.s, test.s}},
+				Fields:      []Field{{test.s, test.s}, {"x", int64(1)}},
+				Time:        123,
+				HasTime:     true,
+			}
+			if !reflect.DeepEqual(p, want) {
+				t.Errorf("%q parses as %#v; want %#v", line, p, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package lineprotocol
+
+import "bytes"
+
+// LineEnd returns the index of the newline that terminates the first
+// line of data, or -1 if the line is incomplete. Unlike a plain
+// search for a newline, it skips newlines inside string field values.
+func LineEnd(data []byte) int {
+	if len(data) > 0 && data[0] == '#' {
+		// Comments end at the first newline.
+		return bytes.IndexByte(data, '\n')
+	}
+	// section is 0 in the measurement and tag set,
+	// 1 in the field set and 2 in the timestamp.
+	section := 0
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; {
+		case c == '\n':
+			return i
+		case c == '\\' && section < 2:
+			// Skip the escaped character, unless it's
+			// a newline, which cannot be escaped.
+			if i+1 < len(data) && data[i+1] != '\n' {
+				i++
+			}
+		case c == ' ' && section < 2:
+			section++
+		case section == 1 && c == '=':
+			// Field values that start with a double
+			// quote are strings.
+			if i+1 < len(data) && data[i+1] == '"' {
+				end := stringEnd(data[i+2:])
+				if end < 0 {
+					return -1
+				}
+				i += 2 + end
+			}
+		}
+	}
+	return -1
+}
+
+// stringEnd returns the index of the double quote that
+// ends the string field value at the start of data,
+// or -1 if there is none.
+func stringEnd(data []byte) int {
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// ScanLines is a bufio.SplitFunc that splits line protocol into
+// lines, each holding one point, as determined by LineEnd. The
+// terminating newlines are not included.
+func ScanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := LineEnd(data); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,87 @@
+package lineprotocol
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var lineEndTests = []struct {
+	testName string
+	data     string
+	want     int
+}{{
+	testName: "simple",
+	data:     "m f=1 1\nm f=2 2\n",
+	want:     7,
+}, {
+	testName: "incomplete",
+	data:     "m f=1 1",
+	want:     -1,
+}, {
+	testName: "newline-in-string",
+	data:     "m f=\"a\nb\" 1\nm f=2\n",
+	want:     11,
+}, {
+	testName: "escaped-quote-in-string",
+	data:     "m f=\"a\\\"\nb\" 1\n",
+	want:     13,
+}, {
+	testName: "backslash-ending-string",
+	data:     "m f=\"a\\\\\" 1\nm f=2\n",
+	want:     11,
+}, {
+	testName: "unterminated-string",
+	data:     "m f=\"a\n",
+	want:     -1,
+}, {
+	testName: "quote-in-measurement-and-tags",
+	data:     "\"m,t=\"x f=1\n",
+	want:     11,
+}, {
+	testName: "escaped-space-in-measurement",
+	data:     "m\\ x,t=\"a f=\"b\nc\"\n",
+	want:     17,
+}, {
+	testName: "quote-in-field-key",
+	data:     "m \"f\"=1,g=\"x\ny\"\n",
+	want:     15,
+}, {
+	testName: "second-string-field",
+	data:     "m f=1,g=\"x\ny\",h=\"\n\" 1\n",
+	want:     21,
+}, {
+	testName: "comment",
+	data:     "# a b=\"c\nm f=1\n",
+	want:     8,
+}}
+
+func TestLineEnd(t *testing.T) {
+	for _, test := range lineEndTests {
+		t.Run(test.testName, func(t *testing.T) {
+			if got := LineEnd([]byte(test.data)); got != test.want {
+				t.Errorf("LineEnd(%q) = %d; want %d", test.data, got, test.want)
+			}
+		})
+	}
+}
+
+func TestScanLines(t *testing.T) {
+	input := "m f=\"a\nb\" 1\n\nm,t=x g=2i 2\r\nm f=\"\n\""
+	scanner := bufio.NewScanner(strings.NewReader(input))
+	// Use a small buffer so that lines are split across reads.
+	scanner.Buffer(make([]byte, 4), 100)
+	scanner.Split(ScanLines)
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"m f=\"a\nb\" 1", "", "m,t=x g=2i 2\r", "m f=\"\n\""}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("got lines %q; want %q", lines, want)
+	}
+}
@@ -0,0 +1,175 @@
+package lineprotocol
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// Point holds a point parsed from a line of line protocol.
+type Point struct {
+	Measurement string
+	Tags        []Tag
+	Fields      []Field
+	// Time holds the timestamp of the point, in units
+	// of the precision of the input. It is only valid
+	// if HasTime is true.
+	Time    int64
+	HasTime bool
+}
+
+// Tag holds a tag key and value.
+type Tag struct {
+	Key   string
+	Value string
+}
+
+// Field holds a field key and its value, which may be of type
+// float64, int64, uint64, bool or string.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// ParseLine parses a single line of line protocol, as returned
+// by ScanLines, which should not include the terminating newline.
+// It returns false if the line is empty or a comment.
+func ParseLine(line []byte) (Point, bool, error) {
+	line = bytes.TrimRight(line, "\r")
+	if len(bytes.TrimSpace(line)) == 0 || line[0] == '#' {
+		return Point{}, false, nil
+	}
+	var p Point
+	p.Measurement, line = scanElement(line, ", ", measurementUnescapes)
+	if p.Measurement == "" {
+		return Point{}, false, fmt.Errorf("missing measurement")
+	}
+	for len(line) > 0 && line[0] == ',' {
+		var key, value string
+		key, line = scanElement(line[1:], "=", keyUnescapes)
+		if len(line) == 0 {
+			return Point{}, false, fmt.Errorf("missing value for tag %q", key)
+		}
+		value, line = scanElement(line[1:], ", ", keyUnescapes)
+		if key == "" || value == "" {
+			return Point{}, false, fmt.Errorf("empty tag key or value")
+		}
+		p.Tags = append(p.Tags, Tag{key, value})
+	}
+	if len(line) == 0 || line[0] != ' ' {
+		return Point{}, false, fmt.Errorf("missing fields")
+	}
+	line = line[1:]
+	for {
+		var key string
+		key, line = scanElement(line, "=", keyUnescapes)
+		if key == "" || len(line) == 0 {
+			return Point{}, false, fmt.Errorf("invalid field")
+		}
+		var value interface{}
+		var err error
+		value, line, err = scanFieldValue(line[1:])
+		if err != nil {
+			return Point{}, false, fmt.Errorf("invalid value for field %q: %v", key, err)
+		}
+		p.Fields = append(p.Fields, Field{key, value})
+		if len(line) == 0 || line[0] != ',' {
+			break
+		}
+		line = line[1:]
+	}
+	if len(line) == 0 {
+		return p, true, nil
+	}
+	if line[0] != ' ' {
+		return Point{}, false, fmt.Errorf("unexpected text after fields")
+	}
+	ts := bytes.TrimSpace(line)
+	if len(ts) == 0 {
+		return p, true, nil
+	}
+	t, err := strconv.ParseInt(string(ts), 10, 64)
+	if err != nil {
+		return Point{}, false, fmt.Errorf("invalid timestamp %q", ts)
+	}
+	p.Time, p.HasTime = t, true
+	return p, true, nil
+}
+
+var (
+	measurementUnescapes = `\, `
+	keyUnescapes         = `\,= `
+)
+
+// scanElement scans an element of line up to the first unescaped
+// character in terminators and returns the unescaped element and
+// the rest of the line. A backslash followed by one of the
+// characters in unescapes stands for that character; any other
+// backslash is taken literally.
+func scanElement(line []byte, terminators, unescapes string) (string, []byte) {
+	var buf []byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if c == '\\' && i+1 < len(line) && bytes.IndexByte([]byte(unescapes), line[i+1]) >= 0 {
+			buf = append(buf, line[i+1])
+			i++
+			continue
+		}
+		if bytes.IndexByte([]byte(terminators), c) >= 0 {
+			return string(buf), line[i:]
+		}
+		buf = append(buf, c)
+	}
+	return string(buf), nil
+}
+
+// scanFieldValue scans a field value from the start of line and
+// returns the value and the rest of the line.
+func scanFieldValue(line []byte) (interface{}, []byte, error) {
+	if len(line) > 0 && line[0] == '"' {
+		var buf []byte
+		for i := 1; i < len(line); i++ {
+			switch c := line[i]; c {
+			case '\\':
+				if i+1 < len(line) && (line[i+1] == '"' || line[i+1] == '\\') {
+					i++
+					c = line[i]
+				}
+				buf = append(buf, c)
+			case '"':
+				return string(buf), line[i+1:], nil
+			default:
+				buf = append(buf, c)
+			}
+		}
+		return nil, nil, fmt.Errorf("unterminated string")
+	}
+	end := bytes.IndexAny(line, ", ")
+	if end == -1 {
+		end = len(line)
+	}
+	s, rest := string(line[:end]), line[end:]
+	if s == "" {
+		return nil, nil, fmt.Errorf("empty value")
+	}
+	switch s {
+	case "t", "T", "true", "True", "TRUE":
+		return true, rest, nil
+	case "f", "F", "false", "False", "FALSE":
+		return false, rest, nil
+	}
+	var v interface{}
+	var err error
+	switch s[len(s)-1] {
+	case 'i':
+		v, err = strconv.ParseInt(s[:len(s)-1], 10, 64)
+	case 'u':
+		v, err = strconv.ParseUint(s[:len(s)-1], 10, 64)
+	default:
+		v, err = strconv.ParseFloat(s, 64)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid number %q", s)
+	}
+	return v, rest, nil
+}
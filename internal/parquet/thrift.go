@@ -0,0 +1,140 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Thrift compact protocol type identifiers.
+const (
+	thriftBoolTrue  = 1
+	thriftBoolFalse = 2
+	thriftByte      = 3
+	thriftI32       = 5
+	thriftI64       = 6
+	thriftBinary    = 8
+	thriftList      = 9
+	thriftStruct    = 12
+)
+
+// thriftWriter encodes Thrift structures using the compact
+// protocol, which is used for all Parquet metadata.
+// Only the features needed for Parquet metadata are implemented.
+type thriftWriter struct {
+	buf bytes.Buffer
+	// lastID holds the last field id written in each
+	// enclosing struct, innermost last.
+	lastID []int16
+}
+
+func newThriftWriter() *thriftWriter {
+	return &thriftWriter{
+		lastID: []int16{0},
+	}
+}
+
+func (w *thriftWriter) Bytes() []byte {
+	return w.buf.Bytes()
+}
+
+func (w *thriftWriter) fieldHeader(id int16, typ byte) {
+	last := &w.lastID[len(w.lastID)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		w.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		w.buf.WriteByte(typ)
+		w.varint(int64(id))
+	}
+	*last = id
+}
+
+func (w *thriftWriter) uvarint(x uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], x)
+	w.buf.Write(buf[:n])
+}
+
+// varint writes x in zigzag encoding.
+func (w *thriftWriter) varint(x int64) {
+	w.uvarint(uint64(x<<1) ^ uint64(x>>63))
+}
+
+func (w *thriftWriter) i32(id int16, x int32) {
+	w.fieldHeader(id, thriftI32)
+	w.varint(int64(x))
+}
+
+func (w *thriftWriter) i64(id int16, x int64) {
+	w.fieldHeader(id, thriftI64)
+	w.varint(x)
+}
+
+func (w *thriftWriter) byte(id int16, x int8) {
+	w.fieldHeader(id, thriftByte)
+	w.buf.WriteByte(byte(x))
+}
+
+func (w *thriftWriter) bool(id int16, x bool) {
+	if x {
+		w.fieldHeader(id, thriftBoolTrue)
+	} else {
+		w.fieldHeader(id, thriftBoolFalse)
+	}
+}
+
+func (w *thriftWriter) string(id int16, s string) {
+	w.fieldHeader(id, thriftBinary)
+	w.uvarint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+// beginStruct starts a struct-valued field. It must
+// be matched by a call to endStruct.
+func (w *thriftWriter) beginStruct(id int16) {
+	w.fieldHeader(id, thriftStruct)
+	w.lastID = append(w.lastID, 0)
+}
+
+func (w *thriftWriter) endStruct() {
+	w.buf.WriteByte(0)
+	w.lastID = w.lastID[:len(w.lastID)-1]
+}
+
+// emptyStruct writes a struct-valued field with no fields.
+func (w *thriftWriter) emptyStruct(id int16) {
+	w.beginStruct(id)
+	w.endStruct()
+}
+
+// beginList starts a list-valued field holding n elements
+// of the given type.
+func (w *thriftWriter) beginList(id int16, elemType byte, n int) {
+	w.fieldHeader(id, thriftList)
+	if n < 15 {
+		w.buf.WriteByte(byte(n)<<4 | elemType)
+	} else {
+		w.buf.WriteByte(0xf0 | elemType)
+		w.uvarint(uint64(n))
+	}
+}
+
+// beginListStruct starts a struct element of a list.
+// It must be matched by a call to endStruct.
+func (w *thriftWriter) beginListStruct() {
+	w.lastID = append(w.lastID, 0)
+}
+
+func (w *thriftWriter) i32List(id int16, xs []int32) {
+	w.beginList(id, thriftI32, len(xs))
+	for _, x := range xs {
+		w.varint(int64(x))
+	}
+}
+
+func (w *thriftWriter) stringList(id int16, ss []string) {
+	w.beginList(id, thriftBinary, len(ss))
+	for _, s := range ss {
+		w.uvarint(uint64(len(s)))
+		w.buf.WriteString(s)
+	}
+}
@@ -0,0 +1,604 @@
+// Package parquet implements a minimal writer for the Apache Parquet
+// file format, sufficient for writing flat tables holding the kinds of
+// value found in annotated CSV.
+//
+// All columns are written as optional (nullable) columns with a single
+// data page per column chunk. Values are PLAIN encoded, or dictionary
+// encoded for string columns that request it.
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// Kind represents the kind of value held in a column.
+type Kind int
+
+const (
+	// Boolean columns hold bool values.
+	Boolean Kind = iota
+	// Int64 columns hold int64 values.
+	Int64
+	// Uint64 columns hold uint64 values.
+	Uint64
+	// Double columns hold float64 values.
+	Double
+	// String columns hold string values.
+	String
+	// Timestamp columns hold time.Time values.
+	Timestamp
+)
+
+// Column describes a column in a Parquet file.
+type Column struct {
+	Name string
+	Kind Kind
+	// Dictionary specifies that a String column should
+	// be dictionary encoded, which is efficient when it holds
+	// few distinct values.
+	Dictionary bool
+}
+
+// Codec represents a compression codec.
+type Codec int
+
+const (
+	Uncompressed Codec = 0
+	Gzip         Codec = 2
+)
+
+// TimeUnit represents the unit used to store timestamps.
+type TimeUnit int
+
+const (
+	Nanos TimeUnit = iota
+	Micros
+	Millis
+)
+
+// Options holds options for a Writer.
+type Options struct {
+	// RowGroupRows holds the maximum number of rows in a
+	// row group. If it's zero, DefaultRowGroupRows is used.
+	RowGroupRows int
+	// Codec holds the compression codec used for pages.
+	Codec Codec
+	// TimeUnit holds the precision of stored timestamps.
+	TimeUnit TimeUnit
+	// CreatedBy is recorded in the file metadata.
+	CreatedBy string
+}
+
+// DefaultRowGroupRows holds the default maximum number
+// of rows in a row group.
+const DefaultRowGroupRows = 100000
+
+// Parquet enum values.
+const (
+	typeBoolean   = 0
+	typeInt64     = 2
+	typeDouble    = 5
+	typeByteArray = 6
+
+	repetitionOptional = 1
+
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+	convertedTimestampMicros = 10
+	convertedUint64          = 14
+	convertedInt64           = 18
+
+	encodingPlain         = 0
+	encodingRLE           = 3
+	encodingRLEDictionary = 8
+
+	pageData       = 0
+	pageDictionary = 2
+)
+
+var magic = []byte("PAR1")
+
+// Writer writes a Parquet file.
+type Writer struct {
+	w         io.Writer
+	offset    int64
+	cols      []Column
+	opts      Options
+	values    [][]interface{}
+	nrows     int
+	totalRows int64
+	rowGroups []rowGroup
+}
+
+type rowGroup struct {
+	chunks         []columnChunk
+	nrows          int
+	offset         int64
+	size           int64
+	compressedSize int64
+}
+
+type columnChunk struct {
+	numValues        int64
+	uncompressedSize int64
+	compressedSize   int64
+	dataPageOffset   int64
+	// dictPageOffset holds the offset of the
+	// dictionary page, or -1 if there is none.
+	dictPageOffset int64
+	encodings      []int32
+}
+
+// NewWriter returns a Writer that writes a Parquet file
+// with the given columns to w. The Close method must
+// be called to complete the file.
+func NewWriter(w io.Writer, cols []Column, opts Options) (*Writer, error) {
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("no columns")
+	}
+	if opts.RowGroupRows <= 0 {
+		opts.RowGroupRows = DefaultRowGroupRows
+	}
+	pw := &Writer{
+		w:      w,
+		cols:   cols,
+		opts:   opts,
+		values: make([][]interface{}, len(cols)),
+	}
+	if err := pw.write(magic); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+// WriteRow writes a row holding one value for each column.
+// A nil value represents a null.
+func (w *Writer) WriteRow(row []interface{}) error {
+	if len(row) != len(w.cols) {
+		return fmt.Errorf("wrong number of values in row; got %d want %d", len(row), len(w.cols))
+	}
+	for i, v := range row {
+		if v == nil {
+			continue
+		}
+		if !w.cols[i].Kind.holds(v) {
+			return fmt.Errorf("unexpected value type %T for column %q", v, w.cols[i].Name)
+		}
+	}
+	for i, v := range row {
+		w.values[i] = append(w.values[i], v)
+	}
+	w.nrows++
+	if w.nrows >= w.opts.RowGroupRows {
+		return w.flushRowGroup()
+	}
+	return nil
+}
+
+func (k Kind) holds(v interface{}) bool {
+	switch v.(type) {
+	case bool:
+		return k == Boolean
+	case int64:
+		return k == Int64
+	case uint64:
+		return k == Uint64
+	case float64:
+		return k == Double
+	case string:
+		return k == String
+	case time.Time:
+		return k == Timestamp
+	}
+	return false
+}
+
+// Close writes any buffered rows and the file footer.
+// It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.nrows > 0 {
+		if err := w.flushRowGroup(); err != nil {
+			return err
+		}
+	}
+	meta := w.fileMetadata()
+	if err := w.write(meta); err != nil {
+		return err
+	}
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(len(meta)))
+	if err := w.write(size[:]); err != nil {
+		return err
+	}
+	return w.write(magic)
+}
+
+func (w *Writer) write(data []byte) error {
+	n, err := w.w.Write(data)
+	w.offset += int64(n)
+	return err
+}
+
+// flushRowGroup writes all the buffered rows as a row group.
+func (w *Writer) flushRowGroup() error {
+	rg := rowGroup{
+		nrows:  w.nrows,
+		offset: w.offset,
+	}
+	for i, col := range w.cols {
+		chunk, err := w.writeChunk(col, w.values[i])
+		if err != nil {
+			return fmt.Errorf("cannot write column %q: %v", col.Name, err)
+		}
+		rg.chunks = append(rg.chunks, chunk)
+		rg.size += chunk.uncompressedSize
+		rg.compressedSize += chunk.compressedSize
+		w.values[i] = w.values[i][:0]
+	}
+	w.rowGroups = append(w.rowGroups, rg)
+	w.totalRows += int64(w.nrows)
+	w.nrows = 0
+	return nil
+}
+
+// writeChunk writes a column chunk holding the given values.
+func (w *Writer) writeChunk(col Column, vals []interface{}) (columnChunk, error) {
+	chunk := columnChunk{
+		numValues:      int64(len(vals)),
+		dictPageOffset: -1,
+		encodings:      []int32{encodingPlain, encodingRLE},
+	}
+	var page bytes.Buffer
+
+	// Definition levels: 1 for a value, 0 for a null.
+	levels := make([]uint32, len(vals))
+	for i, v := range vals {
+		if v != nil {
+			levels[i] = 1
+		}
+	}
+	var levelBuf bytes.Buffer
+	encodeHybrid(&levelBuf, levels, 1)
+	binary.Write(&page, binary.LittleEndian, uint32(levelBuf.Len()))
+	page.Write(levelBuf.Bytes())
+
+	encoding := int32(encodingPlain)
+	var dict []string
+	var indexes []uint32
+	if col.Kind == String && col.Dictionary {
+		dict, indexes = buildDictionary(vals)
+	}
+	if len(dict) > 0 {
+		var dictPage bytes.Buffer
+		for _, s := range dict {
+			encodePlain(&dictPage, Column{Kind: String}, []interface{}{s}, w.opts.TimeUnit)
+		}
+		chunk.dictPageOffset = w.offset
+		n, compressedSize, err := w.writePage(pageDictionary, dictPage.Bytes(), len(dict), encodingPlain)
+		if err != nil {
+			return columnChunk{}, err
+		}
+		chunk.uncompressedSize += n
+		chunk.compressedSize += compressedSize
+		bitWidth := bits.Len32(uint32(len(dict) - 1))
+		if bitWidth == 0 {
+			bitWidth = 1
+		}
+		page.WriteByte(byte(bitWidth))
+		encodeHybrid(&page, indexes, bitWidth)
+		encoding = encodingRLEDictionary
+		chunk.encodings = append(chunk.encodings, encodingRLEDictionary)
+	} else {
+		encodePlain(&page, col, vals, w.opts.TimeUnit)
+	}
+	chunk.dataPageOffset = w.offset
+	n, compressedSize, err := w.writePage(pageData, page.Bytes(), len(vals), encoding)
+	if err != nil {
+		return columnChunk{}, err
+	}
+	chunk.uncompressedSize += n
+	chunk.compressedSize += compressedSize
+	return chunk, nil
+}
+
+// writePage writes a page with the given type and uncompressed
+// contents. It returns the uncompressed and compressed sizes of the
+// page including its header.
+func (w *Writer) writePage(pageType int32, data []byte, numValues int, encoding int32) (int64, int64, error) {
+	compressed := data
+	if w.opts.Codec == Gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(data)
+		if err := zw.Close(); err != nil {
+			return 0, 0, err
+		}
+		compressed = buf.Bytes()
+	}
+	if len(data) > math.MaxInt32 || len(compressed) > math.MaxInt32 {
+		return 0, 0, fmt.Errorf("page too large")
+	}
+	tw := newThriftWriter()
+	tw.i32(1, pageType)
+	tw.i32(2, int32(len(data)))
+	tw.i32(3, int32(len(compressed)))
+	if pageType == pageDictionary {
+		tw.beginStruct(7)
+		tw.i32(1, int32(numValues))
+		tw.i32(2, encoding)
+		tw.endStruct()
+	} else {
+		tw.beginStruct(5)
+		tw.i32(1, int32(numValues))
+		tw.i32(2, encoding)
+		tw.i32(3, encodingRLE)
+		tw.i32(4, encodingRLE)
+		tw.endStruct()
+	}
+	tw.buf.WriteByte(0)
+	header := tw.Bytes()
+	if err := w.write(header); err != nil {
+		return 0, 0, err
+	}
+	if err := w.write(compressed); err != nil {
+		return 0, 0, err
+	}
+	return int64(len(header) + len(data)), int64(len(header) + len(compressed)), nil
+}
+
+// buildDictionary returns the distinct non-null values in vals
+// and the index into the dictionary of each non-null value.
+func buildDictionary(vals []interface{}) ([]string, []uint32) {
+	var dict []string
+	indexOf := make(map[string]uint32)
+	var indexes []uint32
+	for _, v := range vals {
+		if v == nil {
+			continue
+		}
+		s := v.(string)
+		index, ok := indexOf[s]
+		if !ok {
+			index = uint32(len(dict))
+			indexOf[s] = index
+			dict = append(dict, s)
+		}
+		indexes = append(indexes, index)
+	}
+	return dict, indexes
+}
+
+// encodePlain writes the non-null values in vals to buf using
+// the PLAIN encoding.
+func encodePlain(buf *bytes.Buffer, col Column, vals []interface{}, unit TimeUnit) {
+	var b [8]byte
+	if col.Kind == Boolean {
+		var packed []byte
+		n := 0
+		for _, v := range vals {
+			if v == nil {
+				continue
+			}
+			if n%8 == 0 {
+				packed = append(packed, 0)
+			}
+			if v.(bool) {
+				packed[n/8] |= 1 << (n % 8)
+			}
+			n++
+		}
+		buf.Write(packed)
+		return
+	}
+	for _, v := range vals {
+		switch v := v.(type) {
+		case int64:
+			binary.LittleEndian.PutUint64(b[:], uint64(v))
+			buf.Write(b[:])
+		case uint64:
+			binary.LittleEndian.PutUint64(b[:], v)
+			buf.Write(b[:])
+		case float64:
+			binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+			buf.Write(b[:])
+		case time.Time:
+			binary.LittleEndian.PutUint64(b[:], uint64(timestamp(v, unit)))
+			buf.Write(b[:])
+		case string:
+			binary.LittleEndian.PutUint32(b[:4], uint32(len(v)))
+			buf.Write(b[:4])
+			buf.WriteString(v)
+		}
+	}
+}
+
+func timestamp(t time.Time, unit TimeUnit) int64 {
+	switch unit {
+	case Millis:
+		return t.UnixNano() / 1e6
+	case Micros:
+		return t.UnixNano() / 1e3
+	}
+	return t.UnixNano()
+}
+
+// encodeHybrid writes vals to buf using the RLE/bit-packing hybrid
+// encoding with the given bit width. Runs of at least 8 equal values
+// are run-length encoded; other values are bit-packed in groups of 8.
+func encodeHybrid(buf *bytes.Buffer, vals []uint32, bitWidth int) {
+	var packed []uint32
+	flushPacked := func() {
+		if len(packed) == 0 {
+			return
+		}
+		// Only the final group may be incomplete;
+		// it is padded with zeros.
+		groups := (len(packed) + 7) / 8
+		for len(packed) < groups*8 {
+			packed = append(packed, 0)
+		}
+		putUvarint(buf, uint64(groups)<<1|1)
+		out := make([]byte, groups*bitWidth)
+		for i, v := range packed {
+			for b := 0; b < bitWidth; b++ {
+				if v&(1<<b) != 0 {
+					pos := i*bitWidth + b
+					out[pos/8] |= 1 << (pos % 8)
+				}
+			}
+		}
+		buf.Write(out)
+		packed = packed[:0]
+	}
+	valueBytes := (bitWidth + 7) / 8
+	for i := 0; i < len(vals); {
+		run := 1
+		for i+run < len(vals) && vals[i+run] == vals[i] {
+			run++
+		}
+		if run >= 8 {
+			flushPacked()
+			putUvarint(buf, uint64(run)<<1)
+			for b := 0; b < valueBytes; b++ {
+				buf.WriteByte(byte(vals[i] >> (8 * b)))
+			}
+			i += run
+			continue
+		}
+		end := i + 8
+		if end > len(vals) {
+			end = len(vals)
+		}
+		packed = append(packed, vals[i:end]...)
+		i = end
+	}
+	flushPacked()
+}
+
+func putUvarint(buf *bytes.Buffer, x uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], x)
+	buf.Write(b[:n])
+}
+
+// fileMetadata returns the encoded FileMetaData structure.
+func (w *Writer) fileMetadata() []byte {
+	tw := newThriftWriter()
+	tw.i32(1, 1)
+	tw.beginList(2, thriftStruct, len(w.cols)+1)
+	tw.beginListStruct()
+	tw.string(4, "schema")
+	tw.i32(5, int32(len(w.cols)))
+	tw.endStruct()
+	for _, col := range w.cols {
+		tw.beginListStruct()
+		w.schemaElement(tw, col)
+		tw.endStruct()
+	}
+	tw.i64(3, w.totalRows)
+	tw.beginList(4, thriftStruct, len(w.rowGroups))
+	for _, rg := range w.rowGroups {
+		tw.beginListStruct()
+		tw.beginList(1, thriftStruct, len(rg.chunks))
+		for i, chunk := range rg.chunks {
+			tw.beginListStruct()
+			firstPage := chunk.dataPageOffset
+			if chunk.dictPageOffset >= 0 {
+				firstPage = chunk.dictPageOffset
+			}
+			tw.i64(2, firstPage)
+			tw.beginStruct(3)
+			tw.i32(1, physicalType(w.cols[i].Kind))
+			tw.i32List(2, chunk.encodings)
+			tw.stringList(3, []string{w.cols[i].Name})
+			tw.i32(4, int32(w.opts.Codec))
+			tw.i64(5, chunk.numValues)
+			tw.i64(6, chunk.uncompressedSize)
+			tw.i64(7, chunk.compressedSize)
+			tw.i64(9, chunk.dataPageOffset)
+			if chunk.dictPageOffset >= 0 {
+				tw.i64(11, chunk.dictPageOffset)
+			}
+			tw.endStruct()
+			tw.endStruct()
+		}
+		tw.i64(2, rg.size)
+		tw.i64(3, int64(rg.nrows))
+		tw.i64(5, rg.offset)
+		tw.i64(6, rg.compressedSize)
+		tw.endStruct()
+	}
+	if w.opts.CreatedBy != "" {
+		tw.string(6, w.opts.CreatedBy)
+	}
+	tw.buf.WriteByte(0)
+	return tw.Bytes()
+}
+
+// schemaElement writes the fields of the SchemaElement
+// describing col.
+func (w *Writer) schemaElement(tw *thriftWriter, col Column) {
+	tw.i32(1, physicalType(col.Kind))
+	tw.i32(3, repetitionOptional)
+	tw.string(4, col.Name)
+	switch col.Kind {
+	case String:
+		tw.i32(6, convertedUTF8)
+		tw.beginStruct(10)
+		tw.emptyStruct(1)
+		tw.endStruct()
+	case Int64, Uint64:
+		converted := int32(convertedInt64)
+		if col.Kind == Uint64 {
+			converted = convertedUint64
+		}
+		tw.i32(6, converted)
+		tw.beginStruct(10)
+		tw.beginStruct(10)
+		tw.byte(1, 64)
+		tw.bool(2, col.Kind == Int64)
+		tw.endStruct()
+		tw.endStruct()
+	case Timestamp:
+		switch w.opts.TimeUnit {
+		case Millis:
+			tw.i32(6, convertedTimestampMillis)
+		case Micros:
+			tw.i32(6, convertedTimestampMicros)
+		}
+		tw.beginStruct(10)
+		tw.beginStruct(8)
+		tw.bool(1, true)
+		tw.beginStruct(2)
+		switch w.opts.TimeUnit {
+		case Millis:
+			tw.emptyStruct(1)
+		case Micros:
+			tw.emptyStruct(2)
+		default:
+			tw.emptyStruct(3)
+		}
+		tw.endStruct()
+		tw.endStruct()
+		tw.endStruct()
+	}
+}
+
+func physicalType(k Kind) int32 {
+	switch k {
+	case Boolean:
+		return typeBoolean
+	case Int64, Uint64, Timestamp:
+		return typeInt64
+	case Double:
+		return typeDouble
+	}
+	return typeByteArray
+}
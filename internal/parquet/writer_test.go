@@ -0,0 +1,186 @@
+package parquet
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+var allKindsColumns = []Column{
+	{Name: "b", Kind: Boolean},
+	{Name: "i", Kind: Int64},
+	{Name: "u", Kind: Uint64},
+	{Name: "d", Kind: Double},
+	{Name: "s", Kind: String},
+	{Name: "t", Kind: Timestamp},
+}
+
+var t0 = time.Date(2020, 1, 1, 0, 0, 0, 123456789, time.UTC)
+
+// allKindsRows returns n rows for allKindsColumns,
+// each with a null in a different column.
+func allKindsRows(n int) [][]interface{} {
+	rows := make([][]interface{}, n)
+	for i := range rows {
+		row := []interface{}{
+			i%2 == 0,
+			int64(i) - 5,
+			math.MaxUint64 - uint64(i),
+			float64(i) / 4,
+			fmt.Sprintf("value %d", i),
+			t0.Add(time.Duration(i) * time.Hour),
+		}
+		row[i%len(row)] = nil
+		rows[i] = row
+	}
+	return rows
+}
+
+// The golden files in testdata were checked by reading them with
+// the Apache Arrow Go Parquet reader. Run the tests with -update
+// to rewrite them after changing the writer, and check them again.
+var goldenTests = []struct {
+	testName string
+	cols     []Column
+	rows     [][]interface{}
+	opts     Options
+}{{
+	testName: "all-kinds",
+	cols:     allKindsColumns,
+	rows:     allKindsRows(10),
+	opts: Options{
+		TimeUnit:  Micros,
+		CreatedBy: "annotatedcsv test",
+	},
+}, {
+	testName: "row-groups",
+	cols:     allKindsColumns,
+	rows:     allKindsRows(25),
+	opts: Options{
+		RowGroupRows: 10,
+		TimeUnit:     Nanos,
+	},
+}, {
+	testName: "gzip",
+	cols:     allKindsColumns,
+	rows:     allKindsRows(10),
+	opts: Options{
+		Codec:    Gzip,
+		TimeUnit: Millis,
+	},
+}, {
+	testName: "dictionary",
+	cols: []Column{
+		{Name: "host", Kind: String, Dictionary: true},
+		{Name: "region", Kind: String, Dictionary: true},
+		{Name: "empty", Kind: String, Dictionary: true},
+	},
+	rows: func() [][]interface{} {
+		// The hosts change every row, which uses bit-packing,
+		// and the regions change rarely, which uses runs.
+		rows := make([][]interface{}, 30)
+		for i := range rows {
+			var host interface{} = fmt.Sprintf("host%d", i%5)
+			if i%7 == 3 {
+				host = nil
+			}
+			rows[i] = []interface{}{host, fmt.Sprintf("region%d", i/12), nil}
+		}
+		return rows
+	}(),
+}}
+
+func TestGolden(t *testing.T) {
+	for _, test := range goldenTests {
+		t.Run(test.testName, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewWriter(&buf, test.cols, test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, row := range test.rows {
+				if err := w.WriteRow(row); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			file := filepath.Join("testdata", test.testName+".parquet")
+			if *update {
+				if err := ioutil.WriteFile(file, buf.Bytes(), 0666); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("output differs from %s", file)
+			}
+		})
+	}
+}
+
+var encodeHybridTests = []struct {
+	testName string
+	vals     []uint32
+	bitWidth int
+	expect   string
+}{{
+	testName: "run",
+	vals:     []uint32{1, 1, 1, 1, 1, 1, 1, 1, 1, 1},
+	bitWidth: 1,
+	expect:   "\x14\x01",
+}, {
+	testName: "packed",
+	vals:     []uint32{1, 0, 1, 1, 0},
+	bitWidth: 1,
+	expect:   "\x03\x0d",
+}, {
+	testName: "packed-then-run",
+	vals:     []uint32{0, 1, 2, 3, 4, 5, 6, 7, 3, 3, 3, 3, 3, 3, 3, 3},
+	bitWidth: 3,
+	expect:   "\x03\x88\xc6\xfa" + "\x10\x03",
+}, {
+	testName: "wide-run",
+	vals:     []uint32{300, 300, 300, 300, 300, 300, 300, 300},
+	bitWidth: 9,
+	expect:   "\x10\x2c\x01",
+}}
+
+func TestEncodeHybrid(t *testing.T) {
+	for _, test := range encodeHybridTests {
+		t.Run(test.testName, func(t *testing.T) {
+			var buf bytes.Buffer
+			encodeHybrid(&buf, test.vals, test.bitWidth)
+			if got := buf.String(); got != test.expect {
+				t.Errorf("unexpected encoding; got %q want %q", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestWriteRowError(t *testing.T) {
+	w, err := NewWriter(ioutil.Discard, allKindsColumns[:2], Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.WriteRow([]interface{}{true})
+	if want := "wrong number of values in row; got 1 want 2"; err == nil || err.Error() != want {
+		t.Errorf("unexpected error; got %v want %q", err, want)
+	}
+	err = w.WriteRow([]interface{}{true, "x"})
+	if want := `unexpected value type string for column "i"`; err == nil || err.Error() != want {
+		t.Errorf("unexpected error; got %v want %q", err, want)
+	}
+}
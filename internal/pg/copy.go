@@ -0,0 +1,88 @@
+package pg
+
+import (
+	"fmt"
+)
+
+// copyChunkSize holds the amount of data sent
+// in each CopyData message.
+const copyChunkSize = 64 * 1024
+
+// Copy is an io.WriteCloser that sends data to the server
+// for a COPY ... FROM STDIN statement.
+type Copy struct {
+	conn *Conn
+	buf  []byte
+}
+
+// CopyIn starts the given COPY ... FROM STDIN statement.
+// The data written to the returned Copy is sent to the server;
+// the statement completes when it is closed. Errors in the data
+// are reported by Close.
+func (c *Conn) CopyIn(query string) (*Copy, error) {
+	if err := c.sendMessage('Q', cstring(query)); err != nil {
+		return nil, err
+	}
+	var firstErr error
+	for {
+		typ, data, err := c.readMessage()
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case 'E':
+			if firstErr == nil {
+				firstErr = parseError(data)
+			}
+		case 'G':
+			return &Copy{conn: c}, nil
+		case 'Z':
+			if firstErr == nil {
+				firstErr = fmt.Errorf("statement is not COPY FROM STDIN")
+			}
+			return nil, firstErr
+		}
+	}
+}
+
+// Write implements io.Writer.
+func (cp *Copy) Write(p []byte) (int, error) {
+	cp.buf = append(cp.buf, p...)
+	if len(cp.buf) >= copyChunkSize {
+		if err := cp.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (cp *Copy) flush() error {
+	if len(cp.buf) == 0 {
+		return nil
+	}
+	err := cp.conn.sendMessage('d', cp.buf)
+	cp.buf = cp.buf[:0]
+	return err
+}
+
+// Close sends any remaining data and waits for the statement
+// to complete, returning any error from the server.
+func (cp *Copy) Close() error {
+	if err := cp.flush(); err != nil {
+		return err
+	}
+	if err := cp.conn.sendMessage('c', nil); err != nil {
+		return err
+	}
+	return cp.conn.waitReady(nil)
+}
+
+// Abort abandons the COPY statement, causing it to
+// fail with the given message.
+func (cp *Copy) Abort(msg string) error {
+	if err := cp.conn.sendMessage('f', cstring(msg)); err != nil {
+		return err
+	}
+	cp.conn.waitReady(nil)
+	return nil
+}
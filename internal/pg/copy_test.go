@@ -0,0 +1,91 @@
+package pg
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestCopyIn(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	c := &Conn{
+		conn: client,
+		r:    bufio.NewReader(client),
+		w:    bufio.NewWriter(client),
+	}
+	received := make(chan []byte, 1)
+	go func() {
+		defer server.Close()
+		var got []byte
+		readMsg := func() byte {
+			hdr := make([]byte, 5)
+			if _, err := io.ReadFull(server, hdr); err != nil {
+				return 0
+			}
+			n := int(hdr[1])<<24 | int(hdr[2])<<16 | int(hdr[3])<<8 | int(hdr[4])
+			body := make([]byte, n-4)
+			io.ReadFull(server, body)
+			got = append(append(got, hdr...), body...)
+			return hdr[0]
+		}
+		if readMsg() != 'Q' {
+			received <- got
+			return
+		}
+		// CopyInResponse: binary format, one column.
+		server.Write([]byte("G\x00\x00\x00\x09\x01\x00\x01\x00\x01"))
+		for {
+			typ := readMsg()
+			if typ == 'c' || typ == 0 {
+				break
+			}
+		}
+		server.Write([]byte("C\x00\x00\x00\x0bCOPY 1\x00"))
+		server.Write([]byte("Z\x00\x00\x00\x05I"))
+		received <- got
+	}()
+	cp, err := c.CopyIn("COPY t FROM STDIN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(cp, "ab"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(cp, "c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cp.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte("" +
+		"Q\x00\x00\x00\x16COPY t FROM STDIN\x00" +
+		"d\x00\x00\x00\x07abc" +
+		"c\x00\x00\x00\x04")
+	if got := <-received; !bytes.Equal(got, want) {
+		t.Errorf("unexpected messages; got %q want %q", got, want)
+	}
+}
+
+func TestCopyInError(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	c := &Conn{
+		conn: client,
+		r:    bufio.NewReader(client),
+		w:    bufio.NewWriter(client),
+	}
+	go func() {
+		defer server.Close()
+		io.ReadFull(server, make([]byte, 5+len("SELECT 1\x00")))
+		server.Write([]byte("E\x00\x00\x00\x1eSERROR\x00C42601\x00Mbad query\x00\x00"))
+		server.Write([]byte("Z\x00\x00\x00\x05I"))
+	}()
+	_, err := c.CopyIn("SELECT 1")
+	want := "ERROR: bad query (SQLSTATE 42601)"
+	if err == nil || err.Error() != want {
+		t.Fatalf("unexpected error; got %v want %q", err, want)
+	}
+}
@@ -0,0 +1,126 @@
+package pg
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// scramClient implements the client side of SCRAM-SHA-256
+// authentication (RFC 7677), without channel binding.
+type scramClient struct {
+	// user holds the user name sent in the client-first
+	// message. The server ignores it in favour of the one
+	// in the startup message, so it is usually empty.
+	user            string
+	password        string
+	nonce           string
+	clientFirstBare string
+
+	// authMessage and saltedPassword are set by clientFinal.
+	authMessage    string
+	saltedPassword []byte
+}
+
+func newSCRAMClient(password string) (*scramClient, error) {
+	buf := make([]byte, 18)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	return &scramClient{
+		password: password,
+		nonce:    base64.StdEncoding.EncodeToString(buf),
+	}, nil
+}
+
+// clientFirst returns the client-first message.
+func (c *scramClient) clientFirst() []byte {
+	c.clientFirstBare = "n=" + c.user + ",r=" + c.nonce
+	return []byte("n,," + c.clientFirstBare)
+}
+
+// clientFinal returns the client-final message in response
+// to the given server-first message.
+func (c *scramClient) clientFinal(serverFirst []byte) ([]byte, error) {
+	attrs := scramAttrs(string(serverFirst))
+	nonce, salt64, iter := attrs["r"], attrs["s"], attrs["i"]
+	if !strings.HasPrefix(nonce, c.nonce) || len(nonce) == len(c.nonce) {
+		return nil, fmt.Errorf("invalid SCRAM server nonce")
+	}
+	salt, err := base64.StdEncoding.DecodeString(salt64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SCRAM salt")
+	}
+	iterations, err := strconv.Atoi(iter)
+	if err != nil || iterations < 1 {
+		return nil, fmt.Errorf("invalid SCRAM iteration count")
+	}
+	c.saltedPassword = pbkdf2SHA256([]byte(c.password), salt, iterations)
+	clientKey := hmacSHA256(c.saltedPassword, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	withoutProof := "c=biws,r=" + nonce
+	c.authMessage = c.clientFirstBare + "," + string(serverFirst) + "," + withoutProof
+	sig := hmacSHA256(storedKey[:], c.authMessage)
+	proof := make([]byte, len(clientKey))
+	for i := range proof {
+		proof[i] = clientKey[i] ^ sig[i]
+	}
+	return []byte(withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof)), nil
+}
+
+// verifyServerFinal checks the signature in the
+// server-final message.
+func (c *scramClient) verifyServerFinal(serverFinal []byte) error {
+	attrs := scramAttrs(string(serverFinal))
+	if e := attrs["e"]; e != "" {
+		return fmt.Errorf("SCRAM authentication failed: %s", e)
+	}
+	serverKey := hmacSHA256(c.saltedPassword, "Server Key")
+	want := hmacSHA256(serverKey, c.authMessage)
+	got, err := base64.StdEncoding.DecodeString(attrs["v"])
+	if err != nil || !hmac.Equal(got, want) {
+		return fmt.Errorf("invalid SCRAM server signature")
+	}
+	return nil
+}
+
+// scramAttrs parses the comma-separated attributes
+// of a SCRAM message.
+func scramAttrs(msg string) map[string]string {
+	attrs := make(map[string]string)
+	for _, f := range strings.Split(msg, ",") {
+		if len(f) >= 2 && f[1] == '=' {
+			attrs[f[:1]] = f[2:]
+		}
+	}
+	return attrs
+}
+
+// pbkdf2SHA256 implements PBKDF2 (RFC 8018) with HMAC-SHA-256,
+// returning a single block of output.
+func pbkdf2SHA256(password, salt []byte, iterations int) []byte {
+	mac := hmac.New(sha256.New, password)
+	mac.Write(salt)
+	mac.Write([]byte{0, 0, 0, 1})
+	u := mac.Sum(nil)
+	result := append([]byte(nil), u...)
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range result {
+			result[j] ^= u[j]
+		}
+	}
+	return result
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
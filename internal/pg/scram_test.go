@@ -0,0 +1,106 @@
+package pg
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// The test vector from RFC 7677, section 3.
+const (
+	rfcClientFirst = "n,,n=user,r=rOprNGfwEbeRWgbNEkqO"
+	rfcServerFirst = "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"
+	rfcClientFinal = "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="
+	rfcServerFinal = "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="
+)
+
+func newRFCClient() *scramClient {
+	return &scramClient{
+		user:     "user",
+		password: "pencil",
+		nonce:    "rOprNGfwEbeRWgbNEkqO",
+	}
+}
+
+func TestSCRAM(t *testing.T) {
+	c := newRFCClient()
+	if got := string(c.clientFirst()); got != rfcClientFirst {
+		t.Fatalf("unexpected client-first message; got %q want %q", got, rfcClientFirst)
+	}
+	final, err := c.clientFinal([]byte(rfcServerFirst))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(final); got != rfcClientFinal {
+		t.Fatalf("unexpected client-final message; got %q want %q", got, rfcClientFinal)
+	}
+	if err := c.verifyServerFinal([]byte(rfcServerFinal)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var scramErrorTests = []struct {
+	testName    string
+	serverFirst string
+	serverFinal string
+	expectError string
+}{{
+	testName:    "nonce-mismatch",
+	serverFirst: "r=xxx,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+	expectError: "invalid SCRAM server nonce",
+}, {
+	testName:    "nonce-not-extended",
+	serverFirst: "r=rOprNGfwEbeRWgbNEkqO,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+	expectError: "invalid SCRAM server nonce",
+}, {
+	testName:    "bad-salt",
+	serverFirst: "r=rOprNGfwEbeRWgbNEkqOx,s=!!,i=4096",
+	expectError: "invalid SCRAM salt",
+}, {
+	testName:    "bad-iterations",
+	serverFirst: "r=rOprNGfwEbeRWgbNEkqOx,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=0",
+	expectError: "invalid SCRAM iteration count",
+}, {
+	testName:    "bad-signature",
+	serverFirst: rfcServerFirst,
+	serverFinal: "v=AAAATRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=",
+	expectError: "invalid SCRAM server signature",
+}, {
+	testName:    "server-error",
+	serverFirst: rfcServerFirst,
+	serverFinal: "e=invalid-proof",
+	expectError: "SCRAM authentication failed: invalid-proof",
+}}
+
+func TestSCRAMError(t *testing.T) {
+	for _, test := range scramErrorTests {
+		t.Run(test.testName, func(t *testing.T) {
+			c := newRFCClient()
+			c.clientFirst()
+			_, err := c.clientFinal([]byte(test.serverFirst))
+			if err == nil {
+				err = c.verifyServerFinal([]byte(test.serverFinal))
+			}
+			if err == nil || err.Error() != test.expectError {
+				t.Fatalf("unexpected error; got %v want %q", err, test.expectError)
+			}
+		})
+	}
+}
+
+func TestPBKDF2SHA256(t *testing.T) {
+	// Test vectors for PBKDF2-HMAC-SHA256 with
+	// password "password" and salt "salt".
+	for _, test := range []struct {
+		iterations int
+		expect     string
+	}{
+		{1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+		{4096, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+	} {
+		got := hex.EncodeToString(pbkdf2SHA256([]byte("password"), []byte("salt"), test.iterations))
+		if got != test.expect {
+			t.Errorf("%d iterations: got %s want %s", test.iterations, got, test.expect)
+		}
+	}
+}
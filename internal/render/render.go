@@ -0,0 +1,226 @@
+// Package render renders annotated CSV tables as Markdown
+// or HTML tables.
+package render
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rogpeppe/annotatedcsv"
+)
+
+// Format represents an output format.
+type Format int
+
+const (
+	// Markdown specifies GitHub-flavoured Markdown tables.
+	Markdown Format = iota
+	// HTML specifies HTML table elements.
+	HTML
+)
+
+// Options holds options for Render.
+type Options struct {
+	// Columns holds the names of the columns to render, in order.
+	// If it's empty, all columns except the annotation column
+	// are rendered. Columns not present in a table are ignored.
+	Columns []string
+	// MaxRows holds the maximum number of rows to render
+	// for each table. If it's zero, all rows are rendered.
+	MaxRows int
+	// MaxWidth holds the maximum number of characters to
+	// render in each cell. If it's zero, cells are not truncated.
+	MaxWidth int
+}
+
+// Render writes all the tables read from r to w in the given format.
+func Render(w io.Writer, r *annotatedcsv.Reader, f Format, opts Options) error {
+	for r.NextTable() {
+		cols := r.Columns()
+		indexes := selectColumns(cols, opts.Columns)
+		if len(indexes) == 0 {
+			continue
+		}
+		tw := &tableWriter{
+			w:       w,
+			format:  f,
+			opts:    opts,
+			cols:    cols,
+			indexes: indexes,
+		}
+		tw.header()
+		nrows := 0
+		for r.NextRow() {
+			nrows++
+			if opts.MaxRows > 0 && nrows > opts.MaxRows {
+				continue
+			}
+			tw.row(r.Row())
+		}
+		more := 0
+		if opts.MaxRows > 0 && nrows > opts.MaxRows {
+			more = nrows - opts.MaxRows
+		}
+		tw.footer(more)
+	}
+	return r.Err()
+}
+
+// selectColumns returns the indexes in cols of the named columns.
+func selectColumns(cols []annotatedcsv.Column, names []string) []int {
+	var indexes []int
+	if len(names) == 0 {
+		for i, col := range cols {
+			if col.Name != "" {
+				indexes = append(indexes, i)
+			}
+		}
+		return indexes
+	}
+	for _, name := range names {
+		for i, col := range cols {
+			if col.Name == name {
+				indexes = append(indexes, i)
+				break
+			}
+		}
+	}
+	return indexes
+}
+
+type tableWriter struct {
+	w       io.Writer
+	format  Format
+	opts    Options
+	cols    []annotatedcsv.Column
+	indexes []int
+}
+
+func (tw *tableWriter) header() {
+	switch tw.format {
+	case Markdown:
+		var b strings.Builder
+		b.WriteByte('|')
+		for _, i := range tw.indexes {
+			fmt.Fprintf(&b, " %s |", markdownEscape(tw.cols[i].Name))
+		}
+		b.WriteString("\n|")
+		for _, i := range tw.indexes {
+			if numeric(tw.cols[i].Type) {
+				b.WriteString(" ---: |")
+			} else {
+				b.WriteString(" --- |")
+			}
+		}
+		fmt.Fprintln(tw.w, b.String())
+	case HTML:
+		var b strings.Builder
+		b.WriteString("<table>\n<thead>\n<tr>")
+		for _, i := range tw.indexes {
+			fmt.Fprintf(&b, "<th>%s</th>", html.EscapeString(tw.cols[i].Name))
+		}
+		b.WriteString("</tr>\n</thead>\n<tbody>")
+		fmt.Fprintln(tw.w, b.String())
+	}
+}
+
+func (tw *tableWriter) row(row []interface{}) {
+	var b strings.Builder
+	switch tw.format {
+	case Markdown:
+		b.WriteByte('|')
+		for _, i := range tw.indexes {
+			fmt.Fprintf(&b, " %s |", markdownEscape(tw.cell(row[i])))
+		}
+	case HTML:
+		b.WriteString("<tr>")
+		for _, i := range tw.indexes {
+			s := html.EscapeString(tw.cell(row[i]))
+			if numeric(tw.cols[i].Type) {
+				fmt.Fprintf(&b, `<td style="text-align: right">%s</td>`, s)
+			} else {
+				fmt.Fprintf(&b, "<td>%s</td>", s)
+			}
+		}
+		b.WriteString("</tr>")
+	}
+	fmt.Fprintln(tw.w, b.String())
+}
+
+// footer finishes the table, noting the number of
+// rows that were omitted, if any.
+func (tw *tableWriter) footer(more int) {
+	switch tw.format {
+	case Markdown:
+		if more > 0 {
+			fmt.Fprintf(tw.w, "\n_%s_\n", moreRows(more))
+		}
+		// Tables must be separated by a blank line.
+		fmt.Fprintln(tw.w)
+	case HTML:
+		fmt.Fprintln(tw.w, "</tbody>")
+		if more > 0 {
+			fmt.Fprintf(tw.w, "<tfoot>\n<tr><td colspan=\"%d\">%s</td></tr>\n</tfoot>\n", len(tw.indexes), moreRows(more))
+		}
+		fmt.Fprintln(tw.w, "</table>")
+	}
+}
+
+func moreRows(n int) string {
+	if n == 1 {
+		return "1 more row"
+	}
+	return fmt.Sprintf("%d more rows", n)
+}
+
+// cell returns the text of a cell holding v,
+// truncated to the maximum width.
+func (tw *tableWriter) cell(v interface{}) string {
+	s := valueString(v)
+	if tw.opts.MaxWidth > 0 {
+		if r := []rune(s); len(r) > tw.opts.MaxWidth {
+			s = string(r[:tw.opts.MaxWidth]) + "…"
+		}
+	}
+	return s
+}
+
+func valueString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
+
+// numeric reports whether columns of the given
+// datatype should be aligned to the right.
+func numeric(typ string) bool {
+	switch annotatedcsv.DatatypeKind(typ) {
+	case annotatedcsv.LongKind, annotatedcsv.UnsignedLongKind, annotatedcsv.DoubleKind, annotatedcsv.DecimalKind:
+		return true
+	}
+	return false
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`|`, `\|`,
+	"\r\n", "<br>",
+	"\n", "<br>",
+	"\r", "<br>",
+)
+
+// markdownEscape escapes s for inclusion in a Markdown table cell.
+func markdownEscape(s string) string {
+	return markdownEscaper.Replace(s)
+}
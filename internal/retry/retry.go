@@ -0,0 +1,54 @@
+// Package retry implements the retry policy common to the
+// commands that write to remote services.
+package retry
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	// MaxAttempts holds the maximum number of times
+	// a request is sent before giving up.
+	MaxAttempts = 5
+
+	// InitialBackoff holds the delay before the first retry.
+	// The delay doubles after each subsequent attempt
+	// up to MaxBackoff.
+	InitialBackoff = time.Second
+	MaxBackoff     = time.Minute
+)
+
+// sleep is replaced in tests.
+var sleep = time.Sleep
+
+// Do calls f until it succeeds, it returns an error that is
+// not worth retrying, or it has been called MaxAttempts times,
+// and returns the error from the last call.
+//
+// Between calls, Do waits for the current backoff delay or
+// for the delay returned by f, whichever is longer, so that
+// f can honour any delay requested by the server.
+func Do(f func() (retry bool, delay time.Duration, err error)) error {
+	backoff := InitialBackoff
+	for attempt := 1; ; attempt++ {
+		retry, delay, err := f()
+		if err == nil || !retry || attempt >= MaxAttempts {
+			return err
+		}
+		if delay < backoff {
+			delay = backoff
+		}
+		sleep(delay)
+		if backoff *= 2; backoff > MaxBackoff {
+			backoff = MaxBackoff
+		}
+	}
+}
+
+// Status reports whether a request that failed with the given
+// HTTP status code may be retried. A zero status stands for
+// a request that received no response.
+func Status(status int) bool {
+	return status == 0 || status == http.StatusTooManyRequests || status/100 == 5
+}
@@ -0,0 +1,114 @@
+package retry
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var doTests = []struct {
+	testName string
+	// results holds the results of successive calls to f;
+	// any calls beyond them succeed.
+	results      []result
+	expectCalls  int
+	expectSleeps []time.Duration
+	expectError  string
+}{{
+	testName:    "immediate-success",
+	expectCalls: 1,
+}, {
+	testName: "success-after-retries",
+	results: []result{
+		{true, 0, "a"},
+		{true, 0, "b"},
+	},
+	expectCalls:  3,
+	expectSleeps: []time.Duration{time.Second, 2 * time.Second},
+}, {
+	testName: "not-retried",
+	results: []result{
+		{false, 0, "fatal"},
+	},
+	expectCalls: 1,
+	expectError: "fatal",
+}, {
+	testName: "too-many-attempts",
+	results: []result{
+		{true, 0, "e1"},
+		{true, 0, "e2"},
+		{true, 0, "e3"},
+		{true, 0, "e4"},
+		{true, 0, "e5"},
+	},
+	expectCalls:  5,
+	expectSleeps: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second},
+	expectError:  "e5",
+}, {
+	testName: "delay-requested",
+	results: []result{
+		{true, 10 * time.Second, "a"},
+		{true, time.Millisecond, "b"},
+	},
+	expectCalls:  3,
+	expectSleeps: []time.Duration{10 * time.Second, 2 * time.Second},
+}}
+
+type result struct {
+	retry bool
+	delay time.Duration
+	err   string
+}
+
+func TestDo(t *testing.T) {
+	defer func(old func(time.Duration)) {
+		sleep = old
+	}(sleep)
+	for _, test := range doTests {
+		t.Run(test.testName, func(t *testing.T) {
+			var sleeps []time.Duration
+			sleep = func(d time.Duration) {
+				sleeps = append(sleeps, d)
+			}
+			calls := 0
+			err := Do(func() (bool, time.Duration, error) {
+				calls++
+				if calls > len(test.results) {
+					return false, 0, nil
+				}
+				r := test.results[calls-1]
+				return r.retry, r.delay, fmt.Errorf("%s", r.err)
+			})
+			if test.expectError != "" {
+				if err == nil || err.Error() != test.expectError {
+					t.Fatalf("unexpected error; got %v want %q", err, test.expectError)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if calls != test.expectCalls {
+				t.Errorf("unexpected call count; got %d want %d", calls, test.expectCalls)
+			}
+			if !reflect.DeepEqual(sleeps, test.expectSleeps) {
+				t.Errorf("unexpected sleeps; got %v want %v", sleeps, test.expectSleeps)
+			}
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	for status, want := range map[int]bool{
+		0:   true,
+		400: false,
+		401: false,
+		404: false,
+		429: true,
+		500: true,
+		503: true,
+	} {
+		if got := Status(status); got != want {
+			t.Errorf("Status(%d) = %v; want %v", status, got, want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Package series finds the columns of tables holding time
+// series in the layout produced by Flux queries, as read by
+// the commands that write to time series databases.
+package series
+
+import (
+	"fmt"
+
+	"github.com/rogpeppe/annotatedcsv"
+)
+
+// Columns holds the indexes of the columns of a table
+// of time series.
+type Columns struct {
+	// Measurement holds the index of the _measurement
+	// column, or -1 if there is none.
+	Measurement int
+	Time        int
+
+	// Field and Value hold the indexes of the _field
+	// and _value columns, or -1 if the table is pivoted.
+	Field int
+	Value int
+
+	// FieldNames and FieldIndexes hold the field
+	// columns of a pivoted table.
+	FieldNames   []string
+	FieldIndexes []int
+
+	// Tags holds the indexes of the remaining columns,
+	// which identify the series, in column order.
+	Tags []int
+}
+
+// Pivoted reports whether the table is pivoted, holding
+// a column for each field rather than _field and _value
+// columns.
+func (c *Columns) Pivoted() bool {
+	return c.Field == -1 && c.Value == -1
+}
+
+// Find returns the columns of a table with the given columns,
+// ignoring any column for which ignore returns true.
+//
+// A table must have a _time column. Unless it is pivoted, it
+// must also have _field and _value columns; otherwise, all its
+// columns that are not in the group key are fields. The result
+// and table columns added by Flux are neither tags nor fields.
+func Find(cols []annotatedcsv.Column, ignore func(name string) bool) (*Columns, error) {
+	c := Columns{
+		Measurement: -1,
+		Field:       -1,
+		Value:       -1,
+		Time:        -1,
+	}
+	// others holds the indexes of all columns that
+	// may be tags or fields.
+	var others []int
+	for i, col := range cols {
+		if ignore(col.Name) {
+			continue
+		}
+		switch col.Name {
+		case "_measurement":
+			c.Measurement = i
+		case "_field":
+			c.Field = i
+		case "_value":
+			c.Value = i
+		case "_time":
+			c.Time = i
+			if annotatedcsv.DatatypeKind(col.Type) != annotatedcsv.DateTimeKind {
+				return nil, fmt.Errorf("_time column has wrong type, got %q want %q", col.Type, "dateTime:*")
+			}
+		case "", "result", "table":
+			// These are added by Flux and are
+			// neither tags nor fields.
+		default:
+			others = append(others, i)
+		}
+	}
+	if c.Time == -1 {
+		return nil, fmt.Errorf("no _time column found in table")
+	}
+	pivoted := c.Pivoted()
+	for _, i := range others {
+		col := cols[i]
+		if pivoted && !col.Group {
+			c.FieldNames = append(c.FieldNames, col.Name)
+			c.FieldIndexes = append(c.FieldIndexes, i)
+			continue
+		}
+		c.Tags = append(c.Tags, i)
+	}
+	if pivoted {
+		if len(c.FieldNames) == 0 {
+			return nil, fmt.Errorf("no field columns found in pivoted table")
+		}
+	} else {
+		if c.Field == -1 {
+			return nil, fmt.Errorf("no _field column found in table")
+		}
+		if c.Value == -1 {
+			return nil, fmt.Errorf("no _value column found in table")
+		}
+	}
+	return &c, nil
+}
@@ -0,0 +1,144 @@
+package series
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rogpeppe/annotatedcsv"
+)
+
+var findTests = []struct {
+	testName    string
+	csv         string
+	ignore      []string
+	expect      *Columns
+	expectError string
+}{{
+	testName: "field-value",
+	csv: `
+#datatype,string,long,dateTime:RFC3339,dateTime:RFC3339,dateTime:RFC3339,double,string,string,string
+#group,false,false,true,true,false,false,true,true,true
+#default,_result,,,,,,,,
+,result,table,_start,_stop,_time,_value,_field,_measurement,host
+`,
+	ignore: []string{"_start", "_stop"},
+	expect: &Columns{
+		Measurement: 8,
+		Time:        5,
+		Field:       7,
+		Value:       6,
+		Tags:        []int{9},
+	},
+}, {
+	testName: "pivoted",
+	csv: `
+#datatype,string,long,dateTime:RFC3339,string,string,double,long
+#group,false,false,false,true,true,false,false
+#default,_result,,,,,,
+,result,table,_time,_measurement,host,usage,count
+`,
+	expect: &Columns{
+		Measurement:  4,
+		Time:         3,
+		Field:        -1,
+		Value:        -1,
+		FieldNames:   []string{"usage", "count"},
+		FieldIndexes: []int{6, 7},
+		Tags:         []int{5},
+	},
+}, {
+	testName: "no-measurement",
+	csv: `
+#datatype,dateTime:RFC3339,string,double,string
+#group,false,true,false,false
+#default,,,,
+,_time,_field,_value,region
+`,
+	expect: &Columns{
+		Measurement: -1,
+		Time:        1,
+		Field:       2,
+		Value:       3,
+		Tags:        []int{4},
+	},
+}, {
+	testName: "ignored-time",
+	csv: `
+#datatype,dateTime:RFC3339,string,double
+#group,false,true,false
+#default,,,
+,_time,_field,_value
+`,
+	ignore:      []string{"_time"},
+	expectError: `no _time column found in table`,
+}, {
+	testName: "time-wrong-type",
+	csv: `
+#datatype,long,string,double
+#group,false,true,false
+#default,,,
+,_time,_field,_value
+`,
+	expectError: `_time column has wrong type, got "long" want "dateTime:*"`,
+}, {
+	testName: "no-fields",
+	csv: `
+#datatype,dateTime:RFC3339,string
+#group,false,true
+#default,,
+,_time,host
+`,
+	expectError: `no field columns found in pivoted table`,
+}, {
+	testName: "no-field-column",
+	csv: `
+#datatype,dateTime:RFC3339,double
+#group,false,false
+#default,,
+,_time,_value
+`,
+	expectError: `no _field column found in table`,
+}, {
+	testName: "no-value-column",
+	csv: `
+#datatype,dateTime:RFC3339,string
+#group,false,true
+#default,,
+,_time,_field
+`,
+	expectError: `no _value column found in table`,
+}}
+
+func TestFind(t *testing.T) {
+	for _, test := range findTests {
+		t.Run(test.testName, func(t *testing.T) {
+			r := annotatedcsv.NewReader(strings.NewReader(strings.TrimPrefix(test.csv, "\n")))
+			if !r.NextTable() {
+				t.Fatalf("no table: %v", r.Err())
+			}
+			ignore := make(map[string]bool)
+			for _, name := range test.ignore {
+				ignore[name] = true
+			}
+			c, err := Find(r.Columns(), func(name string) bool {
+				return ignore[name]
+			})
+			if test.expectError != "" {
+				if err == nil {
+					t.Fatalf("no error; want %q", test.expectError)
+				}
+				if err.Error() != test.expectError {
+					t.Fatalf("unexpected error; got %q want %q", err, test.expectError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(c, test.expect) {
+				t.Fatalf("unexpected result; got %+v want %+v", c, test.expect)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+// Package serve implements the HTTP server mode
+// of the conversion commands.
+package serve
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/rogpeppe/annotatedcsv/internal/input"
+)
+
+// ListenAndServe listens on the given address and responds to each
+// POST request by calling convert with the request body, which
+// may be gzip-compressed, and a writer for the response body,
+// which has the given content type. It only returns on error.
+//
+// If convert fails before writing anything, the error is returned
+// to the client with a 400 (Bad Request) status; otherwise the
+// response is aborted so that the client sees it as incomplete.
+func ListenAndServe(addr, contentType string, convert func(w io.Writer, r io.Reader) error) error {
+	fmt.Fprintf(os.Stderr, "listening on %s\n", addr)
+	return http.ListenAndServe(addr, &handler{
+		contentType: contentType,
+		convert:     convert,
+	})
+}
+
+type handler struct {
+	contentType string
+	convert     func(w io.Writer, r io.Reader) error
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := input.Decompress(req.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("cannot decompress request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	rw := &responseWriter{
+		w:           w,
+		contentType: h.contentType,
+	}
+	if err := h.convert(rw, body); err != nil {
+		if !rw.written {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "error: request from %s: %v\n", req.RemoteAddr, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// responseWriter sets the content type of a response
+// when its body is first written.
+type responseWriter struct {
+	w           http.ResponseWriter
+	contentType string
+	written     bool
+}
+
+func (w *responseWriter) Write(buf []byte) (int, error) {
+	if !w.written {
+		w.w.Header().Set("Content-Type", w.contentType)
+		w.written = true
+	}
+	return w.w.Write(buf)
+}
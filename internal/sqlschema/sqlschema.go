@@ -0,0 +1,109 @@
+// Package sqlschema implements the mapping from annotated CSV
+// tables to SQL tables common to the commands that write to SQL
+// databases. Annotated CSV tables with the same set of columns
+// share an SQL table.
+package sqlschema
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rogpeppe/annotatedcsv"
+)
+
+// Table describes an SQL table.
+type Table struct {
+	Name string
+	// Columns holds the columns of the table, in the order
+	// of the first annotated CSV table written to it.
+	Columns []annotatedcsv.Column
+}
+
+// Tables holds an SQL table for each distinct schema.
+type Tables struct {
+	name   string
+	tables map[string]*Table
+}
+
+// NewTables returns a Tables value that names the table for
+// the first schema with the given name and those for further
+// schemas with _2, _3 and so on appended.
+func NewTables(name string) *Tables {
+	return &Tables{
+		name:   name,
+		tables: make(map[string]*Table),
+	}
+}
+
+// Len returns the number of tables.
+func (ts *Tables) Len() int {
+	return len(ts.tables)
+}
+
+// Table returns the SQL table for annotated CSV tables with
+// the given columns, ignoring any columns with no name. It also
+// reports whether the table is new, in which case the caller
+// is responsible for creating it.
+func (ts *Tables) Table(cols []annotatedcsv.Column) (_ *Table, isNew bool, _ error) {
+	var tcols []annotatedcsv.Column
+	for _, col := range cols {
+		if col.Name != "" {
+			tcols = append(tcols, col)
+		}
+	}
+	if len(tcols) == 0 {
+		return nil, false, fmt.Errorf("table has no named columns")
+	}
+	key := schemaKey(tcols)
+	if t := ts.tables[key]; t != nil {
+		return t, false, nil
+	}
+	name := ts.name
+	if len(ts.tables) > 0 {
+		name = fmt.Sprintf("%s_%d", name, len(ts.tables)+1)
+	}
+	t := &Table{
+		Name:    name,
+		Columns: tcols,
+	}
+	ts.tables[key] = t
+	return t, true, nil
+}
+
+// Indexes returns the index in cols of each column of t.
+// The columns must have the schema of t.
+func (t *Table) Indexes(cols []annotatedcsv.Column) []int {
+	indexes := make([]int, len(t.Columns))
+	for i, col := range t.Columns {
+		for j, c := range cols {
+			if c.Name == col.Name {
+				indexes[i] = j
+				break
+			}
+		}
+	}
+	return indexes
+}
+
+// Create returns a statement that creates t if it does not
+// already exist. Each column is defined by its name quoted
+// with quoteIdent followed by the result of colDef.
+func (t *Table) Create(quoteIdent func(string) string, colDef func(col annotatedcsv.Column) string) string {
+	defs := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		defs[i] = quoteIdent(col.Name) + " " + colDef(col)
+	}
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", quoteIdent(t.Name), strings.Join(defs, ", "))
+}
+
+// schemaKey returns a string identifying the set of columns,
+// independent of their order.
+func schemaKey(cols []annotatedcsv.Column) string {
+	keys := make([]string, len(cols))
+	for i, col := range cols {
+		keys[i] = col.Name + "\x00" + col.Type
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, "\x00")
+}
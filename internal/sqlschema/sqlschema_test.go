@@ -0,0 +1,94 @@
+package sqlschema
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rogpeppe/annotatedcsv"
+)
+
+func cols(spec string) []annotatedcsv.Column {
+	var cols []annotatedcsv.Column
+	for _, f := range strings.Fields(spec) {
+		name, typ, _ := strings.Cut(f, ":")
+		cols = append(cols, annotatedcsv.Column{
+			Name: name,
+			Type: typ,
+		})
+	}
+	return cols
+}
+
+func TestTables(t *testing.T) {
+	ts := NewTables("data")
+	tables := []struct {
+		cols         []annotatedcsv.Column
+		expectName   string
+		expectNew    bool
+		expectCols   []annotatedcsv.Column
+		expectIndex  []int
+		expectCreate string
+	}{{
+		cols:         cols(":string _time:dateTime:RFC3339 _value:double host:string"),
+		expectName:   "data",
+		expectNew:    true,
+		expectCols:   cols("_time:dateTime:RFC3339 _value:double host:string"),
+		expectIndex:  []int{1, 2, 3},
+		expectCreate: `CREATE TABLE IF NOT EXISTS "data" ("_time" dateTime:RFC3339, "_value" double, "host" string)`,
+	}, {
+		// The same columns in a different order
+		// use the same table.
+		cols:        cols("host:string _value:double _time:dateTime:RFC3339"),
+		expectName:  "data",
+		expectCols:  cols("_time:dateTime:RFC3339 _value:double host:string"),
+		expectIndex: []int{2, 1, 0},
+	}, {
+		// A different type means a different schema.
+		cols:         cols("_time:dateTime:RFC3339 _value:long host:string"),
+		expectName:   "data_2",
+		expectNew:    true,
+		expectCols:   cols("_time:dateTime:RFC3339 _value:long host:string"),
+		expectIndex:  []int{0, 1, 2},
+		expectCreate: `CREATE TABLE IF NOT EXISTS "data_2" ("_time" dateTime:RFC3339, "_value" long, "host" string)`,
+	}, {
+		cols:         cols("a:long"),
+		expectName:   "data_3",
+		expectNew:    true,
+		expectCols:   cols("a:long"),
+		expectIndex:  []int{0},
+		expectCreate: `CREATE TABLE IF NOT EXISTS "data_3" ("a" long)`,
+	}}
+	quote := func(s string) string {
+		return `"` + s + `"`
+	}
+	colDef := func(col annotatedcsv.Column) string {
+		return col.Type
+	}
+	for i, test := range tables {
+		table, isNew, err := ts.Table(test.cols)
+		if err != nil {
+			t.Fatalf("table %d: %v", i, err)
+		}
+		if table.Name != test.expectName || isNew != test.expectNew {
+			t.Errorf("table %d: got %q new %v; want %q new %v", i, table.Name, isNew, test.expectName, test.expectNew)
+		}
+		if !reflect.DeepEqual(table.Columns, test.expectCols) {
+			t.Errorf("table %d: unexpected columns %v", i, table.Columns)
+		}
+		if got := table.Indexes(test.cols); !reflect.DeepEqual(got, test.expectIndex) {
+			t.Errorf("table %d: unexpected indexes; got %v want %v", i, got, test.expectIndex)
+		}
+		if isNew {
+			if got := table.Create(quote, colDef); got != test.expectCreate {
+				t.Errorf("table %d: unexpected create statement\ngot  %s\nwant %s", i, got, test.expectCreate)
+			}
+		}
+	}
+	if n := ts.Len(); n != 3 {
+		t.Errorf("unexpected table count %d", n)
+	}
+	if _, _, err := ts.Table(cols(":string")); err == nil || err.Error() != "table has no named columns" {
+		t.Errorf("unexpected error for unnamed columns: %v", err)
+	}
+}
@@ -0,0 +1,349 @@
+// Package xlsx implements a minimal streaming writer for Office Open
+// XML spreadsheets (.xlsx files), sufficient for writing tables of
+// typed values with a header row.
+//
+// Strings are written inline rather than to a shared string table,
+// so rows are never held in memory.
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Column describes a column in a sheet.
+type Column struct {
+	// Name is written in the header row.
+	Name string
+	// Width holds the width of the column in characters.
+	// If it's zero, the default width is used.
+	Width float64
+}
+
+// MaxRows holds the maximum number of rows in a sheet,
+// including the header row.
+const MaxRows = 1048576
+
+// MaxColumns holds the maximum number of columns in a sheet.
+const MaxColumns = 16384
+
+// Cell style indexes, as defined in styles.
+const (
+	styleDefault = 0
+	styleDate    = 1
+	styleHeader  = 2
+)
+
+// Writer writes an xlsx workbook.
+type Writer struct {
+	zw     *zip.Writer
+	sheets []string
+	// names holds the lower-cased names of all sheets,
+	// which must be unique.
+	names map[string]bool
+	// w holds the writer for the current sheet, if any.
+	w     *bufio.Writer
+	ncols int
+	nrows int
+	err   error
+}
+
+// NewWriter returns a Writer that writes a workbook to w.
+// The Close method must be called to complete the workbook.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		zw:    zip.NewWriter(w),
+		names: make(map[string]bool),
+	}
+}
+
+// AddSheet starts a new sheet with the given columns and writes
+// its header row. Subsequent rows are written to the new sheet.
+// The name is changed if necessary to make it a valid sheet name
+// that's not used by any other sheet.
+func (w *Writer) AddSheet(name string, cols []Column) error {
+	if w.err != nil {
+		return w.err
+	}
+	if len(cols) > MaxColumns {
+		return fmt.Errorf("too many columns (%d) for sheet", len(cols))
+	}
+	if err := w.endSheet(); err != nil {
+		return err
+	}
+	name = w.sheetName(name)
+	w.sheets = append(w.sheets, name)
+	f, err := w.create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(w.sheets)))
+	if err != nil {
+		w.err = err
+		return err
+	}
+	w.w = bufio.NewWriter(f)
+	w.ncols = len(cols)
+	w.nrows = 0
+	w.w.WriteString(xml.Header)
+	w.w.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	// Freeze the header row so it stays visible when scrolling.
+	w.w.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	hasWidths := false
+	for _, col := range cols {
+		hasWidths = hasWidths || col.Width > 0
+	}
+	if hasWidths {
+		w.w.WriteString("<cols>")
+		for i, col := range cols {
+			if col.Width > 0 {
+				fmt.Fprintf(w.w, `<col min="%d" max="%d" width="%g" customWidth="1"/>`, i+1, i+1, col.Width)
+			}
+		}
+		w.w.WriteString("</cols>")
+	}
+	w.w.WriteString("<sheetData>")
+	w.startRow()
+	for i, col := range cols {
+		w.stringCell(i, col.Name, styleHeader)
+	}
+	w.w.WriteString("</row>")
+	return nil
+}
+
+// WriteRow writes a row to the current sheet. Each value may be nil
+// (an empty cell), bool, int64, uint64, float64, string or time.Time.
+// Times are written in UTC, because spreadsheets have no notion of
+// time zone.
+func (w *Writer) WriteRow(row []interface{}) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.w == nil {
+		return fmt.Errorf("no current sheet")
+	}
+	if len(row) != w.ncols {
+		return fmt.Errorf("row has %d values, want %d", len(row), w.ncols)
+	}
+	if w.nrows >= MaxRows {
+		return fmt.Errorf("too many rows for sheet %q", w.sheets[len(w.sheets)-1])
+	}
+	w.startRow()
+	for i, v := range row {
+		switch v := v.(type) {
+		case nil:
+		case bool:
+			x := 0
+			if v {
+				x = 1
+			}
+			fmt.Fprintf(w.w, `<c r="%s" t="b"><v>%d</v></c>`, cellRef(i, w.nrows), x)
+		case int64:
+			w.numberCell(i, float64(v), styleDefault)
+		case uint64:
+			w.numberCell(i, float64(v), styleDefault)
+		case float64:
+			if math.IsInf(v, 0) || math.IsNaN(v) {
+				w.stringCell(i, strconv.FormatFloat(v, 'g', -1, 64), styleDefault)
+			} else {
+				w.numberCell(i, v, styleDefault)
+			}
+		case time.Time:
+			w.numberCell(i, serialDate(v), styleDate)
+		case string:
+			w.stringCell(i, v, styleDefault)
+		default:
+			w.stringCell(i, fmt.Sprint(v), styleDefault)
+		}
+	}
+	w.w.WriteString("</row>")
+	return nil
+}
+
+// Close finishes writing the workbook. It does not
+// close the underlying writer.
+func (w *Writer) Close() error {
+	if err := w.endSheet(); err != nil {
+		return err
+	}
+	if len(w.sheets) == 0 {
+		// A workbook must contain at least one sheet.
+		if err := w.AddSheet("Sheet1", nil); err != nil {
+			return err
+		}
+		if err := w.endSheet(); err != nil {
+			return err
+		}
+	}
+	var contentTypes, workbook, workbookRels strings.Builder
+	contentTypes.WriteString(xml.Header)
+	contentTypes.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	contentTypes.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	contentTypes.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	contentTypes.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	contentTypes.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+
+	workbook.WriteString(xml.Header)
+	workbook.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+
+	workbookRels.WriteString(xml.Header)
+	workbookRels.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i, name := range w.sheets {
+		fmt.Fprintf(&contentTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escape(name), i+1, i+1)
+		fmt.Fprintf(&workbookRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+	}
+	contentTypes.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets></workbook>`)
+	fmt.Fprintf(&workbookRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(w.sheets)+1)
+	workbookRels.WriteString(`</Relationships>`)
+
+	files := []struct {
+		name, data string
+	}{
+		{"[Content_Types].xml", contentTypes.String()},
+		{"_rels/.rels", rootRels},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", workbookRels.String()},
+		{"xl/styles.xml", styles},
+	}
+	for _, f := range files {
+		fw, err := w.create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.data); err != nil {
+			return err
+		}
+	}
+	return w.zw.Close()
+}
+
+// create adds a compressed file to the archive.
+func (w *Writer) create(name string) (io.Writer, error) {
+	return w.zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+}
+
+func (w *Writer) endSheet() error {
+	if w.w == nil {
+		return nil
+	}
+	w.w.WriteString("</sheetData></worksheet>")
+	err := w.w.Flush()
+	w.w = nil
+	if err != nil {
+		w.err = err
+	}
+	return err
+}
+
+func (w *Writer) startRow() {
+	w.nrows++
+	fmt.Fprintf(w.w, `<row r="%d">`, w.nrows)
+}
+
+func (w *Writer) numberCell(col int, x float64, style int) {
+	fmt.Fprintf(w.w, `<c r="%s"`, cellRef(col, w.nrows))
+	if style != styleDefault {
+		fmt.Fprintf(w.w, ` s="%d"`, style)
+	}
+	fmt.Fprintf(w.w, `><v>%s</v></c>`, strconv.FormatFloat(x, 'g', -1, 64))
+}
+
+func (w *Writer) stringCell(col int, s string, style int) {
+	fmt.Fprintf(w.w, `<c r="%s" t="inlineStr"`, cellRef(col, w.nrows))
+	if style != styleDefault {
+		fmt.Fprintf(w.w, ` s="%d"`, style)
+	}
+	fmt.Fprintf(w.w, `><is><t xml:space="preserve">%s</t></is></c>`, escape(s))
+}
+
+// sheetName returns a valid sheet name based on name
+// that is not used by any other sheet.
+func (w *Writer) sheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, "'")
+	if name == "" {
+		name = "Sheet"
+	}
+	// Sheet names are limited to 31 characters.
+	base := truncate(name, 31)
+	name = base
+	for i := 2; w.names[strings.ToLower(name)]; i++ {
+		suffix := fmt.Sprintf(" (%d)", i)
+		name = truncate(base, 31-len(suffix)) + suffix
+	}
+	w.names[strings.ToLower(name)] = true
+	return name
+}
+
+// truncate returns s truncated to at most n runes.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
+
+// cellRef returns the reference of the cell at the given
+// zero-based column and one-based row, for example "B3".
+func cellRef(col, row int) string {
+	var buf [8]byte
+	i := len(buf)
+	for col++; col > 0; col = (col - 1) / 26 {
+		i--
+		buf[i] = byte('A' + (col-1)%26)
+	}
+	return string(buf[i:]) + strconv.Itoa(row)
+}
+
+// serialDate returns t as a spreadsheet serial date: the number of
+// days since 1899-12-30, which is correct for all dates after
+// February 1900.
+func serialDate(t time.Time) float64 {
+	const unixEpoch = 25569 // Serial date of 1970-01-01.
+	secs := float64(t.Unix()) + float64(t.Nanosecond())/1e9
+	return unixEpoch + secs/86400
+}
+
+// escape returns s with XML special characters escaped.
+// Characters that are not allowed in XML are replaced
+// with U+FFFD.
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+const rootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+// styles defines the cell styles: the default style, a date-time
+// style and a bold style for header cells.
+const styles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="3">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`</cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
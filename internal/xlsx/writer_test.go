@@ -0,0 +1,190 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// writeTestWorkbook writes a workbook with two sheets
+// holding every kind of value.
+func writeTestWorkbook(w *Writer) error {
+	err := w.AddSheet("data", []Column{
+		{Name: "time", Width: 20},
+		{Name: "value"},
+		{Name: "n"},
+		{Name: "u"},
+		{Name: "ok"},
+		{Name: "host <&>"},
+	})
+	if err != nil {
+		return err
+	}
+	rows := [][]interface{}{
+		{time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC), 1.5, int64(-3), uint64(7), true, "a"},
+		{time.Date(1999, 12, 31, 0, 0, 0, 0, time.FixedZone("", 3600)), math.Inf(1), nil, nil, false, " x\ty "},
+		{nil, math.NaN(), int64(1e15), uint64(math.MaxUint64), nil, "<b>&amp;</b>"},
+	}
+	for _, row := range rows {
+		if err := w.WriteRow(row); err != nil {
+			return err
+		}
+	}
+	if err := w.AddSheet("data", []Column{{Name: "x"}}); err != nil {
+		return err
+	}
+	return w.WriteRow([]interface{}{"second"})
+}
+
+// The golden files in testdata/workbook hold the parts of the
+// workbook written by writeTestWorkbook. The workbook was checked
+// by reading it with excelize. Run the tests with -update to
+// rewrite them after changing the writer, and check them again.
+func TestGolden(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := writeTestWorkbook(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join("testdata", "workbook")
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		if f.Method != zip.Deflate {
+			t.Errorf("%s is not compressed", f.Name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := filepath.Join(dir, filepath.FromSlash(f.Name))
+		if *update {
+			if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(file, got, 0666); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s differs from %s; got\n%s", f.Name, file, got)
+		}
+	}
+	wantNames := "xl/worksheets/sheet1.xml xl/worksheets/sheet2.xml [Content_Types].xml _rels/.rels xl/workbook.xml xl/_rels/workbook.xml.rels xl/styles.xml"
+	if got := strings.Join(names, " "); got != wantNames {
+		t.Errorf("unexpected parts; got %s want %s", got, wantNames)
+	}
+}
+
+func TestEmptyWorkbook(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewWriter(&buf).Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zr.File[0].Name != "xl/worksheets/sheet1.xml" {
+		t.Errorf("empty workbook has no sheet; first part is %s", zr.File[0].Name)
+	}
+}
+
+func TestWriteRowError(t *testing.T) {
+	w := NewWriter(ioutil.Discard)
+	if err := w.WriteRow(nil); err == nil || err.Error() != "no current sheet" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := w.AddSheet("s", []Column{{Name: "a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRow([]interface{}{1.0, 2.0}); err == nil || err.Error() != "row has 2 values, want 1" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+var sheetNameTests = []struct {
+	name   string
+	expect string
+}{
+	{"data", "data"},
+	{"DATA", "DATA (2)"},
+	{"a/b[c]:d*e?f\\g", "a_b_c__d_e_f_g"},
+	{"'quoted'", "quoted"},
+	{"''", "Sheet"},
+	{strings.Repeat("x", 40), strings.Repeat("x", 31)},
+	{strings.Repeat("x", 40), strings.Repeat("x", 27) + " (2)"},
+	{strings.Repeat("é", 40), strings.Repeat("é", 31)},
+}
+
+func TestSheetName(t *testing.T) {
+	// The names are added to the same writer, so
+	// later ones must avoid the earlier ones.
+	w := NewWriter(ioutil.Discard)
+	for _, test := range sheetNameTests {
+		if got := w.sheetName(test.name); got != test.expect {
+			t.Errorf("sheetName(%q): got %q want %q", test.name, got, test.expect)
+		}
+	}
+}
+
+var cellRefTests = []struct {
+	col, row int
+	expect   string
+}{
+	{0, 1, "A1"},
+	{25, 2, "Z2"},
+	{26, 3, "AA3"},
+	{701, 4, "ZZ4"},
+	{702, 5, "AAA5"},
+	{MaxColumns - 1, MaxRows, "XFD1048576"},
+}
+
+func TestCellRef(t *testing.T) {
+	for _, test := range cellRefTests {
+		if got := cellRef(test.col, test.row); got != test.expect {
+			t.Errorf("cellRef(%d, %d): got %q want %q", test.col, test.row, got, test.expect)
+		}
+	}
+}
+
+func TestSerialDate(t *testing.T) {
+	for _, test := range []struct {
+		t      time.Time
+		expect float64
+	}{
+		{time.Date(1900, 3, 1, 0, 0, 0, 0, time.UTC), 61},
+		{time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC), 25569},
+		{time.Date(2020, 1, 1, 18, 0, 0, 0, time.UTC), 43831.75},
+	} {
+		if got := serialDate(test.t); got != test.expect {
+			t.Errorf("serialDate(%v): got %v want %v", test.t, got, test.expect)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package annotatedcsv
+
+import "strings"
+
+// Kind classifies datatypes by the Go type of the values
+// that the Reader returns for them.
+type Kind int
+
+const (
+	// UnknownKind is the kind of datatypes that the Reader
+	// does not understand, and of the ignored datatype.
+	UnknownKind Kind = iota
+
+	// StringKind is the kind of the string, tag, measurement,
+	// field and enum datatypes and of the empty datatype of
+	// the annotation column, whose values are strings.
+	StringKind
+
+	BooleanKind      // bool
+	LongKind         // int64
+	UnsignedLongKind // uint64
+
+	// DoubleKind is the kind of the double datatype, whose values
+	// are float64 or, unless the Reader is configured otherwise,
+	// strings for infinite and NaN values.
+	DoubleKind
+
+	DecimalKind // Decimal
+	UUIDKind    // UUID
+	IPKind      // netip.Addr
+	CIDRKind    // netip.Prefix
+
+	// DateTimeKind is the kind of the dateTime datatype, with or
+	// without a time format, whose values are time.Time.
+	DateTimeKind
+
+	// JSONKind is the kind of the json datatype, whose
+	// values are decoded JSON values.
+	JSONKind
+
+	// ListKind is the kind of list datatypes such as list:long.
+	ListKind
+)
+
+// DatatypeKind returns the kind of the given datatype.
+func DatatypeKind(typ string) Kind {
+	switch typ {
+	case "string", "tag", "measurement", "field", "":
+		return StringKind
+	case "boolean":
+		return BooleanKind
+	case "long":
+		return LongKind
+	case "unsignedLong":
+		return UnsignedLongKind
+	case "double":
+		return DoubleKind
+	case "decimal":
+		return DecimalKind
+	case "uuid":
+		return UUIDKind
+	case "ip":
+		return IPKind
+	case "cidr":
+		return CIDRKind
+	case "json":
+		return JSONKind
+	case "dateTime":
+		return DateTimeKind
+	}
+	if strings.HasPrefix(typ, "dateTime:") {
+		return DateTimeKind
+	}
+	if _, ok := enumName(typ); ok {
+		return StringKind
+	}
+	if _, ok := listElemType(typ); ok {
+		return ListKind
+	}
+	return UnknownKind
+}
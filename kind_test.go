@@ -0,0 +1,42 @@
+package annotatedcsv
+
+import "testing"
+
+var datatypeKindTests = []struct {
+	typ        string
+	expectKind Kind
+}{
+	{"", StringKind},
+	{"string", StringKind},
+	{"tag", StringKind},
+	{"measurement", StringKind},
+	{"field", StringKind},
+	{"enum:color", StringKind},
+	{"boolean", BooleanKind},
+	{"long", LongKind},
+	{"unsignedLong", UnsignedLongKind},
+	{"double", DoubleKind},
+	{"decimal", DecimalKind},
+	{"uuid", UUIDKind},
+	{"ip", IPKind},
+	{"cidr", CIDRKind},
+	{"json", JSONKind},
+	{"dateTime", DateTimeKind},
+	{"dateTime:RFC3339", DateTimeKind},
+	{"dateTime:number", DateTimeKind},
+	{"dateTime:2006-01-02", DateTimeKind},
+	{"list:long", ListKind},
+	{"list:dateTime:RFC3339", ListKind},
+	{"ignored", UnknownKind},
+	{"enum:", UnknownKind},
+	{"dateTimeish", UnknownKind},
+	{"Long", UnknownKind},
+}
+
+func TestDatatypeKind(t *testing.T) {
+	for _, test := range datatypeKindTests {
+		if got := DatatypeKind(test.typ); got != test.expectKind {
+			t.Errorf("DatatypeKind(%q): got %v want %v", test.typ, got, test.expectKind)
+		}
+	}
+}
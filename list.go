@@ -0,0 +1,92 @@
+package annotatedcsv
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultListDelimiter holds the default delimiter between the
+// elements of values of list datatypes.
+const DefaultListDelimiter = ";"
+
+// listElemType returns the element datatype of typ
+// and reports whether typ is a list datatype.
+func listElemType(typ string) (string, bool) {
+	elem := strings.TrimPrefix(typ, "list:")
+	return elem, len(elem) != len(typ)
+}
+
+// listSliceType returns the type of the slices that
+// hold lists with the given element datatype.
+func listSliceType(elem string) reflect.Type {
+	switch DatatypeKind(elem) {
+	case BooleanKind:
+		return reflect.TypeOf([]bool(nil))
+	case LongKind:
+		return reflect.TypeOf([]int64(nil))
+	case UnsignedLongKind:
+		return reflect.TypeOf([]uint64(nil))
+	case DoubleKind:
+		return reflect.TypeOf([]float64(nil))
+	case StringKind:
+		return reflect.TypeOf([]string(nil))
+	case DateTimeKind:
+		return reflect.TypeOf([]time.Time(nil))
+	}
+	return reflect.TypeOf([]interface{}(nil))
+}
+
+// parseList parses s as a list of elements of the given datatype
+// separated by sep, parsing each element with parse. Lists of
+// booleans, numbers, strings and times are returned as slices of
+// the corresponding Go types, so that infinite and NaN doubles are
+// float64 values, and other lists as []interface{}.
+func parseList(s, elem, sep string, parse func(s, typ string) (interface{}, error)) (interface{}, error) {
+	if _, ok := listElemType(elem); ok || !KnownDatatype(elem) {
+		return nil, errUnknownDatatype
+	}
+	parts := strings.Split(s, sep)
+	list := reflect.MakeSlice(listSliceType(elem), len(parts), len(parts))
+	for i, part := range parts {
+		x, err := parse(part, elem)
+		if err != nil {
+			return nil, fmt.Errorf("list element %d: %v", i, err)
+		}
+		if s, ok := x.(string); ok && elem == "double" {
+			x, _ = strconv.ParseFloat(s, 64)
+		}
+		if x != nil {
+			list.Index(i).Set(reflect.ValueOf(x))
+		}
+	}
+	return list.Interface(), nil
+}
+
+// formatList is the inverse of parseList, formatting
+// each element with format.
+func formatList(v interface{}, elem, sep string, format func(v interface{}, typ string) (string, error)) (string, error) {
+	if s, ok := v.(string); ok {
+		// The Reader returns lists with unknown
+		// element datatypes as strings.
+		return s, nil
+	}
+	list := reflect.ValueOf(v)
+	if list.Kind() != reflect.Slice {
+		return "", fmt.Errorf("unexpected value type %T for list", v)
+	}
+	parts := make([]string, list.Len())
+	for i := range parts {
+		s, err := format(list.Index(i).Interface(), elem)
+		if err != nil {
+			return "", err
+		}
+		if strings.Contains(s, sep) {
+			return "", fmt.Errorf("list element %q contains delimiter %q", s, sep)
+		}
+		parts[i] = s
+	}
+	return strings.Join(parts, sep), nil
+}
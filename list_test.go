@@ -0,0 +1,174 @@
+package annotatedcsv
+
+import (
+	"bytes"
+	"math"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var listTests = []struct {
+	testName   string
+	delimiter  string
+	typ        string
+	cell       string
+	expect     interface{}
+	expectText string
+}{{
+	testName: "long",
+	typ:      "list:long",
+	cell:     "1;-2;3",
+	expect:   []int64{1, -2, 3},
+}, {
+	testName: "single-element",
+	typ:      "list:unsignedLong",
+	cell:     "18446744073709551615",
+	expect:   []uint64{math.MaxUint64},
+}, {
+	// An empty cell is a null list.
+	testName: "null",
+	typ:      "list:long",
+	cell:     "",
+	expect:   nil,
+}, {
+	testName: "empty-string-elements",
+	typ:      "list:string",
+	cell:     ";x;",
+	expect:   []string{"", "x", ""},
+}, {
+	testName: "quoted-cell-with-commas",
+	typ:      "list:string",
+	cell:     `"a,b;c"`,
+	expect:   []string{"a,b", "c"},
+}, {
+	testName: "quoted-cell-with-quotes",
+	typ:      "list:string",
+	cell:     `"say ""hi"";bye"`,
+	expect:   []string{`say "hi"`, "bye"},
+}, {
+	testName:  "comma-delimiter",
+	delimiter: ",",
+	typ:       "list:double",
+	cell:      `"1.5,NaN,-Inf"`,
+	// Non-finite elements are always float64.
+	expect: []float64{1.5, math.NaN(), math.Inf(-1)},
+}, {
+	testName:   "partial-multi-character-delimiter",
+	delimiter:  "::",
+	typ:        "list:boolean",
+	cell:       "true::false:",
+	expectText: `cannot parse "true::false:" as type "list:boolean" at line 5`,
+}, {
+	testName:  "multi-character-delimiter",
+	delimiter: "::",
+	typ:       "list:string",
+	cell:      "a:b::c",
+	expect:    []string{"a:b", "c"},
+}, {
+	testName:  "default-delimiter-not-used",
+	delimiter: "|",
+	typ:       "list:string",
+	cell:      "a;b|c",
+	expect:    []string{"a;b", "c"},
+}, {
+	testName: "times",
+	typ:      "list:dateTime:RFC3339",
+	cell:     "2021-01-01T00:00:00Z;2021-01-02T00:00:00Z",
+	expect:   []time.Time{time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)},
+}, {
+	testName: "other-element-types",
+	typ:      "list:ip",
+	cell:     "10.0.0.1",
+	expect:   []interface{}{netip.MustParseAddr("10.0.0.1")},
+}, {
+	testName:   "empty-numeric-element",
+	typ:        "list:long",
+	cell:       "1;;2",
+	expectText: `cannot parse "1;;2" as type "list:long" at line 5`,
+}, {
+	testName:   "bad-element",
+	typ:        "list:long",
+	cell:       "1;x",
+	expectText: `cannot parse "1;x" as type "list:long" at line 5`,
+}, {
+	// Lists of lists and of unknown datatypes
+	// are read as strings.
+	testName: "nested-list",
+	typ:      "list:list:long",
+	cell:     "1;2",
+	expect:   "1;2",
+}}
+
+func TestList(t *testing.T) {
+	for _, test := range listTests {
+		t.Run(test.testName, func(t *testing.T) {
+			data := "#datatype," + test.typ + "\n#group,false\n#default,\n,a\n," + test.cell + "\n"
+			r := NewReader(strings.NewReader(data))
+			r.SetListDelimiter(test.delimiter)
+			tables, err := r.ReadAll()
+			if test.expectText != "" {
+				assertErrorMatches(t, err, test.expectText)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := tables[0].Rows[0][1]
+			if !equalLists(got, test.expect) {
+				t.Fatalf("unexpected value; got %#v want %#v", got, test.expect)
+			}
+			if got == nil {
+				return
+			}
+			// The list is written back as it was read.
+			var buf bytes.Buffer
+			w := NewWriter(&buf)
+			w.SetListDelimiter(test.delimiter)
+			if err := w.WriteAll(tables); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != data {
+				t.Fatalf("unexpected output\ngot:\n%s\nwant:\n%s", got, data)
+			}
+		})
+	}
+}
+
+// equalLists is like reflect.DeepEqual except that
+// NaN elements of []float64 values are equal.
+func equalLists(a, b interface{}) bool {
+	a1, ok1 := a.([]float64)
+	b1, ok2 := b.([]float64)
+	if !ok1 || !ok2 {
+		return reflect.DeepEqual(a, b)
+	}
+	if len(a1) != len(b1) {
+		return false
+	}
+	for i := range a1 {
+		if a1[i] != b1[i] && !(math.IsNaN(a1[i]) && math.IsNaN(b1[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestWriteListErrors(t *testing.T) {
+	cols := []Column{{}, {Name: "a", Type: "list:string"}}
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetListDelimiter(",")
+	if err := w.WriteHeader(cols); err != nil {
+		t.Fatal(err)
+	}
+	err := w.WriteRow([]interface{}{nil, []string{"x", "y,z"}})
+	assertErrorMatches(t, err, `cannot format value for column "a": list element "y,z" contains delimiter ","`)
+	err = w.WriteRow([]interface{}{nil, int64(1)})
+	assertErrorMatches(t, err, `cannot format value for column "a": unexpected value type int64 for list`)
+}
@@ -0,0 +1,137 @@
+package annotatedcsv
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Merge returns a table holding the rows of all the given tables in
+// order. The tables must have the same columns, with the same names,
+// datatypes and group flags, although not necessarily in the same
+// order; the result has the column order of the first table. The
+// tables must also have the same group key values, as otherwise the
+// group columns of the result would not be constant: use
+// MergeUngrouped to merge tables with different group keys.
+//
+// A column's default value is kept if it is the same in all the
+// tables.
+func Merge(tables ...*Table) (*Table, error) {
+	return merge(tables, false)
+}
+
+// MergeUngrouped is like Merge except that the group columns of the
+// tables become regular columns of the result, so tables with
+// different group keys may be merged. Also, a group column need not
+// be present in all the tables: it is added to the result with a nil
+// value in rows from tables without it.
+func MergeUngrouped(tables ...*Table) (*Table, error) {
+	return merge(tables, true)
+}
+
+func merge(tables []*Table, ungroup bool) (*Table, error) {
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("no tables to merge")
+	}
+	var cols []Column
+	colIndex := make(map[string]int)
+	// optional holds the result columns that may be
+	// missing from some tables.
+	optional := make(map[string]bool)
+	for ti, t := range tables {
+		for _, col := range t.Columns {
+			i, ok := colIndex[col.Name]
+			if !ok {
+				if ti > 0 && !(ungroup && col.Group) {
+					return nil, fmt.Errorf("column %q in table %d is not in table 0", col.Name, ti)
+				}
+				colIndex[col.Name] = len(cols)
+				optional[col.Name] = ungroup && col.Group
+				// Copy the extra annotations so that the result
+				// does not share them with the table.
+				col.Extra = copyExtra(col.Extra)
+				cols = append(cols, col)
+				continue
+			}
+			c := &cols[i]
+			if col.Type != c.Type {
+				return nil, fmt.Errorf("column %q has inconsistent datatypes %q and %q", col.Name, c.Type, col.Type)
+			}
+			if col.Unit != c.Unit {
+				return nil, fmt.Errorf("column %q has inconsistent units %q and %q", col.Name, c.Unit, col.Unit)
+			}
+			if !ungroup && col.Group != c.Group {
+				return nil, fmt.Errorf("column %q is a group column in only some tables", col.Name)
+			}
+			if ungroup && col.Group {
+				optional[col.Name] = true
+			}
+			if !equalValues(col.Default, c.Default) {
+				c.Default = nil
+			}
+			c.Extra = intersectExtra(c.Extra, col.Extra)
+		}
+	}
+	for ti, t := range tables {
+		for _, col := range cols {
+			if !optional[col.Name] && t.columnIndex(col.Name) < 0 {
+				return nil, fmt.Errorf("column %q in table 0 is not in table %d", col.Name, ti)
+			}
+		}
+	}
+	if ungroup {
+		for i := range cols {
+			cols[i].Group = false
+		}
+	}
+	result := &Table{
+		Columns: cols,
+	}
+	// keyRow holds the first row, used to check that the
+	// group key values are the same in all rows.
+	var keyRow []interface{}
+	for _, t := range tables {
+		indexes := make([]int, len(cols))
+		for i, col := range cols {
+			indexes[i] = t.columnIndex(col.Name)
+		}
+		for _, row := range t.Rows {
+			newRow := make([]interface{}, len(cols))
+			for i, j := range indexes {
+				if j >= 0 {
+					newRow[i] = row[j]
+				}
+			}
+			if !ungroup {
+				if keyRow == nil {
+					keyRow = newRow
+				}
+				for i, col := range cols {
+					if col.Group && !equalValues(newRow[i], keyRow[i]) {
+						return nil, fmt.Errorf("tables have different values for group column %q", col.Name)
+					}
+				}
+			}
+			result.Rows = append(result.Rows, newRow)
+		}
+	}
+	return result, nil
+}
+
+// equalValues reports whether a and b are the same value,
+// as returned by the Reader.
+func equalValues(a, b interface{}) bool {
+	switch a := a.(type) {
+	case time.Time:
+		b, ok := b.(time.Time)
+		return ok && a.Equal(b)
+	case Decimal:
+		b, ok := b.(Decimal)
+		return ok && a.Cmp(b) == 0
+	}
+	if a != nil && !reflect.TypeOf(a).Comparable() {
+		// JSON values and lists are not comparable with ==.
+		return reflect.DeepEqual(a, b)
+	}
+	return a == b
+}
@@ -0,0 +1,194 @@
+package annotatedcsv
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	t0 := &Table{
+		Columns: []Column{
+			{},
+			{Name: "host", Type: "string", Group: true},
+			{Name: "v", Type: "long", Default: int64(1), Extra: map[string]string{"a": "x", "b": "y"}},
+			{Name: "s", Type: "string", Default: "d"},
+		},
+		Rows: [][]interface{}{
+			{nil, "h", int64(1), "p"},
+		},
+	}
+	// The second table has its columns in a different order.
+	t1 := &Table{
+		Columns: []Column{
+			{},
+			{Name: "s", Type: "string", Default: "e"},
+			{Name: "v", Type: "long", Default: int64(1), Extra: map[string]string{"a": "x", "b": "z", "c": "w"}},
+			{Name: "host", Type: "string", Group: true},
+		},
+		Rows: [][]interface{}{
+			{nil, "q", int64(2), "h"},
+			{nil, "r", nil, "h"},
+		},
+	}
+	got, err := Merge(t0, t1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectCols := []Column{
+		{},
+		{Name: "host", Type: "string", Group: true},
+		// Only the default and the extra annotations
+		// common to both tables are kept.
+		{Name: "v", Type: "long", Default: int64(1), Extra: map[string]string{"a": "x"}},
+		{Name: "s", Type: "string"},
+	}
+	if !reflect.DeepEqual(got.Columns, expectCols) {
+		t.Fatalf("unexpected columns\ngot  %#v\nwant %#v", got.Columns, expectCols)
+	}
+	expectRows := [][]interface{}{
+		{nil, "h", int64(1), "p"},
+		{nil, "h", int64(2), "q"},
+		{nil, "h", nil, "r"},
+	}
+	if !reflect.DeepEqual(got.Rows, expectRows) {
+		t.Fatalf("unexpected rows\ngot  %#v\nwant %#v", got.Rows, expectRows)
+	}
+}
+
+func TestMergeDoesNotShareExtra(t *testing.T) {
+	extra := map[string]string{"a": "x"}
+	t0 := &Table{
+		Columns: []Column{{}, {Name: "v", Type: "long", Extra: extra}},
+	}
+	got, err := Merge(t0, t0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.Columns[1].Extra["a"] = "changed"
+	if extra["a"] != "x" {
+		t.Fatalf("merged table shares extra annotations with its input")
+	}
+}
+
+func TestMergeUngrouped(t *testing.T) {
+	t0 := &Table{
+		Columns: []Column{
+			{},
+			{Name: "host", Type: "string", Group: true},
+			{Name: "region", Type: "string", Group: true},
+			{Name: "v", Type: "long"},
+		},
+		Rows: [][]interface{}{
+			{nil, "a", "eu", int64(1)},
+		},
+	}
+	// The second table has a different group key and no region column.
+	t1 := &Table{
+		Columns: []Column{
+			{},
+			{Name: "v", Type: "long"},
+			{Name: "host", Type: "string", Group: true},
+		},
+		Rows: [][]interface{}{
+			{nil, int64(2), "b"},
+		},
+	}
+	got, err := MergeUngrouped(t0, t1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectCols := []Column{
+		{},
+		{Name: "host", Type: "string"},
+		{Name: "region", Type: "string"},
+		{Name: "v", Type: "long"},
+	}
+	if !reflect.DeepEqual(got.Columns, expectCols) {
+		t.Fatalf("unexpected columns\ngot  %#v\nwant %#v", got.Columns, expectCols)
+	}
+	expectRows := [][]interface{}{
+		{nil, "a", "eu", int64(1)},
+		{nil, "b", nil, int64(2)},
+	}
+	if !reflect.DeepEqual(got.Rows, expectRows) {
+		t.Fatalf("unexpected rows\ngot  %#v\nwant %#v", got.Rows, expectRows)
+	}
+	// The input tables are unchanged.
+	if !t0.Columns[1].Group || !t1.Columns[2].Group {
+		t.Fatalf("input columns changed")
+	}
+}
+
+var mergeErrorTests = []struct {
+	testName    string
+	ungroup     bool
+	tables      []*Table
+	expectError string
+}{{
+	testName:    "no-tables",
+	expectError: `no tables to merge`,
+}, {
+	testName: "extra-column",
+	tables: []*Table{
+		{Columns: []Column{{}, {Name: "v", Type: "long"}}},
+		{Columns: []Column{{}, {Name: "v", Type: "long"}, {Name: "w", Type: "long"}}},
+	},
+	expectError: `column "w" in table 1 is not in table 0`,
+}, {
+	testName: "missing-column",
+	tables: []*Table{
+		{Columns: []Column{{}, {Name: "v", Type: "long"}, {Name: "w", Type: "long"}}},
+		{Columns: []Column{{}, {Name: "v", Type: "long"}}},
+	},
+	expectError: `column "w" in table 0 is not in table 1`,
+}, {
+	testName: "missing-non-group-column-ungrouped",
+	ungroup:  true,
+	tables: []*Table{
+		{Columns: []Column{{}, {Name: "v", Type: "long"}, {Name: "w", Type: "long"}}},
+		{Columns: []Column{{}, {Name: "v", Type: "long"}}},
+	},
+	expectError: `column "w" in table 0 is not in table 1`,
+}, {
+	testName: "datatype-mismatch",
+	tables: []*Table{
+		{Columns: []Column{{}, {Name: "v", Type: "long"}}},
+		{Columns: []Column{{}, {Name: "v", Type: "double"}}},
+	},
+	expectError: `column "v" has inconsistent datatypes "long" and "double"`,
+}, {
+	testName: "unit-mismatch",
+	tables: []*Table{
+		{Columns: []Column{{}, {Name: "v", Type: "long", Unit: "s"}}},
+		{Columns: []Column{{}, {Name: "v", Type: "long", Unit: "ms"}}},
+	},
+	expectError: `column "v" has inconsistent units "s" and "ms"`,
+}, {
+	testName: "group-mismatch",
+	tables: []*Table{
+		{Columns: []Column{{}, {Name: "v", Type: "long", Group: true}}},
+		{Columns: []Column{{}, {Name: "v", Type: "long"}}},
+	},
+	expectError: `column "v" is a group column in only some tables`,
+}, {
+	testName: "group-key-mismatch",
+	tables: []*Table{
+		{Columns: []Column{{}, {Name: "k", Type: "string", Group: true}}, Rows: [][]interface{}{{nil, "a"}}},
+		{Columns: []Column{{}, {Name: "k", Type: "string", Group: true}}, Rows: [][]interface{}{{nil, "b"}}},
+	},
+	expectError: `tables have different values for group column "k"`,
+}}
+
+func TestMergeErrors(t *testing.T) {
+	for _, test := range mergeErrorTests {
+		t.Run(test.testName, func(t *testing.T) {
+			var err error
+			if test.ungroup {
+				_, err = MergeUngrouped(test.tables...)
+			} else {
+				_, err = Merge(test.tables...)
+			}
+			assertErrorMatches(t, err, test.expectError)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package annotatedcsv
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// NewReaderAt returns a Reader that reads the first size bytes of r.
+// Many Readers can read from the same io.ReaderAt independently, so
+// the input can be scanned more than once without rereading it
+// from its original source.
+func NewReaderAt(r io.ReaderAt, size int64) *Reader {
+	return NewReader(io.NewSectionReader(r, 0, size))
+}
+
+// MappedFile holds the contents of a file mapped into memory. On
+// systems without memory mapping, the contents are read into memory
+// instead.
+type MappedFile struct {
+	data []byte
+}
+
+// MapFile maps the named file into memory.
+// The file must not be changed while it is mapped.
+func MapFile(name string) (*MappedFile, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if size != int64(int(size)) {
+		return nil, fmt.Errorf("%s: file too large to map", name)
+	}
+	data, err := mapFile(f, int(size))
+	if err != nil {
+		return nil, fmt.Errorf("cannot map %s: %v", name, err)
+	}
+	return &MappedFile{data}, nil
+}
+
+// ReadAt implements io.ReaderAt.
+func (f *MappedFile) ReadAt(buf []byte, off int64) (int, error) {
+	if f.data == nil {
+		return 0, os.ErrClosed
+	}
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset")
+	}
+	if off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(buf, f.data[off:])
+	if n < len(buf) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Size returns the size of the file.
+func (f *MappedFile) Size() int64 {
+	return int64(len(f.data))
+}
+
+// NewReader returns a Reader that reads the file
+// from the start. It must not be used after f is closed.
+func (f *MappedFile) NewReader() *Reader {
+	return NewReaderAt(f, f.Size())
+}
+
+// Close unmaps the file.
+func (f *MappedFile) Close() error {
+	if f.data == nil {
+		return os.ErrClosed
+	}
+	data := f.data
+	f.data = nil
+	return unmapFile(data)
+}
@@ -0,0 +1,119 @@
+// Package query implements running Flux queries with the
+// InfluxDB v2 HTTP API.
+package query
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/rogpeppe/annotatedcsv"
+)
+
+// Do runs the Flux query src as the given organization on the
+// InfluxDB server at serverURL, authenticating with token, and
+// returns a Reader for the results.
+//
+// Errors reported by the server part way through the response are
+// returned by the Reader's Err method as an *annotatedcsv.QueryError.
+// The response is closed when the Reader reaches its end; to stop
+// reading early, cancel ctx.
+func Do(ctx context.Context, serverURL, token, org, src string) (*annotatedcsv.Reader, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %v", err)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/v2/query"
+	u.RawQuery = url.Values{"org": {org}}.Encode()
+	body, err := json.Marshal(request{
+		Query: src,
+		Type:  "flux",
+		Dialect: dialect{
+			Annotations:    []string{"datatype", "group", "default"},
+			Delimiter:      ",",
+			Header:         true,
+			CommentPrefix:  "#",
+			DateTimeFormat: "RFC3339Nano",
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/csv")
+	if token != "" {
+		req.Header.Set("Authorization", "Token "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	r := annotatedcsv.NewReader(&autoCloser{rc: resp.Body})
+	r.SetDetectErrors(true)
+	return r, nil
+}
+
+type request struct {
+	Query   string  `json:"query"`
+	Type    string  `json:"type"`
+	Dialect dialect `json:"dialect"`
+}
+
+type dialect struct {
+	Annotations    []string `json:"annotations"`
+	Delimiter      string   `json:"delimiter"`
+	Header         bool     `json:"header"`
+	CommentPrefix  string   `json:"commentPrefix"`
+	DateTimeFormat string   `json:"dateTimeFormat"`
+}
+
+// responseError returns the error described by an unsuccessful
+// response, which usually holds a JSON error message.
+func responseError(resp *http.Response) error {
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var errResp struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(data, &errResp); err == nil && errResp.Message != "" {
+		return fmt.Errorf("query failed: %s: %s", resp.Status, errResp.Message)
+	}
+	if data = bytes.TrimSpace(data); len(data) > 0 {
+		return fmt.Errorf("query failed: %s: %s", resp.Status, data)
+	}
+	return fmt.Errorf("query failed: %s", resp.Status)
+}
+
+// autoCloser closes the underlying reader when
+// a read returns an error.
+type autoCloser struct {
+	rc     io.ReadCloser
+	closed bool
+}
+
+func (r *autoCloser) Read(buf []byte) (int, error) {
+	if r.closed {
+		return 0, io.EOF
+	}
+	n, err := r.rc.Read(buf)
+	if err != nil {
+		r.rc.Close()
+		r.closed = true
+	}
+	return n, err
+}
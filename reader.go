@@ -2,9 +2,12 @@ package annotatedcsv
 
 import (
 	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
+	"net/netip"
 	"os"
 	"strconv"
 	"strings"
@@ -16,6 +19,15 @@ type Column struct {
 	Group   bool
 	Default interface{}
 	Type    string
+	// Unit holds the unit of the column's values from
+	// the #unit annotation, such as "bytes" or "ms",
+	// or the empty string if there is none.
+	Unit string
+	// Extra holds the values of any other annotations,
+	// such as vendor-specific ones, keyed by annotation
+	// name without the leading "#". The Writer writes them
+	// out again unchanged.
+	Extra map[string]string
 }
 
 func NewReader(r io.Reader) *Reader {
@@ -23,6 +35,7 @@ func NewReader(r io.Reader) *Reader {
 		r: csv.NewReader(r),
 	}
 	r1.r.FieldsPerRecord = -1
+	r1.HandleAnnotation("#constant", r1.constantAnnotation)
 	return r1
 }
 
@@ -31,6 +44,71 @@ type Reader struct {
 	row  []interface{}
 	err  error
 
+	detectErrors bool
+
+	expectSchema     Schema
+	schemaStrictness Strictness
+
+	checkGroupKeys bool
+	// groupKey holds the first row of the current table
+	// when checkGroupKeys is set, and groupKeyLine its line.
+	groupKey     []interface{}
+	groupKeyLine int
+
+	rowLength RowLengthMode
+
+	emptyCells EmptyCells
+	nullMarker string
+	nonFinite  NonFinite
+
+	listDelimiter string
+	location      *time.Location
+	epochUnit     time.Duration
+
+	relaxedNumbers bool
+
+	// enums holds the allowed values of each enum
+	// set with SetEnum.
+	enums map[string]map[string]bool
+
+	hooks map[string]func(interface{}) (interface{}, error)
+
+	// units holds the units set with SetUnit,
+	// and unitConvs the conversion for each column
+	// of the current table, if any.
+	units     map[string]string
+	unitConvs []*unitConversion
+
+	annotationHandlers map[string]AnnotationHandler
+	// handledRows holds the annotation rows of the current
+	// table that have handlers, and ncells the number of
+	// cells in each row of the table, which is less than
+	// the number of columns if handlers have added some.
+	handledRows [][]string
+	ncells      int
+
+	// extended holds whether the current table is in the
+	// extended annotated CSV format, whose rows have no
+	// annotation column, and extendedRow is used to hold
+	// each row with an empty annotation cell added.
+	extended    bool
+	extendedRow []string
+
+	duplicates DuplicatePolicy
+	ignored    map[string]bool
+	// keep holds whether each cell of a row is kept when
+	// columns have been dropped from the current table,
+	// or nil if all cells are kept.
+	keep []bool
+
+	onTableStart func(cols []Column)
+	onTableEnd   func(stats TableStats)
+	// stats holds the statistics of the current table.
+	stats TableStats
+	// tableLine holds the line of the input at which the
+	// current table starts, counting blank lines.
+	tableLine int
+
 	hasPeeked bool
 	peekRow   []string
 	peekErr   error
@@ -38,6 +116,268 @@ type Reader struct {
 	line      int
 }
 
+// TableStats holds statistics about a table read by a Reader.
+type TableStats struct {
+	// Columns holds the columns of the table.
+	Columns []Column
+	// Line holds the line of the input at which the table
+	// starts, counting blank lines and the lines of any
+	// multi-line cells.
+	Line int
+	// Rows holds the number of rows read.
+	Rows int
+	// SkippedRows holds the number of rows skipped
+	// because of the SkipBadRows row length mode.
+	SkippedRows int
+}
+
+// OnTableStart sets a function that is called with the columns of
+// each table when NextTable advances to it.
+func (r *Reader) OnTableStart(f func(cols []Column)) {
+	r.onTableStart = f
+}
+
+// OnTableEnd sets a function that is called with the statistics of
+// each table when NextRow reaches its end, including when reading it
+// fails, in which case Err returns the error.
+func (r *Reader) OnTableEnd(f func(stats TableStats)) {
+	r.onTableEnd = f
+}
+
+// SetDetectErrors sets whether the Reader treats tables in the form
+// used by InfluxDB to report query errors, with only error and
+// reference columns, as errors. When it's enabled, NextTable returns
+// false on reaching such a table and Err returns a *QueryError.
+// Any input after an error table is discarded.
+func (r *Reader) SetDetectErrors(detect bool) {
+	r.detectErrors = detect
+}
+
+// ExpectSchema sets the schema that all tables read by the Reader
+// are expected to have. A table deviates from the schema if it does
+// not have the same columns in the same order with the same
+// datatypes, group flags and units; default values and extra
+// annotations are not compared. The mode determines what happens
+// when a table deviates: with SchemaWarn the differences are printed
+// to standard error, and with SchemaStrict NextTable returns false
+// and Err returns a *SchemaError. A nil schema disables the check.
+func (r *Reader) ExpectSchema(s Schema, mode Strictness) {
+	r.expectSchema = s
+	r.schemaStrictness = mode
+}
+
+// SetCheckGroupKeys sets whether the Reader checks that the values
+// of the group columns are the same in every row of a table, as the
+// annotated CSV specification requires. When it's enabled and a row
+// has a different group column value from the first row of its table,
+// NextRow returns false and Err returns an error describing the row.
+func (r *Reader) SetCheckGroupKeys(check bool) {
+	r.checkGroupKeys = check
+}
+
+// EmptyCells determines how a Reader interprets empty cells in
+// columns without a default value. Empty cells in columns with a
+// default value always hold the default.
+type EmptyCells int
+
+const (
+	// EmptyNull treats empty cells as null, represented as nil.
+	EmptyNull EmptyCells = iota
+
+	// EmptyZero treats empty cells as the zero value of the
+	// column's datatype: false, 0, the empty string or the zero
+	// time.Time, for example. Empty ip, cidr, json and list
+	// cells are null.
+	EmptyZero
+)
+
+// SetEmptyCells sets how the Reader interprets empty cells in
+// columns without a default value. By default, EmptyNull is used.
+func (r *Reader) SetEmptyCells(mode EmptyCells) {
+	r.emptyCells = mode
+}
+
+// SetNullMarker sets a marker for explicitly null cells: a cell
+// holding exactly the marker, such as "null" or "\N", is read as
+// nil even if the column has a default value. An empty marker,
+// the default, disables this.
+func (r *Reader) SetNullMarker(marker string) {
+	r.nullMarker = marker
+}
+
+// NonFinite determines how a Reader represents infinite
+// and NaN values of datatype double.
+type NonFinite int
+
+const (
+	// NonFiniteString represents them as the strings
+	// "+Inf", "-Inf" and "NaN".
+	NonFiniteString NonFinite = iota
+
+	// NonFiniteFloat represents them as float64 values.
+	NonFiniteFloat
+
+	// NonFiniteNull represents them as nil.
+	NonFiniteNull
+)
+
+// SetNonFinite sets how the Reader represents infinite and NaN
+// doubles, including default values. By default, NonFiniteString
+// is used, so that all float64 values can be encoded as JSON.
+func (r *Reader) SetNonFinite(mode NonFinite) {
+	r.nonFinite = mode
+}
+
+// SetListDelimiter sets the delimiter between the elements of values
+// of list datatypes such as list:long. By default,
+// DefaultListDelimiter is used. An empty cell holds a null list
+// rather than an empty one.
+func (r *Reader) SetListDelimiter(sep string) {
+	r.listDelimiter = sep
+}
+
+// SetLocation sets the location used for dateTime values that
+// lack a zone offset, such as "2021-03-04T05:06:07", which are
+// otherwise an error, or whose time format lacks one, such as
+// dateTime:2006-01-02, which are otherwise in UTC. A nil location
+// restores the default.
+func (r *Reader) SetLocation(loc *time.Location) {
+	r.location = loc
+}
+
+// SetEpochUnit sets the unit of values of the dateTime:number
+// datatype, which hold integer counts of units since the Unix epoch.
+// The unit must be time.Second, time.Millisecond, time.Microsecond
+// or time.Nanosecond, the default.
+func (r *Reader) SetEpochUnit(unit time.Duration) {
+	checkEpochUnit(unit)
+	r.epochUnit = unit
+}
+
+// SetRelaxedNumbers sets whether the Reader accepts values of the
+// long and unsignedLong datatypes written in hexadecimal with a 0x
+// prefix, such as "0x1F", or in decimal or scientific notation, such
+// as "1e6" or "2.50", as produced by spreadsheets. Values that are
+// not exact integers in range are still an error.
+func (r *Reader) SetRelaxedNumbers(relaxed bool) {
+	r.relaxedNumbers = relaxed
+}
+
+// SetColumnHook sets a function that is called with each value in
+// columns with the given name after it has been converted to its
+// datatype, including nil values, and whose result is used as the
+// value instead. It is also called with the column's default value,
+// if any, to make the default of the column returned by Columns.
+// For example, a hook can normalize units or redact values. The
+// result should be of the type returned for the column's datatype
+// if the row is to be written out again. An error returned by the
+// hook is treated as a parse error. A nil fn removes the hook.
+func (r *Reader) SetColumnHook(name string, fn func(interface{}) (interface{}, error)) {
+	if fn == nil {
+		delete(r.hooks, name)
+		return
+	}
+	if r.hooks == nil {
+		r.hooks = make(map[string]func(interface{}) (interface{}, error))
+	}
+	r.hooks[name] = fn
+}
+
+// SetUnit sets the unit that values in columns with the given name
+// are converted to from the unit in the table's #unit annotation. The
+// column must have a unit of the same dimension, such as time or
+// bytes; see Units. Columns of integer datatypes become double
+// columns if the conversion would lose precision. An empty unit
+// removes the conversion.
+func (r *Reader) SetUnit(name, unit string) {
+	if unit == "" {
+		delete(r.units, name)
+		return
+	}
+	if r.units == nil {
+		r.units = make(map[string]string)
+	}
+	r.units[name] = unit
+}
+
+// RowLengthMode determines how a Reader handles rows that do not
+// have the same number of cells as the table header. It is a
+// combination of flags; when no flag applies to a row, the row is
+// treated as an error.
+type RowLengthMode int
+
+const (
+	// PadShortRows pads rows with too few cells.
+	// The missing cells are treated as empty.
+	PadShortRows RowLengthMode = 1 << iota
+
+	// TruncateLongRows ignores any extra cells in rows with too
+	// many cells.
+	TruncateLongRows
+
+	// SkipBadRows skips rows with the wrong number of cells,
+	// printing a warning to standard error.
+	SkipBadRows
+)
+
+// SetRowLengthMode sets how the Reader handles rows with the wrong
+// number of cells. By default, such rows cause an error.
+func (r *Reader) SetRowLengthMode(mode RowLengthMode) {
+	r.rowLength = mode
+}
+
+// DuplicatePolicy determines how a Reader handles
+// tables with more than one column of the same name.
+type DuplicatePolicy int
+
+const (
+	// DuplicateAllow returns the columns as they are.
+	DuplicateAllow DuplicatePolicy = iota
+
+	// DuplicateError treats duplicate column names as an error.
+	DuplicateError
+
+	// DuplicateKeepFirst omits all but the first column
+	// of each name from the columns and rows.
+	DuplicateKeepFirst
+
+	// DuplicateRename renames the second and subsequent columns
+	// of each name by adding a suffix, so the second column named
+	// x becomes x_2, the third x_3, and so on, skipping any
+	// names already used in the table.
+	DuplicateRename
+)
+
+// SetDuplicateColumns sets how the Reader handles tables with
+// duplicate column names. By default, DuplicateAllow is used.
+func (r *Reader) SetDuplicateColumns(policy DuplicatePolicy) {
+	r.duplicates = policy
+}
+
+// SetIgnoredColumns sets the names of columns that the Reader drops
+// from all tables, as it does columns with the ignored datatype, so
+// that their values are never parsed or stored.
+func (r *Reader) SetIgnoredColumns(names []string) {
+	r.ignored = make(map[string]bool)
+	for _, name := range names {
+		r.ignored[name] = true
+	}
+}
+
+// QueryError represents an error reported in a query response.
+type QueryError struct {
+	Message string
+	// Reference holds an optional error code.
+	Reference string
+}
+
+func (e *QueryError) Error() string {
+	if e.Reference != "" {
+		return fmt.Sprintf("query error: %s (reference %s)", e.Message, e.Reference)
+	}
+	return "query error: " + e.Message
+}
+
 // NextTable advances to the next table and reports whether
 // there is one.
 func (r *Reader) NextTable() bool {
@@ -52,15 +392,114 @@ func (r *Reader) NextTable() bool {
 		r.err = err
 		return false
 	}
-	cols, err := r.readHeader()
+	r.tableLine, _ = r.r.FieldPos(0)
+	cols, defaults, err := r.readHeader()
+	// Note: r.line counts records rather than lines,
+	// so find the header row's line from the CSV reader.
+	headerLine, _ := r.r.FieldPos(0)
+	if err == nil {
+		var ignoredKeep, duplicateKeep []bool
+		cols, ignoredKeep = r.dropIgnored(cols)
+		cols, duplicateKeep, err = resolveDuplicates(cols, r.duplicates)
+		r.keep = combineKeep(ignoredKeep, duplicateKeep)
+		if err == nil {
+			// Only the defaults of the remaining columns
+			// are parsed, so a column can be ignored
+			// because its default is invalid.
+			err = r.parseDefaults(cols, defaults)
+		}
+		if err == nil {
+			cols, err = r.handleAnnotations(cols)
+		}
+		if err == nil {
+			err = r.transformColumns(cols)
+		}
+		if err != nil {
+			err = fmt.Errorf("%v at line %d", err, r.line)
+		}
+	}
 	if err != nil {
 		r.err = err
 		return false
 	}
 	r.cols = cols
+	r.groupKey = nil
+	if r.detectErrors && isErrorTable(cols) {
+		r.err = r.readQueryError()
+		r.cols = nil
+		// Read to the end so that any underlying
+		// network response can be completed.
+		for {
+			if _, err := r.read(); err != nil {
+				break
+			}
+		}
+		return false
+	}
+	if r.expectSchema != nil {
+		if diffs := schemaDeviations(r.expectSchema, cols); len(diffs) > 0 {
+			err := &SchemaError{
+				Line:  headerLine,
+				Diffs: diffs,
+			}
+			if r.schemaStrictness == SchemaStrict {
+				r.err = err
+				r.cols = nil
+				return false
+			}
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+	}
+	r.stats = TableStats{
+		Columns: cols,
+		Line:    r.tableLine,
+	}
+	if r.onTableStart != nil {
+		r.onTableStart(cols)
+	}
 	return true
 }
 
+// isErrorTable reports whether the table with the given
+// columns is an error table.
+func isErrorTable(cols []Column) bool {
+	hasError := false
+	for _, col := range cols {
+		switch col.Name {
+		case "error":
+			hasError = true
+		case "", "reference":
+		default:
+			return false
+		}
+	}
+	return hasError
+}
+
+// readQueryError returns the error described by the
+// first row of the current table.
+func (r *Reader) readQueryError() error {
+	row, err := r.readRow(nil)
+	if err != nil {
+		return err
+	}
+	qerr := &QueryError{
+		Message: "unknown error",
+	}
+	for i, col := range r.cols {
+		if i >= len(row) || row[i] == nil {
+			continue
+		}
+		switch col.Name {
+		case "error":
+			qerr.Message = fmt.Sprint(row[i])
+		case "reference":
+			qerr.Reference = fmt.Sprint(row[i])
+		}
+	}
+	return qerr
+}
+
 // Err returns any error encountered when parsing.
 func (r *Reader) Err() error {
 	if r.err == io.EOF {
@@ -77,75 +516,265 @@ func (r *Reader) Columns() []Column {
 // NextRow advances to the next row in the current table
 // and reports whether there is one.
 func (r *Reader) NextRow() bool {
+	return r.nextRow(nil)
+}
+
+// nextRow is like NextRow except that the row is
+// stored in buf if it has enough capacity.
+func (r *Reader) nextRow(buf []interface{}) bool {
 	if r.cols == nil || r.err != nil {
 		return false
 	}
-	row, err := r.readRow()
+	row, err := r.readRow(buf)
+	if row != nil && r.checkGroupKeys {
+		err = r.checkGroupKey(row)
+		if err != nil {
+			row = nil
+		}
+	}
 	r.row = row
 	if row == nil {
 		r.err = err
 		r.cols = nil
+		if r.onTableEnd != nil {
+			r.onTableEnd(r.stats)
+		}
 		return false
 	}
+	r.stats.Rows++
 	return true
 }
 
+// checkGroupKey checks that the group column values
+// in row are the same as in the first row of the table.
+func (r *Reader) checkGroupKey(row []interface{}) error {
+	if r.groupKey == nil {
+		// Copy the row, as ReadRows may reuse it.
+		r.groupKey, r.groupKeyLine = append([]interface{}(nil), row...), r.line
+		return nil
+	}
+	for i, col := range r.cols {
+		if col.Group && !equalValues(row[i], r.groupKey[i]) {
+			return fmt.Errorf("group column %q has value %v at line %d but %v at line %d", col.Name, row[i], r.line, r.groupKey[i], r.groupKeyLine)
+		}
+	}
+	return nil
+}
+
 // Row returns the items in the current row of the current table.
 func (r *Reader) Row() []interface{} {
 	return r.row
 }
 
-func (r *Reader) readRow() ([]interface{}, error) {
-	row, err := r.peek()
-	if err != nil {
-		return nil, nil
+// ReadRows reads rows from the current table into dst, which avoids
+// much of the overhead of calling NextRow for each row. It returns the
+// number of rows read. If fewer than len(dst) rows are read, the error
+// is io.EOF at the end of the table, or the error that Err returns.
+//
+// Each element of dst is reused to hold a row if it has enough
+// capacity, so the rows may be overwritten by the next call.
+func (r *Reader) ReadRows(dst [][]interface{}) (int, error) {
+	for i := range dst {
+		if !r.nextRow(dst[i]) {
+			if err := r.Err(); err != nil {
+				return i, err
+			}
+			return i, io.EOF
+		}
+		dst[i] = r.row
 	}
-	if len(row) > 0 && strings.HasPrefix(row[0], "#") {
-		// Start of next table.
-		return nil, nil
+	return len(dst), nil
+}
+
+// readRow reads the next row of the current table, storing
+// it in buf if it has enough capacity. It returns nil with
+// no error at the end of the table.
+func (r *Reader) readRow(buf []interface{}) ([]interface{}, error) {
+	for {
+		row, err := r.peek()
+		if err != nil {
+			return nil, nil
+		}
+		if len(row) > 0 && strings.HasPrefix(row[0], "#") {
+			// Start of next table.
+			return nil, nil
+		}
+		r.read()
+		ncols := r.ncells
+		if r.keep != nil {
+			ncols = len(r.keep)
+		}
+		if r.extended {
+			// The row has no annotation column.
+			ncols--
+		}
+		if len(row) != ncols {
+			switch {
+			case len(row) < ncols && r.rowLength&PadShortRows != 0:
+				row = append(row, make([]string, ncols-len(row))...)
+			case len(row) > ncols && r.rowLength&TruncateLongRows != 0:
+				row = row[:ncols]
+			case r.rowLength&SkipBadRows != 0:
+				fmt.Fprintf(os.Stderr, "warning: skipping row with inconsistent number of columns at line %d; got %d want %d\n", r.line, len(row), ncols)
+				r.stats.SkippedRows++
+				continue
+			default:
+				return nil, fmt.Errorf("inconsistent number of columns at line %d; got %d want %d", r.line, len(row), ncols)
+			}
+		}
+		if r.extended {
+			r.extendedRow = append(append(r.extendedRow[:0], ""), row...)
+			row = r.extendedRow
+		}
+		if r.keep != nil {
+			kept := row[:0]
+			for i, val := range row {
+				if r.keep[i] {
+					kept = append(kept, val)
+				}
+			}
+			row = kept
+		}
+		var rowVals []interface{}
+		if cap(buf) >= len(r.cols) {
+			rowVals = buf[:len(r.cols)]
+			for i := range rowVals {
+				rowVals[i] = nil
+			}
+		} else {
+			rowVals = make([]interface{}, len(r.cols))
+		}
+		for i, val := range row {
+			col := r.cols[i]
+			if r.nullMarker != "" && val == r.nullMarker {
+				continue
+			}
+			if val == "" {
+				if col.Default != nil {
+					rowVals[i] = col.Default
+				} else if r.emptyCells == EmptyZero && i > 0 {
+					rowVals[i] = zeroValue(col.Type)
+				}
+				continue
+			}
+			x, err := r.convert(val, col.Type)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse %q as type %q at line %d", val, col.Type, r.line)
+			}
+			x = r.double(x, col.Type)
+			if r.unitConvs != nil && r.unitConvs[i] != nil {
+				x, err = r.unitConvs[i].convert(x)
+				if err != nil {
+					return nil, fmt.Errorf("cannot convert %q to %s at line %d: %v", val, col.Unit, r.line, err)
+				}
+			}
+			rowVals[i] = x
+		}
+		for i := len(row); i < len(r.cols); i++ {
+			// Columns added by annotation handlers.
+			rowVals[i] = r.cols[i].Default
+		}
+		if err := r.applyHooks(row, rowVals); err != nil {
+			return nil, err
+		}
+		return rowVals, nil
+	}
+}
+
+// transformColumns applies the unit conversions set with SetUnit
+// and the hooks set with SetColumnHook to the columns of a new
+// table, including their default values.
+func (r *Reader) transformColumns(cols []Column) error {
+	r.unitConvs = nil
+	for i := 1; i < len(cols); i++ {
+		col := &cols[i]
+		if unit, ok := r.units[col.Name]; ok && unit != col.Unit {
+			conv, err := newUnitConversion(col.Type, col.Unit, unit)
+			if err != nil {
+				return fmt.Errorf("column %q: %v", col.Name, err)
+			}
+			x, err := conv.convert(col.Default)
+			if err != nil {
+				return fmt.Errorf("cannot convert default value of column %q: %v", col.Name, err)
+			}
+			if r.unitConvs == nil {
+				r.unitConvs = make([]*unitConversion, len(cols))
+			}
+			r.unitConvs[i] = conv
+			col.Type, col.Unit, col.Default = conv.typ, unit, x
+		}
+		if hook := r.hooks[col.Name]; hook != nil && col.Default != nil {
+			x, err := hook(col.Default)
+			if err != nil {
+				return fmt.Errorf("cannot transform default value of column %q: %v", col.Name, err)
+			}
+			col.Default = x
+		}
 	}
-	r.read()
-	if len(row) != len(r.cols) {
-		return nil, fmt.Errorf("inconsistent number of columns at line %d; got %d want %d", r.line, len(row), len(r.cols))
+	return nil
+}
+
+// applyHooks applies the hooks set with SetColumnHook to the values
+// read from the given cells. Default values have already had the
+// hooks applied, so they are left alone.
+func (r *Reader) applyHooks(cells []string, row []interface{}) error {
+	if len(r.hooks) == 0 {
+		return nil
 	}
-	rowVals := make([]interface{}, len(row))
-	for i, val := range row {
+	for i := 1; i < len(row); i++ {
 		col := r.cols[i]
-		if col.Default != nil && val == "" {
-			rowVals[i] = col.Default
-			continue
-		}
-		if val == "" && col.Name == "" {
+		hook := r.hooks[col.Name]
+		if hook == nil || i >= len(cells) || cells[i] == "" && col.Default != nil {
 			continue
 		}
-		x, err := convertToType(val, col.Type)
+		x, err := hook(row[i])
 		if err != nil {
-			return nil, fmt.Errorf("cannot parse %q as type %q at line %d", val, col.Type, r.line)
+			return fmt.Errorf("cannot transform value of column %q at line %d: %v", col.Name, r.line, err)
 		}
-		rowVals[i] = x
+		row[i] = x
 	}
-	return rowVals, nil
+	return nil
 }
 
-func (r *Reader) readHeader() ([]Column, error) {
+// readHeader reads the annotations and header row of a table.
+// It returns the columns and the row of default values, if any,
+// which are not parsed until any columns have been dropped.
+func (r *Reader) readHeader() ([]Column, []string, error) {
 	var cols []Column
 	var defaults []string
+	r.handledRows = nil
+	r.extended = false
 	for {
 		row, err := r.peek()
 		if err != nil {
 			if len(cols) > 0 {
 				err = nil
 			}
-			return cols, err
+			return cols, nil, err
 		}
 		r.read()
+		if len(row) > 0 && r.isHandled(row[0]) {
+			r.handledRows = append(r.handledRows, row)
+			continue
+		}
+		if len(row) > 0 && strings.HasPrefix(row[0], "#") {
+			if keyword, value, ok := strings.Cut(row[0], " "); ok {
+				// In the extended annotated CSV format read by
+				// "influx write", there is no annotation column
+				// and the first value follows the keyword.
+				row = append([]string{keyword, value}, row[1:]...)
+				r.extended = true
+			}
+		} else if r.extended {
+			row = append([]string{""}, row...)
+		}
 		if cols == nil {
 			if len(row) == 0 {
-				return nil, fmt.Errorf("no columns in table header at line %d", r.line)
+				return nil, nil, fmt.Errorf("no columns in table header at line %d", r.line)
 			}
 			cols = make([]Column, len(row))
 		} else if len(row) != len(cols) {
-			return nil, fmt.Errorf("inconsistent table header (got %d items want %d)", len(row), len(cols))
+			return nil, nil, fmt.Errorf("inconsistent table header (got %d items want %d)", len(row), len(cols))
 		}
 		if !strings.HasPrefix(row[0], "#") {
 			for i, col := range row {
@@ -165,26 +794,298 @@ func (r *Reader) readHeader() ([]Column, error) {
 			}
 		case "#default":
 			defaults = row
+		case "#unit":
+			for i := 1; i < len(row); i++ {
+				cols[i].Unit = row[i]
+			}
 		default:
-			fmt.Fprintf(os.Stderr, "unknown column annotation %q\n", row[0])
+			key := strings.TrimPrefix(row[0], "#")
+			for i := 1; i < len(row); i++ {
+				if cols[i].Extra == nil {
+					cols[i].Extra = make(map[string]string)
+				}
+				cols[i].Extra[key] = row[i]
+			}
 		}
 	}
-	if defaults != nil {
-		for i := 1; i < len(defaults); i++ {
-			if defaults[i] == "" {
-				continue
+	return cols, defaults, nil
+}
+
+// parseDefaults sets the default values of cols from the
+// cells of the #default annotation row, if any, dropping
+// the cells of columns that are not kept.
+func (r *Reader) parseDefaults(cols []Column, defaults []string) error {
+	if defaults == nil {
+		return nil
+	}
+	if r.keep != nil {
+		kept := make([]string, 0, len(cols))
+		for i, d := range defaults {
+			if r.keep[i] {
+				kept = append(kept, d)
 			}
-			x, err := convertToType(defaults[i], cols[i].Type)
-			if err != nil {
-				return nil, fmt.Errorf("cannot convert default value %q to type %q: %v", defaults[i], cols[i].Type, err)
+		}
+		defaults = kept
+	}
+	for i := 1; i < len(defaults); i++ {
+		if defaults[i] == "" {
+			continue
+		}
+		x, err := r.convert(defaults[i], cols[i].Type)
+		if err != nil {
+			return fmt.Errorf("cannot convert default value %q to type %q: %v", defaults[i], cols[i].Type, err)
+		}
+		cols[i].Default = r.double(x, cols[i].Type)
+	}
+	return nil
+}
+
+// resolveDuplicates applies the given policy to any duplicate
+// column names in cols. If columns are dropped, it also returns
+// whether each of the original columns is kept.
+func resolveDuplicates(cols []Column, policy DuplicatePolicy) ([]Column, []bool, error) {
+	if policy == DuplicateAllow {
+		return cols, nil, nil
+	}
+	used := make(map[string]bool)
+	for _, col := range cols {
+		used[col.Name] = true
+	}
+	seen := make(map[string]int)
+	var keep []bool
+	for i, col := range cols {
+		seen[col.Name]++
+		n := seen[col.Name]
+		if n == 1 {
+			continue
+		}
+		switch policy {
+		case DuplicateError:
+			return nil, nil, fmt.Errorf("duplicate column name %q", col.Name)
+		case DuplicateKeepFirst:
+			if keep == nil {
+				keep = make([]bool, len(cols))
+				for j := range keep {
+					keep[j] = true
+				}
+			}
+			keep[i] = false
+		case DuplicateRename:
+			name := fmt.Sprintf("%s_%d", col.Name, n)
+			for used[name] {
+				n++
+				name = fmt.Sprintf("%s_%d", col.Name, n)
+			}
+			seen[col.Name] = n
+			used[name] = true
+			cols[i].Name = name
+		}
+	}
+	if keep != nil {
+		cols = keepColumns(cols, keep)
+	}
+	return cols, keep, nil
+}
+
+// dropIgnored removes the columns with the ignored datatype and
+// those set with SetIgnoredColumns from cols. If columns are
+// dropped, it also returns whether each of the original columns
+// is kept.
+func (r *Reader) dropIgnored(cols []Column) ([]Column, []bool) {
+	var keep []bool
+	for i := 1; i < len(cols); i++ {
+		if cols[i].Type != "ignored" && !r.ignored[cols[i].Name] {
+			continue
+		}
+		if keep == nil {
+			keep = make([]bool, len(cols))
+			for j := range keep {
+				keep[j] = true
 			}
-			cols[i].Default = x
+		}
+		keep[i] = false
+	}
+	if keep == nil {
+		return cols, nil
+	}
+	return keepColumns(cols, keep), keep
+}
+
+// keepColumns returns the columns for which keep is true.
+func keepColumns(cols []Column, keep []bool) []Column {
+	kept := make([]Column, 0, len(cols))
+	for i, col := range cols {
+		if keep[i] {
+			kept = append(kept, col)
+		}
+	}
+	return kept
+}
+
+// combineKeep returns whether each cell of a row is kept when
+// keep0 is applied to the cells and then keep1 is applied to
+// the remaining cells. A nil slice keeps all cells.
+func combineKeep(keep0, keep1 []bool) []bool {
+	if keep0 == nil {
+		return keep1
+	}
+	if keep1 == nil {
+		return keep0
+	}
+	keep := make([]bool, len(keep0))
+	j := 0
+	for i, k := range keep0 {
+		if k {
+			keep[i] = keep1[j]
+			j++
+		}
+	}
+	return keep
+}
+
+// double returns x, a value of the given datatype, with
+// non-finite doubles represented as specified by SetNonFinite.
+func (r *Reader) double(x interface{}, typ string) interface{} {
+	s, ok := x.(string)
+	if !ok || typ != "double" || r.nonFinite == NonFiniteString {
+		return x
+	}
+	if r.nonFinite == NonFiniteNull {
+		return nil
+	}
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
+
+// zeroValue returns the zero value of the type
+// that the Reader returns for the given datatype.
+func zeroValue(typ string) interface{} {
+	switch DatatypeKind(typ) {
+	case BooleanKind:
+		return false
+	case LongKind:
+		return int64(0)
+	case UnsignedLongKind:
+		return uint64(0)
+	case DoubleKind:
+		return float64(0)
+	case DecimalKind:
+		return Decimal{}
+	case UUIDKind:
+		return UUID{}
+	case DateTimeKind:
+		return time.Time{}
+	case IPKind, CIDRKind, JSONKind, ListKind:
+		// There is no meaningful zero value.
+		return nil
+	}
+	return ""
+}
+
+// parseJSON parses s as a single JSON value. Objects are returned
+// as map[string]interface{}, arrays as []interface{} and numbers as
+// json.Number so that no precision is lost.
+func parseJSON(s string) (interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	return v, nil
+}
+
+// convert is like convertToType but uses the options
+// set on the Reader.
+func (r *Reader) convert(s string, typ string) (interface{}, error) {
+	if elem, ok := listElemType(typ); ok {
+		sep := r.listDelimiter
+		if sep == "" {
+			sep = DefaultListDelimiter
+		}
+		if x, err := parseList(s, elem, sep, r.parseValue); err != errUnknownDatatype {
+			return x, err
+		}
+	} else if x, err := r.parseValue(s, typ); err != errUnknownDatatype {
+		return x, err
+	}
+	return convertToType(s, typ)
+}
+
+// zonelessLayout is the layout used to parse dateTime
+// values that lack a zone offset.
+const zonelessLayout = "2006-01-02T15:04:05.999999999"
+
+// parseValue is like the parseValue function but parses dateTime
+// values that lack a zone offset in the location set with
+// SetLocation, epoch times in the unit set with SetEpochUnit and
+// integers as set with SetRelaxedNumbers.
+func (r *Reader) parseValue(s string, typ string) (interface{}, error) {
+	if typ == epochDatatype {
+		return parseEpoch(s, r.epochUnit)
+	}
+	if name, ok := enumName(typ); ok {
+		if err := r.checkEnum(s, name); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	if r.location != nil && DatatypeKind(typ) == DateTimeKind {
+		layout, ok := timeLayout(typ)
+		if !ok {
+			layout = time.RFC3339Nano
+		}
+		if t, err := time.ParseInLocation(layout, s, r.location); err == nil {
+			return t, nil
+		}
+		if t, err := time.ParseInLocation(zonelessLayout, s, r.location); err == nil {
+			return t, nil
 		}
 	}
-	return cols, nil
+	x, err := parseValue(s, typ)
+	if err != nil && r.relaxedNumbers && (typ == "long" || typ == "unsignedLong") {
+		return parseRelaxedInt(s, typ)
+	}
+	return x, err
 }
 
 func convertToType(s string, typ string) (interface{}, error) {
+	x, err := parseValue(s, typ)
+	if err == errUnknownDatatype {
+		fmt.Fprintf(os.Stderr, "unknown datatype %q\n", typ)
+		return s, nil
+	}
+	return x, err
+}
+
+// ParseValue parses s as a value of the given datatype in the
+// same way that the Reader parses cells. Unlike the Reader,
+// it returns an error if the datatype is not known.
+func ParseValue(s string, typ string) (interface{}, error) {
+	x, err := parseValue(s, typ)
+	if err == errUnknownDatatype {
+		return nil, fmt.Errorf("unknown datatype %q", typ)
+	}
+	return x, err
+}
+
+// KnownDatatype reports whether typ is a datatype
+// understood by the Reader.
+func KnownDatatype(typ string) bool {
+	if strings.HasPrefix(typ, "dateTime:") {
+		_, ok := timeLayout(typ)
+		return ok || typ == epochDatatype
+	}
+	_, err := parseValue("", typ)
+	return err != errUnknownDatatype
+}
+
+var errUnknownDatatype = errors.New("unknown datatype")
+
+func parseValue(s string, typ string) (interface{}, error) {
 	switch typ {
 	case "boolean":
 		return strconv.ParseBool(s)
@@ -201,20 +1102,103 @@ func convertToType(s string, typ string) (interface{}, error) {
 			return s, nil
 		}
 		return x, nil
-	case "string", "tag", "":
+	case "decimal":
+		return ParseDecimal(s)
+	case "uuid":
+		return ParseUUID(s)
+	case "ip":
+		return netip.ParseAddr(s)
+	case "cidr":
+		return netip.ParsePrefix(s)
+	case "json":
+		return parseJSON(s)
+	case "string", "tag", "measurement", "field", "":
 		return s, nil
+	case "ignored":
+		// The Reader drops columns with this datatype.
+		return nil, nil
+	case "dateTime":
+		return parseDateTime(s)
 	}
-	if timeFormat := strings.TrimPrefix(typ, "dateTime:"); len(timeFormat) != len(typ) {
-		layout := timeFormats[timeFormat]
-		if layout == "" {
-			return nil, fmt.Errorf("unknown time format %q", typ)
-		}
+	if typ == epochDatatype {
+		return parseEpoch(s, time.Nanosecond)
+	}
+	if _, ok := enumName(typ); ok {
+		return s, nil
+	}
+	if layout, ok := timeLayout(typ); ok {
 		return time.Parse(layout, s)
 	}
-	fmt.Fprintf(os.Stderr, "unknown datatype %q\n", typ)
-	return s, nil
+	if strings.HasPrefix(typ, "dateTime:") {
+		return nil, fmt.Errorf("unknown time format %q", typ)
+	}
+	if elem, ok := listElemType(typ); ok {
+		return parseList(s, elem, DefaultListDelimiter, parseValue)
+	}
+	return nil, errUnknownDatatype
+}
+
+// parseRelaxedInt parses s as a value of the long or unsignedLong
+// datatype as described in Reader.SetRelaxedNumbers.
+func parseRelaxedInt(s string, typ string) (interface{}, error) {
+	if digits := strings.TrimLeft(s, "+-"); strings.HasPrefix(digits, "0x") || strings.HasPrefix(digits, "0X") {
+		if typ == "long" {
+			return strconv.ParseInt(s, 0, 64)
+		}
+		return strconv.ParseUint(s, 0, 64)
+	}
+	d, err := ParseDecimal(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q", typ, s)
+	}
+	x := d.Rat()
+	if !x.IsInt() {
+		return nil, fmt.Errorf("%q is not an integer", s)
+	}
+	switch n := x.Num(); {
+	case typ == "long" && n.IsInt64():
+		return n.Int64(), nil
+	case typ == "unsignedLong" && n.IsUint64():
+		return n.Uint64(), nil
+	}
+	return nil, fmt.Errorf("%q is out of range for %s", s, typ)
 }
 
+// parseDateTime parses a value of the dateTime datatype without a
+// time format, which the extended annotated CSV format read by
+// "influx write" allows to be in RFC3339 format or a number of
+// nanoseconds since the Unix epoch.
+func parseDateTime(s string) (time.Time, error) {
+	if t, err := parseEpoch(s, time.Nanosecond); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// timeLayout returns the time layout for values of the given
+// datatype: the layout of a named time format such as RFC3339 or,
+// as allowed by the extended annotated CSV format, a Go time layout
+// such as "dateTime:2006-01-02". It reports false if there is none.
+func timeLayout(typ string) (string, bool) {
+	format := strings.TrimPrefix(typ, "dateTime:")
+	if len(format) == len(typ) {
+		return "", false
+	}
+	if layout := timeFormats[format]; layout != "" {
+		return layout, true
+	}
+	if sampleTime.Format(format) != format {
+		// The format contains some layout elements.
+		return format, true
+	}
+	return "", false
+}
+
+// sampleTime is used to check whether a time format is a Go
+// time layout. It differs from the reference time of Go time
+// layouts in every element.
+var sampleTime = time.Date(1999, time.December, 31, 23, 59, 58, 999999999, time.UTC)
+
 var timeFormats = map[string]string{
 	"RFC3339":     time.RFC3339,
 	"RFC3339Nano": time.RFC3339Nano,
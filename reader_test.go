@@ -0,0 +1,411 @@
+package annotatedcsv
+
+import (
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var ignoredDefaultTests = []struct {
+	testName    string
+	csv         string
+	ignore      []string
+	expectCols  []string
+	expectRow   []interface{}
+	expectError string
+}{{
+	testName: "ignored-name",
+	csv: `#datatype,long,long
+#group,false,false
+#default,,not-a-number
+,a,b
+,1,
+`,
+	ignore:     []string{"b"},
+	expectCols: []string{"", "a"},
+	expectRow:  []interface{}{nil, int64(1)},
+}, {
+	testName: "ignored-datatype",
+	csv: `#datatype,long,ignored,long
+#group,false,false,false
+#default,,x,7
+,a,b,c
+,1,2,
+`,
+	expectCols: []string{"", "a", "c"},
+	expectRow:  []interface{}{nil, int64(1), int64(7)},
+}, {
+	testName: "not-ignored",
+	csv: `#datatype,long,long
+#group,false,false
+#default,,not-a-number
+,a,b
+,1,
+`,
+	expectError: `cannot convert default value "not-a-number" to type "long": .* at line 4`,
+}}
+
+func TestIgnoredColumnDefault(t *testing.T) {
+	for _, test := range ignoredDefaultTests {
+		t.Run(test.testName, func(t *testing.T) {
+			r := NewReader(strings.NewReader(test.csv))
+			r.SetIgnoredColumns(test.ignore)
+			if !r.NextTable() {
+				if test.expectError == "" {
+					t.Fatalf("unexpected error: %v", r.Err())
+				}
+				assertErrorMatches(t, r.Err(), test.expectError)
+				return
+			}
+			if test.expectError != "" {
+				t.Fatalf("no error; want %q", test.expectError)
+			}
+			var names []string
+			for _, col := range r.Columns() {
+				names = append(names, col.Name)
+			}
+			if !reflect.DeepEqual(names, test.expectCols) {
+				t.Fatalf("unexpected columns; got %q want %q", names, test.expectCols)
+			}
+			if !r.NextRow() {
+				t.Fatalf("no row: %v", r.Err())
+			}
+			if got := r.Row(); !reflect.DeepEqual(got, test.expectRow) {
+				t.Fatalf("unexpected row; got %#v want %#v", got, test.expectRow)
+			}
+		})
+	}
+}
+
+// assertErrorMatches fails the test unless err matches
+// the regular expression pattern in its entirety.
+func assertErrorMatches(t *testing.T, err error, pattern string) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("no error; want %q", pattern)
+	}
+	if !regexp.MustCompile("^(" + pattern + ")$").MatchString(err.Error()) {
+		t.Fatalf("unexpected error; got %q want %q", err, pattern)
+	}
+}
+
+func TestTableStatsLine(t *testing.T) {
+	// The second table starts after a blank line and
+	// a row with a cell spanning two lines.
+	const data = `#datatype,string
+#group,false
+#default,
+,s
+,"one
+two"
+
+
+#datatype,long
+#group,false
+#default,
+,n
+,1
+`
+	r := NewReader(strings.NewReader(data))
+	var lines []int
+	r.OnTableEnd(func(stats TableStats) {
+		lines = append(lines, stats.Line)
+	})
+	for r.NextTable() {
+	}
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{1, 9}; !reflect.DeepEqual(lines, want) {
+		t.Fatalf("unexpected table lines; got %v want %v", lines, want)
+	}
+	ix, err := BuildIndex(strings.NewReader(data), int64(len(data)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ix.Tables[1].Offset, int64(strings.Index(data, "#datatype,long")); got != want {
+		t.Fatalf("unexpected offset of second table; got %d want %d", got, want)
+	}
+}
+
+func TestReadRowsTableBoundaries(t *testing.T) {
+	const data = `#datatype,string,long
+#group,true,false
+#default,,
+,g,n
+,a,1
+,a,2
+,a,3
+
+#datatype,string,long
+#group,true,false
+#default,,
+,g,n
+#datatype,string,long
+#group,true,false
+#default,,
+,g,n
+,b,4
+`
+	r := NewReader(strings.NewReader(data))
+	dst := make([][]interface{}, 2)
+	type result struct {
+		n    int
+		err  error
+		rows [][]interface{}
+	}
+	var results []result
+	for r.NextTable() {
+		// An empty destination reads nothing.
+		if n, err := r.ReadRows(nil); n != 0 || err != nil {
+			t.Fatalf("got %d, %v from empty destination", n, err)
+		}
+		for {
+			n, err := r.ReadRows(dst)
+			results = append(results, result{n, err, copyRows(dst[:n])})
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	expect := []result{
+		{2, nil, [][]interface{}{{nil, "a", int64(1)}, {nil, "a", int64(2)}}},
+		{1, io.EOF, [][]interface{}{{nil, "a", int64(3)}}},
+		{0, io.EOF, [][]interface{}{}},
+		{1, io.EOF, [][]interface{}{{nil, "b", int64(4)}}},
+	}
+	if !reflect.DeepEqual(results, expect) {
+		t.Fatalf("unexpected results\ngot  %v\nwant %v", results, expect)
+	}
+}
+
+func TestReadRowsGroupKeyError(t *testing.T) {
+	const data = `#datatype,string,long
+#group,true,false
+#default,,
+,g,n
+,a,1
+,a,2
+,b,3
+,b,4
+`
+	r := NewReader(strings.NewReader(data))
+	r.SetCheckGroupKeys(true)
+	if !r.NextTable() {
+		t.Fatal(r.Err())
+	}
+	// The group key is taken from the first row, not the
+	// last row of the previous call, even though the
+	// destination rows are reused.
+	dst := make([][]interface{}, 1)
+	for i := 0; i < 2; i++ {
+		if n, err := r.ReadRows(dst); n != 1 || err != nil {
+			t.Fatalf("call %d: got %d, %v", i, n, err)
+		}
+	}
+	n, err := r.ReadRows(make([][]interface{}, 3))
+	if n != 0 {
+		t.Fatalf("got %d rows after bad group key", n)
+	}
+	assertErrorMatches(t, err, `group column "g" has value b at line 7 but a at line 5`)
+}
+
+func copyRows(rows [][]interface{}) [][]interface{} {
+	rows1 := make([][]interface{}, len(rows))
+	for i, row := range rows {
+		rows1[i] = append([]interface{}(nil), row...)
+	}
+	return rows1
+}
+
+var emptyCellsTests = []struct {
+	testName   string
+	mode       EmptyCells
+	nullMarker string
+	expectRows [][]interface{}
+}{{
+	testName: "null",
+	mode:     EmptyNull,
+	expectRows: [][]interface{}{
+		{nil, nil, nil, nil, int64(7), "dflt", nil},
+		{nil, "null", true, 1.5, int64(7), "null", emptyCellsTime},
+	},
+}, {
+	testName: "zero",
+	mode:     EmptyZero,
+	expectRows: [][]interface{}{
+		{nil, "", false, 0.0, int64(7), "dflt", time.Time{}},
+		{nil, "null", true, 1.5, int64(7), "null", emptyCellsTime},
+	},
+}, {
+	// The null marker takes precedence over a default value.
+	testName:   "null-marker",
+	mode:       EmptyNull,
+	nullMarker: "null",
+	expectRows: [][]interface{}{
+		{nil, nil, nil, nil, int64(7), "dflt", nil},
+		{nil, nil, true, 1.5, int64(7), nil, emptyCellsTime},
+	},
+}, {
+	testName:   "zero-with-null-marker",
+	mode:       EmptyZero,
+	nullMarker: "null",
+	expectRows: [][]interface{}{
+		{nil, "", false, 0.0, int64(7), "dflt", time.Time{}},
+		{nil, nil, true, 1.5, int64(7), nil, emptyCellsTime},
+	},
+}}
+
+var emptyCellsTime = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestEmptyCells(t *testing.T) {
+	const data = `#datatype,string,boolean,double,long,string,dateTime:RFC3339
+#group,false,false,false,false,false,false
+#default,,,,7,dflt,
+,a,b,c,d,e,f
+,,,,,,
+,null,true,1.5,,null,2021-01-01T00:00:00Z
+`
+	for _, test := range emptyCellsTests {
+		t.Run(test.testName, func(t *testing.T) {
+			r := NewReader(strings.NewReader(data))
+			r.SetEmptyCells(test.mode)
+			r.SetNullMarker(test.nullMarker)
+			tables, err := r.ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tables[0].Rows; !reflect.DeepEqual(got, test.expectRows) {
+				t.Fatalf("unexpected rows\ngot  %#v\nwant %#v", got, test.expectRows)
+			}
+		})
+	}
+}
+
+var extendedFormatTests = []struct {
+	testName    string
+	csv         string
+	expectCols  [][]string
+	expectRows  [][][]interface{}
+	expectError string
+}{{
+	testName: "datatypes",
+	csv: `#datatype measurement,tag,double,ignored,dateTime:RFC3339
+m,host,used,junk,time
+cpu,server01,2.5,x,2020-01-01T00:00:00Z
+cpu,server01,,y,2020-01-01T00:00:01Z
+`,
+	expectCols: [][]string{{"m:measurement", "host:tag", "used:double", "time:dateTime:RFC3339"}},
+	expectRows: [][][]interface{}{{
+		{nil, "cpu", "server01", 2.5, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{nil, "cpu", "server01", nil, time.Date(2020, 1, 1, 0, 0, 1, 0, time.UTC)},
+	}},
+}, {
+	testName: "group-and-default",
+	csv: `#group false,true,false
+#datatype string,string,long
+#default dflt,,7
+a,b,c
+x,y,
+,y,1
+`,
+	expectCols: [][]string{{"a:string", "b:string", "c:long"}},
+	expectRows: [][][]interface{}{{
+		{nil, "x", "y", int64(7)},
+		{nil, "dflt", "y", int64(1)},
+	}},
+}, {
+	// Each table may be in either format.
+	testName: "then-standard",
+	csv: `#datatype dateTime,dateTime:number
+t1,t2
+2020-01-01T00:00:00Z,1577836800000000000
+#datatype,long
+#group,false
+#default,
+,n
+,1
+`,
+	expectCols: [][]string{{"t1:dateTime", "t2:dateTime:number"}, {"n:long"}},
+	expectRows: [][][]interface{}{{
+		{nil, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}, {
+		{nil, int64(1)},
+	}},
+}, {
+	testName: "with-constant",
+	csv: `#constant measurement,cpu
+#datatype long
+n
+1
+`,
+	expectCols: [][]string{{"n:long", "_measurement:string"}},
+	expectRows: [][][]interface{}{{
+		{nil, int64(1), "cpu"},
+	}},
+}, {
+	// The number of cells is reported as in the input.
+	testName: "bad-row-length",
+	csv: `#datatype long,long
+a,b
+1,2,3
+`,
+	expectError: `inconsistent number of columns at line 3; got 3 want 2`,
+}, {
+	// A row in the standard format has the
+	// same number of cells as the table.
+	testName: "mixed-annotations",
+	csv: `#datatype long,long
+#group,true,false
+a,b
+1,2
+`,
+	expectCols: [][]string{{"a:long", "b:long"}},
+	expectRows: [][][]interface{}{{
+		{nil, int64(1), int64(2)},
+	}},
+}, {
+	testName: "inconsistent-annotations",
+	csv: `#datatype long,long
+#group false
+a,b
+`,
+	expectError: `inconsistent table header \(got 2 items want 3\)`,
+}}
+
+func TestExtendedFormat(t *testing.T) {
+	for _, test := range extendedFormatTests {
+		t.Run(test.testName, func(t *testing.T) {
+			tables, err := ReadAll(strings.NewReader(test.csv))
+			if test.expectError != "" {
+				assertErrorMatches(t, err, test.expectError)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var cols [][]string
+			var rows [][][]interface{}
+			for _, table := range tables {
+				var tcols []string
+				for _, col := range table.Columns[1:] {
+					tcols = append(tcols, col.Name+":"+col.Type)
+				}
+				cols = append(cols, tcols)
+				rows = append(rows, table.Rows)
+			}
+			if !reflect.DeepEqual(cols, test.expectCols) {
+				t.Errorf("unexpected columns; got %q want %q", cols, test.expectCols)
+			}
+			if !reflect.DeepEqual(rows, test.expectRows) {
+				t.Errorf("unexpected rows\ngot  %#v\nwant %#v", rows, test.expectRows)
+			}
+		})
+	}
+}
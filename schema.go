@@ -0,0 +1,250 @@
+package annotatedcsv
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Schema holds the columns of a table in order, including
+// the annotation column at index 0, as returned by
+// Reader.Columns.
+type Schema []Column
+
+// Equal reports whether s and s1 have the same columns in
+// the same order, with the same names, datatypes, group flags,
+// units, default values and extra annotations.
+func (s Schema) Equal(s1 Schema) bool {
+	if len(s) != len(s1) {
+		return false
+	}
+	for i := range s {
+		if !equalColumns(s[i], s1[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalColumns(c0, c1 Column) bool {
+	return c0.Name == c1.Name &&
+		c0.Type == c1.Type &&
+		c0.Group == c1.Group &&
+		c0.Unit == c1.Unit &&
+		equalExtra(c0.Extra, c1.Extra) &&
+		equalValues(c0.Default, c1.Default)
+}
+
+// SchemaDiff describes how a column differs between two schemas.
+type SchemaDiff struct {
+	// Name holds the name of the column.
+	Name string
+
+	// Old and New hold the column in the old and new
+	// schemas, or nil if it is not present.
+	Old, New *Column
+
+	// Moved reports whether the column's position relative
+	// to the columns present in both schemas has changed.
+	Moved bool
+}
+
+// String returns a description of the difference.
+func (d SchemaDiff) String() string {
+	switch {
+	case d.Old == nil:
+		return fmt.Sprintf("added column %q of type %q", d.Name, d.New.Type)
+	case d.New == nil:
+		return fmt.Sprintf("removed column %q", d.Name)
+	}
+	var changes []string
+	if d.Old.Type != d.New.Type {
+		changes = append(changes, fmt.Sprintf("datatype changed from %q to %q", d.Old.Type, d.New.Type))
+	}
+	if d.Old.Group != d.New.Group {
+		changes = append(changes, fmt.Sprintf("group changed from %v to %v", d.Old.Group, d.New.Group))
+	}
+	if d.Old.Unit != d.New.Unit {
+		changes = append(changes, fmt.Sprintf("unit changed from %q to %q", d.Old.Unit, d.New.Unit))
+	}
+	for _, key := range extraKeys([]Column{*d.Old, *d.New}) {
+		if v0, v1 := d.Old.Extra[key], d.New.Extra[key]; v0 != v1 {
+			changes = append(changes, fmt.Sprintf("annotation #%s changed from %q to %q", key, v0, v1))
+		}
+	}
+	if !equalValues(d.Old.Default, d.New.Default) {
+		changes = append(changes, fmt.Sprintf("default changed from %q to %q", formatDefault(*d.Old), formatDefault(*d.New)))
+	}
+	if d.Moved {
+		changes = append(changes, "moved")
+	}
+	return fmt.Sprintf("column %q: %s", d.Name, strings.Join(changes, ", "))
+}
+
+// Diff returns the differences between s and s1, treating s as
+// the old schema and s1 as the new one. Removed and changed
+// columns are reported in the order of s, followed by added
+// columns in the order of s1. It returns nil if s.Equal(s1).
+func (s Schema) Diff(s1 Schema) []SchemaDiff {
+	oldIndex, newIndex := s.indexes(), s1.indexes()
+	// newRank holds the position of each column in s1
+	// relative to the other columns present in both schemas,
+	// so that we can tell which columns have moved.
+	newRank := make(map[string]int)
+	for i, col := range s1 {
+		if _, ok := oldIndex[col.Name]; ok && newIndex[col.Name] == i {
+			newRank[col.Name] = len(newRank)
+		}
+	}
+	var diffs []SchemaDiff
+	rank := 0
+	for i := range s {
+		old := &s[i]
+		j, ok := newIndex[old.Name]
+		if !ok || oldIndex[old.Name] != i {
+			diffs = append(diffs, SchemaDiff{
+				Name: old.Name,
+				Old:  old,
+			})
+			continue
+		}
+		new := &s1[j]
+		moved := newRank[old.Name] != rank
+		rank++
+		if moved || !equalColumns(*old, *new) {
+			diffs = append(diffs, SchemaDiff{
+				Name:  old.Name,
+				Old:   old,
+				New:   new,
+				Moved: moved,
+			})
+		}
+	}
+	for i := range s1 {
+		new := &s1[i]
+		if _, ok := oldIndex[new.Name]; ok && newIndex[new.Name] == i {
+			continue
+		}
+		diffs = append(diffs, SchemaDiff{
+			Name: new.Name,
+			New:  new,
+		})
+	}
+	return diffs
+}
+
+// indexes returns a map from column name to the index of
+// the first column with that name.
+func (s Schema) indexes() map[string]int {
+	m := make(map[string]int)
+	for i, col := range s {
+		if _, ok := m[col.Name]; !ok {
+			m[col.Name] = i
+		}
+	}
+	return m
+}
+
+// String returns the canonical representation of the schema:
+// the annotation rows and header row of a table with the
+// schema, as written by Writer.WriteHeader.
+func (s Schema) String() string {
+	if len(s) == 0 {
+		return ""
+	}
+	var buf strings.Builder
+	w := csv.NewWriter(&buf)
+	row := make([]string, len(s))
+	row[0] = "#datatype"
+	for i := 1; i < len(s); i++ {
+		row[i] = s[i].Type
+	}
+	w.Write(row)
+	row[0] = "#group"
+	for i := 1; i < len(s); i++ {
+		row[i] = strconv.FormatBool(s[i].Group)
+	}
+	w.Write(row)
+	if hasUnits(s) {
+		row[0] = "#unit"
+		for i := 1; i < len(s); i++ {
+			row[i] = s[i].Unit
+		}
+		w.Write(row)
+	}
+	for _, key := range extraKeys(s) {
+		row[0] = "#" + key
+		for i := 1; i < len(s); i++ {
+			row[i] = s[i].Extra[key]
+		}
+		w.Write(row)
+	}
+	row[0] = "#default"
+	for i := 1; i < len(s); i++ {
+		row[i] = formatDefault(s[i])
+	}
+	w.Write(row)
+	for i, col := range s {
+		row[i] = col.Name
+	}
+	w.Write(row)
+	w.Flush()
+	return buf.String()
+}
+
+// formatDefault returns the default value of col
+// as it would appear in a #default annotation.
+func formatDefault(col Column) string {
+	s, err := formatValue(col.Default, col.Type)
+	if err != nil {
+		return fmt.Sprint(col.Default)
+	}
+	return s
+}
+
+// Strictness determines what a Reader does when
+// a table deviates from its expected schema.
+// See Reader.ExpectSchema.
+type Strictness int
+
+const (
+	// SchemaWarn prints a warning and continues.
+	SchemaWarn Strictness = iota
+
+	// SchemaStrict treats the deviation as an error.
+	SchemaStrict
+)
+
+// SchemaError is returned by Reader.Err when a table
+// deviates from the schema set with Reader.ExpectSchema.
+type SchemaError struct {
+	// Line holds the line number of the table's header row.
+	Line int
+
+	// Diffs holds the differences between the expected
+	// schema and the table's columns.
+	Diffs []SchemaDiff
+}
+
+func (e *SchemaError) Error() string {
+	diffs := make([]string, len(e.Diffs))
+	for i, d := range e.Diffs {
+		diffs[i] = d.String()
+	}
+	return fmt.Sprintf("table at line %d does not match schema: %s", e.Line, strings.Join(diffs, "; "))
+}
+
+// schemaDeviations returns the differences between the expected
+// schema and the columns of a table, ignoring default values
+// and extra annotations.
+func schemaDeviations(expected, cols Schema) []SchemaDiff {
+	var diffs []SchemaDiff
+	for _, d := range expected.Diff(cols) {
+		if d.Old != nil && d.New != nil && !d.Moved && d.Old.Type == d.New.Type && d.Old.Group == d.New.Group && d.Old.Unit == d.New.Unit {
+			continue
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs
+}
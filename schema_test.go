@@ -0,0 +1,255 @@
+package annotatedcsv
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var schemaDiffTests = []struct {
+	testName string
+	old, new Schema
+	expect   []string
+}{{
+	testName: "same",
+	old:      Schema{{}, {Name: "a", Type: "long"}},
+	new:      Schema{{}, {Name: "a", Type: "long"}},
+}, {
+	testName: "equal-default-times",
+	old:      Schema{{}, {Name: "t", Type: "dateTime", Default: time.Date(2021, 1, 1, 1, 0, 0, 0, time.FixedZone("", 3600))}},
+	new:      Schema{{}, {Name: "t", Type: "dateTime", Default: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}},
+}, {
+	testName: "added-column",
+	old:      Schema{{}, {Name: "a", Type: "long"}},
+	new:      Schema{{}, {Name: "a", Type: "long"}, {Name: "b", Type: "string"}},
+	expect:   []string{`added column "b" of type "string"`},
+}, {
+	testName: "removed-column",
+	old:      Schema{{}, {Name: "a", Type: "long"}, {Name: "b", Type: "string"}},
+	new:      Schema{{}, {Name: "a", Type: "long"}},
+	expect:   []string{`removed column "b"`},
+}, {
+	testName: "renamed-column",
+	old:      Schema{{}, {Name: "a", Type: "long"}},
+	new:      Schema{{}, {Name: "b", Type: "long"}},
+	expect:   []string{`removed column "a"`, `added column "b" of type "long"`},
+}, {
+	testName: "datatype",
+	old:      Schema{{}, {Name: "a", Type: "long"}},
+	new:      Schema{{}, {Name: "a", Type: "double"}},
+	expect:   []string{`column "a": datatype changed from "long" to "double"`},
+}, {
+	testName: "group",
+	old:      Schema{{}, {Name: "a", Type: "string"}},
+	new:      Schema{{}, {Name: "a", Type: "string", Group: true}},
+	expect:   []string{`column "a": group changed from false to true`},
+}, {
+	testName: "unit-default-and-annotation",
+	old:      Schema{{}, {Name: "a", Type: "long", Unit: "s", Default: int64(1), Extra: map[string]string{"x": "1"}}},
+	new:      Schema{{}, {Name: "a", Type: "long", Unit: "ms", Extra: map[string]string{"y": "2"}}},
+	expect: []string{
+		`column "a": unit changed from "s" to "ms", annotation #x changed from "1" to "", annotation #y changed from "" to "2", default changed from "1" to ""`,
+	},
+}, {
+	testName: "several-changes",
+	old:      Schema{{}, {Name: "a", Type: "long"}, {Name: "b", Type: "string"}},
+	new:      Schema{{}, {Name: "a", Type: "double", Group: true}, {Name: "c", Type: "long"}},
+	expect: []string{
+		`column "a": datatype changed from "long" to "double", group changed from false to true`,
+		`removed column "b"`,
+		`added column "c" of type "long"`,
+	},
+}, {
+	testName: "moved",
+	old:      Schema{{}, {Name: "a", Type: "long"}, {Name: "b", Type: "long"}, {Name: "c", Type: "long"}},
+	new:      Schema{{}, {Name: "a", Type: "long"}, {Name: "c", Type: "long"}, {Name: "b", Type: "long"}},
+	expect:   []string{`column "b": moved`, `column "c": moved`},
+}, {
+	// A column that moves past a removed column
+	// has not moved relative to the others.
+	testName: "not-moved-past-removed-column",
+	old:      Schema{{}, {Name: "a", Type: "long"}, {Name: "b", Type: "long"}, {Name: "c", Type: "long"}},
+	new:      Schema{{}, {Name: "a", Type: "long"}, {Name: "c", Type: "long"}},
+	expect:   []string{`removed column "b"`},
+}, {
+	// Only the first column with a given name is compared.
+	testName: "duplicate-names",
+	old:      Schema{{}, {Name: "a", Type: "long"}, {Name: "a", Type: "string"}},
+	new:      Schema{{}, {Name: "a", Type: "long"}},
+	expect:   []string{`removed column "a"`},
+}}
+
+func TestSchemaDiff(t *testing.T) {
+	for _, test := range schemaDiffTests {
+		t.Run(test.testName, func(t *testing.T) {
+			var got []string
+			for _, d := range test.old.Diff(test.new) {
+				got = append(got, d.String())
+			}
+			if !reflect.DeepEqual(got, test.expect) {
+				t.Fatalf("unexpected diff\ngot  %q\nwant %q", got, test.expect)
+			}
+			if equal := test.old.Equal(test.new); equal != (len(test.expect) == 0) {
+				t.Fatalf("Equal returned %v with diff %q", equal, got)
+			}
+			if equal := test.new.Equal(test.old); equal != (len(test.expect) == 0) {
+				t.Fatalf("reversed Equal returned %v with diff %q", equal, got)
+			}
+		})
+	}
+}
+
+func TestSchemaString(t *testing.T) {
+	const data = `#datatype,string,long,dateTime:RFC3339
+#group,true,false,false
+#unit,,ms,
+#description,host name,,
+#default,h,7,2021-01-01T00:00:00Z
+,host,n,_time
+`
+	r := NewReader(strings.NewReader(data))
+	if !r.NextTable() {
+		t.Fatal(r.Err())
+	}
+	s := Schema(r.Columns())
+	if got := s.String(); got != data {
+		t.Fatalf("unexpected schema\ngot:\n%s\nwant:\n%s", got, data)
+	}
+	if got := Schema(nil).String(); got != "" {
+		t.Fatalf("unexpected string for empty schema %q", got)
+	}
+}
+
+const expectSchemaHeader = `#datatype,string,long,double
+#group,true,false,false
+#default,,,
+,host,n,v
+`
+
+var expectSchemaTests = []struct {
+	testName    string
+	table       string
+	expectError string
+}{{
+	testName: "same",
+	table:    expectSchemaHeader + ",b,2,2.5\n",
+}, {
+	// Default values and extra annotations are not compared.
+	testName: "different-default-and-annotation",
+	table:    "#datatype,string,long,double\n#group,true,false,false\n#description,,count,\n#default,x,1,\n,host,n,v\n,b,,2.5\n",
+}, {
+	testName:    "datatype",
+	table:       "#datatype,string,double,double\n#group,true,false,false\n#default,,,\n,host,n,v\n,b,2,2.5\n",
+	expectError: `table at line 10 does not match schema: column "n": datatype changed from "long" to "double"`,
+}, {
+	testName:    "group",
+	table:       "#datatype,string,long,double\n#group,false,false,false\n#default,,,\n,host,n,v\n,b,2,2.5\n",
+	expectError: `table at line 10 does not match schema: column "host": group changed from true to false`,
+}, {
+	testName:    "unit",
+	table:       "#datatype,string,long,double\n#group,true,false,false\n#unit,,,ms\n#default,,,\n,host,n,v\n,b,2,2.5\n",
+	expectError: `table at line 11 does not match schema: column "v": unit changed from "" to "ms"`,
+}, {
+	testName:    "missing-column",
+	table:       "#datatype,string,long\n#group,true,false\n#default,,\n,host,n\n,b,2\n",
+	expectError: `table at line 10 does not match schema: removed column "v"`,
+}, {
+	testName:    "extra-column",
+	table:       "#datatype,string,long,double,string\n#group,true,false,false,false\n#default,,,,\n,host,n,v,s\n,b,2,2.5,x\n",
+	expectError: `table at line 10 does not match schema: added column "s" of type "string"`,
+}, {
+	testName:    "moved-column",
+	table:       "#datatype,string,double,long\n#group,true,false,false\n#default,,,\n,host,v,n\n,b,2.5,2\n",
+	expectError: `table at line 10 does not match schema: column "n": moved; column "v": moved`,
+}}
+
+func TestExpectSchema(t *testing.T) {
+	first := expectSchemaHeader + ",a,1,1.5\n\n"
+	// The expected schema is taken from the
+	// first table, as an application might.
+	r := NewReader(strings.NewReader(first))
+	if !r.NextTable() {
+		t.Fatal(r.Err())
+	}
+	expected := Schema(r.Columns())
+	for _, test := range expectSchemaTests {
+		t.Run(test.testName, func(t *testing.T) {
+			r := NewReader(strings.NewReader(first + test.table))
+			r.ExpectSchema(expected, SchemaStrict)
+			var rows int
+			for r.NextTable() {
+				for r.NextRow() {
+					rows++
+				}
+			}
+			if test.expectError == "" {
+				if err := r.Err(); err != nil {
+					t.Fatal(err)
+				}
+				if rows != 2 {
+					t.Fatalf("got %d rows, want 2", rows)
+				}
+				return
+			}
+			assertErrorMatches(t, r.Err(), test.expectError)
+			var schemaErr *SchemaError
+			if !errors.As(r.Err(), &schemaErr) {
+				t.Fatalf("unexpected error type %T", r.Err())
+			}
+			// The first table is read before the error.
+			if rows != 1 {
+				t.Fatalf("got %d rows, want 1", rows)
+			}
+		})
+	}
+}
+
+func TestExpectSchemaWarn(t *testing.T) {
+	data := expectSchemaHeader + ",a,1,1.5\n\n#datatype,string,double,double\n#group,true,false,false\n#default,,,\n,host,n,v\n,b,2,2.5\n"
+	f, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	oldStderr := os.Stderr
+	os.Stderr = f
+	defer func() {
+		os.Stderr = oldStderr
+	}()
+
+	r := NewReader(strings.NewReader(data))
+	r.ExpectSchema(Schema{{}, {Name: "host", Type: "string", Group: true}, {Name: "n", Type: "long"}, {Name: "v", Type: "double"}}, SchemaWarn)
+	var rows int
+	for r.NextTable() {
+		for r.NextRow() {
+			rows++
+		}
+	}
+	os.Stderr = oldStderr
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 2 {
+		t.Fatalf("got %d rows, want 2", rows)
+	}
+	warnings, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expectWarnings = "warning: table at line 10 does not match schema: column \"n\": datatype changed from \"long\" to \"double\"\n"
+	if got := string(warnings); got != expectWarnings {
+		t.Fatalf("unexpected warnings\ngot  %q\nwant %q", got, expectWarnings)
+	}
+}
+
+func TestExpectSchemaNil(t *testing.T) {
+	r := NewReader(strings.NewReader(expectSchemaHeader + ",a,1,1.5\n"))
+	r.ExpectSchema(Schema{{}, {Name: "x", Type: "long"}}, SchemaStrict)
+	r.ExpectSchema(nil, SchemaStrict)
+	if !r.NextTable() {
+		t.Fatal(r.Err())
+	}
+}
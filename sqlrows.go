@@ -0,0 +1,240 @@
+package annotatedcsv
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WriteSQLRows writes the rows of a query result as a table,
+// starting a new table for each further result set. The
+// column datatypes are derived from the SQL column types:
+// integers map to long (or unsignedLong when unsigned), floating
+// point types to double, decimal and numeric types to decimal,
+// booleans to boolean, dates and timestamps to dateTime:RFC3339Nano
+// and everything else to string. SQL NULL values are written as empty cells.
+//
+// WriteSQLRows does not close rows.
+func (w *Writer) WriteSQLRows(rows *sql.Rows) error {
+	for {
+		if err := w.writeSQLResultSet(rows); err != nil {
+			return err
+		}
+		if !rows.NextResultSet() {
+			return rows.Err()
+		}
+	}
+}
+
+func (w *Writer) writeSQLResultSet(rows *sql.Rows) error {
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	cols := make([]Column, len(colTypes)+1)
+	for i, ct := range colTypes {
+		cols[i+1] = Column{
+			Name: ct.Name(),
+			Type: sqlColumnType(ct),
+		}
+	}
+	if err := w.WriteHeader(cols); err != nil {
+		return err
+	}
+	vals := make([]interface{}, len(colTypes))
+	dest := make([]interface{}, len(colTypes))
+	for i := range vals {
+		dest[i] = &vals[i]
+	}
+	row := make([]interface{}, len(cols))
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		for i, v := range vals {
+			col := cols[i+1]
+			x, err := sqlValue(v, col.Type)
+			if err != nil {
+				return fmt.Errorf("invalid value for column %q: %v", col.Name, err)
+			}
+			row[i+1] = x
+		}
+		if err := w.WriteRow(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// sqlColumnType returns the annotated CSV datatype to use for
+// the given SQL column. When the driver does not report a
+// database type name, the Go type it scans into is used instead.
+func sqlColumnType(ct *sql.ColumnType) string {
+	name := strings.ToUpper(ct.DatabaseTypeName())
+	if i := strings.IndexByte(name, '('); i >= 0 {
+		name = strings.TrimSpace(name[:i])
+	}
+	if name != "" {
+		if unsigned := strings.TrimPrefix(name, "UNSIGNED "); unsigned != name {
+			if sqlTypes[unsigned] == "long" {
+				return "unsignedLong"
+			}
+		}
+		if typ := sqlTypes[name]; typ != "" {
+			return typ
+		}
+		return "string"
+	}
+	t := ct.ScanType()
+	if t == nil {
+		return "string"
+	}
+	if t.Kind() == reflect.Struct && strings.HasPrefix(t.Name(), "Null") && t.NumField() > 0 {
+		// sql.NullInt64 and similar.
+		t = t.Field(0).Type
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "long"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "unsignedLong"
+	case reflect.Float32, reflect.Float64:
+		return "double"
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return "dateTime:RFC3339Nano"
+	}
+	return "string"
+}
+
+// sqlTypes maps SQL type names, as reported by the common
+// drivers, to annotated CSV datatypes. Other names map to string.
+var sqlTypes = map[string]string{
+	"BIGINT":           "long",
+	"BIGSERIAL":        "long",
+	"INT":              "long",
+	"INT2":             "long",
+	"INT4":             "long",
+	"INT8":             "long",
+	"INTEGER":          "long",
+	"MEDIUMINT":        "long",
+	"SERIAL":           "long",
+	"SMALLINT":         "long",
+	"SMALLSERIAL":      "long",
+	"TINYINT":          "long",
+	"BOOL":             "boolean",
+	"BOOLEAN":          "boolean",
+	"DECIMAL":          "decimal",
+	"DOUBLE":           "double",
+	"DOUBLE PRECISION": "double",
+	"FLOAT":            "double",
+	"FLOAT4":           "double",
+	"FLOAT8":           "double",
+	"NUMERIC":          "decimal",
+	"REAL":             "double",
+	"DATE":             "dateTime:RFC3339Nano",
+	"DATETIME":         "dateTime:RFC3339Nano",
+	"TIMESTAMP":        "dateTime:RFC3339Nano",
+	"TIMESTAMPTZ":      "dateTime:RFC3339Nano",
+}
+
+// sqlValue converts a value scanned from a SQL row to the Go
+// type used for the given datatype.
+func sqlValue(v interface{}, typ string) (interface{}, error) {
+	switch x := v.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		v = string(x)
+	}
+	switch typ {
+	case "string":
+		switch x := v.(type) {
+		case string:
+			return x, nil
+		case time.Time:
+			return x.Format(time.RFC3339Nano), nil
+		}
+		return fmt.Sprint(v), nil
+	case "long":
+		switch x := v.(type) {
+		case int64:
+			return x, nil
+		case string:
+			return strconv.ParseInt(x, 10, 64)
+		}
+	case "unsignedLong":
+		switch x := v.(type) {
+		case int64:
+			if x < 0 {
+				return nil, fmt.Errorf("negative value %d", x)
+			}
+			return uint64(x), nil
+		case string:
+			return strconv.ParseUint(x, 10, 64)
+		}
+	case "double":
+		switch x := v.(type) {
+		case float64:
+			return x, nil
+		case int64:
+			return float64(x), nil
+		case string:
+			return strconv.ParseFloat(x, 64)
+		}
+	case "decimal":
+		switch x := v.(type) {
+		case string:
+			return ParseDecimal(x)
+		case int64:
+			return Decimal{Unscaled: big.NewInt(x)}, nil
+		case float64:
+			// SQLite stores numeric values as
+			// integers or floating point.
+			return ParseDecimal(strconv.FormatFloat(x, 'g', -1, 64))
+		}
+	case "boolean":
+		switch x := v.(type) {
+		case bool:
+			return x, nil
+		case int64:
+			return x != 0, nil
+		case string:
+			switch strings.ToLower(x) {
+			case "t", "true", "1", "y", "yes":
+				return true, nil
+			case "f", "false", "0", "n", "no":
+				return false, nil
+			}
+		}
+	case "dateTime:RFC3339Nano":
+		switch x := v.(type) {
+		case time.Time:
+			return x, nil
+		case string:
+			for _, layout := range sqlTimeLayouts {
+				if t, err := time.Parse(layout, x); err == nil {
+					return t, nil
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("cannot convert %T value %v to %s", v, v, typ)
+}
+
+// sqlTimeLayouts holds the layouts tried when a driver returns a
+// date or timestamp as text.
+var sqlTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z07",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
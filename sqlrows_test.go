@@ -0,0 +1,63 @@
+package annotatedcsv
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestWriteSQLRows(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		`CREATE TABLE t (i INTEGER, d DECIMAL(30,10), n NUMERIC, f REAL, b BOOLEAN, s TEXT)`,
+		`INSERT INTO t VALUES (1, 1.25, 7, 0.5, 1, 'x')`,
+		`INSERT INTO t VALUES (NULL, -0.5, NULL, NULL, 0, NULL)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	rows, err := db.Query(`SELECT * FROM t`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var buf strings.Builder
+	w := NewWriter(&buf)
+	if err := w.WriteSQLRows(rows); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := `#datatype,long,decimal,decimal,double,boolean,string
+#group,false,false,false,false,false,false
+#default,,,,,,
+,i,d,n,f,b,s
+,1,1.25,7,0.5,true,x
+,,-0.5,,,false,
+`
+	if got := buf.String(); got != want {
+		t.Fatalf("unexpected output\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSQLValueDecimal(t *testing.T) {
+	// Drivers such as Postgres's return numeric values as
+	// text, which must be parsed without loss of precision.
+	const s = "12345678901234567890.123456789"
+	v, err := sqlValue([]byte(s), "decimal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, ok := v.(Decimal)
+	if !ok || d.String() != s {
+		t.Fatalf("unexpected value %#v", v)
+	}
+}
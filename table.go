@@ -0,0 +1,327 @@
+package annotatedcsv
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Table holds all the columns and rows of a single table.
+type Table struct {
+	Columns []Column
+	Rows    [][]interface{}
+}
+
+// Row holds a row of a table.
+type Row struct {
+	Columns []Column
+	Values  []interface{}
+}
+
+// Value returns the value in the named column,
+// or nil if there is no such column.
+func (r Row) Value(name string) interface{} {
+	for i, col := range r.Columns {
+		if col.Name == name && i < len(r.Values) {
+			return r.Values[i]
+		}
+	}
+	return nil
+}
+
+// ReadAll reads all the tables from r.
+func ReadAll(r io.Reader) (Tables, error) {
+	return NewReader(r).ReadAll()
+}
+
+// ReadAll reads all the remaining tables from r.
+func (r *Reader) ReadAll() (Tables, error) {
+	var tables Tables
+	for r.NextTable() {
+		t := &Table{
+			Columns: r.Columns(),
+		}
+		for r.NextRow() {
+			t.Rows = append(t.Rows, r.Row())
+		}
+		tables = append(tables, t)
+	}
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	return tables, nil
+}
+
+// WriteAll writes all the given tables to w as annotated CSV.
+func WriteAll(w io.Writer, tables []*Table) error {
+	return NewWriter(w).WriteAll(tables)
+}
+
+// WriteAll writes all the given tables and flushes w.
+func (w *Writer) WriteAll(tables []*Table) error {
+	for _, t := range tables {
+		if err := w.WriteHeader(t.Columns); err != nil {
+			return err
+		}
+		for _, row := range t.Rows {
+			if err := w.WriteRow(row); err != nil {
+				return err
+			}
+		}
+	}
+	return w.Flush()
+}
+
+// Filter removes the rows for which keep returns false.
+// To filter with an expression, use Expr.Predicate.
+func (t *Table) Filter(keep func(Row) bool) {
+	rows := t.Rows[:0]
+	for _, row := range t.Rows {
+		if keep(Row{t.Columns, row}) {
+			rows = append(rows, row)
+		}
+	}
+	for i := len(rows); i < len(t.Rows); i++ {
+		// Allow the removed rows to be garbage collected.
+		t.Rows[i] = nil
+	}
+	t.Rows = rows
+}
+
+// columnIndex returns the index of the named
+// column, or -1 if there is none.
+func (t *Table) columnIndex(name string) int {
+	for i, col := range t.Columns {
+		if col.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Rename renames columns, as given by a map from old name to new
+// name. The other properties of the columns are unchanged. It
+// returns an error if there is no column with one of the old names
+// or if a new name is the name of another column.
+func (t *Table) Rename(names map[string]string) error {
+	newNames := make([]string, len(t.Columns))
+	found := make(map[string]bool)
+	for i, col := range t.Columns {
+		newNames[i] = col.Name
+		if name, ok := names[col.Name]; ok {
+			newNames[i] = name
+			found[col.Name] = true
+		}
+	}
+	for oldName := range names {
+		if !found[oldName] {
+			return fmt.Errorf("cannot rename column %q: no such column", oldName)
+		}
+	}
+	for i, col := range t.Columns {
+		if _, ok := names[col.Name]; !ok {
+			continue
+		}
+		for j, name := range newNames {
+			if j != i && name == newNames[i] {
+				return fmt.Errorf("cannot rename column %q to %q: column already exists", col.Name, name)
+			}
+		}
+	}
+	for i := range t.Columns {
+		t.Columns[i].Name = newNames[i]
+	}
+	return nil
+}
+
+// Drop removes the named columns and their values in each row.
+// It returns an error if there is no column with one of the names.
+func (t *Table) Drop(names ...string) error {
+	drop := make(map[string]bool)
+	for _, name := range names {
+		drop[name] = true
+	}
+	var keep []int
+	for i, col := range t.Columns {
+		if drop[col.Name] {
+			delete(drop, col.Name)
+			continue
+		}
+		keep = append(keep, i)
+	}
+	for _, name := range names {
+		if drop[name] {
+			return fmt.Errorf("cannot drop column %q: no such column", name)
+		}
+	}
+	if len(keep) == len(t.Columns) {
+		return nil
+	}
+	cols := make([]Column, len(keep))
+	for i, j := range keep {
+		cols[i] = t.Columns[j]
+	}
+	t.Columns = cols
+	for r, row := range t.Rows {
+		newRow := make([]interface{}, len(keep))
+		for i, j := range keep {
+			if j < len(row) {
+				newRow[i] = row[j]
+			}
+		}
+		t.Rows[r] = newRow
+	}
+	return nil
+}
+
+// AddColumn adds a column with the given name and datatype after
+// the existing columns. Its value in each row is the result of
+// calling f with the row, which must be nil or of the type that
+// the Reader returns for the datatype. The column is not part of
+// the group key.
+func (t *Table) AddColumn(name, typ string, f func(row []interface{}) interface{}) error {
+	for _, col := range t.Columns {
+		if col.Name == name {
+			return fmt.Errorf("cannot add column %q: column already exists", name)
+		}
+	}
+	if !KnownDatatype(typ) {
+		return fmt.Errorf("cannot add column %q: unknown datatype %q", name, typ)
+	}
+	vals := make([]interface{}, len(t.Rows))
+	for i, row := range t.Rows {
+		v := f(row)
+		if !valueHasType(v, typ) {
+			return fmt.Errorf("cannot add column %q: value %v of type %T in row %d does not match datatype %q", name, v, v, i, typ)
+		}
+		vals[i] = v
+	}
+	t.Columns = append(t.Columns, Column{
+		Name: name,
+		Type: typ,
+	})
+	for i, row := range t.Rows {
+		t.Rows[i] = append(row, vals[i])
+	}
+	return nil
+}
+
+// valueHasType reports whether v is nil or of the type
+// that the Reader returns for the given known datatype.
+func valueHasType(v interface{}, typ string) bool {
+	if v == nil {
+		return true
+	}
+	if elem, ok := listElemType(typ); ok {
+		if reflect.TypeOf(v) != listSliceType(elem) {
+			return false
+		}
+		if list, ok := v.([]interface{}); ok {
+			for _, x := range list {
+				if !valueHasType(x, elem) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	switch DatatypeKind(typ) {
+	case BooleanKind:
+		_, ok := v.(bool)
+		return ok
+	case LongKind:
+		_, ok := v.(int64)
+		return ok
+	case UnsignedLongKind:
+		_, ok := v.(uint64)
+		return ok
+	case DoubleKind:
+		switch v := v.(type) {
+		case float64:
+			return true
+		case string:
+			// The Reader represents infinities and NaN as strings.
+			return isNonFinite(v)
+		}
+		return false
+	case DecimalKind:
+		_, ok := v.(Decimal)
+		return ok
+	case UUIDKind:
+		_, ok := v.(UUID)
+		return ok
+	case IPKind:
+		_, ok := v.(netip.Addr)
+		return ok
+	case CIDRKind:
+		_, ok := v.(netip.Prefix)
+		return ok
+	case JSONKind:
+		switch v.(type) {
+		case map[string]interface{}, []interface{}, string, json.Number, float64, bool:
+			return true
+		}
+		return false
+	case StringKind:
+		_, ok := v.(string)
+		return ok
+	case DateTimeKind:
+		_, ok := v.(time.Time)
+		return ok
+	}
+	return false
+}
+
+// ColumnValues returns the values in the named column of t as a
+// slice of T, which must be interface{} or the type that the Reader
+// returns for the column's datatype: for example, float64 for a
+// double column or time.Time for a dateTime column. Non-finite
+// double values, which the Reader returns as strings, are converted
+// when T is float64. It returns an error if the column holds a null
+// value unless T is an interface type.
+func ColumnValues[T any](t *Table, name string) ([]T, error) {
+	i := t.columnIndex(name)
+	if i < 0 {
+		return nil, fmt.Errorf("no column %q", name)
+	}
+	col := t.Columns[i]
+	var zero T
+	isInterface := reflect.TypeOf(&zero).Elem().Kind() == reflect.Interface
+	if !isInterface {
+		ok := false
+		if KnownDatatype(col.Type) {
+			ok = valueHasType(zero, col.Type)
+		} else {
+			// The Reader returns values of unknown datatypes as strings.
+			_, ok = interface{}(zero).(string)
+		}
+		if !ok {
+			return nil, fmt.Errorf("column %q of datatype %q cannot be read as %T", name, col.Type, zero)
+		}
+	}
+	vals := make([]T, len(t.Rows))
+	for r, row := range t.Rows {
+		v := row[i]
+		if v == nil {
+			if !isInterface {
+				return nil, fmt.Errorf("null value in column %q at row %d", name, r)
+			}
+			continue
+		}
+		if s, ok := v.(string); ok && col.Type == "double" && !isInterface {
+			if f, err := strconv.ParseFloat(s, 64); err == nil {
+				v = f
+			}
+		}
+		x, ok := v.(T)
+		if !ok {
+			return nil, fmt.Errorf("unexpected value %v of type %T in column %q at row %d", v, v, name, r)
+		}
+		vals[r] = x
+	}
+	return vals, nil
+}
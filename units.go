@@ -0,0 +1,172 @@
+package annotatedcsv
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// unit describes a unit understood by ConvertUnit.
+type unit struct {
+	// dimension holds the kind of quantity measured.
+	dimension string
+	// scale holds the size of the unit as a multiple of
+	// the smallest unit of the same dimension.
+	scale int64
+}
+
+var units = map[string]unit{
+	"B":       {"bytes", 1},
+	"bytes":   {"bytes", 1},
+	"kB":      {"bytes", 1e3},
+	"MB":      {"bytes", 1e6},
+	"GB":      {"bytes", 1e9},
+	"TB":      {"bytes", 1e12},
+	"KiB":     {"bytes", 1 << 10},
+	"MiB":     {"bytes", 1 << 20},
+	"GiB":     {"bytes", 1 << 30},
+	"TiB":     {"bytes", 1 << 40},
+	"ns":      {"time", 1},
+	"us":      {"time", 1e3},
+	"µs":      {"time", 1e3},
+	"ms":      {"time", 1e6},
+	"s":       {"time", 1e9},
+	"seconds": {"time", 1e9},
+	"min":     {"time", 60e9},
+	"h":       {"time", 3600e9},
+}
+
+// Units returns the names of the units that values can be
+// converted between, in sorted order. Units of the same
+// dimension, such as "kB" and "MiB", or "ms" and "h", can be
+// converted to one another.
+func Units() []string {
+	names := make([]string, 0, len(units))
+	for name := range units {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// unitConversion converts the values in a column
+// from one unit to another.
+type unitConversion struct {
+	// factor holds the amount each value is multiplied by.
+	factor *big.Rat
+	// typ holds the datatype of the converted values.
+	typ string
+}
+
+// newUnitConversion returns a conversion of values of the given
+// datatype from one unit to another. Values of integer datatypes stay
+// integers if the conversion factor is a whole number; otherwise they
+// become doubles.
+func newUnitConversion(typ, from, to string) (*unitConversion, error) {
+	if from == "" {
+		return nil, fmt.Errorf("cannot convert to %q: no unit", to)
+	}
+	u0, ok := units[from]
+	if !ok {
+		return nil, fmt.Errorf("unknown unit %q", from)
+	}
+	u1, ok := units[to]
+	if !ok {
+		return nil, fmt.Errorf("unknown unit %q", to)
+	}
+	if u0.dimension != u1.dimension {
+		return nil, fmt.Errorf("cannot convert %s to %s", from, to)
+	}
+	c := &unitConversion{
+		factor: big.NewRat(u0.scale, u1.scale),
+		typ:    typ,
+	}
+	switch DatatypeKind(typ) {
+	case DoubleKind:
+	case LongKind, UnsignedLongKind, DecimalKind:
+		if !c.factor.IsInt() {
+			c.typ = "double"
+		}
+	default:
+		return nil, fmt.Errorf("cannot convert units of datatype %q", typ)
+	}
+	return c, nil
+}
+
+// convert converts v, which must be a value of the
+// conversion's original datatype.
+func (c *unitConversion) convert(v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if c.typ == "double" {
+		switch v := v.(type) {
+		case string:
+			// Infinities and NaN are unchanged.
+			if isNonFinite(v) {
+				return v, nil
+			}
+		case int64, uint64, float64, Decimal:
+			num, _ := new(big.Float).SetInt(c.factor.Num()).Float64()
+			den, _ := new(big.Float).SetInt(c.factor.Denom()).Float64()
+			return floatValue(v) * num / den, nil
+		}
+		return nil, fmt.Errorf("unexpected value type %T", v)
+	}
+	n := c.factor.Num()
+	switch v := v.(type) {
+	case int64:
+		x := new(big.Int).Mul(big.NewInt(v), n)
+		if !x.IsInt64() {
+			return nil, fmt.Errorf("%d out of range after conversion", v)
+		}
+		return x.Int64(), nil
+	case uint64:
+		x := new(big.Int).Mul(new(big.Int).SetUint64(v), n)
+		if !x.IsUint64() {
+			return nil, fmt.Errorf("%d out of range after conversion", v)
+		}
+		return x.Uint64(), nil
+	case Decimal:
+		return Decimal{
+			Unscaled: new(big.Int).Mul(v.unscaled(), n),
+			Scale:    v.Scale,
+		}, nil
+	}
+	return nil, fmt.Errorf("unexpected value type %T", v)
+}
+
+// ConvertUnit converts the numeric value v from one unit to
+// another, returning a float64 unless v is an int64, uint64 or
+// Decimal and the conversion factor is a whole number, in which case
+// the result has the same type as v.
+func ConvertUnit(v interface{}, from, to string) (interface{}, error) {
+	var typ string
+	switch v.(type) {
+	case int64:
+		typ = "long"
+	case uint64:
+		typ = "unsignedLong"
+	case Decimal:
+		typ = "decimal"
+	case float64:
+		typ = "double"
+	default:
+		return nil, fmt.Errorf("cannot convert units of value of type %T", v)
+	}
+	c, err := newUnitConversion(typ, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return c.convert(v)
+}
+
+// hasUnits reports whether any of the columns has a unit.
+func hasUnits(cols []Column) bool {
+	for _, col := range cols {
+		if col.Unit != "" {
+			return true
+		}
+	}
+	return false
+}
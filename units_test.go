@@ -0,0 +1,289 @@
+package annotatedcsv
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var convertUnitTests = []struct {
+	testName    string
+	v           interface{}
+	from, to    string
+	expect      interface{}
+	expectError string
+}{{
+	testName: "whole-factor-long",
+	v:        int64(2),
+	from:     "KiB",
+	to:       "B",
+	expect:   int64(2048),
+}, {
+	testName: "fractional-factor-long",
+	v:        int64(1500),
+	from:     "ms",
+	to:       "s",
+	expect:   1.5,
+}, {
+	testName: "same-scale-different-names",
+	v:        int64(3),
+	from:     "µs",
+	to:       "us",
+	expect:   int64(3),
+}, {
+	testName: "seconds-alias",
+	v:        int64(2),
+	from:     "h",
+	to:       "seconds",
+	expect:   int64(7200),
+}, {
+	testName: "binary-to-decimal-bytes",
+	v:        int64(1),
+	from:     "KiB",
+	to:       "kB",
+	expect:   1.024,
+}, {
+	testName: "unsigned",
+	v:        uint64(3),
+	from:     "min",
+	to:       "s",
+	expect:   uint64(180),
+}, {
+	testName: "double",
+	v:        1.5,
+	from:     "s",
+	to:       "ms",
+	expect:   1500.0,
+}, {
+	testName: "negative",
+	v:        int64(-2),
+	from:     "s",
+	to:       "ms",
+	expect:   int64(-2000),
+}, {
+	testName: "decimal",
+	v:        mustParseDecimal("1.25"),
+	from:     "GB",
+	to:       "MB",
+	expect:   mustParseDecimal("1250"),
+}, {
+	testName: "decimal-fractional-factor",
+	v:        mustParseDecimal("1.5"),
+	from:     "MB",
+	to:       "GB",
+	expect:   0.0015,
+}, {
+	testName:    "long-overflow",
+	v:           int64(math.MaxInt64 / 2),
+	from:        "s",
+	to:          "ns",
+	expectError: `4611686018427387903 out of range after conversion`,
+}, {
+	testName:    "unsigned-overflow",
+	v:           uint64(math.MaxUint64),
+	from:        "kB",
+	to:          "B",
+	expectError: `18446744073709551615 out of range after conversion`,
+}, {
+	testName:    "unknown-from-unit",
+	v:           int64(1),
+	from:        "furlong",
+	to:          "s",
+	expectError: `unknown unit "furlong"`,
+}, {
+	testName:    "unknown-to-unit",
+	v:           int64(1),
+	from:        "s",
+	to:          "fortnight",
+	expectError: `unknown unit "fortnight"`,
+}, {
+	testName:    "case-sensitive",
+	v:           int64(1),
+	from:        "kb",
+	to:          "B",
+	expectError: `unknown unit "kb"`,
+}, {
+	testName:    "no-unit",
+	v:           int64(1),
+	from:        "",
+	to:          "s",
+	expectError: `cannot convert to "s": no unit`,
+}, {
+	testName:    "different-dimensions",
+	v:           int64(1),
+	from:        "s",
+	to:          "B",
+	expectError: `cannot convert s to B`,
+}, {
+	testName:    "non-numeric",
+	v:           "1",
+	from:        "s",
+	to:          "ms",
+	expectError: `cannot convert units of value of type string`,
+}}
+
+func TestConvertUnit(t *testing.T) {
+	for _, test := range convertUnitTests {
+		t.Run(test.testName, func(t *testing.T) {
+			got, err := ConvertUnit(test.v, test.from, test.to)
+			if test.expectError != "" {
+				assertErrorMatches(t, err, test.expectError)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reflect.TypeOf(got) != reflect.TypeOf(test.expect) || !equalValues(got, test.expect) {
+				t.Fatalf("unexpected result; got %#v want %#v", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestUnitsTable(t *testing.T) {
+	// Every unit can be converted to itself and to the
+	// smallest unit of its dimension.
+	smallest := map[string]string{
+		"bytes": "B",
+		"time":  "ns",
+	}
+	for _, name := range Units() {
+		u := units[name]
+		got, err := ConvertUnit(int64(1), name, name)
+		if err != nil || got != int64(1) {
+			t.Errorf("converting 1 %s to itself: got %v, %v", name, got, err)
+		}
+		got, err = ConvertUnit(int64(1), name, smallest[u.dimension])
+		if err != nil || got != u.scale {
+			t.Errorf("converting 1 %s to %s: got %v, %v want %d", name, smallest[u.dimension], got, err, u.scale)
+		}
+	}
+}
+
+func TestReaderUnit(t *testing.T) {
+	const data = `#datatype,long,double,unsignedLong,string
+#group,false,false,false,false
+#unit,ms,ms,KiB,
+#default,500,,,
+,a,b,c,s
+,1500,2.5,1,x
+,,+Inf,,y
+`
+	r := NewReader(strings.NewReader(data))
+	r.SetUnit("a", "s")
+	r.SetUnit("b", "us")
+	r.SetUnit("c", "B")
+	r.SetUnit("s", "")
+	tables, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectCols := []Column{
+		{},
+		{Name: "a", Type: "double", Unit: "s", Default: 0.5},
+		{Name: "b", Type: "double", Unit: "us"},
+		{Name: "c", Type: "unsignedLong", Unit: "B"},
+		{Name: "s", Type: "string"},
+	}
+	if !reflect.DeepEqual(tables[0].Columns, expectCols) {
+		t.Fatalf("unexpected columns\ngot  %#v\nwant %#v", tables[0].Columns, expectCols)
+	}
+	expectRows := [][]interface{}{
+		{nil, 1.5, 2500.0, uint64(1024), "x"},
+		{nil, 0.5, "+Inf", nil, "y"},
+	}
+	if !reflect.DeepEqual(tables[0].Rows, expectRows) {
+		t.Fatalf("unexpected rows\ngot  %#v\nwant %#v", tables[0].Rows, expectRows)
+	}
+}
+
+var readerUnitErrorTests = []struct {
+	testName    string
+	data        string
+	unit        string
+	expectError string
+}{{
+	testName:    "unknown-unit",
+	data:        "#datatype,long\n#group,false\n#unit,ms\n#default,\n,a\n,1\n",
+	unit:        "fortnight",
+	expectError: `column "a": unknown unit "fortnight" at line 5`,
+}, {
+	testName:    "no-unit-annotation",
+	data:        "#datatype,long\n#group,false\n#default,\n,a\n,1\n",
+	unit:        "s",
+	expectError: `column "a": cannot convert to "s": no unit at line 4`,
+}, {
+	testName:    "non-numeric-column",
+	data:        "#datatype,string\n#group,false\n#unit,ms\n#default,\n,a\n,1\n",
+	unit:        "s",
+	expectError: `column "a": cannot convert units of datatype "string" at line 5`,
+}, {
+	testName:    "value-out-of-range",
+	data:        "#datatype,long\n#group,false\n#unit,s\n#default,\n,a\n,1\n,9223372036854775807\n",
+	unit:        "ns",
+	expectError: `cannot convert "9223372036854775807" to ns at line 7: 9223372036854775807 out of range after conversion`,
+}, {
+	testName:    "default-out-of-range",
+	data:        "#datatype,long\n#group,false\n#unit,s\n#default,9223372036854775807\n,a\n,1\n",
+	unit:        "ns",
+	expectError: `cannot convert default value of column "a": 9223372036854775807 out of range after conversion at line 5`,
+}}
+
+func TestReaderUnitErrors(t *testing.T) {
+	for _, test := range readerUnitErrorTests {
+		t.Run(test.testName, func(t *testing.T) {
+			r := NewReader(strings.NewReader(test.data))
+			r.SetUnit("a", test.unit)
+			_, err := r.ReadAll()
+			assertErrorMatches(t, err, test.expectError)
+		})
+	}
+}
+
+func TestWriterUnit(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetUnit("a", "KiB")
+	w.SetUnit("b", "ms")
+	cols := []Column{
+		{},
+		{Name: "a", Type: "long", Unit: "B"},
+		{Name: "b", Type: "long", Unit: "s", Default: int64(1)},
+	}
+	if err := w.WriteHeader(cols); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range [][]interface{}{
+		{nil, int64(1536), int64(1)},
+		{nil, nil, int64(2)},
+	} {
+		if err := w.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	const expect = `#datatype,double,long
+#group,false,false
+#unit,KiB,ms
+#default,,1000
+,a,b
+,1.5,
+,,2000
+`
+	if got := buf.String(); got != expect {
+		t.Fatalf("unexpected output\ngot:\n%s\nwant:\n%s", got, expect)
+	}
+	// The columns passed to WriteHeader are unchanged.
+	if cols[1].Unit != "B" || cols[2].Default != int64(1) {
+		t.Fatalf("columns changed: %#v", cols)
+	}
+
+	err := w.WriteRow([]interface{}{nil, int64(1), int64(math.MaxInt64)})
+	assertErrorMatches(t, err, `cannot convert value for column "b" to ms: 9223372036854775807 out of range after conversion`)
+	err = w.WriteHeader([]Column{{}, {Name: "a", Type: "long", Unit: "s"}})
+	assertErrorMatches(t, err, `column "a": cannot convert s to KiB`)
+}
@@ -0,0 +1,51 @@
+package annotatedcsv
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// UUID is a universally unique identifier, as returned by
+// the Reader for values of the uuid datatype.
+type UUID [16]byte
+
+// ParseUUID parses s as a UUID in the standard form of 32
+// hexadecimal digits separated into groups by hyphens, for
+// example "123e4567-e89b-12d3-a456-426614174000". Upper case
+// digits and enclosing braces are also accepted.
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+	str := s
+	if len(str) == 38 && str[0] == '{' && str[37] == '}' {
+		str = str[1:37]
+	}
+	if len(str) != 36 || str[8] != '-' || str[13] != '-' || str[18] != '-' || str[23] != '-' {
+		return u, fmt.Errorf("invalid UUID %q", s)
+	}
+	digits := str[0:8] + str[9:13] + str[14:18] + str[19:23] + str[24:]
+	if _, err := hex.Decode(u[:], []byte(digits)); err != nil {
+		return UUID{}, fmt.Errorf("invalid UUID %q", s)
+	}
+	return u, nil
+}
+
+// String returns u in the standard form
+// with lower case hexadecimal digits.
+func (u UUID) String() string {
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (u UUID) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
@@ -0,0 +1,259 @@
+package annotatedcsv
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Window describes how Tables.Window divides rows into time windows.
+type Window struct {
+	// Every holds the interval between the starts
+	// of successive windows.
+	Every time.Duration
+
+	// Period holds the length of each window. If it is zero,
+	// Every is used. When Period is greater than Every, the
+	// windows overlap and a row may be in several windows;
+	// when it is less, rows between windows are ignored.
+	Period time.Duration
+
+	// Offset shifts the window boundaries, which are
+	// otherwise multiples of Every since the Unix epoch.
+	Offset time.Duration
+
+	// Column holds the name of the dateTime column holding
+	// the time of each row. If it is empty, _time is used.
+	Column string
+
+	// Start and Stop, if non-zero, restrict the windows to the
+	// time range from Start up to but not including Stop. Rows
+	// outside the range are ignored, and the first and last
+	// windows are truncated to the range.
+	Start time.Time
+	Stop  time.Time
+
+	// Empty determines what happens to windows with no rows.
+	Empty EmptyWindows
+}
+
+// EmptyWindows determines what happens to windows with no rows.
+type EmptyWindows int
+
+const (
+	// SkipEmpty omits empty windows.
+	SkipEmpty EmptyWindows = iota
+
+	// CreateEmpty produces a row for each empty window
+	// with the result of aggregating no rows: Count gives
+	// zero and the other aggregators give nil.
+	CreateEmpty
+
+	// FillPrevious produces a row for each empty window
+	// with the values of the previous window, or as for
+	// CreateEmpty if there is no previous window.
+	FillPrevious
+)
+
+// maxEmptyWindows holds the maximum number of windows
+// that may be created for each group.
+const maxEmptyWindows = 10000000
+
+// Window groups the rows of all the tables by their group key and
+// divides the rows of each group into time windows, so that
+// Aggregate produces a row for each window in each group. The
+// result columns _start and _stop hold the bounds of each window
+// and the time column holds its stop time. Group columns named
+// _start or _stop or with the name of the time column are not
+// part of the group key.
+//
+// With CreateEmpty or FillPrevious, rows are produced for all
+// the windows between Start and Stop if they are set, or between
+// the earliest and latest times in the tables otherwise.
+func (ts Tables) Window(w Window) *Grouping {
+	if w.Column == "" {
+		w.Column = "_time"
+	}
+	if w.Every <= 0 {
+		return &Grouping{
+			err: fmt.Errorf("invalid window length %v", w.Every),
+		}
+	}
+	if w.Period < 0 {
+		return &Grouping{
+			err: fmt.Errorf("invalid window period %v", w.Period),
+		}
+	}
+	if w.Period == 0 {
+		w.Period = w.Every
+	}
+	if !w.Start.IsZero() && !w.Stop.IsZero() && !w.Start.Before(w.Stop) {
+		return &Grouping{
+			err: fmt.Errorf("window start %v is not before stop %v", w.Start, w.Stop),
+		}
+	}
+	var keys []string
+	seen := map[string]bool{
+		"_start": true,
+		"_stop":  true,
+		w.Column: true,
+	}
+	for _, t := range ts {
+		for _, col := range t.Columns {
+			if col.Group && !seen[col.Name] {
+				seen[col.Name] = true
+				keys = append(keys, col.Name)
+			}
+		}
+	}
+	g := ts.GroupBy(keys...)
+	if g.err != nil {
+		return g
+	}
+	wd := &windowing{
+		Window: w,
+	}
+	var minTime, maxTime time.Time
+	for _, t := range ts {
+		j := t.columnIndex(w.Column)
+		if j < 0 {
+			continue
+		}
+		for _, row := range t.Rows {
+			tm, ok := row[j].(time.Time)
+			if !ok || !wd.inRange(tm) {
+				continue
+			}
+			if minTime.IsZero() || tm.Before(minTime) {
+				minTime = tm
+			}
+			if maxTime.IsZero() || tm.After(maxTime) {
+				maxTime = tm
+			}
+		}
+	}
+	if !w.Start.IsZero() {
+		minTime = w.Start
+	}
+	if !w.Stop.IsZero() {
+		maxTime = w.Stop.Add(-1)
+	}
+	if !minTime.IsZero() && !maxTime.IsZero() {
+		// The first window is the earliest one that
+		// ends after minTime.
+		wd.first, wd.last = wd.index(minTime.Add(-w.Period))+1, wd.index(maxTime)
+		wd.haveRange = wd.first <= wd.last
+		if w.Empty != SkipEmpty && wd.last-wd.first >= maxEmptyWindows {
+			g.err = fmt.Errorf("too many windows (%d)", wd.last-wd.first+1)
+		}
+	}
+	g.window = wd
+	return g
+}
+
+// windowing holds a Window and the range of
+// windows to produce when creating empty windows.
+type windowing struct {
+	Window
+	first, last int64
+	haveRange   bool
+}
+
+// index returns the index of the last window starting at or before t.
+func (w *windowing) index(t time.Time) int64 {
+	ns := t.UnixNano() - int64(w.Offset%w.Every)
+	every := int64(w.Every)
+	i := ns / every
+	if ns%every < 0 {
+		// Round towards minus infinity.
+		i--
+	}
+	return i
+}
+
+// bounds returns the bounds of the window with the given index.
+func (w *windowing) bounds(i int64) (start, stop time.Time) {
+	ns := i*int64(w.Every) + int64(w.Offset%w.Every)
+	start = time.Unix(0, ns).UTC()
+	stop = start.Add(w.Period)
+	if !w.Start.IsZero() && start.Before(w.Start) {
+		start = w.Start
+	}
+	if !w.Stop.IsZero() && stop.After(w.Stop) {
+		stop = w.Stop
+	}
+	return start, stop
+}
+
+// inRange reports whether t is within the time range of the windows.
+func (w *windowing) inRange(t time.Time) bool {
+	return (w.Start.IsZero() || !t.Before(w.Start)) && (w.Stop.IsZero() || t.Before(w.Stop))
+}
+
+// endsAfter reports whether the window with the given index
+// ends after t, ignoring Stop.
+func (w *windowing) endsAfter(i int64, t time.Time) bool {
+	ns := i*int64(w.Every) + int64(w.Offset%w.Every)
+	return t.Before(time.Unix(0, ns).Add(w.Period))
+}
+
+// aggregate returns the rows for the windows of the given group,
+// calling aggregate to compute the aggregated values for the rows
+// in each window.
+func (w *windowing) aggregate(grp *group, aggregate func(parts []groupPart) []interface{}) [][]interface{} {
+	windows := make(map[int64]*group)
+	var indexes []int64
+	for _, part := range grp.parts {
+		j := part.table.columnIndex(w.Column)
+		if j < 0 {
+			continue
+		}
+		for _, row := range part.rows {
+			t, ok := row[j].(time.Time)
+			if !ok || !w.inRange(t) {
+				continue
+			}
+			// Walk back through the windows that start at or
+			// before t until reaching one that ends at or before it.
+			for i := w.index(t); w.endsAfter(i, t); i-- {
+				win := windows[i]
+				if win == nil {
+					win = &group{}
+					windows[i] = win
+					indexes = append(indexes, i)
+				}
+				win.add(part.table, row)
+			}
+		}
+	}
+	if w.Empty != SkipEmpty && w.haveRange {
+		indexes = indexes[:0]
+		for i := w.first; i <= w.last; i++ {
+			indexes = append(indexes, i)
+		}
+	} else {
+		sort.Slice(indexes, func(i, j int) bool {
+			return indexes[i] < indexes[j]
+		})
+	}
+	rows := make([][]interface{}, 0, len(indexes))
+	var prev []interface{}
+	for _, i := range indexes {
+		var vals []interface{}
+		if win := windows[i]; win != nil {
+			vals = aggregate(win.parts)
+		} else if w.Empty == FillPrevious && prev != nil {
+			vals = prev
+		} else {
+			vals = aggregate(nil)
+		}
+		prev = vals
+		start, stop := w.bounds(i)
+		row := make([]interface{}, 0, 4+len(grp.key)+len(vals))
+		row = append(row, nil)
+		row = append(row, grp.key...)
+		row = append(row, start, stop, stop)
+		rows = append(rows, append(row, vals...))
+	}
+	return rows
+}
@@ -0,0 +1,224 @@
+package annotatedcsv
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// windowTestTable returns a table with a row for each of the
+// given times, in seconds since the epoch. A nil time
+// gives a row with a null time. The value of each
+// row is its index plus one.
+func windowTestTable(times ...interface{}) *Table {
+	t := &Table{
+		Columns: []Column{{}, {Name: "host", Type: "string", Group: true}, {Name: "_time", Type: "dateTime:RFC3339"}, {Name: "v", Type: "long"}},
+	}
+	for i, tm := range times {
+		if tm != nil {
+			tm = sec(int64(tm.(int)))
+		}
+		t.Rows = append(t.Rows, []interface{}{nil, "a", tm, int64(i + 1)})
+	}
+	return t
+}
+
+func sec(n int64) time.Time {
+	return time.Unix(n, 0).UTC()
+}
+
+// windowRow returns the expected row for the window from start to
+// stop seconds with the given count and sum.
+func windowRow(start, stop int64, count int64, sum interface{}) []interface{} {
+	return []interface{}{nil, "a", sec(start), sec(stop), sec(stop), count, sum}
+}
+
+var windowTests = []struct {
+	testName string
+	window   Window
+	table    *Table
+	expect   [][]interface{}
+}{{
+	testName: "boundaries-null-and-out-of-order",
+	window:   Window{Every: 10 * time.Second},
+	// Rows exactly on a boundary are in the window that starts there.
+	table: windowTestTable(0, 5, 10, 25, nil, 3, 9),
+	expect: [][]interface{}{
+		windowRow(0, 10, 4, int64(1+2+6+7)),
+		windowRow(10, 20, 1, int64(3)),
+		windowRow(20, 30, 1, int64(4)),
+	},
+}, {
+	testName: "negative-times",
+	window:   Window{Every: 10 * time.Second},
+	table:    windowTestTable(-1, -10, -11),
+	expect: [][]interface{}{
+		windowRow(-20, -10, 1, int64(3)),
+		windowRow(-10, 0, 2, int64(1+2)),
+	},
+}, {
+	testName: "offset",
+	window:   Window{Every: 10 * time.Second, Offset: 13 * time.Second},
+	table:    windowTestTable(2, 3),
+	expect: [][]interface{}{
+		windowRow(-7, 3, 1, int64(1)),
+		windowRow(3, 13, 1, int64(2)),
+	},
+}, {
+	testName: "skip-empty",
+	window:   Window{Every: 10 * time.Second},
+	table:    windowTestTable(0, 35),
+	expect: [][]interface{}{
+		windowRow(0, 10, 1, int64(1)),
+		windowRow(30, 40, 1, int64(2)),
+	},
+}, {
+	testName: "create-empty",
+	window:   Window{Every: 10 * time.Second, Empty: CreateEmpty},
+	table:    windowTestTable(35, 0),
+	expect: [][]interface{}{
+		windowRow(0, 10, 1, int64(2)),
+		windowRow(10, 20, 0, nil),
+		windowRow(20, 30, 0, nil),
+		windowRow(30, 40, 1, int64(1)),
+	},
+}, {
+	testName: "fill-previous",
+	window:   Window{Every: 10 * time.Second, Empty: FillPrevious},
+	table:    windowTestTable(0, 1, 35),
+	expect: [][]interface{}{
+		windowRow(0, 10, 2, int64(3)),
+		windowRow(10, 20, 2, int64(3)),
+		windowRow(20, 30, 2, int64(3)),
+		windowRow(30, 40, 1, int64(3)),
+	},
+}, {
+	testName: "fill-previous-with-no-previous",
+	window:   Window{Every: 10 * time.Second, Start: sec(0), Empty: FillPrevious},
+	table:    windowTestTable(15),
+	expect: [][]interface{}{
+		windowRow(0, 10, 0, nil),
+		windowRow(10, 20, 1, int64(1)),
+	},
+}, {
+	testName: "start-and-stop",
+	window:   Window{Every: 10 * time.Second, Start: sec(5), Stop: sec(25), Empty: CreateEmpty},
+	// The rows at 0 and 25 are outside the range.
+	table: windowTestTable(0, 5, 24, 25),
+	expect: [][]interface{}{
+		windowRow(5, 10, 1, int64(2)),
+		windowRow(10, 20, 0, nil),
+		windowRow(20, 25, 1, int64(3)),
+	},
+}, {
+	testName: "only-null-times",
+	window:   Window{Every: 10 * time.Second, Empty: CreateEmpty},
+	table:    windowTestTable(nil, nil),
+	expect:   nil,
+}, {
+	testName: "period-greater-than-every",
+	window:   Window{Every: 10 * time.Second, Period: 20 * time.Second},
+	table:    windowTestTable(0, 15, 20),
+	expect: [][]interface{}{
+		windowRow(-10, 10, 1, int64(1)),
+		windowRow(0, 20, 2, int64(1+2)),
+		windowRow(10, 30, 2, int64(2+3)),
+		windowRow(20, 40, 1, int64(3)),
+	},
+}, {
+	testName: "period-greater-than-every-create-empty",
+	window:   Window{Every: 10 * time.Second, Period: 20 * time.Second, Empty: CreateEmpty},
+	table:    windowTestTable(0, 45),
+	expect: [][]interface{}{
+		windowRow(-10, 10, 1, int64(1)),
+		windowRow(0, 20, 1, int64(1)),
+		windowRow(10, 30, 0, nil),
+		windowRow(20, 40, 0, nil),
+		windowRow(30, 50, 1, int64(2)),
+		windowRow(40, 60, 1, int64(2)),
+	},
+}, {
+	testName: "period-less-than-every",
+	window:   Window{Every: 10 * time.Second, Period: 5 * time.Second},
+	// The row at 5 is between windows.
+	table: windowTestTable(0, 4, 5, 12),
+	expect: [][]interface{}{
+		windowRow(0, 5, 2, int64(1+2)),
+		windowRow(10, 15, 1, int64(4)),
+	},
+}, {
+	testName: "period-less-than-every-create-empty",
+	window:   Window{Every: 10 * time.Second, Period: 5 * time.Second, Empty: CreateEmpty},
+	table:    windowTestTable(7, 22),
+	expect: [][]interface{}{
+		windowRow(10, 15, 0, nil),
+		windowRow(20, 25, 1, int64(2)),
+	},
+}}
+
+func TestWindow(t *testing.T) {
+	for _, test := range windowTests {
+		t.Run(test.testName, func(t *testing.T) {
+			ts, err := Tables{test.table}.Window(test.window).Aggregate(Count(), Sum("v"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got [][]interface{}
+			for _, t := range ts {
+				got = append(got, t.Rows...)
+			}
+			if !reflect.DeepEqual(got, test.expect) {
+				t.Fatalf("unexpected rows\ngot  %v\nwant %v", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestWindowColumns(t *testing.T) {
+	ts, err := Tables{windowTestTable(0)}.Window(Window{Every: time.Second}).Aggregate(Count())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, col := range ts[0].Columns[1:] {
+		names = append(names, col.Name)
+	}
+	if want := []string{"host", "_start", "_stop", "_time", "count"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("unexpected columns; got %q want %q", names, want)
+	}
+}
+
+var windowErrorTests = []struct {
+	testName    string
+	window      Window
+	expectError string
+}{{
+	testName:    "zero-every",
+	window:      Window{},
+	expectError: `invalid window length 0s`,
+}, {
+	testName:    "negative-period",
+	window:      Window{Every: time.Second, Period: -time.Second},
+	expectError: `invalid window period -1s`,
+}, {
+	testName:    "start-not-before-stop",
+	window:      Window{Every: time.Second, Start: sec(1), Stop: sec(1)},
+	expectError: `window start .* is not before stop .*`,
+}, {
+	testName:    "too-many-windows",
+	window:      Window{Every: time.Nanosecond, Start: sec(0), Stop: sec(1), Empty: CreateEmpty},
+	expectError: `too many windows \(1000000000\)`,
+}, {
+	testName:    "not-a-time-column",
+	window:      Window{Every: time.Second, Column: "v"},
+	expectError: `cannot window by column "v" of datatype "long"`,
+}}
+
+func TestWindowErrors(t *testing.T) {
+	for _, test := range windowErrorTests {
+		t.Run(test.testName, func(t *testing.T) {
+			_, err := Tables{windowTestTable(0)}.Window(test.window).Aggregate(Count())
+			assertErrorMatches(t, err, test.expectError)
+		})
+	}
+}
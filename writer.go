@@ -0,0 +1,287 @@
+package annotatedcsv
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Writer writes annotated CSV.
+type Writer struct {
+	w        *csv.Writer
+	cols     []Column
+	defaults []string
+	ntables  int
+
+	listDelimiter string
+	location      *time.Location
+	epochUnit     time.Duration
+
+	// units holds the units set with SetUnit,
+	// and unitConvs the conversion for each column
+	// of the current table, if any.
+	units     map[string]string
+	unitConvs []*unitConversion
+}
+
+// NewWriter returns a Writer that writes to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		w: csv.NewWriter(w),
+	}
+}
+
+// SetListDelimiter sets the delimiter between the elements of values
+// of list datatypes. By default, DefaultListDelimiter is used. It is
+// an error to write a list with an element that contains the
+// delimiter.
+func (w *Writer) SetListDelimiter(sep string) {
+	w.listDelimiter = sep
+}
+
+// SetLocation sets the location that times are converted to
+// before they are written. By default, times are written in
+// their own locations.
+func (w *Writer) SetLocation(loc *time.Location) {
+	w.location = loc
+}
+
+// SetEpochUnit sets the unit of values of the dateTime:number
+// datatype, as for Reader.SetEpochUnit.
+func (w *Writer) SetEpochUnit(unit time.Duration) {
+	checkEpochUnit(unit)
+	w.epochUnit = unit
+}
+
+// SetUnit sets the unit that values in columns with the given name
+// are converted to before they are written, as for Reader.SetUnit.
+// The Unit field of the columns passed to WriteHeader holds the unit
+// they are converted from. An empty unit removes the conversion.
+func (w *Writer) SetUnit(name, unit string) {
+	if unit == "" {
+		delete(w.units, name)
+		return
+	}
+	if w.units == nil {
+		w.units = make(map[string]string)
+	}
+	w.units[name] = unit
+}
+
+// WriteHeader starts a new table with the given columns,
+// writing its annotation rows and its header row.
+// The first column holds the annotation names.
+func (w *Writer) WriteHeader(cols []Column) error {
+	if len(cols) == 0 {
+		return fmt.Errorf("no columns in table")
+	}
+	cols, unitConvs, err := w.convertColumns(cols)
+	if err != nil {
+		return err
+	}
+	if w.ntables > 0 {
+		// Separate tables with a blank line.
+		if err := w.w.Write(nil); err != nil {
+			return err
+		}
+	}
+	w.ntables++
+	w.cols = cols
+	w.unitConvs = unitConvs
+	row := make([]string, len(cols))
+	row[0] = "#datatype"
+	for i := 1; i < len(cols); i++ {
+		row[i] = cols[i].Type
+	}
+	if err := w.w.Write(row); err != nil {
+		return err
+	}
+	row[0] = "#group"
+	for i := 1; i < len(cols); i++ {
+		row[i] = strconv.FormatBool(cols[i].Group)
+	}
+	if err := w.w.Write(row); err != nil {
+		return err
+	}
+	if hasUnits(cols) {
+		row[0] = "#unit"
+		for i := 1; i < len(cols); i++ {
+			row[i] = cols[i].Unit
+		}
+		if err := w.w.Write(row); err != nil {
+			return err
+		}
+	}
+	for _, key := range extraKeys(cols) {
+		row[0] = "#" + key
+		for i := 1; i < len(cols); i++ {
+			row[i] = cols[i].Extra[key]
+		}
+		if err := w.w.Write(row); err != nil {
+			return err
+		}
+	}
+	row[0] = "#default"
+	w.defaults = make([]string, len(cols))
+	for i := 1; i < len(cols); i++ {
+		s, err := w.format(cols[i].Default, cols[i].Type)
+		if err != nil {
+			return fmt.Errorf("cannot format default value for column %q: %v", cols[i].Name, err)
+		}
+		row[i] = s
+		w.defaults[i] = s
+	}
+	if err := w.w.Write(row); err != nil {
+		return err
+	}
+	for i, col := range cols {
+		row[i] = col.Name
+	}
+	return w.w.Write(row)
+}
+
+// WriteRow writes a row to the current table.
+// The row must hold one value for each column.
+func (w *Writer) WriteRow(row []interface{}) error {
+	if w.cols == nil {
+		return fmt.Errorf("row written before header")
+	}
+	if len(row) != len(w.cols) {
+		return fmt.Errorf("wrong number of values in row; got %d want %d", len(row), len(w.cols))
+	}
+	rec := make([]string, len(row))
+	for i, v := range row {
+		if w.unitConvs != nil && w.unitConvs[i] != nil {
+			x, err := w.unitConvs[i].convert(v)
+			if err != nil {
+				return fmt.Errorf("cannot convert value for column %q to %s: %v", w.cols[i].Name, w.cols[i].Unit, err)
+			}
+			v = x
+		}
+		s, err := w.format(v, w.cols[i].Type)
+		if err != nil {
+			return fmt.Errorf("cannot format value for column %q: %v", w.cols[i].Name, err)
+		}
+		if s == w.defaults[i] {
+			// The reader will fill in the default.
+			s = ""
+		}
+		rec[i] = s
+	}
+	return w.w.Write(rec)
+}
+
+// convertColumns returns the columns as they will be written after
+// the unit conversions set with SetUnit, and the conversion for each
+// column, if any.
+func (w *Writer) convertColumns(cols []Column) ([]Column, []*unitConversion, error) {
+	var convs []*unitConversion
+	for i := 1; i < len(cols); i++ {
+		col := cols[i]
+		unit, ok := w.units[col.Name]
+		if !ok || unit == col.Unit {
+			continue
+		}
+		conv, err := newUnitConversion(col.Type, col.Unit, unit)
+		if err != nil {
+			return nil, nil, fmt.Errorf("column %q: %v", col.Name, err)
+		}
+		x, err := conv.convert(col.Default)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot convert default value for column %q: %v", col.Name, err)
+		}
+		if convs == nil {
+			convs = make([]*unitConversion, len(cols))
+			cols = append([]Column(nil), cols...)
+		}
+		convs[i] = conv
+		cols[i].Type, cols[i].Unit, cols[i].Default = conv.typ, unit, x
+	}
+	return cols, convs, nil
+}
+
+// Flush writes any buffered data to the underlying writer
+// and returns any error encountered.
+func (w *Writer) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// format is like formatValue but uses the list delimiter
+// set with SetListDelimiter, the location set with SetLocation
+// and the unit set with SetEpochUnit.
+func (w *Writer) format(v interface{}, typ string) (string, error) {
+	if elem, ok := listElemType(typ); ok && v != nil {
+		sep := w.listDelimiter
+		if sep == "" {
+			sep = DefaultListDelimiter
+		}
+		return formatList(v, elem, sep, w.formatValue)
+	}
+	return w.formatValue(v, typ)
+}
+
+// formatValue formats a single value for format.
+func (w *Writer) formatValue(v interface{}, typ string) (string, error) {
+	t, ok := v.(time.Time)
+	if !ok {
+		return formatValue(v, typ)
+	}
+	if w.location != nil {
+		t = t.In(w.location)
+	}
+	if typ == epochDatatype {
+		return formatEpoch(t, w.epochUnit)
+	}
+	return formatValue(t, typ)
+}
+
+// formatValue is the inverse of convertToType.
+func formatValue(v interface{}, typ string) (string, error) {
+	if elem, ok := listElemType(typ); ok && v != nil {
+		return formatList(v, elem, DefaultListDelimiter, formatValue)
+	}
+	if typ == "json" && v != nil {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case Decimal:
+		return v.String(), nil
+	case UUID, netip.Addr, netip.Prefix:
+		return fmt.Sprint(v), nil
+	case time.Time:
+		if typ == epochDatatype {
+			return formatEpoch(v, time.Nanosecond)
+		}
+		layout, ok := timeLayout(typ)
+		if !ok {
+			if strings.HasPrefix(typ, "dateTime:") {
+				return "", fmt.Errorf("unknown time format %q", typ)
+			}
+			layout = time.RFC3339Nano
+		}
+		return v.Format(layout), nil
+	}
+	return "", fmt.Errorf("unexpected value type %T", v)
+}